@@ -0,0 +1,104 @@
+// This file contains helpers for reading optional configuration values from environment variables.
+// Each helper falls back to the provided default when the variable is unset or cannot be parsed.
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getEnvInt returns the environment variable `key` parsed as an int, or def if unset or invalid.
+func getEnvInt(key string, def int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// getEnvDuration returns the environment variable `key` parsed as a time.Duration (e.g. "30s", "5m"), or def if unset or invalid.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// getEnvBool returns the environment variable `key` parsed as a bool (e.g. "true", "0"), or def if unset or invalid.
+func getEnvBool(key string, def bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// getEnvList returns the environment variable `key` split on commas, with surrounding whitespace and empty
+// entries removed, or def if unset.
+func getEnvList(key string, def []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvIntMap returns the environment variable `key` parsed as a comma separated list of `name=int` pairs
+// (e.g. "thumbnail=2,maintenance=1"), merged over a copy of def. Invalid pairs are ignored.
+func getEnvIntMap(key string, def map[string]int) map[string]int {
+	merged := make(map[string]int, len(def))
+	for k, v := range def {
+		merged[k] = v
+	}
+	for _, item := range getEnvList(key, nil) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		merged[strings.TrimSpace(name)] = parsed
+	}
+	return merged
+}
+
+// getEnvStringMap returns the environment variable `key` parsed as a comma separated list of `name=value` pairs
+// (e.g. "point_cloud=gzip,model=zstd"), merged over a copy of def. Pairs without a value are ignored.
+func getEnvStringMap(key string, def map[string]string) map[string]string {
+	merged := make(map[string]string, len(def))
+	for k, v := range def {
+		merged[k] = v
+	}
+	for _, item := range getEnvList(key, nil) {
+		name, value, ok := strings.Cut(item, "=")
+		if value = strings.TrimSpace(value); !ok || value == "" {
+			continue
+		}
+		merged[strings.TrimSpace(name)] = value
+	}
+	return merged
+}
@@ -25,7 +25,7 @@ func main() {
 	}
 
 	// Create webserver logger
-	logger, err := log.NewLogger(true, true)
+	logger, err := log.NewLogger(true, true, getEnvBool("LOG_SANITIZE", true), getEnvBool("LOG_JSON", false))
 	if err != nil {
 		panic(err)
 	}
@@ -43,27 +43,189 @@ func main() {
 	if err != nil {
 		logger.Fatal("Error creating MongoDB client:", err)
 	}
+	defer client.Disconnect(context.Background())
 
 	// Create separate managers with the MongoDB client
-	sceneManager := scene.NewSceneManager(client, logger, false)
-	queueManager := queue.NewQueueListManager(client, logger, false)
-	userManager := user.NewUserManager(client, logger, false)
+	sceneConfig := scene.DefaultSceneManagerConfig()
+	sceneConfig.NameCacheSize = getEnvInt("SCENE_NAME_CACHE_SIZE", sceneConfig.NameCacheSize)
+	sceneConfig.OperationTimeout = getEnvDuration("SCENE_OPERATION_TIMEOUT", sceneConfig.OperationTimeout)
+	if policy := os.Getenv("DUPLICATE_WORKER_WRITES"); policy != "" {
+		sceneConfig.DuplicateWrites = policy
+	}
+
+	sceneManager := scene.NewSceneManager(client, sceneConfig, logger, false)
+	if err := sceneManager.EnsureIndexes(context.Background()); err != nil {
+		logger.Error("Error creating scene indexes:", err)
+	}
+	queueConfig := queue.DefaultQueueListManagerConfig()
+	queueConfig.FlushInterval = getEnvDuration("QUEUE_FLUSH_INTERVAL", queueConfig.FlushInterval)
+	queueConfig.FlushTimeout = getEnvDuration("QUEUE_FLUSH_TIMEOUT", queueConfig.FlushTimeout)
+
+	queueManager := queue.NewQueueListManager(client, queueConfig, logger, false)
+	defer queueManager.Close(context.Background())
+	passwordHasher, err := user.NewPasswordHasher(os.Getenv("PASSWORD_HASH_ALGORITHM"))
+	if err != nil {
+		logger.Fatal("Error creating password hasher:", err)
+	}
+	userManager := user.NewUserManager(client, passwordHasher, logger, false)
+	if err := userManager.EnsureIndexes(context.Background()); err != nil {
+		logger.Error("Error creating user indexes:", err)
+	}
+	refreshTokenManager := user.NewRefreshTokenManager(client, logger, false)
+	if err := refreshTokenManager.EnsureIndexes(context.Background()); err != nil {
+		logger.Error("Error creating refresh token indexes:", err)
+	}
+	loginFailureManager := user.NewLoginFailureManager(client, logger, false)
+	if err := loginFailureManager.EnsureIndexes(context.Background()); err != nil {
+		logger.Error("Error creating login failure indexes:", err)
+	}
+	notificationManager := user.NewNotificationManager(client, logger, false)
+	if err := notificationManager.EnsureIndexes(context.Background()); err != nil {
+		logger.Error("Error creating notification indexes:", err)
+	}
+	tokenRevoker, err := user.NewTokenRevoker(os.Getenv("TOKEN_REVOCATION_STORE"), client)
+	if err != nil {
+		logger.Fatal("Error creating token revocation store:", err)
+	}
+	if mongoRevoker, ok := tokenRevoker.(*user.MongoTokenRevoker); ok {
+		if err := mongoRevoker.EnsureIndexes(context.Background()); err != nil {
+			logger.Error("Error creating revoked token indexes:", err)
+		}
+	}
 
 	// Initialize services
-	mqService, err := services.NewAMPQService(rabbitMQIP, sceneManager, queueManager, logger)
+	mqConfig := services.DefaultAMPQServiceConfig()
+	mqConfig.OutputCompression = getEnvStringMap("OUTPUT_COMPRESSION", mqConfig.OutputCompression)
+	mqConfig.WorkerURLSecret = os.Getenv("WORKER_URL_SECRET")
+	mqConfig.WorkerURLTTL = getEnvDuration("WORKER_URL_TTL", mqConfig.WorkerURLTTL)
+	mqConfig.WorkerHeartbeatTimeout = getEnvDuration("WORKER_HEARTBEAT_TIMEOUT", mqConfig.WorkerHeartbeatTimeout)
+	mqConfig.SyncWrites = getEnvBool("SYNC_WRITES", mqConfig.SyncWrites)
+
+	mqService, err := services.NewAMPQService(rabbitMQIP, sceneManager, queueManager, notificationManager, mqConfig, logger)
 	if err != nil {
 		logger.Panic("Error initializing AMPQ service:", err)
 	}
-	clientService := services.NewClientService(mqService, sceneManager, userManager, queueManager, logger)
+	defer mqService.Shutdown()
+	taskConfig := services.DefaultTaskPoolConfig()
+	taskConfig.Workers = getEnvInt("TASK_POOL_WORKERS", taskConfig.Workers)
+	taskConfig.QueueSize = getEnvInt("TASK_POOL_QUEUE_SIZE", taskConfig.QueueSize)
+	taskConfig.TypeLimits = getEnvIntMap("TASK_POOL_TYPE_LIMITS", taskConfig.TypeLimits)
+
+	taskPool := services.NewTaskPool(taskConfig, logger)
+	defer taskPool.Close()
+
+	clientConfig := services.DefaultClientServiceConfig()
+	clientConfig.AdminStatsCacheTTL = getEnvDuration("ADMIN_STATS_CACHE_TTL", clientConfig.AdminStatsCacheTTL)
+	clientConfig.UsageAccounting = getEnvBool("USAGE_ACCOUNTING", clientConfig.UsageAccounting)
+	clientConfig.ThumbnailDimensions = getEnvBool("THUMBNAIL_DIMENSIONS", clientConfig.ThumbnailDimensions)
+	clientConfig.WebhookTimeout = getEnvDuration("WEBHOOK_TIMEOUT", clientConfig.WebhookTimeout)
+	clientConfig.WebhookAllowPrivate = getEnvBool("WEBHOOK_ALLOW_PRIVATE", clientConfig.WebhookAllowPrivate)
+	clientConfig.IdempotencyKeyTTL = getEnvDuration("IDEMPOTENCY_KEY_TTL", clientConfig.IdempotencyKeyTTL)
+	clientConfig.IdempotencyWaitTimeout = getEnvDuration("IDEMPOTENCY_WAIT_TIMEOUT", clientConfig.IdempotencyWaitTimeout)
+	clientConfig.RefreshTokenTTL = getEnvDuration("REFRESH_TOKEN_TTL", clientConfig.RefreshTokenTTL)
+	clientConfig.DeduplicateUploads = getEnvBool("DEDUPLICATE_UPLOADS", clientConfig.DeduplicateUploads)
+	clientConfig.IsolateSharedInputs = getEnvBool("ISOLATE_SHARED_INPUTS", clientConfig.IsolateSharedInputs)
+	clientConfig.SyncWrites = getEnvBool("SYNC_WRITES", clientConfig.SyncWrites)
+	clientConfig.StorageCheck = getEnvBool("STORAGE_CHECK", clientConfig.StorageCheck)
+	clientConfig.FullRunIterations = getEnvInt("FULL_RUN_ITERATIONS", clientConfig.FullRunIterations)
+	clientConfig.StorageHighWaterMark = int64(getEnvInt("STORAGE_HIGH_WATER_MARK", int(clientConfig.StorageHighWaterMark)))
+	clientConfig.StorageUsageRefresh = getEnvDuration("STORAGE_USAGE_REFRESH", clientConfig.StorageUsageRefresh)
+	clientConfig.TrashRetention = getEnvDuration("TRASH_RETENTION", clientConfig.TrashRetention)
+	clientConfig.StorageEvictScenes = getEnvBool("STORAGE_EVICT_SCENES", clientConfig.StorageEvictScenes)
+	clientConfig.StorageCleanupAfter = getEnvDuration("STORAGE_CLEANUP_AFTER", clientConfig.StorageCleanupAfter)
+	clientConfig.LoginLockoutThreshold = getEnvInt("LOGIN_LOCKOUT_THRESHOLD", clientConfig.LoginLockoutThreshold)
+	clientConfig.LoginLockoutDuration = getEnvDuration("LOGIN_LOCKOUT_DURATION", clientConfig.LoginLockoutDuration)
+	clientConfig.PasswordPolicy.MinLength = getEnvInt("PASSWORD_MIN_LENGTH", clientConfig.PasswordPolicy.MinLength)
+	clientConfig.PasswordPolicy.MinCharacterClasses = getEnvInt("PASSWORD_MIN_CHARACTER_CLASSES", clientConfig.PasswordPolicy.MinCharacterClasses)
+	clientConfig.NotificationRetention = getEnvDuration("NOTIFICATION_RETENTION", clientConfig.NotificationRetention)
+	clientConfig.RejectUploadsWithoutWorkers = getEnvBool("REJECT_UPLOADS_WITHOUT_WORKERS", clientConfig.RejectUploadsWithoutWorkers)
+	if ffmpegPath := os.Getenv("FFMPEG_PATH"); ffmpegPath != "" {
+		clientConfig.FFmpegPath = ffmpegPath
+	}
+	if ffprobePath := os.Getenv("FFPROBE_PATH"); ffprobePath != "" {
+		clientConfig.FFprobePath = ffprobePath
+	}
+	clientConfig.DownscaleVideos = getEnvBool("DOWNSCALE_VIDEOS", clientConfig.DownscaleVideos)
+	clientConfig.MaxVideoDimension = getEnvInt("MAX_VIDEO_DIMENSION", clientConfig.MaxVideoDimension)
+
+	chunkedUploads := services.NewChunkedUploadStore("data/raw/chunks")
+	clientService := services.NewClientService(mqService, sceneManager, userManager, queueManager, refreshTokenManager, loginFailureManager, notificationManager, tokenRevoker, taskPool, chunkedUploads, clientConfig, logger)
+	if err := clientService.CheckStorage(); err != nil {
+		logger.Error("Data directory is not writable, uploads will be rejected until it is:", err)
+	}
+
+	maintenanceConfig := services.DefaultMaintenanceServiceConfig()
+	maintenanceConfig.CompactionInterval = getEnvDuration("SCENE_COMPACTION_INTERVAL", maintenanceConfig.CompactionInterval)
+	maintenanceConfig.CompactAfter = getEnvDuration("SCENE_COMPACT_AFTER", maintenanceConfig.CompactAfter)
+	maintenanceConfig.CompactKeepLogs = getEnvInt("SCENE_COMPACT_KEEP_LOGS", maintenanceConfig.CompactKeepLogs)
+	maintenanceConfig.ChunkedUploadCleanupInterval = getEnvDuration("CHUNKED_UPLOAD_CLEANUP_INTERVAL", maintenanceConfig.ChunkedUploadCleanupInterval)
+	maintenanceConfig.ChunkedUploadTTL = getEnvDuration("CHUNKED_UPLOAD_TTL", maintenanceConfig.ChunkedUploadTTL)
+	maintenanceConfig.TrashPurgeInterval = getEnvDuration("TRASH_PURGE_INTERVAL", maintenanceConfig.TrashPurgeInterval)
+
+	maintenanceService := services.NewMaintenanceService(sceneManager, clientService, chunkedUploads, taskPool, maintenanceConfig, logger)
+	maintenanceService.Start()
+	defer maintenanceService.Stop()
 
 	// Initialize web server
-	jwtSecret := os.Getenv("JWT_SECRET_KEY")
-	server := web.NewWebServer(jwtSecret, clientService, logger)
+	webConfig := web.DefaultWebServerConfig()
+	webConfig.JWTSecret = os.Getenv("JWT_SECRET_KEY")
+	if algorithm := os.Getenv("JWT_ALGORITHM"); algorithm != "" {
+		webConfig.JWTAlgorithm = algorithm
+	}
+	if path := os.Getenv("JWT_PUBLIC_KEY_FILE"); path != "" {
+		webConfig.JWTPublicKey, err = web.LoadRSAPublicKey(path)
+		if err != nil {
+			logger.Fatal("Error loading JWT public key:", err)
+		}
+	}
+	if path := os.Getenv("JWT_PRIVATE_KEY_FILE"); path != "" {
+		webConfig.JWTPrivateKey, err = web.LoadRSAPrivateKey(path)
+		if err != nil {
+			logger.Fatal("Error loading JWT private key:", err)
+		}
+	}
+	webConfig.TokenTTL = getEnvDuration("TOKEN_TTL", webConfig.TokenTTL)
+	webConfig.ShareLinkSecret = os.Getenv("SHARE_LINK_SECRET")
+	webConfig.ShareLinkMaxTTL = getEnvDuration("SHARE_LINK_MAX_TTL", webConfig.ShareLinkMaxTTL)
+	webConfig.WorkerToken = os.Getenv("WORKER_TOKEN")
+	webConfig.WorkerURLSecret = os.Getenv("WORKER_URL_SECRET")
+	webConfig.Upload.MinTotalIterations[scene.TrainingModeGaussian] = getEnvInt("MIN_ITERATIONS_GAUSSIAN", webConfig.Upload.MinTotalIterations[scene.TrainingModeGaussian])
+	webConfig.Upload.MinTotalIterations[scene.TrainingModeTensorf] = getEnvInt("MIN_ITERATIONS_TENSORF", webConfig.Upload.MinTotalIterations[scene.TrainingModeTensorf])
+	webConfig.Upload.MaxIterations = getEnvInt("MAX_ITERATIONS", webConfig.Upload.MaxIterations)
+	webConfig.Upload.MaxFileSize = int64(getEnvInt("MAX_UPLOAD_SIZE", int(webConfig.Upload.MaxFileSize)))
+	webConfig.Upload.VideoFormats = getEnvList("VIDEO_FORMATS", webConfig.Upload.VideoFormats)
+	webConfig.BodyLimit = getEnvInt("MAX_REQUEST_BODY_SIZE", webConfig.BodyLimit)
+	webConfig.MaxConcurrentUploads = getEnvInt("MAX_CONCURRENT_UPLOADS", webConfig.MaxConcurrentUploads)
+	webConfig.UploadRetryAfter = getEnvDuration("UPLOAD_RETRY_AFTER", webConfig.UploadRetryAfter)
+	webConfig.AuthRateLimit = getEnvInt("AUTH_RATE_LIMIT", webConfig.AuthRateLimit)
+	webConfig.AuthRateLimitWindow = getEnvDuration("AUTH_RATE_LIMIT_WINDOW", webConfig.AuthRateLimitWindow)
+
+	webConfig.DatabaseRetryAfter = getEnvDuration("DATABASE_RETRY_AFTER", webConfig.DatabaseRetryAfter)
+	webConfig.DisabledRoutes = getEnvList("DISABLED_ROUTES", webConfig.DisabledRoutes)
+	webConfig.StrictRouting = getEnvBool("STRICT_ROUTING", webConfig.StrictRouting)
+	webConfig.CaseSensitiveRoutes = getEnvBool("CASE_SENSITIVE_ROUTES", webConfig.CaseSensitiveRoutes)
+	webConfig.PublicMetrics = getEnvBool("PUBLIC_METRICS", webConfig.PublicMetrics)
+	webConfig.CORS.AllowOrigins = getEnvList("CORS_ALLOWED_ORIGINS", webConfig.CORS.AllowOrigins)
+	webConfig.CORS.AllowMethods = getEnvList("CORS_ALLOWED_METHODS", webConfig.CORS.AllowMethods)
+	webConfig.CORS.AllowCredentials = getEnvBool("CORS_ALLOW_CREDENTIALS", webConfig.CORS.AllowCredentials)
+	webConfig.ShutdownTimeout = getEnvDuration("SHUTDOWN_TIMEOUT", webConfig.ShutdownTimeout)
+	webConfig.SceneProgressInterval = getEnvDuration("SCENE_PROGRESS_INTERVAL", webConfig.SceneProgressInterval)
+	if level := os.Getenv("ACCESS_LOG_LEVEL"); level != "" {
+		webConfig.AccessLog.Level = level
+	}
+	webConfig.AccessLog.RouteLevels = getEnvStringMap("ACCESS_LOG_ROUTES", webConfig.AccessLog.RouteLevels)
+	webConfig.ContentTypes = getEnvStringMap("CONTENT_TYPES", webConfig.ContentTypes)
+
+	server, err := web.NewWebServer(webConfig, clientService, logger)
+	if err != nil {
+		logger.Fatal("Error creating web server:", err)
+	}
 
 	fmt.Println("Starting server...")
 
-	// Start the web server
+	// Start the web server. It returns once shut down by SIGINT or SIGTERM; the deferred calls then stop the
+	// services, close the database connection and flush the logger
 	if err := server.Run(webserverIP, 5000); err != nil {
-		logger.Fatal("Error starting web server:", err)
+		logger.Error("Web server stopped:", err)
 	}
 }
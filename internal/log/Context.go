@@ -0,0 +1,39 @@
+// This file contains the request scoped fields of the Logger. Fields describing a request (i.e its request_id) are
+// carried by the request's context, so any code handling the request can add them to its log entries, and entries
+// of the same request can be correlated by log aggregators.
+
+package log
+
+import "context"
+
+// fieldsKey is the context key request scoped fields are stored under.
+type fieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying the given key-value pairs, in addition to the fields ctx already
+// carries. They are added to the entries of loggers returned by WithContext.
+func ContextWithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	fields := FieldsFromContext(ctx)
+	merged := make([]interface{}, 0, len(fields)+len(keysAndValues))
+	merged = append(merged, fields...)
+	merged = append(merged, keysAndValues...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FieldsFromContext returns the key-value pairs carried by ctx, if any.
+func FieldsFromContext(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	return fields
+}
+
+// WithContext returns a Logger adding the fields carried by ctx (see ContextWithFields) to all of its entries.
+// Returns l itself if ctx carries no fields.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	fields := FieldsFromContext(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return &Logger{l.SugaredLogger.With(fields...)}
+}
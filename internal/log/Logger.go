@@ -10,8 +10,11 @@ type Logger struct {
 	*zap.SugaredLogger
 }
 
-// NewLogger creates a new Logger instance
-func NewLogger(development, debug bool) (*Logger, error) {
+// NewLogger creates a new Logger instance. If sanitize is true, control characters in text mode
+// (development) output are escaped, so logged values cannot forge log lines. If jsonOutput is true, entries are
+// written as one JSON object per line, with `level`, `time` and `msg` keys followed by the entry's fields,
+// for log aggregators to parse.
+func NewLogger(development, debug, sanitize, jsonOutput bool) (*Logger, error) {
 	var config zap.Config
 	if development {
 		config = zap.NewDevelopmentConfig()
@@ -27,6 +30,19 @@ func NewLogger(development, debug bool) (*Logger, error) {
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	config.OutputPaths = []string{"web-server.log"}
 	config.ErrorOutputPaths = []string{"web-server.log"}
+	if jsonOutput {
+		config.Encoding = "json"
+		config.EncoderConfig.LevelKey = "level"
+		config.EncoderConfig.TimeKey = "time"
+		config.EncoderConfig.MessageKey = "msg"
+		config.EncoderConfig.NameKey = "logger"
+		config.EncoderConfig.CallerKey = "caller"
+		config.EncoderConfig.StacktraceKey = "stacktrace"
+		config.EncoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+	}
+	if sanitize && config.Encoding == "console" {
+		config.Encoding = sanitizedConsoleEncoding
+	}
 
 	zapLogger, err := config.Build()
 	if err != nil {
@@ -0,0 +1,130 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inTempDir runs the test in a temporary directory, as loggers write to web-server.log in the working directory.
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// readLines returns the lines written to web-server.log in dir.
+func readLines(t *testing.T, dir string) []string {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, "web-server.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestNewLoggerJSONOutput(t *testing.T) {
+	dir := inTempDir(t)
+	logger, err := NewLogger(false, true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Infow("scene created", "scene_id", "abc")
+	logger.Debug("line one\nline two")
+	logger.Sync()
+
+	lines := readLines(t, dir)
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), lines)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("entry is not JSON: %v", err)
+	}
+	for key, want := range map[string]string{"level": "info", "msg": "scene created", "scene_id": "abc"} {
+		if entry[key] != want {
+			t.Errorf("%s = %v, want %q", key, entry[key], want)
+		}
+	}
+	if _, ok := entry["time"].(string); !ok {
+		t.Errorf("time = %v, want a timestamp", entry["time"])
+	}
+
+	// Messages are escaped by the JSON encoder, so they stay on one line
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("entry is not JSON: %v", err)
+	}
+	if entry["level"] != "debug" || entry["msg"] != "line one\nline two" {
+		t.Errorf("got level %v and msg %q, want debug and the original message", entry["level"], entry["msg"])
+	}
+}
+
+func TestWithContextAddsFields(t *testing.T) {
+	dir := inTempDir(t)
+	logger, err := NewLogger(false, false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if logger.WithContext(context.Background()) != logger {
+		t.Error("WithContext without fields should return the logger itself")
+	}
+
+	ctx := ContextWithFields(context.Background(), "request_id", "req-1")
+	ctx = ContextWithFields(ctx, "user_id", "user-1")
+	logger.WithContext(ctx).Info("request handled")
+	logger.Debug("not logged at info level")
+	logger.Sync()
+
+	lines := readLines(t, dir)
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(lines), lines)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("entry is not JSON: %v", err)
+	}
+	if entry["request_id"] != "req-1" || entry["user_id"] != "user-1" {
+		t.Errorf("got request_id %v and user_id %v, want the context fields", entry["request_id"], entry["user_id"])
+	}
+}
+
+func TestSanitizedConsoleEscapesControlCharacters(t *testing.T) {
+	dir := inTempDir(t)
+	logger, err := NewLogger(true, false, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("scene name\nINFO\tforged entry")
+	logger.Sync()
+
+	lines := readLines(t, dir)
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(lines), lines)
+	}
+	if strings.Contains(lines[0], "\tforged") || !strings.Contains(lines[0], `scene name\nINFO`) {
+		t.Errorf("message was not escaped: %q", lines[0])
+	}
+}
@@ -0,0 +1,78 @@
+// This file contains the log sanitization. User supplied values (scene names, usernames, paths, ...) are logged as is,
+// so a value containing a newline could forge log lines in text (console) mode. When sanitization is enabled,
+// control characters in messages are escaped before they are written. Fields do not need this, as the console
+// encoder already writes them as JSON.
+//
+// JSON mode does not need this either, as the JSON encoder already escapes control characters.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// sanitizedConsoleEncoding is the name the sanitizing console encoder is registered under with zap.
+const sanitizedConsoleEncoding = "sanitized-console"
+
+func init() {
+	err := zap.RegisterEncoder(sanitizedConsoleEncoding, func(config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return sanitizingEncoder{zapcore.NewConsoleEncoder(config)}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// sanitizingEncoder wraps a zapcore.Encoder, escaping control characters in messages.
+// Stack traces are left untouched, as their line breaks are expected.
+type sanitizingEncoder struct {
+	zapcore.Encoder
+}
+
+// Clone implements zapcore.Encoder.
+func (e sanitizingEncoder) Clone() zapcore.Encoder {
+	return sanitizingEncoder{e.Encoder.Clone()}
+}
+
+// EncodeEntry implements zapcore.Encoder.
+func (e sanitizingEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	entry.Message = sanitize(entry.Message)
+	return e.Encoder.EncodeEntry(entry, fields)
+}
+
+// isUnsafe checks if r must be escaped to keep a log entry on a single line.
+func isUnsafe(r rune) bool {
+	return unicode.IsControl(r) || r == '\u2028' || r == '\u2029'
+}
+
+// sanitize escapes control characters (including newlines) and unicode line separators in s.
+// Common whitespace is escaped as \n, \r and \t; anything else as \uXXXX.
+func sanitize(s string) string {
+	if strings.IndexFunc(s, isUnsafe) == -1 {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case isUnsafe(r):
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -3,6 +3,15 @@
 // get queue data from the database. Interaction with queues is almost always by ID, as the ID will (almost always) be unique.
 
 // Note that the only valid queues are those in the queueNames slice.
+//
+// Queues are kept in memory, and the database copy is used for durability. Additions are written to the database
+// immediately (write-on-enqueue), so a job is never lost once queued. Removals are batched and written every
+// FlushInterval, as they are frequent and losing one is harmless: after a crash, Reconcile rebuilds the queues
+// from the scene states, which are the source of truth. The in-memory view assumes a single web server instance.
+//
+// Changes are written to the database before they are applied in memory, so a failed write leaves the queue as it
+// was. Flushes copy the pending queues under the lock and write them without it, so a slow database does not block
+// the queues.
 
 package queue
 
@@ -11,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 	"slices"
+	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -39,18 +50,42 @@ var (
 type QueueListManager struct {
 	collection *mongo.Collection
 	queueNames []string
+	config     QueueListManagerConfig
 	logger     *log.Logger
+
+	mu     sync.Mutex
+	queues map[string][]primitive.ObjectID
+	dirty  map[string]bool
+	// revisions counts the changes of each queue, so a flush can tell whether a queue changed while it was written.
+	revisions map[string]uint64
+	stop      chan struct{}
+	done      chan struct{}
 }
 
-// NewQueueListManager creates a new QueueListManager with the given MongoDB client and logger.
+// NewQueueListManager creates a new QueueListManager with the given MongoDB client, configuration and logger.
 // By default, creates 'sfm_list', 'nerf_list', and 'queue_list' queues.
-func NewQueueListManager(client *mongo.Client, logger *log.Logger, unittest bool) *QueueListManager {
+//
+// If the FlushInterval is non-zero, pending removals are flushed in the background until Close is called.
+func NewQueueListManager(client *mongo.Client, config QueueListManagerConfig, logger *log.Logger, unittest bool) *QueueListManager {
 	db := client.Database("nerfdb")
-	return &QueueListManager{
+	qlm := &QueueListManager{
 		collection: db.Collection("queues"),
 		queueNames: []string{"queue_list", "sfm_list", "nerf_list"},
+		config:     config,
 		logger:     logger,
+		queues:     make(map[string][]primitive.ObjectID),
+		dirty:      make(map[string]bool),
+		revisions:  make(map[string]uint64),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	if config.FlushInterval > 0 {
+		go qlm.runFlusher()
+	} else {
+		close(qlm.done)
 	}
+	return qlm
 }
 
 // GetQueueNames returns the list of valid queue names.
@@ -58,6 +93,125 @@ func (qlm *QueueListManager) GetQueueNames() []string {
 	return qlm.queueNames
 }
 
+// runFlusher flushes pending removals every FlushInterval until Close is called.
+func (qlm *QueueListManager) runFlusher() {
+	defer close(qlm.done)
+
+	ticker := time.NewTicker(qlm.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-qlm.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), qlm.config.FlushTimeout)
+			if err := qlm.Flush(ctx); err != nil {
+				qlm.logger.Error("Failed to flush queues:", err.Error())
+			}
+			cancel()
+		}
+	}
+}
+
+// Close stops the background flusher and flushes any pending changes.
+func (qlm *QueueListManager) Close(ctx context.Context) error {
+	select {
+	case <-qlm.stop:
+	default:
+		close(qlm.stop)
+	}
+	<-qlm.done
+	return qlm.Flush(ctx)
+}
+
+// Ping checks that the manager is responsive: its in-memory queues can be locked, and the queues collection can be
+// read, both within ctx.
+func (qlm *QueueListManager) Ping(ctx context.Context) error {
+	locked := make(chan struct{})
+	go func() {
+		qlm.mu.Lock()
+		qlm.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-ctx.Done():
+		return fmt.Errorf("queues are locked: %w", ctx.Err())
+	}
+
+	err := qlm.collection.FindOne(ctx, bson.M{}, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	return nil
+}
+
+// flushPasses is the number of times Flush writes queues that keep changing while they are written.
+const flushPasses = 3
+
+// Flush writes all queues with pending changes to the database. Queues that fail to write stay pending.
+//
+// The pending queues are copied under the lock and written without it, so a slow database does not block the queues.
+// A queue that changed in the meantime may have been written after its newer content, so it stays pending and is
+// written again with its current content, until no queue changes while it is written. A queue still changing after
+// flushPasses writes is left to the next flush.
+func (qlm *QueueListManager) Flush(ctx context.Context) error {
+	var firstErr error
+	for pass := 0; pass < flushPasses; pass++ {
+		changed, err := qlm.flushPending(ctx)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if !changed {
+			break
+		}
+	}
+	return firstErr
+}
+
+// flushPending writes the queues with pending changes once, without holding the lock while writing.
+//
+// Returns whether a written queue changed while it was written, and the first write error.
+func (qlm *QueueListManager) flushPending(ctx context.Context) (bool, error) {
+	qlm.mu.Lock()
+	pending := make(map[string][]primitive.ObjectID, len(qlm.dirty))
+	revisions := make(map[string]uint64, len(qlm.dirty))
+	for queueID := range qlm.dirty {
+		// Stored queues are never modified in place, so the copy can share them
+		pending[queueID] = qlm.queues[queueID]
+		revisions[queueID] = qlm.revisions[queueID]
+	}
+	qlm.mu.Unlock()
+
+	var firstErr error
+	written := make([]string, 0, len(pending))
+	for queueID, queue := range pending {
+		if err := qlm.setQueue(ctx, queueID, &QueueList{ID: queueID, Queue: queue}); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		written = append(written, queueID)
+	}
+
+	qlm.mu.Lock()
+	defer qlm.mu.Unlock()
+
+	changed := false
+	for _, queueID := range written {
+		if qlm.revisions[queueID] != revisions[queueID] {
+			// An immediate write in the meantime clears the pending flag, but may have been overwritten by this one
+			qlm.dirty[queueID] = true
+			changed = true
+			continue
+		}
+		delete(qlm.dirty, queueID)
+	}
+	return changed, firstErr
+}
+
 // setQueue sets the data in queueList in the database by the queue ID.
 // It is not intended to be used outside of the QueueListManager.
 func (qlm *QueueListManager) setQueue(ctx context.Context, queueID string, queueList *QueueList) error {
@@ -75,34 +229,74 @@ func (qlm *QueueListManager) setQueue(ctx context.Context, queueID string, queue
 	return err
 }
 
+// loadQueue returns the in-memory queue by the queue ID, loading it from the database on first use.
+// A queue missing from the database is treated as empty. The caller must hold qlm.mu.
+func (qlm *QueueListManager) loadQueue(ctx context.Context, queueID string) ([]primitive.ObjectID, error) {
+	if q, ok := qlm.queues[queueID]; ok {
+		return q, nil
+	}
+
+	var queueList QueueList
+	err := qlm.collection.FindOne(ctx, bson.M{"_id": queueID}).Decode(&queueList)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	if queueList.Queue == nil {
+		queueList.Queue = []primitive.ObjectID{}
+	}
+	qlm.queues[queueID] = queueList.Queue
+	return queueList.Queue, nil
+}
+
+// storeQueue replaces the in-memory queue by the queue ID. If immediate is true, or batching is disabled,
+// the queue is written to the database first, and is left unchanged if the write fails; otherwise it is written on
+// the next flush. queue must not be modified afterwards. The caller must hold qlm.mu.
+func (qlm *QueueListManager) storeQueue(ctx context.Context, queueID string, queue []primitive.ObjectID, immediate bool) error {
+	if immediate || qlm.config.FlushInterval <= 0 {
+		if err := qlm.setQueue(ctx, queueID, &QueueList{ID: queueID, Queue: queue}); err != nil {
+			return err
+		}
+		delete(qlm.dirty, queueID)
+	} else {
+		qlm.dirty[queueID] = true
+	}
+
+	qlm.queues[queueID] = queue
+	qlm.revisions[queueID]++
+	return nil
+}
+
 // AddNewQueue adds a new queue to the database by the queue ID. The queueID is added to  qlm.queueNames slice.
 // If the queue already exists, returns ErrQueueAlreadyExists.
 func (qlm *QueueListManager) AddNewQueue(ctx context.Context, queueID string) error {
+	qlm.mu.Lock()
+	defer qlm.mu.Unlock()
+
 	if slices.Contains(qlm.queueNames, queueID) {
 		return ErrQueueAlreadyExists
 	}
 
 	qlm.queueNames = append(qlm.queueNames, queueID)
-
-	queueList := QueueList{ID: queueID, Queue: []primitive.ObjectID{}}
-	return qlm.setQueue(ctx, queueID, &queueList)
+	return qlm.storeQueue(ctx, queueID, []primitive.ObjectID{}, true)
 }
 
 // GetQueuePosition gets the position of itemID in the queue by the queue ID.
 // Returns the position of the item in the queue and the total number of items in the queue.
 func (qlm *QueueListManager) GetQueuePosition(ctx context.Context, queueID string, itemID primitive.ObjectID) (int, int, error) {
+	qlm.mu.Lock()
+	defer qlm.mu.Unlock()
+
 	if !slices.Contains(qlm.queueNames, queueID) {
 		return 0, 0, ErrInvalidQueueID
 	}
 
-	var queueList QueueList
-	err := qlm.collection.FindOne(ctx, bson.M{"_id": queueID}).Decode(&queueList)
+	queue, err := qlm.loadQueue(ctx, queueID)
 	if err != nil {
 		return 0, 0, err
 	}
 
 	position := -1
-	for i, id := range queueList.Queue {
+	for i, id := range queue {
 		if id == itemID {
 			if position != -1 {
 				return 0, 0, ErrMultipleIDsInQueue
@@ -115,70 +309,71 @@ func (qlm *QueueListManager) GetQueuePosition(ctx context.Context, queueID strin
 		return 0, 0, ErrIDNotFoundInQueue
 	}
 
-	return position, len(queueList.Queue), nil
+	return position, len(queue), nil
 }
 
 // GetQueueSize returns the number of items in the queue by the queue ID.
 func (qlm *QueueListManager) GetQueueSize(ctx context.Context, queueID string) (int, error) {
+	qlm.mu.Lock()
+	defer qlm.mu.Unlock()
+
 	if !slices.Contains(qlm.queueNames, queueID) {
 		return 0, ErrInvalidQueueID
 	}
 
-	var queueList QueueList
-	err := qlm.collection.FindOne(ctx, bson.M{"_id": queueID}).Decode(&queueList)
+	queue, err := qlm.loadQueue(ctx, queueID)
 	if err != nil {
 		return 0, err
 	}
 
-	return len(queueList.Queue), nil
+	return len(queue), nil
 }
 
-// AppendToQueue appends a item's ID to the queue by the queue ID.
+// AppendToQueue appends a item's ID to the queue by the queue ID. The change is written to the database immediately.
 // Returns ErrIDAlreadyInQueue if the itemID is already in the queue.
 // If the queue does not exist, and queueID is valid, it is created, and the item is added.
 func (qlm *QueueListManager) AppendToQueue(ctx context.Context, queueID string, itemID primitive.ObjectID) error {
+	qlm.mu.Lock()
+	defer qlm.mu.Unlock()
+
 	if !slices.Contains(qlm.queueNames, queueID) {
 		qlm.logger.Info("Invalid queue ID")
 		return ErrInvalidQueueID
 	}
 
-	var queueList QueueList
-	err := qlm.collection.FindOne(ctx, bson.M{"_id": queueID}).Decode(&queueList)
+	queue, err := qlm.loadQueue(ctx, queueID)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			queueList = QueueList{ID: queueID, Queue: []primitive.ObjectID{itemID}}
-			return qlm.setQueue(ctx, queueID, &queueList)
-		}
 		return err
 	}
 
-	if slices.Contains(queueList.Queue, itemID) {
+	if slices.Contains(queue, itemID) {
 		qlm.logger.Info(fmt.Sprintf("Attemped to add %s to queue %s, but it is already in the queue", itemID, queueID))
 		return ErrIDAlreadyInQueue
 	}
 
-	queueList.Queue = append(queueList.Queue, itemID)
-	return qlm.setQueue(ctx, queueID, &queueList)
+	return qlm.storeQueue(ctx, queueID, append(slices.Clone(queue), itemID), true)
 }
 
-// PopFromQueue pops the itemID from the queue by the queue ID.
+// DeleteFromQueue deletes the itemID from the queue by the queue ID. The change is written on the next flush.
 // Returns ErrIDNotFoundInQueue if the itemID is not in the queue.
 func (qlm *QueueListManager) DeleteFromQueue(ctx context.Context, queueID string, itemID primitive.ObjectID) error {
+	qlm.mu.Lock()
+	defer qlm.mu.Unlock()
+
 	if !slices.Contains(qlm.queueNames, queueID) {
 		return ErrInvalidQueueID
 	}
 
-	var queueList QueueList
-	err := qlm.collection.FindOne(ctx, bson.M{"_id": queueID}).Decode(&queueList)
+	queue, err := qlm.loadQueue(ctx, queueID)
 	if err != nil {
 		return err
 	}
 
-	if len(queueList.Queue) == 0 {
+	if len(queue) == 0 {
 		return ErrInvalidOpOnEmptyQueue
 	}
 
-	index := slices.IndexFunc(queueList.Queue, func(id primitive.ObjectID) bool {
+	index := slices.IndexFunc(queue, func(id primitive.ObjectID) bool {
 		return id == itemID
 	})
 
@@ -186,7 +381,58 @@ func (qlm *QueueListManager) DeleteFromQueue(ctx context.Context, queueID string
 		return ErrIDNotFoundInQueue
 	}
 
-	queueList.Queue = slices.Delete(queueList.Queue, index, index+1)
+	return qlm.storeQueue(ctx, queueID, slices.Delete(slices.Clone(queue), index, index+1), false)
+}
+
+// Reconcile rebuilds the queues from the expected queue contents, which callers derive from the scene states.
+// Items of a queue that are still expected keep their persisted order; expected items missing from the queue
+// (i.e enqueued but lost in a crash) are appended in the given order, and unexpected items are dropped.
+// Queues not in expected are left untouched. All reconciled queues are written immediately.
+//
+// Returns the number of items recovered and dropped across all queues.
+func (qlm *QueueListManager) Reconcile(ctx context.Context, expected map[string][]primitive.ObjectID) (int, int, error) {
+	qlm.mu.Lock()
+	defer qlm.mu.Unlock()
+
+	recovered, dropped := 0, 0
+	for queueID, want := range expected {
+		if !slices.Contains(qlm.queueNames, queueID) {
+			return recovered, dropped, ErrInvalidQueueID
+		}
+
+		// Drop any in-memory state, so the persisted queue is what gets reconciled.
+		delete(qlm.queues, queueID)
+		current, err := qlm.loadQueue(ctx, queueID)
+		if err != nil {
+			return recovered, dropped, err
+		}
+
+		wantSet := make(map[primitive.ObjectID]bool, len(want))
+		for _, id := range want {
+			wantSet[id] = true
+		}
 
-	return qlm.setQueue(ctx, queueID, &queueList)
-}
\ No newline at end of file
+		reconciled := make([]primitive.ObjectID, 0, len(want))
+		present := make(map[primitive.ObjectID]bool, len(current))
+		for _, id := range current {
+			if !wantSet[id] || present[id] {
+				dropped++
+				continue
+			}
+			present[id] = true
+			reconciled = append(reconciled, id)
+		}
+		for _, id := range want {
+			if !present[id] {
+				present[id] = true
+				recovered++
+				reconciled = append(reconciled, id)
+			}
+		}
+
+		if err := qlm.storeQueue(ctx, queueID, reconciled, true); err != nil {
+			return recovered, dropped, err
+		}
+	}
+	return recovered, dropped, nil
+}
@@ -0,0 +1,24 @@
+// This file contains the QueueListManagerConfig struct, which holds the tunable settings of a QueueListManager.
+// Values are expected to be populated by the caller (usually from environment variables in main), falling back
+// to DefaultQueueListManagerConfig for anything not provided.
+
+package queue
+
+import "time"
+
+// QueueListManagerConfig holds the tunable settings of a QueueListManager.
+type QueueListManagerConfig struct {
+	// FlushInterval is how often removals from queues are written to the database. Additions are always written
+	// immediately. Zero writes every change immediately.
+	FlushInterval time.Duration
+	// FlushTimeout is how long a background flush may take. Queues not written by then stay pending until the next.
+	FlushTimeout time.Duration
+}
+
+// DefaultQueueListManagerConfig returns the default QueueListManager configuration.
+func DefaultQueueListManagerConfig() QueueListManagerConfig {
+	return QueueListManagerConfig{
+		FlushInterval: 5 * time.Second,
+		FlushTimeout:  10 * time.Second,
+	}
+}
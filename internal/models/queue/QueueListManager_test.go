@@ -0,0 +1,232 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// newTestQueueListManager returns a QueueListManager on the mocked client, flushing removals every flushInterval.
+// Its background flusher is not started, so tests flush explicitly.
+func newTestQueueListManager(mt *mtest.T, flushInterval time.Duration) *QueueListManager {
+	qlm := NewQueueListManager(mt.Client, QueueListManagerConfig{}, &log.Logger{SugaredLogger: zap.NewNop().Sugar()}, true)
+	qlm.config.FlushInterval = flushInterval
+	return qlm
+}
+
+// queueResponse returns a mocked FindOne response of the queue holding ids.
+func queueResponse(queueID string, ids ...primitive.ObjectID) bson.D {
+	return mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: queueID},
+		{Key: "queue", Value: ids},
+	})
+}
+
+// updateResponse returns a mocked successful update command response.
+func updateResponse() bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}}
+}
+
+// errorResponse returns a mocked failed command response.
+func errorResponse() bson.D {
+	return mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "write failed"})
+}
+
+// writtenQueue returns the queue written by the given update command.
+func writtenQueue(mt *mtest.T, event bson.Raw) []primitive.ObjectID {
+	mt.Helper()
+	update := event.Lookup("updates").Array().Index(0).Value().Document()
+	values, err := update.Lookup("u", "$set", "queue").Array().Values()
+	if err != nil {
+		mt.Fatal(err)
+	}
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		ids = append(ids, value.ObjectID())
+	}
+	return ids
+}
+
+func TestAppendToQueueWritesBeforeApplying(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("written", func(mt *mtest.T) {
+		mt.AddMockResponses(queueResponse("sfm_list", a), updateResponse())
+		qlm := newTestQueueListManager(mt, time.Minute)
+
+		if err := qlm.AppendToQueue(ctx, "sfm_list", b); err != nil {
+			mt.Fatalf("AppendToQueue() = %v", err)
+		}
+		if position, size, err := qlm.GetQueuePosition(ctx, "sfm_list", b); err != nil || position != 1 || size != 2 {
+			mt.Errorf("GetQueuePosition() = %d, %d, %v, want 1, 2", position, size, err)
+		}
+	})
+
+	mt.Run("write failed", func(mt *mtest.T) {
+		mt.AddMockResponses(queueResponse("sfm_list", a), errorResponse())
+		qlm := newTestQueueListManager(mt, time.Minute)
+
+		if err := qlm.AppendToQueue(ctx, "sfm_list", b); err == nil {
+			mt.Fatal("AppendToQueue() succeeded, want the write error")
+		}
+		// The queue is left as it was, and nothing is pending
+		if _, _, err := qlm.GetQueuePosition(ctx, "sfm_list", b); !errors.Is(err, ErrIDNotFoundInQueue) {
+			mt.Errorf("GetQueuePosition() = %v, want ErrIDNotFoundInQueue", err)
+		}
+		if len(qlm.dirty) != 0 {
+			mt.Errorf("queues %v pending after a failed write", qlm.dirty)
+		}
+	})
+}
+
+func TestDeleteFromQueueIsFlushed(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("batched", func(mt *mtest.T) {
+		mt.AddMockResponses(queueResponse("nerf_list", a, b), updateResponse())
+		qlm := newTestQueueListManager(mt, time.Minute)
+
+		if err := qlm.DeleteFromQueue(ctx, "nerf_list", a); err != nil {
+			mt.Fatalf("DeleteFromQueue() = %v", err)
+		}
+		if !qlm.dirty["nerf_list"] {
+			mt.Fatal("removal is not pending")
+		}
+
+		mt.ClearEvents()
+		if err := qlm.Flush(ctx); err != nil {
+			mt.Fatalf("Flush() = %v", err)
+		}
+		if written := writtenQueue(mt, mt.GetStartedEvent().Command); len(written) != 1 || written[0] != b {
+			mt.Errorf("flushed queue %v, want [%v]", written, b)
+		}
+		if len(qlm.dirty) != 0 {
+			mt.Errorf("queues %v still pending after a flush", qlm.dirty)
+		}
+	})
+
+	mt.Run("flush failed", func(mt *mtest.T) {
+		mt.AddMockResponses(queueResponse("nerf_list", a, b), errorResponse())
+		qlm := newTestQueueListManager(mt, time.Minute)
+
+		qlm.DeleteFromQueue(ctx, "nerf_list", a)
+		if err := qlm.Flush(ctx); err == nil {
+			mt.Fatal("Flush() succeeded, want the write error")
+		}
+		if !qlm.dirty["nerf_list"] {
+			mt.Error("removal is no longer pending after a failed flush")
+		}
+	})
+
+	mt.Run("immediate without batching", func(mt *mtest.T) {
+		mt.AddMockResponses(queueResponse("nerf_list", a, b), updateResponse())
+		qlm := newTestQueueListManager(mt, 0)
+
+		if err := qlm.DeleteFromQueue(ctx, "nerf_list", a); err != nil {
+			mt.Fatalf("DeleteFromQueue() = %v", err)
+		}
+		if len(qlm.dirty) != 0 {
+			mt.Errorf("queues %v pending without batching", qlm.dirty)
+		}
+	})
+}
+
+func TestAppendWritesPendingRemovals(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ctx := context.Background()
+	a, b, c := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("appended", func(mt *mtest.T) {
+		mt.AddMockResponses(queueResponse("queue_list", a, b), updateResponse())
+		qlm := newTestQueueListManager(mt, time.Minute)
+		qlm.DeleteFromQueue(ctx, "queue_list", a)
+
+		mt.ClearEvents()
+		if err := qlm.AppendToQueue(ctx, "queue_list", c); err != nil {
+			mt.Fatalf("AppendToQueue() = %v", err)
+		}
+		// The append writes the whole queue, including the pending removal
+		if written := writtenQueue(mt, mt.GetStartedEvent().Command); len(written) != 2 || written[0] != b || written[1] != c {
+			mt.Errorf("wrote queue %v, want [%v %v]", written, b, c)
+		}
+
+		mt.ClearEvents()
+		if err := qlm.Flush(ctx); err != nil {
+			mt.Fatalf("Flush() = %v", err)
+		}
+		if events := mt.GetAllStartedEvents(); len(events) != 0 {
+			mt.Errorf("flush wrote %d queues, want none pending", len(events))
+		}
+	})
+}
+
+// hookContext is a context calling hook whenever it is checked for a deadline or cancellation, i.e while a command
+// using it runs.
+type hookContext struct {
+	context.Context
+	hook func()
+}
+
+func (c *hookContext) Deadline() (time.Time, bool) {
+	c.hook()
+	return c.Context.Deadline()
+}
+
+func (c *hookContext) Done() <-chan struct{} {
+	c.hook()
+	return c.Context.Done()
+}
+
+func TestFlushRewritesQueuesChangedWhileWritten(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("changed", func(mt *mtest.T) {
+		mt.AddMockResponses(queueResponse("nerf_list", a, b), updateResponse(), updateResponse())
+		qlm := newTestQueueListManager(mt, time.Minute)
+		qlm.DeleteFromQueue(context.Background(), "nerf_list", a)
+
+		// Remove b while the first flush write runs. Writes must not hold the lock.
+		var removed sync.Once
+		ctx := &hookContext{Context: context.Background(), hook: func() {
+			if !qlm.mu.TryLock() {
+				mt.Error("queues are locked while they are written")
+				return
+			}
+			defer qlm.mu.Unlock()
+			removed.Do(func() {
+				qlm.queues["nerf_list"] = []primitive.ObjectID{}
+				qlm.revisions["nerf_list"]++
+				qlm.dirty["nerf_list"] = true
+			})
+		}}
+		mt.ClearEvents()
+		if err := qlm.Flush(ctx); err != nil {
+			mt.Fatalf("Flush() = %v", err)
+		}
+
+		events := mt.GetAllStartedEvents()
+		if len(events) != 2 {
+			mt.Fatalf("flush wrote the queue %d times, want it written again after it changed", len(events))
+		}
+		if written := writtenQueue(mt, events[1].Command); len(written) != 0 {
+			mt.Errorf("rewrote queue %v, want its current content []", written)
+		}
+		if len(qlm.dirty) != 0 {
+			mt.Errorf("queues %v still pending after a flush", qlm.dirty)
+		}
+	})
+}
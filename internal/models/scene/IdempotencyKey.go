@@ -0,0 +1,100 @@
+// This file contains the idempotency key store used when creating scenes. A client may tag a new scene request
+// with an idempotency key, so a retried or double-submitted request does not create a second scene.
+//
+// Keys are stored in the nerfdb.idempotency_keys collection, with the (user, key) pair as the document ID. Using the
+// document ID (rather than a separate index) guarantees that exactly one concurrent request can claim a key.
+// The claiming request creates the scene and marks the key done; concurrent duplicates see the existing claim, and
+// wait for it to be done (or released, if creating the scene failed).
+
+package scene
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// idempotencyKeyID is the document ID of an idempotency key. Keys are only unique per user.
+type idempotencyKeyID struct {
+	UserID primitive.ObjectID `bson:"user_id"`
+	Key    string             `bson:"key"`
+}
+
+// IdempotencyRecord is a claimed idempotency key and the scene it creates.
+type IdempotencyRecord struct {
+	ID      idempotencyKeyID   `bson:"_id"`
+	SceneID primitive.ObjectID `bson:"scene_id"`
+	// Done is set once the scene has been created. Until then, the key is held by the request creating the scene.
+	Done      bool      `bson:"done"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// ClaimIdempotencyKey claims the user's idempotency key for the scene with the given ID. Claims older than
+// expireAfter are considered expired, and are taken over.
+//
+// Returns the record holding the key: if its SceneID is sceneID, the key was claimed by this call. Otherwise the key
+// is held by another request. Returns (nil, nil) if the existing claim was released while claiming; callers may retry.
+func (sm *SceneManager) ClaimIdempotencyKey(ctx context.Context, userID primitive.ObjectID, key string, sceneID primitive.ObjectID, expireAfter time.Duration) (*IdempotencyRecord, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	id := idempotencyKeyID{UserID: userID, Key: key}
+	now := time.Now().UTC()
+	claim := &IdempotencyRecord{
+		ID:        id,
+		SceneID:   sceneID,
+		CreatedAt: now,
+	}
+
+	// Inserts the claim if there is none, and replaces an expired one. If an unexpired claim exists,
+	// the filter does not match and the upsert fails on the duplicate ID.
+	filter := bson.M{"_id": id, "created_at": bson.M{"$lt": now.Add(-expireAfter)}}
+	_, err := sm.idempotency.ReplaceOne(ctx, filter, claim, options.Replace().SetUpsert(true))
+	if err == nil {
+		return claim, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, sm.dbError(err)
+	}
+
+	var existing IdempotencyRecord
+	err = sm.idempotency.FindOne(ctx, bson.M{"_id": id}).Decode(&existing)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, sm.dbError(err)
+	}
+	return &existing, nil
+}
+
+// CompleteIdempotencyKey marks the user's idempotency key, claimed for sceneID, as done.
+func (sm *SceneManager) CompleteIdempotencyKey(ctx context.Context, userID primitive.ObjectID, key string, sceneID primitive.ObjectID) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": idempotencyKeyID{UserID: userID, Key: key}, "scene_id": sceneID}
+	_, err := sm.idempotency.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"done": true}})
+	if err != nil {
+		return sm.dbError(err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey releases the user's idempotency key, claimed for sceneID, so it can be claimed again.
+// Used when creating the scene failed.
+func (sm *SceneManager) ReleaseIdempotencyKey(ctx context.Context, userID primitive.ObjectID, key string, sceneID primitive.ObjectID) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": idempotencyKeyID{UserID: userID, Key: key}, "scene_id": sceneID}
+	_, err := sm.idempotency.DeleteOne(ctx, filter)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	return nil
+}
@@ -12,6 +12,9 @@ package scene
 
 import (
 	"errors"
+	"math"
+	"sort"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -25,6 +28,25 @@ var (
 	// ErrInvalidOpOnProcessingScene is returned when an invalid operation is attempted on a processing scene.
 	//(I.e, trying to delete a scene that nerf-worker is actively training)
 	ErrInvalidOpOnProcessingScene = errors.New("invalid operation on processing scene")
+	// ErrShareWithOwner is returned when a scene owner attempts to share a scene with themselves.
+	ErrShareWithOwner = errors.New("cannot share a scene with its owner")
+	// ErrSceneNotReady is returned when an operation requires a scene that has finished processing.
+	ErrSceneNotReady = errors.New("scene has not finished processing")
+	// ErrSfmReportNotFound is returned when a scene's sfm has no quality report.
+	ErrSfmReportNotFound = errors.New("sfm quality report not found")
+	// ErrSfmPointCloudNotFound is returned when a scene's sfm has no point cloud.
+	ErrSfmPointCloudNotFound = errors.New("sfm point cloud not found")
+	// ErrTurntableNotFound is returned when a scene's nerf has no turntable preview frames.
+	ErrTurntableNotFound = errors.New("turntable preview not found")
+	// ErrIterationNotSaved is returned when an output is requested at an iteration that was not saved.
+	ErrIterationNotSaved = errors.New("iteration not saved")
+	// ErrInvalidStageProgress is returned when a stage progress is not a known stage, or not within 0-100%.
+	ErrInvalidStageProgress = errors.New("invalid stage progress")
+	// ErrSceneNotPreview is returned when promoting a scene that is not a preview (i.e already a full run).
+	ErrSceneNotPreview = errors.New("scene is not a preview")
+	// ErrSceneNotInTrash is returned when restoring a scene that was not deleted, or was deleted longer ago than the
+	// trash retention.
+	ErrSceneNotInTrash = errors.New("scene is not in the trash")
 )
 
 // Scene represents a scene and its components
@@ -36,6 +58,243 @@ type Scene struct {
     ID     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
     Status int                `bson:"status" json:"status"`
 	Name   string             `bson:"name" json:"name"`
+	// UserID is the owner of the scene. Only the owner may modify or delete the scene.
+	UserID primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	// SharedWith is the list of users (other than the owner) that have read access to the scene.
+	SharedWith []primitive.ObjectID `bson:"shared_with,omitempty" json:"shared_with,omitempty"`
+	// FinishedAt is the time the scene reached a terminal status (complete or failed).
+	FinishedAt *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+	// DeletedAt is the time the owner deleted the scene, which moved it to the trash. Scenes in the trash are hidden,
+	// and can be restored until they are purged. See SceneManager.SoftDeleteScene.
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	// Failure describes why processing failed. Only set when Status is StatusFailed.
+	Failure *Failure `bson:"failure,omitempty" json:"failure,omitempty"`
+	// Logs is the processing log of the scene, appended to as it moves through the pipeline.
+	// Once a scene is compacted, only the most recent entries are kept, and LogSummary describes the full log.
+	Logs []LogEntry `bson:"logs,omitempty" json:"logs,omitempty"`
+	// LogSummary summarizes the full processing log. Only set once the scene has been compacted.
+	LogSummary *LogSummary `bson:"log_summary,omitempty" json:"log_summary,omitempty"`
+	// Compacted is set once verbose data of a terminal scene has been trimmed. See SceneManager.CompactScenes.
+	Compacted bool `bson:"compacted,omitempty" json:"compacted,omitempty"`
+	// ThumbnailPath is the local path of a thumbnail rendered from the trained model.
+	// When empty, the first sfm frame is used as the thumbnail.
+	ThumbnailPath string `bson:"thumbnail_path,omitempty" json:"thumbnail_path,omitempty"`
+	// ThumbnailSize is the size of the scene's thumbnail (rendered or sfm frame), computed when it is first served.
+	ThumbnailSize *ImageSize `bson:"thumbnail_size,omitempty" json:"thumbnail_size,omitempty"`
+	// Tags are free-form, user assigned labels used to organize scenes. Tags are stored lowercase.
+	Tags []string `bson:"tags,omitempty" json:"tags,omitempty"`
+	// StageProgress is the last progress reported by the worker processing the scene. See SceneManager.SetStageProgress.
+	StageProgress *StageProgress `bson:"stage_progress,omitempty" json:"stage_progress,omitempty"`
+	// PromotedFrom is the preview scene this scene is a full run of. A promoted scene shares the raw video
+	// (and, if it was reused, the sfm output) of its source.
+	PromotedFrom *primitive.ObjectID `bson:"promoted_from,omitempty" json:"promoted_from,omitempty"`
+	// Description is a free-form, user written description of the scene.
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	// Favorite is set when the user marked the scene as a favorite.
+	Favorite bool `bson:"favorite,omitempty" json:"favorite,omitempty"`
+	// DownloadStats counts the downloads of each output file, by output type and then iteration.
+	// See SceneManager.RecordOutputDownload.
+	DownloadStats map[string]map[string]*OutputDownloadStats `bson:"download_stats,omitempty" json:"download_stats,omitempty"`
+}
+
+// OutputDownloadStats counts the downloads of a single output file.
+type OutputDownloadStats struct {
+	Count          int64      `bson:"count" json:"count"`
+	LastAccessedAt *time.Time `bson:"last_accessed_at,omitempty" json:"last_accessed_at,omitempty"`
+}
+
+// SceneUpdate is a partial update of the user editable fields of a scene. Only non-nil fields are updated.
+type SceneUpdate struct {
+	Name        *string
+	Description *string
+	Tags        *[]string
+	Favorite    *bool
+}
+
+// IsEmpty reports whether the update changes no fields.
+func (u *SceneUpdate) IsEmpty() bool {
+	return u.Name == nil && u.Description == nil && u.Tags == nil && u.Favorite == nil
+}
+
+// StageProgress is a worker reported, fine-grained progress within a pipeline stage.
+type StageProgress struct {
+	// Stage is the stage the progress is for (StageSfm or StageNerf).
+	Stage string `bson:"stage" json:"stage"`
+	// Percent is the progress within the stage, from 0 to 100.
+	Percent   float64   `bson:"percent" json:"percent"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// CurrentStageProgress returns the progress of the scene within its current stage, or nil if none was reported
+// for it (or the scene is not processing).
+func (s *Scene) CurrentStageProgress() *StageProgress {
+	if s.StageProgress == nil {
+		return nil
+	}
+	if status, ok := stageStatuses[s.StageProgress.Stage]; !ok || status != s.Status {
+		return nil
+	}
+	return s.StageProgress
+}
+
+// Processing states of a single pipeline stage, as reported by Scene.ProcessingStatus.
+const (
+	StageStatePending = "pending"
+	StageStateRunning = "running"
+	StageStateDone    = "done"
+	StageStateFailed  = "failed"
+	// StageStateSkipped is the state of the NeRF stage of SfM only scenes, which are not trained.
+	StageStateSkipped = "skipped"
+)
+
+// ProcessingStatus is a structured summary of where a scene is in the processing pipeline.
+type ProcessingStatus struct {
+	// Status is the name of the scene's status (see StatusName).
+	Status string `json:"status"`
+	// Sfm and Nerf are the states of the pipeline stages (StageStatePending, Running, Done or Failed).
+	Sfm  string `json:"sfm"`
+	Nerf string `json:"nerf"`
+	// Progress is the overall progress through the pipeline, from 0 to 1. Each stage counts for half (SfM counts
+	// for all of it in SfM only scenes), and the running stage adds its worker reported progress, if any.
+	Progress float64 `json:"progress"`
+}
+
+// ProcessingStatus derives the processing status of the scene from its status, the stage outputs (Sfm and Nerf)
+// it has, and the progress reported for its current stage.
+func (s *Scene) ProcessingStatus() ProcessingStatus {
+	status := ProcessingStatus{
+		Status: StatusName(s.Status),
+		Sfm:    s.stageState(StageSfm, s.Sfm != nil),
+		Nerf:   s.stageState(StageNerf, s.Nerf != nil),
+	}
+
+	stageWeight := 0.5
+	if s.IsSfmOnly() {
+		status.Nerf = StageStateSkipped
+		stageWeight = 1
+	}
+	for _, state := range []string{status.Sfm, status.Nerf} {
+		if state == StageStateDone {
+			status.Progress += stageWeight
+		}
+	}
+	if progress := s.CurrentStageProgress(); progress != nil {
+		status.Progress += progress.Percent / 100 * stageWeight
+	}
+	if s.Status == StatusComplete {
+		status.Progress = 1
+	}
+	status.Progress = math.Round(status.Progress*10000) / 10000
+	return status
+}
+
+// IsSfmOnly reports whether the scene only runs SfM, and is complete without NeRF training.
+func (s *Scene) IsSfmOnly() bool {
+	return s.Config != nil && s.Config.SfmOnly
+}
+
+// Finished reports whether the status is of a scene that completed or failed processing.
+func (p ProcessingStatus) Finished() bool {
+	return p.Status == StatusName(StatusComplete) || p.Status == StatusName(StatusFailed)
+}
+
+// stageState returns the state of a pipeline stage, given whether its output exists.
+func (s *Scene) stageState(stage string, hasOutput bool) string {
+	switch {
+	case s.Status == StatusComplete || hasOutput:
+		return StageStateDone
+	case s.Status == StatusFailed:
+		if s.Failure != nil && s.Failure.Stage != "" {
+			if s.Failure.Stage == stage {
+				return StageStateFailed
+			}
+			return StageStatePending
+		}
+		// Without a recorded stage, the scene failed in the first stage without output
+		if stage == StageNerf && s.Sfm == nil {
+			return StageStatePending
+		}
+		return StageStateFailed
+	case stageStatuses[stage] == s.Status:
+		return StageStateRunning
+	default:
+		return StageStatePending
+	}
+}
+
+// ImageSize is the size of an image, in pixels.
+type ImageSize struct {
+	Width  int `bson:"width" json:"width"`
+	Height int `bson:"height" json:"height"`
+}
+
+// TagCount is a tag and the number of scenes it is used on.
+type TagCount struct {
+	Tag   string `bson:"_id" json:"tag"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+// Scene processing statuses. A scene starts in StatusSfmProcessing, and ends in either StatusComplete or StatusFailed.
+const (
+	StatusSfmProcessing  = 0
+	StatusNerfProcessing = 1
+	StatusComplete       = 2
+	StatusFailed         = 3
+)
+
+// Pipeline stage names, used in logs and failure reports.
+const (
+	StageSfm  = "sfm"
+	StageNerf = "nerf"
+)
+
+// stageStatuses maps a pipeline stage to the status of a scene in that stage.
+var stageStatuses = map[string]int{
+	StageSfm:  StatusSfmProcessing,
+	StageNerf: StatusNerfProcessing,
+}
+
+// StatusName returns a human readable name for the given status.
+func StatusName(status int) string {
+	switch status {
+	case StatusSfmProcessing:
+		return "sfm_processing"
+	case StatusNerfProcessing:
+		return "nerf_processing"
+	case StatusComplete:
+		return "complete"
+	case StatusFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// IsTerminalStatus checks if the given status is one that a scene will not leave on its own.
+func IsTerminalStatus(status int) bool {
+	return status == StatusComplete || status == StatusFailed
+}
+
+// Failure describes why and where a scene failed processing.
+type Failure struct {
+	Stage  string `bson:"stage" json:"stage"`
+	Reason string `bson:"reason" json:"reason"`
+}
+
+// LogEntry is a single line of a scene's processing log.
+type LogEntry struct {
+	Time    time.Time `bson:"time" json:"time"`
+	Stage   string    `bson:"stage" json:"stage"`
+	Level   string    `bson:"level" json:"level"`
+	Message string    `bson:"message" json:"message"`
+}
+
+// LogSummary summarizes a processing log that has been trimmed by compaction.
+type LogSummary struct {
+	Entries int        `bson:"entries" json:"entries"`
+	Errors  int        `bson:"errors" json:"errors"`
+	FirstAt *time.Time `bson:"first_at,omitempty" json:"first_at,omitempty"`
+	LastAt  *time.Time `bson:"last_at,omitempty" json:"last_at,omitempty"`
 }
 
 // Video represents video metadata
@@ -46,6 +305,31 @@ type Video struct {
     FPS        int    `bson:"fps" json:"fps"`
     Duration   int    `bson:"duration" json:"duration"`
     FrameCount int    `bson:"frame_count" json:"frame_count"`
+	// ContentHash is the hex encoded SHA-256 hash of the uploaded video.
+	ContentHash string `bson:"content_hash,omitempty" json:"content_hash,omitempty"`
+	// Size is the size of the uploaded video file, in bytes.
+	Size int64 `bson:"size,omitempty" json:"size,omitempty"`
+	// Codec is the video codec (i.e "h264"), as probed by the sfm-worker. Not all workers report it.
+	Codec string `bson:"codec,omitempty" json:"codec,omitempty"`
+	// OriginalFilePath is the path of the uploaded video, if it was downscaled before processing. FilePath is then
+	// the path of the downscaled video, which is sent to the workers.
+	OriginalFilePath string `bson:"original_file_path,omitempty" json:"original_file_path,omitempty"`
+	// Scaling describes how the uploaded video was downscaled, if it was.
+	Scaling *VideoScaling `bson:"scaling,omitempty" json:"scaling,omitempty"`
+}
+
+// VideoScaling describes how an uploaded video was downscaled before processing, from its original resolution.
+type VideoScaling struct {
+	OriginalWidth  int `bson:"original_width" json:"original_width"`
+	OriginalHeight int `bson:"original_height" json:"original_height"`
+	Width          int `bson:"width" json:"width"`
+	Height         int `bson:"height" json:"height"`
+}
+
+// IsProbed reports whether the video has been probed, which the sfm-worker does before processing it.
+// Until then only the file path, content hash and size are known.
+func (v *Video) IsProbed() bool {
+	return v.Width > 0 && v.Height > 0
 }
 
 // Frame represents a single frame in the SfM process
@@ -59,6 +343,19 @@ type Sfm struct {
     IntrinsicMatrix [][]float64 `bson:"intrinsic_matrix" json:"intrinsic_matrix"`
     Frames          []Frame     `bson:"frames" json:"frames"`
     WhiteBackground bool        `bson:"white_background" json:"white_background"`
+	// QualityReport describes how well SfM went, as reported by the sfm-worker. Not all workers report it.
+	QualityReport *SfmQualityReport `bson:"quality_report,omitempty" json:"quality_report,omitempty"`
+	// PointCloudFilePath is the local path of the sparse point cloud reconstructed by SfM. Not all workers send it.
+	PointCloudFilePath string `bson:"point_cloud_file_path,omitempty" json:"-"`
+}
+
+// SfmQualityReport describes the quality of an SfM reconstruction. SfM can partially fail (i.e frames dropped),
+// which explains poor training results.
+type SfmQualityReport struct {
+	FramesUsed            int     `bson:"frames_used" json:"frames_used"`
+	FramesTotal           int     `bson:"frames_total" json:"frames_total"`
+	RegisteredCameras     int     `bson:"registered_cameras" json:"registered_cameras"`
+	MeanReprojectionError float64 `bson:"mean_reprojection_error" json:"mean_reprojection_error"`
 }
 
 
@@ -66,6 +363,9 @@ type Sfm struct {
 type TrainingConfig struct {
 	SfmTrainingConfig  *SfmTrainingConfig  `bson:"sfm_training_config,omitempty" json:"sfm_training_config,omitempty"`
 	NerfTrainingConfig *NerfTrainingConfig `bson:"nerf_training_config,omitempty" json:"nerf_training_config,omitempty"`
+	// SfmOnly scenes (i.e for camera calibration) complete after SfM, without NeRF training. They have no
+	// NerfTrainingConfig.
+	SfmOnly bool `bson:"sfm_only,omitempty" json:"sfm_only,omitempty"`
 }
 
 // NerfTrainingConfig represents the configuration for NeRF training
@@ -90,6 +390,23 @@ type Nerf struct {
     PointCloudFilePathsMap map[int]string `bson:"point_cloud_file_paths,omitempty" json:"point_cloud_file_paths,omitempty"`
     VideoFilePathsMap      map[int]string `bson:"video_file_paths,omitempty" json:"video_file_paths,omitempty"`
     Flag                   int            `bson:"flag" json:"flag"`
+	// TurntableFramePaths are the local paths of pre-rendered frames orbiting the trained model, in playback order.
+	// Only set if the nerf-worker rendered a turntable preview.
+	TurntableFramePaths []string `bson:"turntable_frame_paths,omitempty" json:"turntable_frame_paths,omitempty"`
+	// LatestIteration is the latest iteration output was saved at. Set by SceneManager.SetNerf, which uses it to
+	// reject stale writes.
+	LatestIteration int `bson:"latest_iteration,omitempty" json:"latest_iteration,omitempty"`
+}
+
+// latestIteration returns the latest iteration any output type was saved at, or 0 if there is no output.
+func (n *Nerf) latestIteration() int {
+	latest := 0
+	for _, paths := range []map[int]string{n.ModelFilePathsMap, n.SplatCloudFilePathsMap, n.PointCloudFilePathsMap, n.VideoFilePathsMap} {
+		for iteration := range paths {
+			latest = max(latest, iteration)
+		}
+	}
+	return latest
 }
 
 // Declarations for valid training modes and output types
@@ -147,6 +464,23 @@ func (n *Nerf) GetFilePathsForType(outputType string) (map[int]string, error) {
 	}
 }
 
+// SavedIterations returns the iterations a given output type was saved at, in ascending order.
+//
+// Returns (nil, ErrInvalidOutputType) if the output type is invalid.
+func (n *Nerf) SavedIterations(outputType string) ([]int, error) {
+	filePathsMap, err := n.GetFilePathsForType(outputType)
+	if err != nil {
+		return nil, err
+	}
+
+	iterations := make([]int, 0, len(filePathsMap))
+	for iteration := range filePathsMap {
+		iterations = append(iterations, iteration)
+	}
+	sort.Ints(iterations)
+	return iterations, nil
+}
+
 // GetFilePathsForTypeAndIter returns the file path for a single given output type and iteration.
 //
 // Iteration is the key in the file paths map, and should be > 0, unless iteration is -1,
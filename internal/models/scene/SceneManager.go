@@ -7,11 +7,17 @@ package scene
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 
 	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
 )
@@ -28,23 +34,125 @@ var (
 	ErrNerfNotFound = errors.New("nerf not found")
 	// ErrTrainingConfigNotFound is returned when a requested training config is not found in the database.
 	ErrTrainingConfigNotFound = errors.New("training config not found")
+	// ErrDuplicateWrite is returned by SetSfm and SetNerf when the output was already recorded, and duplicate writes
+	// are rejected (see DuplicateWritesReject).
+	ErrDuplicateWrite = errors.New("output already recorded for scene")
+	// ErrStaleWrite is returned by SetNerf when output of a later iteration was already recorded, unless duplicate
+	// writes overwrite (see DuplicateWritesOverwrite).
+	ErrStaleWrite = errors.New("output of a later iteration already recorded for scene")
+	// ErrDatabaseUnavailable is returned when the database cannot be reached, i.e the connection was lost mid-request.
+	// The underlying driver error is wrapped, so it can still be logged.
+	ErrDatabaseUnavailable = errors.New("database unavailable")
 )
 
 type SceneManager struct {
-	collection *mongo.Collection
-	logger     *log.Logger
+	collection  *mongo.Collection
+	idempotency *mongo.Collection
+	nameCache   *sceneNameCache
+	// duplicateWrites is the DuplicateWrites policy of SetSfm and SetNerf.
+	duplicateWrites string
+	// operationTimeout bounds operations called without a deadline, see withTimeout.
+	operationTimeout time.Duration
+	logger           *log.Logger
 }
 
-// NewSceneManager creates a new SceneManager with the given MongoDB client and logger.
-func NewSceneManager(client *mongo.Client, logger *log.Logger, unittest bool) *SceneManager {
+// NewSceneManager creates a new SceneManager with the given MongoDB client, configuration, and logger.
+func NewSceneManager(client *mongo.Client, config SceneManagerConfig, logger *log.Logger, unittest bool) *SceneManager {
+	db := client.Database("nerfdb")
 	return &SceneManager{
-		collection: client.Database("nerfdb").Collection("scenes"),
-		logger:     logger,
+		collection:       db.Collection("scenes"),
+		idempotency:      db.Collection("idempotency_keys"),
+		nameCache:        newSceneNameCache(config.NameCacheSize),
+		duplicateWrites:  config.DuplicateWrites,
+		operationTimeout: config.OperationTimeout,
+		logger:           logger,
 	}
 }
 
+// withTimeout returns a copy of ctx bounded by the operation timeout, unless ctx already has a deadline (or the
+// timeout is disabled), in which case ctx is returned as is. The returned cancel function must always be called.
+func (sm *SceneManager) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || sm.operationTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, sm.operationTimeout)
+}
+
+// Ping checks that the database is reachable.
+//
+// Returns ErrDatabaseUnavailable (wrapping the driver error) if it is not, or error if the ping failed otherwise.
+func (sm *SceneManager) Ping(ctx context.Context) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	if err := sm.collection.Database().Client().Ping(ctx, readpref.Primary()); err != nil {
+		return sm.dbError(err)
+	}
+	return nil
+}
+
+// dbError translates driver errors caused by a lost or unreachable database into ErrDatabaseUnavailable,
+// wrapping the original error. All other errors are returned unchanged. Context errors (i.e an exceeded operation
+// timeout) remain detectable with errors.Is.
+func (sm *SceneManager) dbError(err error) error {
+	var selectionErr topology.ServerSelectionError
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.As(err, &selectionErr) {
+		return fmt.Errorf("%w: %w", ErrDatabaseUnavailable, err)
+	}
+	return err
+}
+
+// EnsureIndexes creates the indexes the SceneManager's queries rely on, logging the ones that did not exist yet.
+// Creating an existing index is a no-op, so this is safe to call on every start.
+func (sm *SceneManager) EnsureIndexes(ctx context.Context) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	existing, err := sm.collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return sm.dbError(err)
+	}
+
+	names, err := sm.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Scenes of a user, newest first (scene history, GetScenesByIDs, GetOwnedScenes)
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+		// Scenes of a user by name (scene search, FindSceneByContent)
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}}},
+		// Scenes by name
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+		// Scenes shared with a user (GetScenesSharedWith, IsSharedWith)
+		{Keys: bson.D{{Key: "shared_with", Value: 1}}},
+		// Scenes of a user by uploaded content (FindSceneByContent)
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "video.content_hash", Value: 1}}},
+		// Scenes promoted from a preview (IsPromotionSourceInUse)
+		{Keys: bson.D{{Key: "promoted_from", Value: 1}}, Options: options.Index().SetSparse(true)},
+		// Recently completed scenes (GetRecentCompletionTimes)
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "finished_at", Value: -1}}},
+		// Scenes in the trash (GetTrashedScenes)
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return sm.dbError(err)
+	}
+
+	for _, name := range names {
+		if !slices.ContainsFunc(existing, func(spec *mongo.IndexSpecification) bool { return spec.Name == name }) {
+			sm.logger.Infof("Created scene index %s", name)
+		}
+	}
+	return nil
+}
+
+// NameCacheStats returns a snapshot of the scene name cache counters.
+func (sm *SceneManager) NameCacheStats() CacheStats {
+	return sm.nameCache.Stats()
+}
+
 // SetTrainingConfig sets the TrainingConfig data in the database by the scene ID.
 func (sm *SceneManager) SetTrainingConfig(ctx context.Context, id primitive.ObjectID, config *TrainingConfig) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	result, err := sm.collection.UpdateOne(
 		ctx,
 		bson.M{"_id": id},
@@ -52,7 +160,7 @@ func (sm *SceneManager) SetTrainingConfig(ctx context.Context, id primitive.Obje
 		options.Update().SetUpsert(true),
 	)
 	if err != nil {
-		return err
+		return sm.dbError(err)
 	}
 	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
 		return ErrSceneNotFound
@@ -62,6 +170,9 @@ func (sm *SceneManager) SetTrainingConfig(ctx context.Context, id primitive.Obje
 
 // SetScene sets the Scene data in the database by the scene ID.
 func (sm *SceneManager) SetScene(ctx context.Context, id primitive.ObjectID, scene *Scene) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	result, err := sm.collection.UpdateOne(
 		ctx,
 		bson.M{"_id": id},
@@ -69,16 +180,20 @@ func (sm *SceneManager) SetScene(ctx context.Context, id primitive.ObjectID, sce
 		options.Update().SetUpsert(true),
 	)
 	if err != nil {
-		return err
+		return sm.dbError(err)
 	}
 	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
 		return ErrSceneNotFound
 	}
+	sm.nameCache.Set(id, scene.Name)
 	return nil
 }
 
 // SetVideo sets the Video data in the database by the scene ID.
 func (sm *SceneManager) SetVideo(ctx context.Context, id primitive.ObjectID, vid *Video) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	result, err := sm.collection.UpdateOne(
 		ctx,
 		bson.M{"_id": id},
@@ -86,7 +201,7 @@ func (sm *SceneManager) SetVideo(ctx context.Context, id primitive.ObjectID, vid
 		options.Update().SetUpsert(true),
 	)
 	if err != nil {
-		return err
+		return sm.dbError(err)
 	}
 	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
 		return ErrSceneNotFound
@@ -94,59 +209,215 @@ func (sm *SceneManager) SetVideo(ctx context.Context, id primitive.ObjectID, vid
 	return nil
 }
 
-// SetSfm sets the Sfm data in the database by the scene ID.
-func (sm *SceneManager) SetSfm(ctx context.Context, id primitive.ObjectID, sfm *Sfm) error {
+// UpdateVideo replaces the Video data of an existing scene that is not in the trash. Unlike SetVideo, it never
+// creates the scene.
+//
+// Returns ErrSceneNotFound if the scene does not exist or is in the trash (i.e it was deleted in the meantime).
+func (sm *SceneManager) UpdateVideo(ctx context.Context, id primitive.ObjectID, vid *Video) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	result, err := sm.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": id},
-		bson.M{"$set": bson.M{"sfm": sfm}},
-		options.Update().SetUpsert(true),
+		bson.M{"_id": id, "deleted_at": notInTrash},
+		bson.M{"$set": bson.M{"video": vid}},
 	)
 	if err != nil {
-		return err
+		return sm.dbError(err)
 	}
-	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+	if result.MatchedCount == 0 {
 		return ErrSceneNotFound
 	}
 	return nil
 }
 
-// SetNerf sets the Nerf data in the database by the scene ID.
-func (sm *SceneManager) SetNerf(ctx context.Context, id primitive.ObjectID, nerf *Nerf) error {
+// SetSfm sets the Sfm data in the database by the scene ID. If the scene already has Sfm data, i.e the sfm-worker
+// was retried, the write is handled by the DuplicateWrites policy. The check and the write are a single operation.
+//
+// Returns whether the data was written: false if it was a duplicate and ignored. Returns ErrDuplicateWrite if it was a
+// duplicate and rejected, or ErrSceneNotFound if there is no such scene.
+func (sm *SceneManager) SetSfm(ctx context.Context, id primitive.ObjectID, sfm *Sfm) (bool, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	if sm.duplicateWrites == DuplicateWritesOverwrite {
+		result, err := sm.collection.UpdateOne(
+			ctx,
+			bson.M{"_id": id},
+			bson.M{"$set": bson.M{"sfm": sfm}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return false, sm.dbError(err)
+		}
+		if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+			return false, ErrSceneNotFound
+		}
+		return true, nil
+	}
+
 	result, err := sm.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": id},
-		bson.M{"$set": bson.M{"nerf": nerf}},
-		options.Update().SetUpsert(true),
+		bson.M{"_id": id, "sfm": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"sfm": sfm}},
 	)
 	if err != nil {
-		return err
+		return false, sm.dbError(err)
 	}
-	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
-		return ErrSceneNotFound
+	if result.MatchedCount == 1 {
+		return true, nil
 	}
-	return nil
+
+	count, err := sm.collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, sm.dbError(err)
+	}
+	if count == 0 {
+		return false, ErrSceneNotFound
+	}
+	return sm.duplicateWrite()
+}
+
+// SetNerf sets the Nerf data in the database by the scene ID. Nerf data is ordered by its latest iteration: if the
+// scene already has Nerf data of the same iteration, i.e the nerf-worker was retried, the write is handled by the
+// DuplicateWrites policy, and if it has data of a later iteration, the write is stale. The check and the write are a
+// single operation.
+//
+// Returns whether the data was written: false if it was a duplicate and ignored. Returns ErrDuplicateWrite if it was a
+// duplicate and rejected, ErrStaleWrite if it was stale, or ErrSceneNotFound if there is no such scene. With
+// DuplicateWritesOverwrite, every write is accepted.
+func (sm *SceneManager) SetNerf(ctx context.Context, id primitive.ObjectID, nerf *Nerf) (bool, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	nerf.LatestIteration = nerf.latestIteration()
+
+	if sm.duplicateWrites == DuplicateWritesOverwrite {
+		result, err := sm.collection.UpdateOne(
+			ctx,
+			bson.M{"_id": id},
+			bson.M{"$set": bson.M{"nerf": nerf}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return false, sm.dbError(err)
+		}
+		if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+			return false, ErrSceneNotFound
+		}
+		return true, nil
+	}
+
+	// Nerf data recorded before iterations were tracked is always replaced
+	filter := bson.M{"_id": id, "$or": bson.A{
+		bson.M{"nerf.latest_iteration": bson.M{"$exists": false}},
+		bson.M{"nerf.latest_iteration": bson.M{"$lt": nerf.LatestIteration}},
+	}}
+	result, err := sm.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"nerf": nerf}})
+	if err != nil {
+		return false, sm.dbError(err)
+	}
+	if result.MatchedCount == 1 {
+		return true, nil
+	}
+
+	var recorded struct {
+		Nerf struct {
+			LatestIteration int `bson:"latest_iteration"`
+		} `bson:"nerf"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"nerf.latest_iteration": 1})
+	err = sm.collection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&recorded)
+	if err == mongo.ErrNoDocuments {
+		return false, ErrSceneNotFound
+	}
+	if err != nil {
+		return false, sm.dbError(err)
+	}
+	if recorded.Nerf.LatestIteration > nerf.LatestIteration {
+		return false, fmt.Errorf("%w: iteration %d recorded, got %d", ErrStaleWrite, recorded.Nerf.LatestIteration, nerf.LatestIteration)
+	}
+	return sm.duplicateWrite()
+}
+
+// duplicateWrite returns the result of a write of already recorded output, by the DuplicateWrites policy.
+func (sm *SceneManager) duplicateWrite() (bool, error) {
+	if sm.duplicateWrites == DuplicateWritesReject {
+		return false, ErrDuplicateWrite
+	}
+	return false, nil
 }
 
 // SetSceneName sets the name of the scene in the database by its ID.
+//
+// Returns ErrSceneNotFound if the scene does not exist or is in the trash.
 func (sm *SceneManager) SetSceneName(ctx context.Context, id primitive.ObjectID, name string) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	result, err := sm.collection.UpdateOne(
 		ctx,
-		bson.M{"_id": id},
+		bson.M{"_id": id, "deleted_at": notInTrash},
 		bson.M{"$set": bson.M{"name": name}},
-		options.Update().SetUpsert(true),
 	)
 	if err != nil {
-		return err
+		return sm.dbError(err)
 	}
-	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+	if result.MatchedCount == 0 {
 		return ErrSceneNotFound
 	}
+	sm.nameCache.Set(id, name)
+	return nil
+}
+
+// UpdateScene applies a partial update of the user editable fields of the scene with the given ID, in a single
+// update. Tags are expected to be normalized (lowercase, without duplicates).
+//
+// Returns ErrSceneNotFound if the scene does not exist or is in the trash.
+func (sm *SceneManager) UpdateScene(ctx context.Context, id primitive.ObjectID, update SceneUpdate) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	set := bson.M{}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Description != nil {
+		set["description"] = *update.Description
+	}
+	if update.Tags != nil {
+		set["tags"] = *update.Tags
+	}
+	if update.Favorite != nil {
+		set["favorite"] = *update.Favorite
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	result, err := sm.collection.UpdateOne(ctx, bson.M{"_id": id, "deleted_at": notInTrash}, bson.M{"$set": set})
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	if update.Name != nil {
+		sm.nameCache.Set(id, *update.Name)
+	}
 	return nil
 }
 
 // GetSceneName retrieves the name of the scene from the database by its ID.
+// Names are served from the LRU name cache when possible.
 func (sm *SceneManager) GetSceneName(ctx context.Context, id primitive.ObjectID) (string, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	if name, ok := sm.nameCache.Get(id); ok {
+		return name, nil
+	}
+
 	var result struct {
 		Name string `bson:"name"`
 	}
@@ -155,13 +426,17 @@ func (sm *SceneManager) GetSceneName(ctx context.Context, id primitive.ObjectID)
 		if err == mongo.ErrNoDocuments {
 			return "", ErrSceneNotFound
 		}
-		return "", err
+		return "", sm.dbError(err)
 	}
+	sm.nameCache.Set(id, result.Name)
 	return result.Name, nil
 }
 
 // GetTrainingConfig retrieves the TrainingConfig data from the database by its ID.
 func (sm *SceneManager) GetTrainingConfig(ctx context.Context, id primitive.ObjectID) (*TrainingConfig, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	var result struct {
 		Config *TrainingConfig `bson:"config"`
 	}
@@ -170,7 +445,7 @@ func (sm *SceneManager) GetTrainingConfig(ctx context.Context, id primitive.Obje
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrSceneNotFound
 		}
-		return nil, err
+		return nil, sm.dbError(err)
 	}
 	if result.Config == nil {
 		return nil, ErrTrainingConfigNotFound
@@ -180,19 +455,54 @@ func (sm *SceneManager) GetTrainingConfig(ctx context.Context, id primitive.Obje
 
 // GetScene retrieves the Scene data from the database by its ID.
 func (sm *SceneManager) GetScene(ctx context.Context, id primitive.ObjectID) (*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	var scene Scene
 	err := sm.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&scene)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrSceneNotFound
 		}
-		return nil, err
+		return nil, sm.dbError(err)
+	}
+	return &scene, nil
+}
+
+// GetSceneForUser retrieves the Scene data from the database by its ID, if it is owned by (or shared with) the given
+// user. Scenes among sceneIDs (the user's scene list) are owned by the user, which covers scenes created before
+// owners were recorded. Access is checked in the same query, so there is no gap between checking access and reading
+// the scene. Logs are not retrieved.
+//
+// Returns ErrSceneNotFound if the scene does not exist or the user has no access to it, so the two are
+// indistinguishable to the caller.
+func (sm *SceneManager) GetSceneForUser(ctx context.Context, userID, id primitive.ObjectID, sceneIDs []primitive.ObjectID) (*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":        id,
+		"$or":        append(ownedBy(userID, sceneIDs), bson.M{"shared_with": userID}),
+		"deleted_at": notInTrash,
+	}
+	opts := options.FindOne().SetProjection(bson.M{"logs": 0})
+
+	var scene Scene
+	err := sm.collection.FindOne(ctx, filter, opts).Decode(&scene)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSceneNotFound
+		}
+		return nil, sm.dbError(err)
 	}
 	return &scene, nil
 }
 
 // GetVideo retrieves the Video data from the database by its ID.
 func (sm *SceneManager) GetVideo(ctx context.Context, id primitive.ObjectID) (*Video, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	var result struct {
 		Video *Video `bson:"video"`
 	}
@@ -201,7 +511,7 @@ func (sm *SceneManager) GetVideo(ctx context.Context, id primitive.ObjectID) (*V
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrSceneNotFound
 		}
-		return nil, err
+		return nil, sm.dbError(err)
 	}
 	if result.Video == nil {
 		return nil, ErrVideoNotFound
@@ -211,6 +521,9 @@ func (sm *SceneManager) GetVideo(ctx context.Context, id primitive.ObjectID) (*V
 
 // GetSfm retrieves the Sfm data from the database by its ID.
 func (sm *SceneManager) GetSfm(ctx context.Context, id primitive.ObjectID) (*Sfm, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	var result struct {
 		Sfm *Sfm `bson:"sfm"`
 	}
@@ -219,7 +532,7 @@ func (sm *SceneManager) GetSfm(ctx context.Context, id primitive.ObjectID) (*Sfm
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrSceneNotFound
 		}
-		return nil, err
+		return nil, sm.dbError(err)
 	}
 	if result.Sfm == nil {
 		return nil, ErrSfmNotFound
@@ -229,6 +542,9 @@ func (sm *SceneManager) GetSfm(ctx context.Context, id primitive.ObjectID) (*Sfm
 
 // GetNerf retrieves the Nerf data from the database by its ID.
 func (sm *SceneManager) GetNerf(ctx context.Context, id primitive.ObjectID) (*Nerf, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
 	var result struct {
 		Nerf *Nerf `bson:"nerf"`
 	}
@@ -237,7 +553,7 @@ func (sm *SceneManager) GetNerf(ctx context.Context, id primitive.ObjectID) (*Ne
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrSceneNotFound
 		}
-		return nil, err
+		return nil, sm.dbError(err)
 	}
 	if result.Nerf == nil {
 		return nil, ErrNerfNotFound
@@ -245,14 +561,1005 @@ func (sm *SceneManager) GetNerf(ctx context.Context, id primitive.ObjectID) (*Ne
 	return result.Nerf, nil
 }
 
+// SetSceneThumbnail sets the local path and size of the scene's render-based thumbnail by the scene ID.
+// A nil size clears the stored size.
+func (sm *SceneManager) SetSceneThumbnail(ctx context.Context, id primitive.ObjectID, path string, size *ImageSize) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"thumbnail_path": path, "thumbnail_size": size}}
+	if size == nil {
+		update = bson.M{"$set": bson.M{"thumbnail_path": path}, "$unset": bson.M{"thumbnail_size": ""}}
+	}
+	result, err := sm.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// SetThumbnailSize sets the size of the scene's current thumbnail by the scene ID.
+func (sm *SceneManager) SetThumbnailSize(ctx context.Context, id primitive.ObjectID, size *ImageSize) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	result, err := sm.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"thumbnail_size": size}})
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// RecordOutputDownload counts a download of the output of the given type of the scene, saved at the given iteration,
+// and sets its last accessed time to now.
+func (sm *SceneManager) RecordOutputDownload(ctx context.Context, id primitive.ObjectID, outputType string, iteration int) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	key := fmt.Sprintf("download_stats.%s.%d", outputType, iteration)
+	result, err := sm.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$inc": bson.M{key + ".count": 1},
+			"$max": bson.M{key + ".last_accessed_at": time.Now().UTC()},
+		},
+	)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// GetOutputDownloadStats retrieves the download counts of the outputs of the given type of the scene, by iteration.
+// Iterations that were never downloaded have no entry.
+func (sm *SceneManager) GetOutputDownloadStats(ctx context.Context, id primitive.ObjectID, outputType string) (map[string]*OutputDownloadStats, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.FindOne().SetProjection(bson.M{"download_stats." + outputType: 1})
+
+	var scene Scene
+	err := sm.collection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&scene)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSceneNotFound
+		}
+		return nil, sm.dbError(err)
+	}
+	if scene.DownloadStats[outputType] == nil {
+		return make(map[string]*OutputDownloadStats), nil
+	}
+	return scene.DownloadStats[outputType], nil
+}
+
+// AddSharedUser grants a user read access to the scene by adding them to the scene's shared_with list.
+// Adding a user that already has access is a no-op.
+//
+// Returns ErrSceneNotFound if the scene does not exist or is in the trash.
+func (sm *SceneManager) AddSharedUser(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	result, err := sm.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "deleted_at": notInTrash},
+		bson.M{"$addToSet": bson.M{"shared_with": userID}},
+	)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// RemoveSharedUser revokes a user's read access to the scene by removing them from the scene's shared_with list.
+// Removing a user that does not have access is a no-op.
+//
+// Returns ErrSceneNotFound if the scene does not exist or is in the trash.
+func (sm *SceneManager) RemoveSharedUser(ctx context.Context, id, userID primitive.ObjectID) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	result, err := sm.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id, "deleted_at": notInTrash},
+		bson.M{"$pull": bson.M{"shared_with": userID}},
+	)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// RemoveSharedUserFromAll revokes a user's read access to every scene shared with them, i.e when the user is deleted.
+//
+// Returns the number of scenes the user was removed from.
+func (sm *SceneManager) RemoveSharedUserFromAll(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	result, err := sm.collection.UpdateMany(
+		ctx,
+		bson.M{"shared_with": userID},
+		bson.M{"$pull": bson.M{"shared_with": userID}},
+	)
+	if err != nil {
+		return 0, sm.dbError(err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// IsSharedWith checks if the scene has been shared with the given user.
+func (sm *SceneManager) IsSharedWith(ctx context.Context, id, userID primitive.ObjectID) (bool, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	count, err := sm.collection.CountDocuments(ctx, bson.M{"_id": id, "shared_with": userID, "deleted_at": notInTrash})
+	if err != nil {
+		return false, sm.dbError(err)
+	}
+	return count > 0, nil
+}
+
+// AppendSceneLog appends a single entry to the processing log of the scene by its ID.
+func (sm *SceneManager) AppendSceneLog(ctx context.Context, id primitive.ObjectID, entry LogEntry) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	result, err := sm.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$push": bson.M{"logs": entry}},
+	)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// SetSceneStatus sets the processing status of the scene by its ID.
+// If the status is terminal, the scene's finished_at time is also set.
+func (sm *SceneManager) SetSceneStatus(ctx context.Context, id primitive.ObjectID, status int) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	set := bson.M{"status": status}
+	if IsTerminalStatus(status) {
+		set["finished_at"] = time.Now().UTC()
+	}
+
+	result, err := sm.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// MarkSceneFailed sets the scene status to StatusFailed, records the failure reason, and appends the reason
+// to the scene's processing log.
+func (sm *SceneManager) MarkSceneFailed(ctx context.Context, id primitive.ObjectID, stage, reason string) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now().UTC()
+	result, err := sm.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{
+			"$set": bson.M{
+				"status":      StatusFailed,
+				"finished_at": now,
+				"failure":     Failure{Stage: stage, Reason: reason},
+			},
+			"$push": bson.M{"logs": LogEntry{Time: now, Stage: stage, Level: "error", Message: reason}},
+		},
+	)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// SetStageProgress records the worker reported progress of the scene within the given stage.
+// Progress only moves forward: it is ignored if it is not higher than the progress already recorded for the stage,
+// as workers messages may arrive out of order, or if the scene is no longer in the stage.
+//
+// Returns true if the progress was recorded, false if it was ignored. Returns ErrInvalidStageProgress if stage is
+// unknown or percent is not within 0-100.
+func (sm *SceneManager) SetStageProgress(ctx context.Context, id primitive.ObjectID, stage string, percent float64) (bool, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	status, ok := stageStatuses[stage]
+	if !ok || math.IsNaN(percent) || percent < 0 || percent > 100 {
+		return false, ErrInvalidStageProgress
+	}
+
+	filter := bson.M{
+		"_id":    id,
+		"status": status,
+		"$or": bson.A{
+			bson.M{"stage_progress.stage": bson.M{"$ne": stage}},
+			bson.M{"stage_progress.percent": bson.M{"$lt": percent}},
+		},
+	}
+	progress := StageProgress{Stage: stage, Percent: percent, UpdatedAt: time.Now().UTC()}
+	result, err := sm.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"stage_progress": progress}})
+	if err != nil {
+		return false, sm.dbError(err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// finishedScenesFilter matches the scenes among ids that have nerf output, created within [since, until].
+// Creation time is taken from the scene's ObjectID, so no extra field is needed.
+func finishedScenesFilter(ids []primitive.ObjectID, since, until *time.Time) bson.M {
+	idFilter := bson.M{"$in": ids}
+	if since != nil {
+		idFilter["$gte"] = primitive.NewObjectIDFromTimestamp(*since)
+	}
+	if until != nil {
+		// ObjectIDs only have second precision, so include everything created within until's second.
+		idFilter["$lt"] = primitive.NewObjectIDFromTimestamp(until.Truncate(time.Second).Add(time.Second))
+	}
+	return bson.M{
+		"_id":        idFilter,
+		"nerf":       bson.M{"$exists": true, "$ne": nil},
+		"deleted_at": notInTrash,
+	}
+}
+
+// FilterFinishedScenes returns the IDs among the given scene IDs of scenes that have nerf output.
+// If since or until are non-nil, only scenes created within [since, until] are returned.
+func (sm *SceneManager) FilterFinishedScenes(ctx context.Context, ids []primitive.ObjectID, since, until *time.Time) ([]primitive.ObjectID, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	return sm.findSceneIDs(ctx, finishedScenesFilter(ids, since, until), options.Find())
+}
+
+// GetFinishedScenesPage returns a page of the IDs among the given scene IDs of scenes that have nerf output,
+// oldest first, skipping the first offset and returning at most limit. If since or until are non-nil, only scenes
+// created within [since, until] are included.
+//
+// Also returns the total number of matching scenes, across all pages.
+func (sm *SceneManager) GetFinishedScenesPage(ctx context.Context, ids []primitive.ObjectID, since, until *time.Time, offset, limit int64) ([]primitive.ObjectID, int64, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := finishedScenesFilter(ids, since, until)
+	total, err := sm.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, sm.dbError(err)
+	}
+	if offset >= total {
+		return make([]primitive.ObjectID, 0), total, nil
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetSkip(offset).
+		SetLimit(limit)
+	found, err := sm.findSceneIDs(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return found, total, nil
+}
+
+// findSceneIDs returns the IDs of the scenes matching filter.
+func (sm *SceneManager) findSceneIDs(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]primitive.ObjectID, error) {
+	cursor, err := sm.collection.Find(ctx, filter, opts.SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, sm.dbError(err)
+	}
+
+	found := make([]primitive.ObjectID, 0, len(results))
+	for _, result := range results {
+		found = append(found, result.ID)
+	}
+	return found, nil
+}
+
+// GetProcessingScenes retrieves the ID and status of every scene that has not reached a terminal status,
+// oldest first.
+func (sm *SceneManager) GetProcessingScenes(ctx context.Context) ([]*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"status": bson.M{"$in": []int{StatusSfmProcessing, StatusNerfProcessing}}}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 1, "status": 1}).
+		SetSort(bson.M{"_id": 1})
+
+	cursor, err := sm.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	scenes := make([]*Scene, 0)
+	if err := cursor.All(ctx, &scenes); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return scenes, nil
+}
+
+// GetCleanupCandidates retrieves up to limit scenes that may be deleted to free storage: failed scenes, then
+// completed scenes that finished before finishedBefore, oldest first.
+//
+// Logs are not retrieved.
+func (sm *SceneManager) GetCleanupCandidates(ctx context.Context, finishedBefore time.Time, limit int64) ([]*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": StatusFailed},
+		bson.M{"status": StatusComplete, "finished_at": bson.M{"$lt": finishedBefore}},
+	}}
+	opts := options.Find().
+		SetProjection(bson.M{"logs": 0}).
+		SetSort(bson.D{{Key: "status", Value: -1}, {Key: "finished_at", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := sm.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	scenes := make([]*Scene, 0)
+	if err := cursor.All(ctx, &scenes); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return scenes, nil
+}
+
+// GetScenesSharedWith retrieves the scenes shared with the given user, excluding scenes the user owns, newest first.
+//
+// Only the fields needed to list scenes (name, status, owner, finished_at, tags) are retrieved.
+func (sm *SceneManager) GetScenesSharedWith(ctx context.Context, userID primitive.ObjectID) ([]*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"shared_with": userID,
+		"user_id":     bson.M{"$ne": userID},
+		"deleted_at":  notInTrash,
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"name": 1, "status": 1, "user_id": 1, "finished_at": 1, "tags": 1}).
+		SetSort(bson.M{"_id": -1})
+
+	cursor, err := sm.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	scenes := make([]*Scene, 0)
+	if err := cursor.All(ctx, &scenes); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return scenes, nil
+}
+
+// ownedBy returns the `$or` conditions matching the scenes owned by the given user: those whose owner is the user, and
+// those among the given IDs (the user's scene list, which also covers scenes created before owners were recorded).
+func ownedBy(userID primitive.ObjectID, ids []primitive.ObjectID) bson.A {
+	if ids == nil {
+		// $in requires an array
+		ids = []primitive.ObjectID{}
+	}
+	return bson.A{
+		bson.M{"user_id": userID},
+		bson.M{"_id": bson.M{"$in": ids}},
+	}
+}
+
+// GetOwnedScene retrieves the scene by its ID, if it is owned by the given user: its owner is the user, or it is
+// among the given IDs (the user's scene list, which also covers scenes created before owners were recorded). Unlike
+// GetSceneForUser, scenes in the trash are found. Logs are not retrieved.
+//
+// Returns ErrSceneNotFound if the scene does not exist or the user does not own it.
+func (sm *SceneManager) GetOwnedScene(ctx context.Context, userID, id primitive.ObjectID, ids []primitive.ObjectID) (*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	var scene Scene
+	opts := options.FindOne().SetProjection(bson.M{"logs": 0})
+	err := sm.collection.FindOne(ctx, bson.M{"_id": id, "$or": ownedBy(userID, ids)}, opts).Decode(&scene)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSceneNotFound
+		}
+		return nil, sm.dbError(err)
+	}
+	return &scene, nil
+}
+
+// GetOwnedScenes retrieves the scenes owned by the given user: those whose owner is the user, and those among the
+// given IDs (the user's scene list, which also covers scenes created before owners were recorded).
+//
+// Logs are not retrieved.
+func (sm *SceneManager) GetOwnedScenes(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) ([]*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"$or": ownedBy(userID, ids)}
+	opts := options.Find().SetProjection(bson.M{"logs": 0})
+
+	cursor, err := sm.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	scenes := make([]*Scene, 0)
+	if err := cursor.All(ctx, &scenes); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return scenes, nil
+}
+
+// ForEachUserScene calls fn with each scene owned by the given user (see GetOwnedScenes) that is not in the trash,
+// oldest first. Scenes are read from a cursor, so they are never all held in memory. Only the name, status, tags and
+// video size are retrieved.
+//
+// Iteration lasts as long as fn takes (i.e streaming the scenes to a client), so it is not bounded by the operation
+// timeout. It stops at the first error returned by fn, which is returned.
+func (sm *SceneManager) ForEachUserScene(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID, fn func(*Scene) error) error {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"name": 1, "status": 1, "tags": 1, "video.size": 1})
+
+	cursor, err := sm.collection.Find(ctx, bson.M{"$or": ownedBy(userID, ids), "deleted_at": notInTrash}, opts)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var sc Scene
+		if err := cursor.Decode(&sc); err != nil {
+			return err
+		}
+		if err := fn(&sc); err != nil {
+			return err
+		}
+	}
+	return sm.dbError(cursor.Err())
+}
+
+// GetScenesByIDs retrieves the scenes among the given IDs that are owned by the given user (see GetOwnedScenes, with
+// the user's scene list sceneIDs), in a single query. IDs of scenes that do not exist or are owned by another user
+// are left out.
+func (sm *SceneManager) GetScenesByIDs(ctx context.Context, userID primitive.ObjectID, sceneIDs, ids []primitive.ObjectID) ([]*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":        bson.M{"$in": ids},
+		"$or":        ownedBy(userID, sceneIDs),
+		"deleted_at": notInTrash,
+	}
+	opts := options.Find().SetProjection(bson.M{"logs": 0})
+
+	cursor, err := sm.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	scenes := make([]*Scene, 0)
+	if err := cursor.All(ctx, &scenes); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return scenes, nil
+}
+
+// GetFailedScenes retrieves all failed scenes among the given scene IDs. If since or until are non-nil,
+// only scenes that failed within [since, until] are returned.
+//
+// Only the fields needed for failure reports (name, failure, logs, finished_at) are retrieved.
+func (sm *SceneManager) GetFailedScenes(ctx context.Context, ids []primitive.ObjectID, since, until *time.Time) ([]*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":    bson.M{"$in": ids},
+		"status": StatusFailed,
+	}
+	if since != nil || until != nil {
+		finished := bson.M{}
+		if since != nil {
+			finished["$gte"] = *since
+		}
+		if until != nil {
+			finished["$lte"] = *until
+		}
+		filter["finished_at"] = finished
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"name": 1, "status": 1, "failure": 1, "logs": 1, "finished_at": 1}).
+		SetSort(bson.M{"finished_at": 1})
+
+	cursor, err := sm.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	scenes := make([]*Scene, 0)
+	if err := cursor.All(ctx, &scenes); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return scenes, nil
+}
+
+// CountScenesForUser counts the scenes owned by the given user (see GetOwnedScenes), including scenes still
+// processing or failed, but not scenes in the trash.
+// The counting is done by the database; no scene documents are loaded.
+func (sm *SceneManager) CountScenesForUser(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	count, err := sm.collection.CountDocuments(ctx, bson.M{"$or": ownedBy(userID, ids), "deleted_at": notInTrash})
+	if err != nil {
+		return 0, sm.dbError(err)
+	}
+	return count, nil
+}
+
+// CountScenesByStatus counts all scenes in the database, grouped by status.
+// The counting is done by the database; no scene documents are loaded.
+func (sm *SceneManager) CountScenesByStatus(ctx context.Context) (map[int]int64, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	return sm.countByStatus(ctx, bson.M{})
+}
+
+// CountScenesFinishedSince counts scenes that reached a terminal status at or after the given time, grouped by status.
+func (sm *SceneManager) CountScenesFinishedSince(ctx context.Context, since time.Time) (map[int]int64, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	return sm.countByStatus(ctx, bson.M{"finished_at": bson.M{"$gte": since}})
+}
+
+// CountScenesFinishedPerBucket counts scenes that reached a terminal status in each of the given number of
+// consecutive, equally sized time buckets, the first starting at start. Counts are grouped by status.
+//
+// Returns a slice with the counts of each bucket, in order.
+func (sm *SceneManager) CountScenesFinishedPerBucket(ctx context.Context, start time.Time, size time.Duration, buckets int) ([]map[int]int64, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	end := start.Add(time.Duration(buckets) * size)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"finished_at": bson.M{"$gte": start, "$lt": end}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				// Milliseconds since start, divided by the bucket size
+				"bucket": bson.M{"$floor": bson.M{"$divide": bson.A{
+					bson.M{"$subtract": bson.A{"$finished_at", start}},
+					size.Milliseconds(),
+				}}},
+				"status": "$status",
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := sm.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		ID struct {
+			Bucket int `bson:"bucket"`
+			Status int `bson:"status"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, sm.dbError(err)
+	}
+
+	counts := make([]map[int]int64, buckets)
+	for i := range counts {
+		counts[i] = make(map[int]int64)
+	}
+	for _, result := range results {
+		if result.ID.Bucket >= 0 && result.ID.Bucket < buckets {
+			counts[result.ID.Bucket][result.ID.Status] += result.Count
+		}
+	}
+	return counts, nil
+}
+
+// GetRecentCompletionTimes retrieves the times the most recently completed scenes finished, newest first.
+// Returns at most limit times.
+func (sm *SceneManager) GetRecentCompletionTimes(ctx context.Context, limit int64) ([]time.Time, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"status": StatusComplete, "finished_at": bson.M{"$exists": true}}
+	opts := options.Find().
+		SetProjection(bson.M{"finished_at": 1}).
+		SetSort(bson.M{"finished_at": -1}).
+		SetLimit(limit)
+
+	cursor, err := sm.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		FinishedAt time.Time `bson:"finished_at"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, sm.dbError(err)
+	}
+
+	times := make([]time.Time, 0, len(results))
+	for _, result := range results {
+		times = append(times, result.FinishedAt)
+	}
+	return times, nil
+}
+
+// GetRecentCompletedScenes returns the last limit completed scenes, most recently finished first. Only their nerf
+// and sfm outputs are loaded.
+func (sm *SceneManager) GetRecentCompletedScenes(ctx context.Context, limit int64) ([]*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"status": StatusComplete, "finished_at": bson.M{"$exists": true}}
+	opts := options.Find().
+		SetProjection(bson.M{"nerf": 1, "sfm": 1}).
+		SetSort(bson.M{"finished_at": -1}).
+		SetLimit(limit)
+
+	cursor, err := sm.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var scenes []*Scene
+	if err := cursor.All(ctx, &scenes); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return scenes, nil
+}
+
+// countByStatus runs an aggregation counting the scenes matching filter, grouped by status.
+func (sm *SceneManager) countByStatus(ctx context.Context, filter bson.M) (map[int]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	}
+
+	cursor, err := sm.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Status int   `bson:"_id"`
+		Count  int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, sm.dbError(err)
+	}
+
+	counts := make(map[int]int64, len(results))
+	for _, result := range results {
+		counts[result.Status] = result.Count
+	}
+	return counts, nil
+}
+
+// GetUserTagCounts returns the distinct tags used across all scenes owned by the user (see GetOwnedScenes), with the
+// number of scenes each tag is used on. Results are sorted by descending count, then alphabetically.
+func (sm *SceneManager) GetUserTagCounts(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) ([]TagCount, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": ownedBy(userID, ids), "deleted_at": notInTrash}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	cursor, err := sm.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	tags := make([]TagCount, 0)
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return tags, nil
+}
+
+// CompactScenes compacts all scenes that reached a terminal status before the given time, and have not been
+// compacted yet. Compaction replaces the full processing log with a LogSummary, keeping only the keepLogs most
+// recent entries. Outputs, failure reasons, and all other fields are preserved.
+//
+// The compaction is done by the database in a single update. Returns the number of scenes compacted.
+func (sm *SceneManager) CompactScenes(ctx context.Context, finishedBefore time.Time, keepLogs int) (int64, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"status":      bson.M{"$in": []int{StatusComplete, StatusFailed}},
+		"finished_at": bson.M{"$lt": finishedBefore},
+		"compacted":   bson.M{"$ne": true},
+	}
+
+	logs := bson.M{"$ifNull": []interface{}{"$logs", bson.A{}}}
+	var keptLogs interface{} = bson.A{}
+	if keepLogs > 0 {
+		keptLogs = bson.M{"$slice": []interface{}{logs, -keepLogs}}
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"log_summary": bson.M{
+				"entries": bson.M{"$size": logs},
+				"errors": bson.M{"$size": bson.M{"$filter": bson.M{
+					"input": logs,
+					"cond":  bson.M{"$eq": []interface{}{"$$this.level", "error"}},
+				}}},
+				"first_at": bson.M{"$arrayElemAt": []interface{}{"$logs.time", 0}},
+				"last_at":  bson.M{"$arrayElemAt": []interface{}{"$logs.time", -1}},
+			},
+			"logs":      keptLogs,
+			"compacted": true,
+		}}},
+	}
+
+	result, err := sm.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, sm.dbError(err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// FindSceneByContent returns the ID of the user's most recent scene with the given name, created from a video with
+// the given content hash, that is SfM only if sfmOnly is set, or trained otherwise. Failed scenes are not considered,
+// so identical content can be reprocessed after a failure.
+//
+// Returns ErrSceneNotFound if there is no such scene.
+func (sm *SceneManager) FindSceneByContent(ctx context.Context, userID primitive.ObjectID, name, contentHash string, sfmOnly bool) (primitive.ObjectID, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"user_id":            userID,
+		"name":               name,
+		"video.content_hash": contentHash,
+		"status":             bson.M{"$ne": StatusFailed},
+		"config.sfm_only":    bson.M{"$ne": true},
+		"deleted_at":         notInTrash,
+	}
+	if sfmOnly {
+		filter["config.sfm_only"] = true
+	}
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetProjection(bson.M{"_id": 1})
+
+	var result struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := sm.collection.FindOne(ctx, filter, opts).Decode(&result)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return primitive.NilObjectID, ErrSceneNotFound
+		}
+		return primitive.NilObjectID, sm.dbError(err)
+	}
+	return result.ID, nil
+}
+
+// IsPromotionSourceInUse checks if the files of the given scene may still be used, either by the scene itself or by
+// a scene promoted from it.
+func (sm *SceneManager) IsPromotionSourceInUse(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"_id": id},
+		bson.M{"promoted_from": id},
+	}}
+	count, err := sm.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, sm.dbError(err)
+	}
+	return count > 0, nil
+}
+
 // DeleteScene deletes a scene from the database by its ID.
 func (sm *SceneManager) DeleteScene(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	sm.nameCache.Invalidate(id)
 	result, err := sm.collection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
-		return err
+		return sm.dbError(err)
 	}
 	if result.DeletedCount == 0 {
 		return ErrSceneNotFound
 	}
 	return nil
 }
+
+// notInTrash matches the deleted_at field of scenes that are not in the trash. Queries listing a user's scenes, or
+// giving access to them, leave out scenes in the trash.
+var notInTrash = bson.M{"$exists": false}
+
+// SoftDeleteScene moves a scene of the given owner to the trash, by setting its deleted_at time. The scene document
+// and its files are kept, so it can be restored with RestoreScene until it is purged. The owner is recorded on the
+// scene, as scenes in the trash are removed from their owner's scene list, which is the only link to the owner of
+// scenes created before owners were recorded.
+//
+// Returns ErrSceneNotFound if there is no such scene, or it is already in the trash.
+func (sm *SceneManager) SoftDeleteScene(ctx context.Context, id, ownerID primitive.ObjectID) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	result, err := sm.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "deleted_at": notInTrash},
+		bson.M{"$set": bson.M{"deleted_at": time.Now().UTC(), "user_id": ownerID}},
+	)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotFound
+	}
+	return nil
+}
+
+// RestoreScene takes a scene out of the trash, if it was deleted at or after deletedSince (i.e within the trash
+// retention).
+//
+// Returns ErrSceneNotInTrash if the scene is not in the trash, or was deleted before deletedSince.
+func (sm *SceneManager) RestoreScene(ctx context.Context, id primitive.ObjectID, deletedSince time.Time) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	result, err := sm.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "deleted_at": bson.M{"$gte": deletedSince}},
+		bson.M{"$unset": bson.M{"deleted_at": ""}},
+	)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSceneNotInTrash
+	}
+	return nil
+}
+
+// GetTrashedScenes retrieves at most limit scenes that were moved to the trash before deletedBefore, oldest deletion
+// first.
+func (sm *SceneManager) GetTrashedScenes(ctx context.Context, deletedBefore time.Time, limit int64) ([]*Scene, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().
+		SetProjection(bson.M{"logs": 0}).
+		SetSort(bson.M{"deleted_at": 1}).
+		SetLimit(limit)
+	cursor, err := sm.collection.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": deletedBefore}}, opts)
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	defer cursor.Close(ctx)
+
+	scenes := make([]*Scene, 0)
+	if err := cursor.All(ctx, &scenes); err != nil {
+		return nil, sm.dbError(err)
+	}
+	return scenes, nil
+}
+
+// DeleteScenes deletes the scenes with the given IDs from the database in a single operation. IDs without a scene
+// are ignored.
+//
+// Returns the number of scenes deleted.
+func (sm *SceneManager) DeleteScenes(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	for _, id := range ids {
+		sm.nameCache.Invalidate(id)
+	}
+	result, err := sm.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, sm.dbError(err)
+	}
+	return result.DeletedCount, nil
+}
+
+// DeleteQueuedScene deletes a scene from the database by its ID, if it is still waiting for SfM. The check and
+// the deletion are a single operation, so a scene cannot start processing in between.
+//
+// Returns ErrInvalidOpOnProcessingScene if the scene has moved past the SfM queue, or ErrSceneNotFound if there is
+// no such scene.
+func (sm *SceneManager) DeleteQueuedScene(ctx context.Context, id primitive.ObjectID) error {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":    id,
+		"status": StatusSfmProcessing,
+		"sfm":    bson.M{"$exists": false},
+	}
+	result, err := sm.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if result.DeletedCount == 1 {
+		sm.nameCache.Invalidate(id)
+		return nil
+	}
+
+	count, err := sm.collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return sm.dbError(err)
+	}
+	if count == 0 {
+		return ErrSceneNotFound
+	}
+	return ErrInvalidOpOnProcessingScene
+}
@@ -0,0 +1,40 @@
+// This file contains the SceneManagerConfig struct, which holds the tunable settings of a SceneManager.
+// Values are expected to be populated by the caller (usually from environment variables in main), falling back
+// to DefaultSceneManagerConfig for anything not provided.
+
+package scene
+
+import "time"
+
+// SceneManagerConfig holds the tunable settings of a SceneManager.
+type SceneManagerConfig struct {
+	// NameCacheSize is the maximum number of scene names kept in the in-memory LRU cache. 0 disables the cache.
+	NameCacheSize int
+	// DuplicateWrites is how SetSfm and SetNerf handle a write of output already recorded for a scene, i.e sent
+	// again by a retried worker: DuplicateWritesOverwrite, DuplicateWritesIgnore or DuplicateWritesReject. Unknown
+	// policies ignore duplicate writes.
+	DuplicateWrites string
+	// OperationTimeout bounds each database operation called with a context without a deadline (i.e
+	// context.TODO()), so a hung database does not block callers forever. Operations called with a deadline keep
+	// it. 0 disables the timeout.
+	OperationTimeout time.Duration
+}
+
+// Policies for writes of output already recorded for a scene. See SceneManagerConfig.DuplicateWrites.
+const (
+	// DuplicateWritesOverwrite replaces the recorded output with every write, the last write wins.
+	DuplicateWritesOverwrite = "overwrite"
+	// DuplicateWritesIgnore keeps the recorded output, and ignores duplicate writes.
+	DuplicateWritesIgnore = "ignore"
+	// DuplicateWritesReject keeps the recorded output, and rejects duplicate writes with ErrDuplicateWrite.
+	DuplicateWritesReject = "reject"
+)
+
+// DefaultSceneManagerConfig returns the default SceneManager configuration.
+func DefaultSceneManagerConfig() SceneManagerConfig {
+	return SceneManagerConfig{
+		NameCacheSize:    10000,
+		DuplicateWrites:  DuplicateWritesIgnore,
+		OperationTimeout: 10 * time.Second,
+	}
+}
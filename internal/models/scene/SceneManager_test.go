@@ -0,0 +1,379 @@
+package scene
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// newTestSceneManager returns a SceneManager on the mocked client, handling duplicate writes by the given policy.
+func newTestSceneManager(mt *mtest.T, duplicateWrites string) *SceneManager {
+	config := DefaultSceneManagerConfig()
+	config.DuplicateWrites = duplicateWrites
+	return NewSceneManager(mt.Client, config, &log.Logger{SugaredLogger: zap.NewNop().Sugar()}, true)
+}
+
+// updateResponse returns a mocked update command response, matching n documents and modifying nModified.
+func updateResponse(n, nModified int) bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: n}, {Key: "nModified", Value: nModified}}
+}
+
+// countResponse returns a mocked CountDocuments response counting n documents.
+func countResponse(n int) bson.D {
+	if n == 0 {
+		return mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch)
+	}
+	return mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{{Key: "_id", Value: 1}, {Key: "n", Value: n}})
+}
+
+// nerfResponse returns a mocked FindOne response of a scene with nerf output recorded at the given iteration.
+func nerfResponse(id primitive.ObjectID, iteration int) bson.D {
+	return mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: id},
+		{Key: "nerf", Value: bson.D{{Key: "latest_iteration", Value: iteration}}},
+	})
+}
+
+// nerfAt returns nerf output saved at the given iteration.
+func nerfAt(iteration int) *Nerf {
+	return &Nerf{SplatCloudFilePathsMap: map[int]string{iteration: "splat.ply"}}
+}
+
+func TestSetSfm(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	id := primitive.NewObjectID()
+
+	mt.Run("first write", func(mt *mtest.T) {
+		mt.AddMockResponses(updateResponse(1, 1))
+		written, err := newTestSceneManager(mt, DuplicateWritesReject).SetSfm(context.Background(), id, &Sfm{})
+		if err != nil || !written {
+			mt.Fatalf("SetSfm() = %v, %v, want written", written, err)
+		}
+
+		// Only scenes without sfm data are written
+		filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if _, err := filter.LookupErr("sfm", "$exists"); err != nil {
+			mt.Errorf("filter %v does not skip scenes with sfm data", filter)
+		}
+	})
+
+	tests := []struct {
+		policy  string
+		written bool
+		err     error
+	}{
+		{DuplicateWritesIgnore, false, nil},
+		{DuplicateWritesReject, false, ErrDuplicateWrite},
+	}
+	for _, tt := range tests {
+		mt.Run("duplicate "+tt.policy, func(mt *mtest.T) {
+			mt.AddMockResponses(updateResponse(0, 0), countResponse(1))
+			written, err := newTestSceneManager(mt, tt.policy).SetSfm(context.Background(), id, &Sfm{})
+			if written != tt.written || !errors.Is(err, tt.err) {
+				mt.Errorf("SetSfm() = %v, %v, want %v, %v", written, err, tt.written, tt.err)
+			}
+		})
+	}
+
+	mt.Run("duplicate overwrite", func(mt *mtest.T) {
+		mt.AddMockResponses(updateResponse(1, 1))
+		written, err := newTestSceneManager(mt, DuplicateWritesOverwrite).SetSfm(context.Background(), id, &Sfm{})
+		if err != nil || !written {
+			mt.Errorf("SetSfm() = %v, %v, want written", written, err)
+		}
+	})
+
+	mt.Run("scene not found", func(mt *mtest.T) {
+		mt.AddMockResponses(updateResponse(0, 0), countResponse(0))
+		_, err := newTestSceneManager(mt, DuplicateWritesIgnore).SetSfm(context.Background(), id, &Sfm{})
+		if !errors.Is(err, ErrSceneNotFound) {
+			mt.Errorf("SetSfm() = %v, want ErrSceneNotFound", err)
+		}
+	})
+}
+
+func TestSetNerf(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	id := primitive.NewObjectID()
+
+	mt.Run("later iteration", func(mt *mtest.T) {
+		mt.AddMockResponses(updateResponse(1, 1))
+		nerf := nerfAt(30000)
+		written, err := newTestSceneManager(mt, DuplicateWritesReject).SetNerf(context.Background(), id, nerf)
+		if err != nil || !written {
+			mt.Fatalf("SetNerf() = %v, %v, want written", written, err)
+		}
+		if nerf.LatestIteration != 30000 {
+			mt.Errorf("LatestIteration = %d, want 30000", nerf.LatestIteration)
+		}
+	})
+
+	mt.Run("stale", func(mt *mtest.T) {
+		mt.AddMockResponses(updateResponse(0, 0), nerfResponse(id, 30000))
+		written, err := newTestSceneManager(mt, DuplicateWritesIgnore).SetNerf(context.Background(), id, nerfAt(7000))
+		if written || !errors.Is(err, ErrStaleWrite) {
+			mt.Errorf("SetNerf() = %v, %v, want ErrStaleWrite", written, err)
+		}
+	})
+
+	tests := []struct {
+		policy  string
+		written bool
+		err     error
+	}{
+		{DuplicateWritesIgnore, false, nil},
+		{DuplicateWritesReject, false, ErrDuplicateWrite},
+	}
+	for _, tt := range tests {
+		mt.Run("duplicate "+tt.policy, func(mt *mtest.T) {
+			mt.AddMockResponses(updateResponse(0, 0), nerfResponse(id, 30000))
+			written, err := newTestSceneManager(mt, tt.policy).SetNerf(context.Background(), id, nerfAt(30000))
+			if written != tt.written || !errors.Is(err, tt.err) {
+				mt.Errorf("SetNerf() = %v, %v, want %v, %v", written, err, tt.written, tt.err)
+			}
+		})
+	}
+
+	mt.Run("scene not found", func(mt *mtest.T) {
+		mt.AddMockResponses(updateResponse(0, 0), mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch))
+		_, err := newTestSceneManager(mt, DuplicateWritesIgnore).SetNerf(context.Background(), id, nerfAt(30000))
+		if !errors.Is(err, ErrSceneNotFound) {
+			mt.Errorf("SetNerf() = %v, want ErrSceneNotFound", err)
+		}
+	})
+}
+
+func TestSetStageProgress(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	id := primitive.NewObjectID()
+
+	mt.Run("higher progress", func(mt *mtest.T) {
+		mt.AddMockResponses(updateResponse(1, 1))
+		recorded, err := newTestSceneManager(mt, DuplicateWritesIgnore).SetStageProgress(context.Background(), id, StageNerf, 40)
+		if err != nil || !recorded {
+			mt.Fatalf("SetStageProgress() = %v, %v, want recorded", recorded, err)
+		}
+
+		// Only scenes in the stage, with lower progress for it, are written
+		filter := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+		if status := filter.Lookup("status").AsInt64(); status != StatusNerfProcessing {
+			mt.Errorf("filter matches status %d, want %d", status, StatusNerfProcessing)
+		}
+		conditions, err := filter.Lookup("$or").Array().Values()
+		if err != nil || len(conditions) != 2 {
+			mt.Fatalf("filter %v does not match lower progress", filter)
+		}
+		if percent := conditions[1].Document().Lookup("stage_progress.percent", "$lt").Double(); percent != 40 {
+			mt.Errorf("filter matches progress below %v, want 40", percent)
+		}
+	})
+
+	mt.Run("lower or equal progress", func(mt *mtest.T) {
+		// Out of order messages do not match the filter, so nothing is modified
+		mt.AddMockResponses(updateResponse(0, 0))
+		recorded, err := newTestSceneManager(mt, DuplicateWritesIgnore).SetStageProgress(context.Background(), id, StageSfm, 10)
+		if err != nil || recorded {
+			mt.Errorf("SetStageProgress() = %v, %v, want ignored", recorded, err)
+		}
+	})
+
+	for name, tt := range map[string]struct {
+		stage   string
+		percent float64
+	}{
+		"unknown stage":    {"render", 50},
+		"negative percent": {StageSfm, -1},
+		"percent over 100": {StageNerf, 101},
+	} {
+		mt.Run(name, func(mt *mtest.T) {
+			// No mocked response: the database must not be written
+			_, err := newTestSceneManager(mt, DuplicateWritesIgnore).SetStageProgress(context.Background(), id, tt.stage, tt.percent)
+			if !errors.Is(err, ErrInvalidStageProgress) {
+				mt.Errorf("SetStageProgress() = %v, want ErrInvalidStageProgress", err)
+			}
+		})
+	}
+}
+
+func TestCurrentStageProgress(t *testing.T) {
+	progress := &StageProgress{Stage: StageSfm, Percent: 50}
+
+	tests := []struct {
+		name   string
+		scene  Scene
+		wanted bool
+	}{
+		{"in the stage", Scene{Status: StatusSfmProcessing, StageProgress: progress}, true},
+		{"moved to the next stage", Scene{Status: StatusNerfProcessing, StageProgress: progress}, false},
+		{"complete", Scene{Status: StatusComplete, StageProgress: progress}, false},
+		{"no progress reported", Scene{Status: StatusSfmProcessing}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scene.CurrentStageProgress(); (got != nil) != tt.wanted {
+				t.Errorf("CurrentStageProgress() = %v, want progress: %v", got, tt.wanted)
+			}
+		})
+	}
+}
+
+func TestTrashedScenesAreReadOnly(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	id, userID := primitive.NewObjectID(), primitive.NewObjectID()
+	name := "garden"
+
+	writes := map[string]func(sm *SceneManager) error{
+		"UpdateScene": func(sm *SceneManager) error {
+			return sm.UpdateScene(context.Background(), id, SceneUpdate{Name: &name})
+		},
+		"SetSceneName": func(sm *SceneManager) error {
+			return sm.SetSceneName(context.Background(), id, name)
+		},
+		"AddSharedUser": func(sm *SceneManager) error {
+			return sm.AddSharedUser(context.Background(), id, userID)
+		},
+		"RemoveSharedUser": func(sm *SceneManager) error {
+			return sm.RemoveSharedUser(context.Background(), id, userID)
+		},
+	}
+	for method, write := range writes {
+		mt.Run(method, func(mt *mtest.T) {
+			// A scene in the trash is not matched, as if it did not exist
+			mt.AddMockResponses(updateResponse(0, 0))
+			if err := write(newTestSceneManager(mt, DuplicateWritesReject)); !errors.Is(err, ErrSceneNotFound) {
+				mt.Fatalf("%s() = %v, want ErrSceneNotFound", method, err)
+			}
+
+			update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+			if _, err := update.LookupErr("q", "deleted_at"); err != nil {
+				mt.Errorf("%s filter %s does not exclude scenes in the trash", method, update.Lookup("q"))
+			}
+			if upsert, ok := update.Lookup("upsert").BooleanOK(); ok && upsert {
+				mt.Errorf("%s creates missing scenes", method)
+			}
+		})
+	}
+}
+
+func TestSoftDeleteSceneRecordsOwner(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	id, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("owner", func(mt *mtest.T) {
+		mt.AddMockResponses(updateResponse(1, 1))
+		if err := newTestSceneManager(mt, DuplicateWritesReject).SoftDeleteScene(context.Background(), id, ownerID); err != nil {
+			mt.Fatalf("SoftDeleteScene: %v", err)
+		}
+
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if got := update.Lookup("u", "$set", "user_id").ObjectID(); got != ownerID {
+			mt.Errorf("recorded owner %s, want %s", got.Hex(), ownerID.Hex())
+		}
+	})
+}
+
+func TestGetSceneForUser(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID, id := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("in the user's scene list", func(mt *mtest.T) {
+		// Scenes created before owners were recorded have no user_id, and are owned through the user's scene list
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{{Key: "_id", Value: id}}))
+		sc, err := newTestSceneManager(mt, DuplicateWritesReject).GetSceneForUser(context.Background(), userID, id, []primitive.ObjectID{id})
+		if err != nil || sc.ID != id {
+			mt.Fatalf("GetSceneForUser() = %v, %v, want the scene", sc, err)
+		}
+
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		ids, err := filter.LookupErr("$or", "1", "_id", "$in")
+		if err != nil {
+			mt.Fatalf("filter %s does not match the user's scene list", filter)
+		}
+		if values, _ := ids.Array().Values(); len(values) != 1 || values[0].ObjectID() != id {
+			mt.Errorf("filter matches scenes %s, want the user's scene list", ids)
+		}
+		if _, err := filter.LookupErr("deleted_at"); err != nil {
+			mt.Errorf("filter %s does not exclude scenes in the trash", filter)
+		}
+	})
+
+	mt.Run("another user's scene", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch))
+		if _, err := newTestSceneManager(mt, DuplicateWritesReject).GetSceneForUser(context.Background(), userID, id, nil); !errors.Is(err, ErrSceneNotFound) {
+			mt.Fatalf("GetSceneForUser() = %v, want ErrSceneNotFound", err)
+		}
+
+		// Users without scenes still get a valid query
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if _, err := filter.Lookup("$or", "1", "_id", "$in").Array().Values(); err != nil {
+			mt.Errorf("filter %s does not match an empty scene list: %v", filter, err)
+		}
+	})
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("creates indexes", func(mt *mtest.T) {
+		core, logs := observer.New(zap.InfoLevel)
+		sm := newTestSceneManager(mt, DuplicateWritesReject)
+		sm.logger = &log.Logger{SugaredLogger: zap.New(core).Sugar()}
+
+		// The owner index already exists, the others are new
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch,
+				bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "name", Value: "_id_"}},
+				bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}}, {Key: "name", Value: "user_id_1__id_-1"}},
+			),
+			bson.D{{Key: "ok", Value: 1}},
+		)
+		if err := sm.EnsureIndexes(context.Background()); err != nil {
+			mt.Fatalf("EnsureIndexes: %v", err)
+		}
+
+		event := mt.GetAllStartedEvents()[1]
+		if event.CommandName != "createIndexes" {
+			mt.Fatalf("second command is %s, want createIndexes", event.CommandName)
+		}
+		indexes, err := event.Command.Lookup("indexes").Array().Values()
+		if err != nil {
+			mt.Fatal(err)
+		}
+		created := map[string]bool{}
+		for _, index := range indexes {
+			created[index.Document().Lookup("name").StringValue()] = true
+		}
+		for _, name := range []string{"user_id_1__id_-1", "shared_with_1", "deleted_at_1", "status_1_finished_at_-1"} {
+			if !created[name] {
+				mt.Errorf("index %s was not created, got %v", name, created)
+			}
+		}
+
+		logged := map[string]bool{}
+		for _, entry := range logs.FilterMessageSnippet("Created scene index").All() {
+			logged[strings.TrimPrefix(entry.Message, "Created scene index ")] = true
+		}
+		if logged["user_id_1__id_-1"] {
+			mt.Error("existing index was logged as created")
+		}
+		if len(logged) != len(indexes)-1 || !logged["shared_with_1"] {
+			mt.Errorf("logged %v as created, want the %d new indexes", logged, len(indexes)-1)
+		}
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		if err := newTestSceneManager(mt, DuplicateWritesReject).EnsureIndexes(context.Background()); err == nil {
+			mt.Fatal("EnsureIndexes succeeded, want the database error")
+		}
+	})
+}
@@ -0,0 +1,116 @@
+// This file contains the sceneNameCache implementation, a bounded LRU cache used by SceneManager to avoid a database
+// round trip every time a scene's name is requested. The cache holds at most `capacity` entries, evicting the least
+// recently used entry once full. Hit, miss and eviction counters are kept so cache effectiveness can be monitored.
+//
+// The cache is safe for concurrent use.
+
+package scene
+
+import (
+	"container/list"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CacheStats is a snapshot of a cache's counters.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+}
+
+// sceneNameEntry is a single entry in the sceneNameCache.
+type sceneNameEntry struct {
+	id   primitive.ObjectID
+	name string
+}
+
+// sceneNameCache is a bounded LRU cache of scene ID to scene name.
+// A capacity <= 0 disables the cache; every lookup is then a miss and nothing is stored.
+type sceneNameCache struct {
+	mu        sync.Mutex
+	capacity  int
+	order     *list.List
+	entries   map[primitive.ObjectID]*list.Element
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// newSceneNameCache creates a new sceneNameCache holding at most capacity entries.
+func newSceneNameCache(capacity int) *sceneNameCache {
+	return &sceneNameCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[primitive.ObjectID]*list.Element),
+	}
+}
+
+// Get returns the cached name for the scene, and whether it was found.
+// A found entry is marked as most recently used.
+func (c *sceneNameCache) Get(id primitive.ObjectID) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		c.misses++
+		return "", false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*sceneNameEntry).name, true
+}
+
+// Set stores the name for the scene, evicting the least recently used entry if the cache is full.
+func (c *sceneNameCache) Set(id primitive.ObjectID, name string) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[id]; ok {
+		elem.Value.(*sceneNameEntry).name = name
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	for c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*sceneNameEntry).id)
+		c.evictions++
+	}
+
+	c.entries[id] = c.order.PushFront(&sceneNameEntry{id: id, name: name})
+}
+
+// Invalidate removes the scene from the cache, if present.
+func (c *sceneNameCache) Invalidate(id primitive.ObjectID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[id]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *sceneNameCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.order.Len(),
+		Capacity:  c.capacity,
+	}
+}
@@ -0,0 +1,99 @@
+package scene
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newIDs returns n new scene IDs.
+func newIDs(n int) []primitive.ObjectID {
+	ids := make([]primitive.ObjectID, n)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+	}
+	return ids
+}
+
+func TestSceneNameCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newSceneNameCache(2)
+	ids := newIDs(4)
+
+	c.Set(ids[0], "a")
+	c.Set(ids[1], "b")
+	c.Set(ids[2], "c") // Evicts a, the oldest
+	if _, ok := c.Get(ids[0]); ok {
+		t.Error("oldest entry was not evicted")
+	}
+
+	// Getting b makes c the least recently used, so it is evicted next
+	if name, ok := c.Get(ids[1]); !ok || name != "b" {
+		t.Fatalf("Get(b) = %q, %v, want b", name, ok)
+	}
+	c.Set(ids[3], "d")
+	if _, ok := c.Get(ids[2]); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for i, want := range map[int]string{1: "b", 3: "d"} {
+		if name, ok := c.Get(ids[i]); !ok || name != want {
+			t.Errorf("Get(%s) = %q, %v, want %s", want, name, ok, want)
+		}
+	}
+
+	want := CacheStats{Hits: 3, Misses: 2, Evictions: 2, Size: 2, Capacity: 2}
+	if stats := c.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestSceneNameCacheSetUpdatesEntry(t *testing.T) {
+	c := newSceneNameCache(2)
+	ids := newIDs(3)
+
+	c.Set(ids[0], "a")
+	c.Set(ids[1], "b")
+	c.Set(ids[0], "renamed") // Updates a, making b the least recently used
+	c.Set(ids[2], "c")
+
+	if name, ok := c.Get(ids[0]); !ok || name != "renamed" {
+		t.Errorf("Get(a) = %q, %v, want renamed", name, ok)
+	}
+	if _, ok := c.Get(ids[1]); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Size != 2 {
+		t.Errorf("Stats() = %+v, want 1 eviction and 2 entries", stats)
+	}
+}
+
+func TestSceneNameCacheInvalidate(t *testing.T) {
+	c := newSceneNameCache(2)
+	ids := newIDs(2)
+
+	c.Set(ids[0], "a")
+	c.Set(ids[1], "b")
+	c.Invalidate(ids[0])
+	c.Invalidate(primitive.NewObjectID()) // Not cached, ignored
+
+	if _, ok := c.Get(ids[0]); ok {
+		t.Error("invalidated entry still cached")
+	}
+	want := CacheStats{Hits: 0, Misses: 1, Evictions: 0, Size: 1, Capacity: 2}
+	if stats := c.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestSceneNameCacheDisabled(t *testing.T) {
+	c := newSceneNameCache(0)
+	id := primitive.NewObjectID()
+
+	c.Set(id, "a")
+	if _, ok := c.Get(id); ok {
+		t.Error("disabled cache stored an entry")
+	}
+	want := CacheStats{Misses: 1}
+	if stats := c.Stats(); stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,156 @@
+// This file contains the scene document repair logic. After schema changes or partial writes, scene documents
+// may be missing fields that the rest of the server expects. RepairScene inspects the raw document, fills any
+// missing fields with their defaults, and reports what was (or, on a dry run, would be) repaired.
+//
+// Only fields that have a sensible default are repaired. Fields that cannot be recovered (i.e a missing video
+// path) are left untouched.
+
+package scene
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Defaults for scene fields that are not provided by the user.
+const (
+	DefaultSceneName       = "Untitled Scene"
+	DefaultTrainingMode    = TrainingModeGaussian
+	DefaultTotalIterations = 30000
+)
+
+var (
+	DefaultOutputTypes    = []string{"video"}
+	DefaultSaveIterations = []int{1000, 7000, 30000}
+)
+
+// RepairReport describes the repairs made to a single scene document.
+type RepairReport struct {
+	SceneID string `json:"scene_id"`
+	DryRun  bool   `json:"dry_run"`
+	// Repaired maps the path of each repaired field to the default it was set to.
+	Repaired map[string]interface{} `json:"repaired"`
+	// Error is set when the scene could not be repaired. Only used in batch repairs.
+	Error string `json:"error,omitempty"`
+}
+
+// RepairScene fills missing fields of the scene document with their defaults. If owner is not the zero ID,
+// it is used to repair a missing user_id. If dryRun is true, the repairs are only reported, not written.
+//
+// Returns ErrSceneNotFound if the scene does not exist.
+func (sm *SceneManager) RepairScene(ctx context.Context, id, owner primitive.ObjectID, dryRun bool) (*RepairReport, error) {
+	ctx, cancel := sm.withTimeout(ctx)
+	defer cancel()
+
+	var doc bson.M
+	err := sm.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSceneNotFound
+		}
+		return nil, sm.dbError(err)
+	}
+
+	repairs := sceneRepairs(doc, owner)
+	report := &RepairReport{
+		SceneID:  id.Hex(),
+		DryRun:   dryRun,
+		Repaired: repairs,
+	}
+	if dryRun || len(repairs) == 0 {
+		return report, nil
+	}
+
+	result, err := sm.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M(repairs)})
+	if err != nil {
+		return nil, sm.dbError(err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrSceneNotFound
+	}
+	sm.nameCache.Invalidate(id)
+	return report, nil
+}
+
+// sceneRepairs returns the dotted field paths missing from doc, mapped to their defaults.
+func sceneRepairs(doc bson.M, owner primitive.ObjectID) map[string]interface{} {
+	repairs := make(map[string]interface{})
+
+	if name, ok := doc["name"].(string); !ok || name == "" {
+		repairs["name"] = DefaultSceneName
+	}
+	if _, ok := doc["status"]; !ok {
+		repairs["status"] = inferStatus(doc)
+	}
+	if _, ok := doc["user_id"]; !ok && !owner.IsZero() {
+		repairs["user_id"] = owner
+	}
+
+	config, ok := subdocument(doc["config"])
+	if !ok {
+		repairs["config.nerf_training_config"] = defaultNerfTrainingConfig()
+	} else if nerfConfig, ok := subdocument(config["nerf_training_config"]); !ok {
+		// SfM only scenes have no nerf training config
+		if sfmOnly, _ := config["sfm_only"].(bool); !sfmOnly {
+			repairs["config.nerf_training_config"] = defaultNerfTrainingConfig()
+		}
+	} else {
+		prefix := "config.nerf_training_config."
+		if mode, ok := nerfConfig["training_mode"].(string); !ok || mode == "" {
+			repairs[prefix+"training_mode"] = DefaultTrainingMode
+		}
+		if nerfConfig["output_types"] == nil {
+			repairs[prefix+"output_types"] = DefaultOutputTypes
+		}
+		if nerfConfig["save_iterations"] == nil {
+			repairs[prefix+"save_iterations"] = DefaultSaveIterations
+		}
+		if _, ok := nerfConfig["total_iterations"]; !ok {
+			repairs[prefix+"total_iterations"] = DefaultTotalIterations
+		}
+	}
+
+	if nerf, ok := subdocument(doc["nerf"]); ok {
+		if _, ok := nerf["flag"]; !ok {
+			repairs["nerf.flag"] = 0
+		}
+	}
+
+	return repairs
+}
+
+// inferStatus guesses the status of a scene without one from how far through the pipeline its data goes.
+func inferStatus(doc bson.M) int {
+	if _, ok := doc["nerf"]; ok {
+		return StatusComplete
+	}
+	if _, ok := doc["sfm"]; ok {
+		return StatusNerfProcessing
+	}
+	return StatusSfmProcessing
+}
+
+// subdocument returns v as a bson.M if it is an embedded document.
+func subdocument(v interface{}) (bson.M, bool) {
+	switch d := v.(type) {
+	case bson.M:
+		return d, true
+	case bson.D:
+		return d.Map(), true
+	default:
+		return nil, false
+	}
+}
+
+// defaultNerfTrainingConfig returns the NerfTrainingConfig used when a scene has none.
+func defaultNerfTrainingConfig() *NerfTrainingConfig {
+	return &NerfTrainingConfig{
+		TrainingMode:    DefaultTrainingMode,
+		OutputTypes:     DefaultOutputTypes,
+		SaveIterations:  DefaultSaveIterations,
+		TotalIterations: DefaultTotalIterations,
+	}
+}
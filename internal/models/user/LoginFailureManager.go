@@ -0,0 +1,117 @@
+// This file contains the LoginFailureManager implementation, which is responsible for interacting with the MongoDB
+// login_failures collection. It counts consecutive failed logins per username, and the lockout they triggered, so
+// lockouts hold across restarts and across web server instances.
+//
+// Failures are stored by username, whether or not the account exists, so a lockout does not reveal which usernames
+// are registered. Records are removed by MongoDB once their failures are forgotten and their lockout has ended.
+
+package user
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// LoginFailures is the stored failed logins of a username.
+type LoginFailures struct {
+	Username string `bson:"_id"`
+	// Count is the number of consecutive failures since the last lockout.
+	Count       int       `bson:"count"`
+	LastFailure time.Time `bson:"last_failure"`
+	// LockedUntil is when the username's lockout ends. Zero if it was never locked.
+	LockedUntil time.Time `bson:"locked_until,omitempty"`
+	// ExpiresAt is when the record is removed: once failures are forgotten and the lockout has ended.
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+type LoginFailureManager struct {
+	collection *mongo.Collection
+	logger     *log.Logger
+}
+
+// NewLoginFailureManager creates a new instance of LoginFailureManager.
+func NewLoginFailureManager(client *mongo.Client, logger *log.Logger, unittest bool) *LoginFailureManager {
+	return &LoginFailureManager{
+		collection: client.Database("nerfdb").Collection("login_failures"),
+		logger:     logger,
+	}
+}
+
+// EnsureIndexes creates the indexes the LoginFailureManager relies on. Creating an existing index is a no-op,
+// so this is safe to call on every start.
+func (lfm *LoginFailureManager) EnsureIndexes(ctx context.Context) error {
+	_, err := lfm.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		// Forgotten failures are removed by MongoDB
+		Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// LockedUntil returns when the username's lockout ends, or the zero time if it is not locked.
+func (lfm *LoginFailureManager) LockedUntil(ctx context.Context, username string) (time.Time, error) {
+	var record LoginFailures
+	err := lfm.collection.FindOne(ctx, bson.M{"_id": username}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !time.Now().Before(record.LockedUntil) {
+		return time.Time{}, nil
+	}
+	return record.LockedUntil, nil
+}
+
+// RecordFailure records a failed login for the username. Failures are consecutive while they are less than window
+// apart; once threshold consecutive failures are recorded, the count is reset and the username is locked for
+// lockFor. The update is atomic, so concurrent failures are all counted.
+//
+// Returns when the lockout triggered by this failure ends, or the zero time if it did not trigger one.
+func (lfm *LoginFailureManager) RecordFailure(ctx context.Context, username string, threshold int, window, lockFor time.Duration) (time.Time, error) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	lockedUntil := now.Add(lockFor)
+	forgetAt := now.Add(window)
+
+	locking := bson.M{"$gte": bson.A{"$count", threshold}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			// A missing last_failure compares lower than any date, so a new record starts at 1
+			"count": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$last_failure", now.Add(-window)}},
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$count", 0}}, 1}},
+				1,
+			}},
+			"last_failure": now,
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"locked_until": bson.M{"$cond": bson.A{locking, lockedUntil, "$locked_until"}},
+			"count":        bson.M{"$cond": bson.A{locking, 0, "$count"}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"expires_at": bson.M{"$max": bson.A{forgetAt, bson.M{"$ifNull": bson.A{"$locked_until", forgetAt}}}},
+		}}},
+	}
+
+	var record LoginFailures
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	if err := lfm.collection.FindOneAndUpdate(ctx, bson.M{"_id": username}, update, opts).Decode(&record); err != nil {
+		return time.Time{}, err
+	}
+	if !record.LockedUntil.Equal(lockedUntil) {
+		return time.Time{}, nil
+	}
+	return record.LockedUntil, nil
+}
+
+// ResetFailures forgets the failed logins of the username, i.e after a successful login.
+func (lfm *LoginFailureManager) ResetFailures(ctx context.Context, username string) error {
+	_, err := lfm.collection.DeleteOne(ctx, bson.M{"_id": username})
+	return err
+}
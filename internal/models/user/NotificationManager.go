@@ -0,0 +1,139 @@
+// This file contains the NotificationManager implementation, which is responsible for interacting with the MongoDB
+// notifications collection. It holds each user's notification inbox: the scenes of the user that completed,
+// failed, or were deleted to free storage, for clients that can not receive webhooks.
+//
+// Notifications stay unread until the user marks them read. Read notifications are kept for a while, and are then
+// removed by MongoDB.
+
+package user
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// Notification types.
+const (
+	NotificationSceneCompleted = "scene_completed"
+	NotificationSceneFailed    = "scene_failed"
+	NotificationSceneEvicted   = "scene_evicted"
+)
+
+// Notification is a notification of a user's inbox, about one of their scenes.
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"-"`
+	Type      string             `bson:"type" json:"type"`
+	SceneID   primitive.ObjectID `bson:"scene_id" json:"scene_id"`
+	SceneName string             `bson:"scene_name,omitempty" json:"scene_name,omitempty"`
+	// Message describes the notification, i.e the failure reason of a failed scene.
+	Message   string    `bson:"message,omitempty" json:"message,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	// ReadAt is when the user marked the notification read. Nil while it is unread.
+	ReadAt *time.Time `bson:"read_at,omitempty" json:"read_at,omitempty"`
+	// ExpiresAt is when a read notification is removed. Nil while it is unread.
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"-"`
+}
+
+type NotificationManager struct {
+	collection *mongo.Collection
+	logger     *log.Logger
+}
+
+// NewNotificationManager creates a new instance of NotificationManager.
+func NewNotificationManager(client *mongo.Client, logger *log.Logger, unittest bool) *NotificationManager {
+	return &NotificationManager{
+		collection: client.Database("nerfdb").Collection("notifications"),
+		logger:     logger,
+	}
+}
+
+// EnsureIndexes creates the indexes the NotificationManager relies on. Creating an existing index is a no-op,
+// so this is safe to call on every start.
+func (nm *NotificationManager) EnsureIndexes(ctx context.Context) error {
+	_, err := nm.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Inboxes are listed newest first
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+		// A scene is only notified of once per type, see AddNotification
+		{Keys: bson.D{{Key: "scene_id", Value: 1}, {Key: "type", Value: 1}}, Options: options.Index().SetUnique(true)},
+		// Read notifications are removed by MongoDB once they expire
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// AddNotification adds the notification to its user's inbox, unread. A scene is only notified of once per type, so
+// notifying again (i.e for a redelivered worker result) is a no-op.
+func (nm *NotificationManager) AddNotification(ctx context.Context, notification *Notification) error {
+	_, err := nm.collection.UpdateOne(ctx,
+		bson.M{"scene_id": notification.SceneID, "type": notification.Type},
+		bson.M{"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"user_id":    notification.UserID,
+			"scene_name": notification.SceneName,
+			"message":    notification.Message,
+			"created_at": time.Now().UTC(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent notification of the same scene was inserted first
+		return nil
+	}
+	return err
+}
+
+// GetUnreadNotifications returns at most limit unread notifications of the user, newest first.
+func (nm *NotificationManager) GetUnreadNotifications(ctx context.Context, userID primitive.ObjectID, limit int64) ([]*Notification, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+	cursor, err := nm.collection.Find(ctx, bson.M{"user_id": userID, "read_at": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	notifications := make([]*Notification, 0)
+	if err := cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// MarkNotificationsRead marks the given unread notifications of the user read, or all of them if ids is empty.
+// Read notifications are removed after keepFor. Notifications of other users are not affected.
+//
+// Returns the number of notifications marked read.
+func (nm *NotificationManager) MarkNotificationsRead(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID, keepFor time.Duration) (int64, error) {
+	filter := bson.M{"user_id": userID, "read_at": bson.M{"$exists": false}}
+	if len(ids) > 0 {
+		filter["_id"] = bson.M{"$in": ids}
+	}
+
+	now := time.Now().UTC()
+	result, err := nm.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{
+		"read_at":    now,
+		"expires_at": now.Add(keepFor),
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// DeleteUserNotifications deletes all notifications of the user.
+//
+// Returns the number of notifications deleted.
+func (nm *NotificationManager) DeleteUserNotifications(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := nm.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,208 @@
+// This file contains the PasswordHasher interface and its bcrypt and argon2id implementations.
+// The algorithm used for new passwords is selected via configuration (see NewPasswordHasher).
+//
+// Every encoded hash is prefixed with its algorithm identifier ("$2a$"/"$2b$" for bcrypt, "$argon2id$" for argon2id),
+// so a stored password can always be verified with VerifyPassword, regardless of which algorithm created it.
+// This allows deployments to switch algorithms without invalidating existing accounts; old hashes are
+// upgraded to the configured algorithm on the user's next successful login.
+
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrIncorrectPassword is returned when a password does not match the stored hash.
+	ErrIncorrectPassword = errors.New("incorrect password")
+	// ErrUnknownHashAlgorithm is returned when a hash algorithm is not supported.
+	ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+	// ErrMalformedHash is returned when a stored hash cannot be decoded.
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// Supported password hash algorithms.
+const (
+	HashAlgorithmBcrypt   = "bcrypt"
+	HashAlgorithmArgon2id = "argon2id"
+)
+
+// PasswordHasher hashes and verifies passwords with a single algorithm.
+type PasswordHasher interface {
+	// Name returns the algorithm identifier used in configuration.
+	Name() string
+	// Hash returns the encoded, algorithm-prefixed hash of the password.
+	Hash(password string) (string, error)
+	// Matches checks if the encoded hash was produced by this algorithm.
+	Matches(encoded string) bool
+	// Verify checks the password against the encoded hash. Returns nil on success, ErrIncorrectPassword on mismatch.
+	Verify(encoded, password string) error
+}
+
+// NewPasswordHasher returns the PasswordHasher for the given algorithm name, using default parameters.
+//
+// Returns ErrUnknownHashAlgorithm if the algorithm is not supported.
+func NewPasswordHasher(algorithm string) (PasswordHasher, error) {
+	switch algorithm {
+	case HashAlgorithmBcrypt, "":
+		return NewBcryptHasher(), nil
+	case HashAlgorithmArgon2id:
+		return NewArgon2idHasher(), nil
+	default:
+		return nil, ErrUnknownHashAlgorithm
+	}
+}
+
+// VerifyPassword checks the password against an encoded hash produced by any supported algorithm.
+//
+// Returns nil on success, ErrIncorrectPassword on mismatch, or ErrUnknownHashAlgorithm if no algorithm recognizes the hash.
+func VerifyPassword(encoded, password string) error {
+	for _, hasher := range []PasswordHasher{NewBcryptHasher(), NewArgon2idHasher()} {
+		if hasher.Matches(encoded) {
+			return hasher.Verify(encoded, password)
+		}
+	}
+	return ErrUnknownHashAlgorithm
+}
+
+// BcryptHasher is a PasswordHasher using bcrypt.
+type BcryptHasher struct {
+	Cost int
+}
+
+// NewBcryptHasher creates a BcryptHasher with the default bcrypt cost.
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost}
+}
+
+// Name returns "bcrypt".
+func (h *BcryptHasher) Name() string {
+	return HashAlgorithmBcrypt
+}
+
+// Hash hashes the password with bcrypt. Bcrypt hashes are inherently prefixed with "$2a$".
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Matches checks for any of the bcrypt version prefixes.
+func (h *BcryptHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Verify checks the password against a bcrypt hash.
+func (h *BcryptHasher) Verify(encoded, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrIncorrectPassword
+	}
+	return err
+}
+
+// Argon2idHasher is a PasswordHasher using argon2id. Hashes are encoded in the PHC string format:
+//
+//	$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<base64 salt>$<base64 key>
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// NewArgon2idHasher creates an Argon2idHasher with the parameters recommended by RFC 9106 for memory constrained environments.
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+}
+
+// Name returns "argon2id".
+func (h *Argon2idHasher) Name() string {
+	return HashAlgorithmArgon2id
+}
+
+// Hash hashes the password with argon2id and a random salt.
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Matches checks for the "$argon2id$" prefix.
+func (h *Argon2idHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// Bounds of the argon2id parameters accepted from stored hashes. argon2.IDKey panics on a zero time or thread count,
+// and allocates the memory parameter as is, so a corrupted or forged hash could otherwise crash or exhaust the server.
+const (
+	argon2MaxMemory = 1024 * 1024 // KiB
+	argon2MaxTime   = 64
+)
+
+// Verify checks the password against an argon2id hash. The parameters stored in the hash are used,
+// so hashes created with different parameters still verify, as long as they are within the argon2 bounds.
+// Hashes with parameters out of bounds, or an empty salt or key, are rejected with ErrMalformedHash.
+func (h *Argon2idHasher) Verify(encoded, password string) error {
+	parts := strings.Split(encoded, "$")
+	// ["", "argon2id", "v=19", "m=..,t=..,p=..", salt, key]
+	if len(parts) != 6 {
+		return ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return ErrMalformedHash
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return ErrMalformedHash
+	}
+	if time == 0 || time > argon2MaxTime || threads == 0 || memory == 0 || memory > argon2MaxMemory {
+		return ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return ErrMalformedHash
+	}
+	if len(salt) == 0 || len(key) == 0 {
+		return ErrMalformedHash
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
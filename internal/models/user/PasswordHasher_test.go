@@ -0,0 +1,102 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHashers returns hashers with cheap parameters, so the tests run quickly.
+func testHashers() []PasswordHasher {
+	return []PasswordHasher{
+		&BcryptHasher{Cost: bcrypt.MinCost},
+		&Argon2idHasher{Time: 1, Memory: 64, Threads: 1, KeyLen: 16, SaltLen: 8},
+	}
+}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	for _, hasher := range testHashers() {
+		t.Run(hasher.Name(), func(t *testing.T) {
+			encoded, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasher.Matches(encoded) {
+				t.Errorf("Matches(%q) = false, want true", encoded)
+			}
+			if err := hasher.Verify(encoded, "correct horse"); err != nil {
+				t.Errorf("Verify() = %v, want nil", err)
+			}
+			if err := hasher.Verify(encoded, "wrong horse"); !errors.Is(err, ErrIncorrectPassword) {
+				t.Errorf("Verify() = %v, want ErrIncorrectPassword", err)
+			}
+
+			// Hashes verify whichever algorithm is configured
+			if err := VerifyPassword(encoded, "correct horse"); err != nil {
+				t.Errorf("VerifyPassword() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	for algorithm, want := range map[string]string{"": HashAlgorithmBcrypt, "bcrypt": HashAlgorithmBcrypt, "argon2id": HashAlgorithmArgon2id} {
+		hasher, err := NewPasswordHasher(algorithm)
+		if err != nil {
+			t.Fatalf("NewPasswordHasher(%q) = %v", algorithm, err)
+		}
+		if hasher.Name() != want {
+			t.Errorf("NewPasswordHasher(%q).Name() = %q, want %q", algorithm, hasher.Name(), want)
+		}
+	}
+	if _, err := NewPasswordHasher("md5"); !errors.Is(err, ErrUnknownHashAlgorithm) {
+		t.Errorf("NewPasswordHasher(md5) = %v, want ErrUnknownHashAlgorithm", err)
+	}
+	if err := VerifyPassword("$md5$abc", "password"); !errors.Is(err, ErrUnknownHashAlgorithm) {
+		t.Errorf("VerifyPassword() = %v, want ErrUnknownHashAlgorithm", err)
+	}
+}
+
+func TestArgon2idVerifyRejectsMalformedHashes(t *testing.T) {
+	hasher := NewArgon2idHasher()
+	const salt, key = "c2FsdHNhbHQ", "a2V5a2V5a2V5a2V5"
+
+	tests := map[string]string{
+		"missing part":      "$argon2id$v=19$m=64,t=1,p=1$" + salt,
+		"wrong version":     "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key,
+		"zero time":         "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key,
+		"time too high":     "$argon2id$v=19$m=64,t=65,p=1$" + salt + "$" + key,
+		"zero threads":      "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key,
+		"zero memory":       "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key,
+		"memory too high":   "$argon2id$v=19$m=4194304,t=1,p=1$" + salt + "$" + key,
+		"empty salt":        "$argon2id$v=19$m=64,t=1,p=1$$" + key,
+		"empty key":         "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$",
+		"invalid base64":    "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!!!",
+		"invalid parameter": "$argon2id$v=19$m=x,t=1,p=1$" + salt + "$" + key,
+	}
+	for name, encoded := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := hasher.Verify(encoded, "password"); !errors.Is(err, ErrMalformedHash) {
+				t.Errorf("Verify(%q) = %v, want ErrMalformedHash", encoded, err)
+			}
+		})
+	}
+}
+
+func TestArgon2idVerifyUsesStoredParameters(t *testing.T) {
+	old := &Argon2idHasher{Time: 2, Memory: 32, Threads: 2, KeyLen: 24, SaltLen: 12}
+	encoded, err := old.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(encoded, "m=32,t=2,p=2") {
+		t.Fatalf("hash %q does not hold its parameters", encoded)
+	}
+
+	// A hasher configured differently still verifies the hash
+	if err := NewArgon2idHasher().Verify(encoded, "password"); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,90 @@
+// This file contains the password strength policy new passwords (at registration, or when changing a password) must
+// meet. Existing passwords are never checked against it, so tightening the policy does not lock anyone out.
+
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrWeakPassword is matched (with errors.Is) by WeakPasswordError.
+var ErrWeakPassword = errors.New("password is too weak")
+
+// maxPasswordBytes is the longest accepted password. bcrypt only uses the first 72 bytes of a password.
+const maxPasswordBytes = 72
+
+// PasswordPolicy is the strength required of new passwords.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+	// MinCharacterClasses is the minimum number of character classes (lowercase letters, uppercase letters, digits
+	// and other characters) used.
+	MinCharacterClasses int
+}
+
+// DefaultPasswordPolicy returns the default PasswordPolicy.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:           8,
+		MinCharacterClasses: 2,
+	}
+}
+
+// WeakPasswordError is returned when a password does not meet the PasswordPolicy. It lists every unmet requirement.
+type WeakPasswordError struct {
+	// Failed describes the unmet requirements, i.e "must be at least 8 characters".
+	Failed []string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrWeakPassword.Error(), strings.Join(e.Failed, "; "))
+}
+
+// Unwrap allows matching the error with errors.Is(err, ErrWeakPassword).
+func (e *WeakPasswordError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Check checks that password meets the policy.
+//
+// Returns nil if it does, or a *WeakPasswordError listing every unmet requirement.
+func (p PasswordPolicy) Check(password string) error {
+	var failed []string
+	if len([]rune(password)) < p.MinLength {
+		failed = append(failed, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if len(password) > maxPasswordBytes {
+		failed = append(failed, fmt.Sprintf("must be at most %d bytes", maxPasswordBytes))
+	}
+
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, used := range []bool{lower, upper, digit, other} {
+		if used {
+			classes++
+		}
+	}
+	if classes < p.MinCharacterClasses {
+		failed = append(failed, fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinCharacterClasses))
+	}
+
+	if len(failed) > 0 {
+		return &WeakPasswordError{Failed: failed}
+	}
+	return nil
+}
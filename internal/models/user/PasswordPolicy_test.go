@@ -0,0 +1,59 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+
+	tests := []struct {
+		name     string
+		password string
+		failed   int
+	}{
+		{"long with two classes", "password1", 0},
+		{"all classes", "Pa55w0rd!", 0},
+		{"unicode letters count as characters", "pässwörd1", 0},
+		{"too short", "pass1", 1},
+		{"single class", "passwordpassword", 1},
+		{"too short and single class", "pass", 2},
+		{"longer than bcrypt uses", "password1" + strings.Repeat("a", maxPasswordBytes), 1},
+		{"empty", "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password)
+			if tt.failed == 0 {
+				if err != nil {
+					t.Fatalf("Check() = %v, want nil", err)
+				}
+				return
+			}
+
+			var weakErr *WeakPasswordError
+			if !errors.As(err, &weakErr) {
+				t.Fatalf("Check() = %v, want a *WeakPasswordError", err)
+			}
+			if !errors.Is(err, ErrWeakPassword) {
+				t.Error("error does not match ErrWeakPassword")
+			}
+			if len(weakErr.Failed) != tt.failed {
+				t.Errorf("got %d unmet requirements %q, want %d", len(weakErr.Failed), weakErr.Failed, tt.failed)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyCheckCustom(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 12, MinCharacterClasses: 4}
+
+	if err := policy.Check("Password123!"); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+	if err := policy.Check("Password1234"); !errors.Is(err, ErrWeakPassword) {
+		t.Errorf("Check() = %v, want ErrWeakPassword for a missing symbol", err)
+	}
+}
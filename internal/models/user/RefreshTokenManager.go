@@ -0,0 +1,270 @@
+// This file contains the RefreshTokenManager implementation, which is responsible for interacting with the MongoDB
+// refresh_tokens collection. Refresh tokens are long-lived, opaque tokens used to obtain new (short-lived) access tokens.
+//
+// Tokens are stored server-side so they can be revoked. Only a SHA-256 hash of each token is stored, so a database
+// leak does not leak usable tokens. Tokens are rotated: using a token consumes it and issues a new one in the same
+// family. Using an already consumed token means it was leaked (or replayed), so the whole family is revoked.
+//
+// A family is a session (i.e a device the user logged in on): the family ID is the session ID, and the unused token
+// of a family carries the session's details. Revoking a session revokes its family.
+
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned when a refresh token is unknown, expired or revoked.
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already used refresh token is used again. Its family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+	// ErrSessionNotFound is returned when a session does not exist, has ended, or belongs to another user.
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// refreshTokenBytes is the number of random bytes in a refresh token.
+const refreshTokenBytes = 32
+
+// RefreshToken is a stored refresh token. The token itself is never stored, only its hash.
+type RefreshToken struct {
+	Hash   string             `bson:"_id"`
+	UserID primitive.ObjectID `bson:"user_id"`
+	// FamilyID is shared by all tokens rotated from the same login.
+	FamilyID primitive.ObjectID `bson:"family_id"`
+	// TokenVersion is the user's token version when the family was issued. See UserManager.RevokeTokens.
+	TokenVersion int       `bson:"token_version"`
+	CreatedAt    time.Time `bson:"created_at"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+	// Used is set once the token has been exchanged for a new one.
+	Used    bool `bson:"used"`
+	Revoked bool `bson:"revoked"`
+
+	// Device is a label for the device the family was issued to, copied to each rotated token.
+	Device string `bson:"device,omitempty"`
+	// SessionStartedAt is when the family was issued (the login), copied to each rotated token.
+	SessionStartedAt time.Time `bson:"session_started_at,omitempty"`
+}
+
+// Session is an active login of a user, i.e a refresh token family with an unused, unexpired token.
+type Session struct {
+	ID     primitive.ObjectID `json:"id"`
+	Device string             `json:"device,omitempty"`
+	// IssuedAt is when the user logged in.
+	IssuedAt time.Time `json:"issued_at"`
+	// LastUsedAt is when the session last obtained a token, at login or refresh.
+	LastUsedAt time.Time `json:"last_used_at"`
+	// ExpiresAt is when the session ends unless it is refreshed.
+	ExpiresAt time.Time `json:"expires_at"`
+	// Current is set by the caller for the session making the request.
+	Current bool `json:"current"`
+}
+
+type RefreshTokenManager struct {
+	collection *mongo.Collection
+	logger     *log.Logger
+}
+
+// NewRefreshTokenManager creates a new instance of RefreshTokenManager.
+func NewRefreshTokenManager(client *mongo.Client, logger *log.Logger, unittest bool) *RefreshTokenManager {
+	return &RefreshTokenManager{
+		collection: client.Database("nerfdb").Collection("refresh_tokens"),
+		logger:     logger,
+	}
+}
+
+// EnsureIndexes creates the indexes the RefreshTokenManager relies on. Creating an existing index is a no-op,
+// so this is safe to call on every start.
+func (rtm *RefreshTokenManager) EnsureIndexes(ctx context.Context) error {
+	_, err := rtm.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Expired tokens are removed by MongoDB
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		// Revoking a family (RevokeFamily)
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		// Listing the sessions of a user (Sessions)
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "used", Value: 1}}},
+	})
+	return err
+}
+
+// hashRefreshToken returns the hash a refresh token is stored under.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue creates a refresh token for the user, valid for ttl, starting a new family (session) on the given device.
+// tokenVersion is the user's current token version.
+//
+// Returns the token, which is only available at this point, and the ID of the new family.
+func (rtm *RefreshTokenManager) Issue(ctx context.Context, userID primitive.ObjectID, tokenVersion int, device string, ttl time.Duration) (string, primitive.ObjectID, error) {
+	familyID := primitive.NewObjectID()
+	token, err := rtm.issue(ctx, &RefreshToken{
+		UserID:           userID,
+		FamilyID:         familyID,
+		TokenVersion:     tokenVersion,
+		Device:           device,
+		SessionStartedAt: time.Now().UTC(),
+	}, ttl)
+	return token, familyID, err
+}
+
+// issue creates a refresh token in the family of the given record, copying its session details.
+func (rtm *RefreshTokenManager) issue(ctx context.Context, family *RefreshToken, ttl time.Duration) (string, error) {
+	raw := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	_, err := rtm.collection.InsertOne(ctx, &RefreshToken{
+		Hash:             hashRefreshToken(token),
+		UserID:           family.UserID,
+		FamilyID:         family.FamilyID,
+		TokenVersion:     family.TokenVersion,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(ttl),
+		Device:           family.Device,
+		SessionStartedAt: family.SessionStartedAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Rotate consumes the given refresh token, and issues a new one in the same family, valid for ttl.
+// Consuming is atomic, so a token can only be rotated once.
+//
+// Returns the consumed token's record and the new token. Returns ErrRefreshTokenInvalid if the token is unknown,
+// expired or revoked, or ErrRefreshTokenReused if it was already used, in which case its family is revoked.
+func (rtm *RefreshTokenManager) Rotate(ctx context.Context, token string, ttl time.Duration) (*RefreshToken, string, error) {
+	hash := hashRefreshToken(token)
+	now := time.Now().UTC()
+
+	var record RefreshToken
+	err := rtm.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": hash, "used": false, "revoked": false, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"used": true}},
+	).Decode(&record)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, "", err
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, "", rtm.rejected(ctx, hash, now)
+	}
+
+	newToken, err := rtm.issue(ctx, &record, ttl)
+	if err != nil {
+		return nil, "", err
+	}
+	return &record, newToken, nil
+}
+
+// rejected determines why the token with the given hash could not be rotated. Reuse of a consumed token revokes
+// its family, as either the legitimate client or an attacker holds a token that was rotated away from them.
+func (rtm *RefreshTokenManager) rejected(ctx context.Context, hash string, now time.Time) error {
+	var record RefreshToken
+	err := rtm.collection.FindOne(ctx, bson.M{"_id": hash}).Decode(&record)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrRefreshTokenInvalid
+		}
+		return err
+	}
+	if record.Revoked || !record.ExpiresAt.After(now) {
+		return ErrRefreshTokenInvalid
+	}
+
+	rtm.logger.Infof("Refresh token reused, revoking family %s of user %s", record.FamilyID.Hex(), record.UserID.Hex())
+	if err := rtm.RevokeFamily(ctx, record.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// RevokeFamily revokes all refresh tokens of the given family.
+func (rtm *RefreshTokenManager) RevokeFamily(ctx context.Context, familyID primitive.ObjectID) error {
+	_, err := rtm.collection.UpdateMany(ctx, bson.M{"family_id": familyID}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+// DeleteUserTokens deletes all refresh tokens of the user, ending all of their sessions, i.e when the user is deleted.
+//
+// Returns the number of tokens deleted.
+func (rtm *RefreshTokenManager) DeleteUserTokens(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := rtm.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// Sessions returns the active sessions of the user, most recently used first. A session is active while its family
+// has an unused, unexpired and unrevoked token.
+func (rtm *RefreshTokenManager) Sessions(ctx context.Context, userID primitive.ObjectID) ([]Session, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := rtm.collection.Find(ctx, rtm.activeFilter(userID), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []RefreshToken
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(records))
+	for _, record := range records {
+		// Tokens issued before sessions were tracked do not know when their session started
+		issuedAt := record.SessionStartedAt
+		if issuedAt.IsZero() {
+			issuedAt = record.CreatedAt
+		}
+		sessions = append(sessions, Session{
+			ID:         record.FamilyID,
+			Device:     record.Device,
+			IssuedAt:   issuedAt,
+			LastUsedAt: record.CreatedAt,
+			ExpiresAt:  record.ExpiresAt,
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes the family of the user's active session with the given ID.
+//
+// Returns ErrSessionNotFound if the user has no active session with the ID.
+func (rtm *RefreshTokenManager) RevokeSession(ctx context.Context, userID, sessionID primitive.ObjectID) error {
+	filter := rtm.activeFilter(userID)
+	filter["family_id"] = sessionID
+	count, err := rtm.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSessionNotFound
+	}
+	return rtm.RevokeFamily(ctx, sessionID)
+}
+
+// activeFilter matches the unused, unexpired and unrevoked tokens of the user, one per active session.
+func (rtm *RefreshTokenManager) activeFilter(userID primitive.ObjectID) bson.M {
+	return bson.M{"user_id": userID, "used": false, "revoked": false, "expires_at": bson.M{"$gt": time.Now().UTC()}}
+}
@@ -0,0 +1,166 @@
+// This file contains the TokenRevoker interface and its in-memory and MongoDB implementations. A TokenRevoker
+// remembers individual tokens that were revoked before they expired (i.e on logout), so they are rejected.
+//
+// Tokens are identified by their `jti` claim. A revoked token only has to be remembered until it expires, after which
+// it is rejected anyway; both implementations drop entries once they expire, so the store does not grow unbounded.
+//
+// The in-memory store is only suitable for a single web server instance, and forgets revocations on restart.
+
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrUnknownRevocationStore is returned when a token revocation store is not supported.
+var ErrUnknownRevocationStore = errors.New("unknown token revocation store")
+
+// Supported token revocation stores.
+const (
+	RevocationStoreMemory = "memory"
+	RevocationStoreMongo  = "mongo"
+)
+
+// TokenRevoker stores revoked tokens until they expire.
+type TokenRevoker interface {
+	// Revoke revokes the token with the given ID, until expiresAt. A zero expiresAt revokes the token forever,
+	// for tokens that never expire.
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// IsRevoked checks if any of the tokens with the given IDs is revoked, so related revocations (i.e of a token
+	// and of its session) are checked at once.
+	IsRevoked(ctx context.Context, tokenIDs ...string) (bool, error)
+}
+
+// NewTokenRevoker returns the TokenRevoker for the given store name. client is only used by the MongoDB store.
+//
+// Returns ErrUnknownRevocationStore if the store is not supported.
+func NewTokenRevoker(store string, client *mongo.Client) (TokenRevoker, error) {
+	switch store {
+	case RevocationStoreMongo, "":
+		return NewMongoTokenRevoker(client), nil
+	case RevocationStoreMemory:
+		return NewMemoryTokenRevoker(), nil
+	default:
+		return nil, ErrUnknownRevocationStore
+	}
+}
+
+// memorySweepInterval is how often the in-memory store drops expired entries.
+const memorySweepInterval = time.Minute
+
+// MemoryTokenRevoker is a TokenRevoker keeping revoked tokens in memory.
+type MemoryTokenRevoker struct {
+	mu        sync.Mutex
+	revoked   map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryTokenRevoker creates an empty MemoryTokenRevoker.
+func NewMemoryTokenRevoker() *MemoryTokenRevoker {
+	return &MemoryTokenRevoker{revoked: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+// Revoke implements TokenRevoker. Expired entries are dropped at most every memorySweepInterval.
+func (r *MemoryTokenRevoker) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastSweep) >= memorySweepInterval {
+		for id, expiry := range r.revoked {
+			if !expiry.IsZero() && !expiry.After(now) {
+				delete(r.revoked, id)
+			}
+		}
+		r.lastSweep = now
+	}
+
+	r.revoked[tokenID] = expiresAt
+	return nil
+}
+
+// IsRevoked implements TokenRevoker.
+func (r *MemoryTokenRevoker) IsRevoked(ctx context.Context, tokenIDs ...string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	revoked := false
+	for _, tokenID := range tokenIDs {
+		expiresAt, ok := r.revoked[tokenID]
+		if !ok {
+			continue
+		}
+		if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+			delete(r.revoked, tokenID)
+			continue
+		}
+		revoked = true
+	}
+	return revoked, nil
+}
+
+// revokedToken is a revoked token stored by MongoTokenRevoker.
+type revokedToken struct {
+	ID string `bson:"_id"`
+	// ExpiresAt is omitted for tokens revoked forever, so the TTL index never removes them.
+	ExpiresAt *time.Time `bson:"expires_at,omitempty"`
+}
+
+// MongoTokenRevoker is a TokenRevoker keeping revoked tokens in the nerfdb.revoked_tokens collection.
+// Expired entries are removed by a TTL index (see EnsureIndexes).
+type MongoTokenRevoker struct {
+	collection *mongo.Collection
+}
+
+// NewMongoTokenRevoker creates a new MongoTokenRevoker.
+func NewMongoTokenRevoker(client *mongo.Client) *MongoTokenRevoker {
+	return &MongoTokenRevoker{collection: client.Database("nerfdb").Collection("revoked_tokens")}
+}
+
+// EnsureIndexes creates the TTL index removing expired entries. Creating an existing index is a no-op,
+// so this is safe to call on every start.
+func (r *MongoTokenRevoker) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Revoke implements TokenRevoker.
+func (r *MongoTokenRevoker) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	entry := revokedToken{ID: tokenID}
+	if !expiresAt.IsZero() {
+		expiresAt = expiresAt.UTC()
+		entry.ExpiresAt = &expiresAt
+	}
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": tokenID}, entry, options.Replace().SetUpsert(true))
+	return err
+}
+
+// IsRevoked implements TokenRevoker, in a single query. The TTL index is only applied periodically, so expiry is
+// checked explicitly.
+func (r *MongoTokenRevoker) IsRevoked(ctx context.Context, tokenIDs ...string) (bool, error) {
+	if len(tokenIDs) == 0 {
+		return false, nil
+	}
+	filter := bson.M{
+		"_id": bson.M{"$in": tokenIDs},
+		"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": time.Now().UTC()}},
+		},
+	}
+	count, err := r.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
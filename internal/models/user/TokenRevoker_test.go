@@ -0,0 +1,109 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMemoryTokenRevoker(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryTokenRevoker()
+
+	if revoked, err := r.IsRevoked(ctx, "a"); err != nil || revoked {
+		t.Fatalf("IsRevoked() before Revoke = %v, %v, want false", revoked, err)
+	}
+
+	r.Revoke(ctx, "a", time.Now().Add(time.Hour))
+	r.Revoke(ctx, "forever", time.Time{})
+	r.Revoke(ctx, "expired", time.Now().Add(-time.Second))
+	for id, want := range map[string]bool{"a": true, "forever": true, "expired": false, "b": false} {
+		if revoked, err := r.IsRevoked(ctx, id); err != nil || revoked != want {
+			t.Errorf("IsRevoked(%q) = %v, %v, want %v", id, revoked, err, want)
+		}
+	}
+	// Expired entries are dropped when they are looked up
+	if _, ok := r.revoked["expired"]; ok {
+		t.Error("expired entry kept after it was looked up")
+	}
+}
+
+func TestMemoryTokenRevokerSweepsExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryTokenRevoker()
+
+	r.Revoke(ctx, "expiring", time.Now().Add(-time.Second))
+	r.Revoke(ctx, "forever", time.Time{})
+	r.Revoke(ctx, "valid", time.Now().Add(time.Hour))
+	if len(r.revoked) != 3 {
+		t.Fatalf("%d entries before the sweep interval, want 3", len(r.revoked))
+	}
+
+	// The next Revoke after the sweep interval drops the entries that expired
+	r.lastSweep = time.Now().Add(-memorySweepInterval)
+	r.Revoke(ctx, "new", time.Now().Add(time.Hour))
+	for _, id := range []string{"forever", "valid", "new"} {
+		if _, ok := r.revoked[id]; !ok {
+			t.Errorf("entry %q dropped by the sweep", id)
+		}
+	}
+	if _, ok := r.revoked["expiring"]; ok {
+		t.Error("expired entry kept by the sweep")
+	}
+}
+
+func TestMemoryTokenRevokerChecksAllIDs(t *testing.T) {
+	ctx := context.Background()
+	r := NewMemoryTokenRevoker()
+
+	r.Revoke(ctx, "session", time.Now().Add(time.Hour))
+	if revoked, err := r.IsRevoked(ctx, "token", "session"); err != nil || !revoked {
+		t.Errorf("IsRevoked() with a revoked ID = %v, %v, want true", revoked, err)
+	}
+	if revoked, err := r.IsRevoked(ctx, "token", "other"); err != nil || revoked {
+		t.Errorf("IsRevoked() without revoked IDs = %v, %v, want false", revoked, err)
+	}
+	if revoked, err := r.IsRevoked(ctx); err != nil || revoked {
+		t.Errorf("IsRevoked() without IDs = %v, %v, want false", revoked, err)
+	}
+}
+
+func TestMongoTokenRevokerChecksAllIDsAtOnce(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("revoked", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.revoked_tokens", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: 1},
+			{Key: "n", Value: 1},
+		}))
+		revoked, err := NewMongoTokenRevoker(mt.Client).IsRevoked(context.Background(), "token", "session")
+		if err != nil || !revoked {
+			mt.Fatalf("IsRevoked() = %v, %v, want true", revoked, err)
+		}
+
+		events := mt.GetAllStartedEvents()
+		if len(events) != 1 {
+			mt.Fatalf("got %d commands, want a single lookup", len(events))
+		}
+		filter := events[0].Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match").Document()
+		ids, err := filter.LookupErr("_id", "$in")
+		if err != nil {
+			mt.Fatalf("filter %s does not match the IDs at once", filter)
+		}
+		if values, _ := ids.Array().Values(); len(values) != 2 {
+			mt.Errorf("filter matches %s, want both IDs", ids)
+		}
+	})
+
+	mt.Run("no IDs", func(mt *mtest.T) {
+		if revoked, err := NewMongoTokenRevoker(mt.Client).IsRevoked(context.Background()); err != nil || revoked {
+			mt.Fatalf("IsRevoked() = %v, %v, want false", revoked, err)
+		}
+		if events := mt.GetAllStartedEvents(); len(events) != 0 {
+			mt.Errorf("got %d commands, want none", len(events))
+		}
+	})
+}
@@ -0,0 +1,78 @@
+// This file contains per-user transfer accounting. The number of bytes each user uploads and downloads is kept
+// in the nerfdb.usage collection, one document per user, and is only ever changed with atomic increments.
+//
+// Usage is kept out of the users collection on purpose: UpdateUser writes back whole user documents, which
+// would race with (and overwrite) concurrent increments.
+
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TransferUsage is the total number of bytes a user (or, when aggregated, all users) has transferred.
+type TransferUsage struct {
+	UploadedBytes   int64      `bson:"uploaded_bytes" json:"uploaded_bytes"`
+	DownloadedBytes int64      `bson:"downloaded_bytes" json:"downloaded_bytes"`
+	UpdatedAt       *time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// AddTransferUsage atomically adds the given byte counts to the user's transfer totals.
+func (um *UserManager) AddTransferUsage(ctx context.Context, userID primitive.ObjectID, uploaded, downloaded int64) error {
+	_, err := um.usage.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{
+			"$inc": bson.M{"uploaded_bytes": uploaded, "downloaded_bytes": downloaded},
+			"$set": bson.M{"updated_at": time.Now().UTC()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// GetTransferUsage returns the user's transfer totals. Users that have not transferred anything have zero usage.
+func (um *UserManager) GetTransferUsage(ctx context.Context, userID primitive.ObjectID) (*TransferUsage, error) {
+	var usage TransferUsage
+	err := um.usage.FindOne(ctx, bson.M{"_id": userID}).Decode(&usage)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &TransferUsage{}, nil
+		}
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// SumTransferUsage returns the transfer totals of all users combined.
+func (um *UserManager) SumTransferUsage(ctx context.Context) (*TransferUsage, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":              nil,
+			"uploaded_bytes":   bson.M{"$sum": "$uploaded_bytes"},
+			"downloaded_bytes": bson.M{"$sum": "$downloaded_bytes"},
+		}}},
+	}
+
+	cursor, err := um.usage.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []TransferUsage
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return &TransferUsage{}, nil
+	}
+	return &results[0], nil
+}
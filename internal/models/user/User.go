@@ -2,7 +2,7 @@
 // User is used to represent a user in the system, and is used for authentication and authorization.
 // The User struct contains the user's ID, username, encrypted password, and a list of scene IDs.
 // The scene IDs are used to associate a user with the scenes they have access to.
-// Passwords are encrypted and checked using bcrypt.
+// Passwords are hashed with a configurable PasswordHasher, and can be checked regardless of which algorithm hashed them.
 
 package user
 
@@ -11,7 +11,6 @@ import (
 	"slices"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -19,6 +18,14 @@ var (
 	ErrSceneIDNotFound = errors.New("scene ID not found in User scene list")
 	// ErrSceneIDAlreadyExists is returned when a scene ID is already in the user's scene list
 	ErrSceneIDAlreadyExists = errors.New("scene ID already exists in user scene list")
+	// ErrInvalidRole is returned when a user is given a role that does not exist.
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// User roles. Users without a stored role are regular users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
 )
 
 // User represents a user in the system
@@ -27,6 +34,26 @@ type User struct {
 	Username          string               `bson:"username"`
 	EncryptedPassword string               `bson:"encrypted_password"`
 	SceneIDs          []primitive.ObjectID `bson:"scene_ids"`
+	Role              string               `bson:"role,omitempty"`
+	Webhook           *Webhook             `bson:"webhook,omitempty"`
+	// TokenVersion is embedded in the user's tokens. Incrementing it revokes all previously issued tokens.
+	TokenVersion int `bson:"token_version,omitempty"`
+}
+
+// Webhook is a user's notification endpoint. Payloads sent to URL are signed with Secret.
+type Webhook struct {
+	URL    string `bson:"url"`
+	Secret string `bson:"secret"`
+}
+
+// IsValidRole checks if role is a known user role.
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+// IsAdmin checks if the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
 // AddScene adds a scene ID to the user's list of scenes
@@ -51,19 +78,18 @@ func (u *User) RemoveScene(sceneID primitive.ObjectID) error {
 	return ErrSceneIDNotFound
 }
 
-// SetPassword sets a new password for the user. Encrypts the password using bcrypt.
-func (u *User) SetPassword(password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// SetPassword sets a new password for the user. Encrypts the password using the given hasher.
+func (u *User) SetPassword(hasher PasswordHasher, password string) error {
+	hashedPassword, err := hasher.Hash(password)
 	if err != nil {
 		return err
 	}
-	u.EncryptedPassword = string(hashedPassword)
+	u.EncryptedPassword = hashedPassword
 	return nil
 }
 
-// CheckPassword verifies if the provided password is correct.
+// CheckPassword verifies if the provided password is correct, regardless of the algorithm used to hash it.
 // Returns nil on success, or error on failure
 func (u *User) CheckPassword(password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(u.EncryptedPassword), []byte(password))
-	return err
+	return VerifyPassword(u.EncryptedPassword, password)
 }
@@ -30,20 +30,35 @@ var (
 
 type UserManager struct {
 	collection *mongo.Collection
+	usage      *mongo.Collection
+	hasher     PasswordHasher
 	logger     *log.Logger
 }
 
-// NewUserManager creates a new instance of UserManager.
-func NewUserManager(client *mongo.Client, logger *log.Logger, unittest bool) *UserManager {
+// NewUserManager creates a new instance of UserManager. New passwords are hashed with the given hasher.
+func NewUserManager(client *mongo.Client, hasher PasswordHasher, logger *log.Logger, unittest bool) *UserManager {
 	db := client.Database("nerfdb")
 	return &UserManager{
 		collection: db.Collection("users"),
+		usage:      db.Collection("usage"),
+		hasher:     hasher,
 		logger:     logger,
 	}
 }
 
+// EnsureIndexes creates the indexes the UserManager relies on. Creating an existing index is a no-op,
+// so this is safe to call on every start. It fails if the collection already holds duplicate usernames.
+func (um *UserManager) EnsureIndexes(ctx context.Context) error {
+	_, err := um.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		// Usernames are unique, even when two users register the same one at once
+		Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
 // SetUser updates or inserts a user document in the database.
-// Returns nil if successful, or an error if an error occurred while updating the user.
+// Returns nil if successful, ErrUsernameTaken if another user has the username, or an error if an error occurred
+// while updating the user.
 func (um *UserManager) SetUser(ctx context.Context, user *User) error {
 	_, err := um.collection.UpdateOne(
 		ctx,
@@ -51,16 +66,23 @@ func (um *UserManager) SetUser(ctx context.Context, user *User) error {
 		bson.M{"$set": user},
 		options.Update().SetUpsert(true),
 	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameTaken
+	}
 	return err
 }
 
 // UpdateUser updates an existing user document in the database.
+// Returns ErrUsernameTaken if another user has the username, or ErrUserNotFound if the user does not exist.
 func (um *UserManager) UpdateUser(ctx context.Context, user *User) error {
 	result, err := um.collection.UpdateOne(
 		ctx,
 		bson.M{"_id": user.ID},
 		bson.M{"$set": user},
 	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameTaken
+	}
 	if err != nil {
 		return err
 	}
@@ -72,7 +94,8 @@ func (um *UserManager) UpdateUser(ctx context.Context, user *User) error {
 
 // GenerateUser generates a new user document with the given username and password,
 // and inserts it into the database. Returns the User, nil if successful.
-// Returns nil, error if the username is already taken or an error occurred while inserting the user.
+// Returns nil, ErrUsernameTaken if the username is already taken, or nil, error if an error occurred while inserting
+// the user. The unique username index catches users registering the same username at once, after the check below.
 func (um *UserManager) GenerateUser(ctx context.Context, username, password string) (*User, error) {
 	// Check if username is already taken
 	_, err := um.GetUserByUsername(ctx, username)
@@ -90,7 +113,7 @@ func (um *UserManager) GenerateUser(ctx context.Context, username, password stri
 		Username: username,
 	}
 
-	if err := user.SetPassword(password); err != nil {
+	if err := user.SetPassword(um.hasher, password); err != nil {
 		return nil, err
 	}
 
@@ -130,6 +153,43 @@ func (um *UserManager) GetUserByUsername(ctx context.Context, username string) (
 	return &user, nil
 }
 
+// GetSceneOwnerID returns the ID of the user whose scene list contains the given scene.
+// Returns ErrUserNotFound if no user owns the scene.
+func (um *UserManager) GetSceneOwnerID(ctx context.Context, sceneID primitive.ObjectID) (primitive.ObjectID, error) {
+	var result struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+	err := um.collection.FindOne(ctx, bson.M{"scene_ids": sceneID}, opts).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return primitive.NilObjectID, ErrUserNotFound
+		}
+		return primitive.NilObjectID, err
+	}
+	return result.ID, nil
+}
+
+// GetUsernames returns the usernames of the users with the given IDs. Users that do not exist are left out.
+func (um *UserManager) GetUsernames(ctx context.Context, userIDs []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "username": 1})
+	cursor, err := um.collection.Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	usernames := make(map[primitive.ObjectID]string, len(users))
+	for _, u := range users {
+		usernames[u.ID] = u.Username
+	}
+	return usernames, nil
+}
+
 // UserHasJobAccess checks if a user has access to a job by searching for the job ID in the user's sceneIDs.
 func (um *UserManager) UserHasJobAccess(ctx context.Context, userID, jobID primitive.ObjectID) (bool, error) {
 	user, err := um.GetUserByID(ctx, userID)
@@ -156,7 +216,25 @@ func (um *UserManager) UpdatePassword(ctx context.Context, userID primitive.Obje
 	if err != nil {
 		return err
 	}
-	return user.SetPassword(newPassword)
+	if err := user.SetPassword(um.hasher, newPassword); err != nil {
+		return err
+	}
+	return um.UpdateUser(ctx, user)
+}
+
+// RehashPasswordIfNeeded re-hashes the user's password with the configured hasher if it was hashed with a different
+// algorithm, and saves the user. The password must already have been verified by the caller.
+// Returns nil if no re-hash was needed or the re-hash succeeded.
+func (um *UserManager) RehashPasswordIfNeeded(ctx context.Context, user *User, password string) error {
+	if um.hasher.Matches(user.EncryptedPassword) {
+		return nil
+	}
+
+	um.logger.Infof("Migrating password hash of user %s to %s", user.ID.Hex(), um.hasher.Name())
+	if err := user.SetPassword(um.hasher, password); err != nil {
+		return err
+	}
+	return um.UpdateUser(ctx, user)
 }
 
 // UpdateUsername updates the user's username. Checks if the new username is already taken.
@@ -181,3 +259,110 @@ func (um *UserManager) UpdateUsername(ctx context.Context, userID primitive.Obje
 	user.Username = newUsername
 	return um.UpdateUser(ctx, user)
 }
+
+// SetWebhook sets the user's webhook, or removes it if webhook is nil.
+func (um *UserManager) SetWebhook(ctx context.Context, userID primitive.ObjectID, webhook *Webhook) error {
+	update := bson.M{"$set": bson.M{"webhook": webhook}}
+	if webhook == nil {
+		update = bson.M{"$unset": bson.M{"webhook": ""}}
+	}
+	result, err := um.collection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetRole sets the user's role. Returns ErrInvalidRole if role is not a known role.
+func (um *UserManager) SetRole(ctx context.Context, userID primitive.ObjectID, role string) error {
+	if !IsValidRole(role) {
+		return ErrInvalidRole
+	}
+	result, err := um.collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// AddUserScene adds a scene ID to the user's list of scenes. Adding a scene the user already has is a no-op.
+func (um *UserManager) AddUserScene(ctx context.Context, userID, sceneID primitive.ObjectID) error {
+	result, err := um.collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$addToSet": bson.M{"scene_ids": sceneID}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// RemoveUserScene removes a scene ID from the user's list of scenes. Removing a scene the user does not have is a no-op.
+func (um *UserManager) RemoveUserScene(ctx context.Context, userID, sceneID primitive.ObjectID) error {
+	result, err := um.collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$pull": bson.M{"scene_ids": sceneID}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetTokenVersion returns the user's current token version. Tokens issued with an older version are revoked.
+func (um *UserManager) GetTokenVersion(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	var result struct {
+		TokenVersion int `bson:"token_version"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"token_version": 1})
+	err := um.collection.FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+	return result.TokenVersion, nil
+}
+
+// RevokeTokens revokes all of the user's previously issued tokens by incrementing their token version.
+// Returns the new token version.
+func (um *UserManager) RevokeTokens(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	var result struct {
+		TokenVersion int `bson:"token_version"`
+	}
+	opts := options.FindOneAndUpdate().
+		SetProjection(bson.M{"token_version": 1}).
+		SetReturnDocument(options.After)
+	err := um.collection.FindOneAndUpdate(ctx, bson.M{"_id": userID}, bson.M{"$inc": bson.M{"token_version": 1}}, opts).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+	return result.TokenVersion, nil
+}
+
+// DeleteUser deletes the user with the given ID from the database. Their scenes are not deleted.
+func (um *UserManager) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	result, err := um.collection.DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// CountUsers returns the total number of users in the database.
+func (um *UserManager) CountUsers(ctx context.Context) (int64, error) {
+	return um.collection.CountDocuments(ctx, bson.M{})
+}
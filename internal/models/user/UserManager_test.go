@@ -0,0 +1,30 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+func TestGenerateUserDuplicateUsername(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("unique index", func(mt *mtest.T) {
+		um := NewUserManager(mt.Client, &BcryptHasher{Cost: bcrypt.MinCost}, &log.Logger{SugaredLogger: zap.NewNop().Sugar()}, true)
+
+		// The username was free when checked, and taken before the user was written
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+		)
+		if _, err := um.GenerateUser(context.Background(), "alice", "password"); !errors.Is(err, ErrUsernameTaken) {
+			mt.Fatalf("GenerateUser() = %v, want ErrUsernameTaken", err)
+		}
+	})
+}
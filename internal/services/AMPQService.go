@@ -15,6 +15,7 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -30,6 +31,7 @@ import (
 	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
 	"github.com/NeRF-or-Nothing/go-web-server/internal/models/queue"
 	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
 )
 
 type AMPQService struct {
@@ -37,35 +39,89 @@ type AMPQService struct {
 	messageBrokerDomain string
 	sceneManager        *scene.SceneManager
 	queueManager        *queue.QueueListManager
+	notifications       *user.NotificationManager
 	connection          *amqp.Connection
 	channel             *amqp.Channel
+	config              AMPQServiceConfig
+	workerURLs          *WorkerURLSigner
+	workers             *WorkerHealth
 	logger              *log.Logger
+	// opens critical files to flush them, openFile if nil
+	openFile fileOpener
 	// used for reconnection and graceful shutdown
 	stopChan chan struct{}
 	wg       sync.WaitGroup
 }
 
 // Starts a new AMPQService instance as goroutine
-func NewAMPQService(messageBrokerDomain string, sceneManager *scene.SceneManager, queueManager *queue.QueueListManager, logger *log.Logger) (*AMPQService, error) {
+func NewAMPQService(messageBrokerDomain string, sceneManager *scene.SceneManager, queueManager *queue.QueueListManager, notifications *user.NotificationManager, config AMPQServiceConfig, logger *log.Logger) (*AMPQService, error) {
+	if err := ValidateOutputCompression(config.OutputCompression); err != nil {
+		return nil, err
+	}
+
 	service := &AMPQService{
 		messageBrokerDomain: messageBrokerDomain,
 		queueManager:        queueManager,
 		sceneManager:        sceneManager,
+		notifications:       notifications,
 		baseURL:             "http://web-server:5000/",
+		config:              config,
+		workerURLs:          NewWorkerURLSigner(config.WorkerURLSecret),
+		workers:             NewWorkerHealth(config.WorkerHeartbeatTimeout),
 		logger:              logger,
 		stopChan:            make(chan struct{}),
 	}
 
+	if !service.workerURLs.Enabled() {
+		logger.Warn("No worker URL secret configured, worker data URLs are sent unsigned")
+	}
+
 	err := service.connect()
 	if err != nil {
 		return nil, err
 	}
 
-	go service.startConsumers()
+	if err := service.ReconcileQueues(context.Background()); err != nil {
+		logger.Error("Failed to reconcile queues:", err.Error())
+	}
+
+	service.startConsumers()
 
 	return service, nil
 }
 
+// ReconcileQueues rebuilds the progress queues from the scene states, which are trusted over the persisted queues.
+// This recovers scenes that were enqueued but not yet persisted when the server stopped, and drops scenes that
+// finished processing before their removal was persisted. It should be called on startup, before jobs are processed.
+func (s *AMPQService) ReconcileQueues(ctx context.Context) error {
+	scenes, err := s.sceneManager.GetProcessingScenes(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected := map[string][]primitive.ObjectID{
+		"queue_list": {},
+		"sfm_list":   {},
+		"nerf_list":  {},
+	}
+	for _, sc := range scenes {
+		expected["queue_list"] = append(expected["queue_list"], sc.ID)
+		switch sc.Status {
+		case scene.StatusSfmProcessing:
+			expected["sfm_list"] = append(expected["sfm_list"], sc.ID)
+		case scene.StatusNerfProcessing:
+			expected["nerf_list"] = append(expected["nerf_list"], sc.ID)
+		}
+	}
+
+	recovered, dropped, err := s.queueManager.Reconcile(ctx, expected)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("Queues reconciled with scene states: %d recovered, %d dropped", recovered, dropped)
+	return nil
+}
+
 // connect establishes a connection to the AMPQ message broker and creates the necessary queues
 func (s *AMPQService) connect() error {
 	fmt.Println("AMPQService.connect")
@@ -93,7 +149,7 @@ func (s *AMPQService) connect() error {
 	}
 
 	// Declare queues with 1 hour consumer timeout
-	queues := []string{"sfm-in", "nerf-in", "sfm-out", "nerf-out"}
+	queues := []string{"sfm-in", "nerf-in", "sfm-out", "nerf-out", "progress-out", "heartbeat-out"}
 	for _, queue := range queues {
 		args := amqp.Table{
 			"x-consumer-timeout": int64(time.Hour.Milliseconds()),
@@ -109,10 +165,13 @@ func (s *AMPQService) connect() error {
 
 // startConsumers starts the consumers for the AMPQ queues.
 //
-// consumers are started as goroutines, and the function waits for them to finish using a WaitGroup.
+// consumers are started as goroutines, tracked by a WaitGroup so Shutdown can wait for them to finish.
 func (s *AMPQService) startConsumers() {
+	s.wg.Add(4)
 	go s.runConsumer("sfm-out", s.processSFMJob)
 	go s.runConsumer("nerf-out", s.processNERFJob)
+	go s.runConsumer("progress-out", s.processProgress)
+	go s.runConsumer("heartbeat-out", s.processHeartbeat)
 }
 
 // runConsumer runs a consumer for the specified queue and consumption handler
@@ -126,14 +185,26 @@ func (s *AMPQService) runConsumer(queueName string, processFunc func(amqp.Delive
 			return
 		default:
 			if err := s.consume(queueName, processFunc); err != nil {
+				select {
+				case <-s.stopChan:
+					// The connection was closed by Shutdown
+					s.logger.Infof("Stopping %s consumer", queueName)
+					return
+				default:
+				}
 				s.logger.Errorf("Error in %s consumer: %v. Reconnecting in 5 seconds...", queueName, err)
-				time.Sleep(5 * time.Second)
+				select {
+				case <-s.stopChan:
+				case <-time.After(5 * time.Second):
+				}
 			}
 		}
 	}
 }
 
-// consume consumes messages from the specified queue and processes them using the provided function
+// consume consumes messages from the specified queue and processes them using the provided function.
+// Each message is acknowledged once processFunc returns, or negatively acknowledged and requeued if it returns an
+// error, so processFunc must not acknowledge the delivery itself.
 func (s *AMPQService) consume(queueName string, processFunc func(amqp.Delivery) error) error {
 	if err := s.ensureConnection(); err != nil {
 		return fmt.Errorf("failed to ensure connection: %v", err)
@@ -176,20 +247,99 @@ func (s *AMPQService) ensureConnection() error {
 	return s.connect()
 }
 
-// Shutdown shuts down the AMPQ service
+// Connected reports whether the connection to the message broker is open. While it is not, consumers are
+// reconnecting, and jobs can not be published.
+func (s *AMPQService) Connected() bool {
+	return s.connection != nil && !s.connection.IsClosed()
+}
+
+// HealthyWorkers returns the workers that sent a heartbeat within the heartbeat timeout.
+func (s *AMPQService) HealthyWorkers() []WorkerStatus {
+	return s.workers.Healthy()
+}
+
+// Shutdown shuts down the AMPQ service. Closing the connection stops the consumers, which are waited for; a message
+// being processed is not acknowledged, so the broker redelivers it.
 func (s *AMPQService) Shutdown() {
 	s.logger.Info("Shutting down AMQP service...")
 	close(s.stopChan)
-	s.wg.Wait()
 	if s.connection != nil {
 		s.connection.Close()
 	}
+	s.wg.Wait()
 	s.logger.Info("AMQP service shut down")
 }
 
-// toAPIUrl converts a file path to an API URL
+// toAPIUrl converts a file path to an API URL, signed for WorkerURLTTL if a worker URL secret is configured
 func (s *AMPQService) toAPIUrl(filePath string) string {
-	return s.baseURL + "worker-data/" + filePath
+	apiURL := s.baseURL + "worker-data/" + filePath
+	if query := s.workerURLs.Sign(filePath, time.Now().Add(s.config.WorkerURLTTL)); query != "" {
+		apiURL += "?" + query
+	}
+	return apiURL
+}
+
+// logSceneEvent appends an entry to the scene's processing log. Failures to log are reported but otherwise ignored,
+// as the processing log is informational and should never break the pipeline.
+func (s *AMPQService) logSceneEvent(ctx context.Context, sceneID primitive.ObjectID, stage, level, message string) {
+	entry := scene.LogEntry{Time: time.Now().UTC(), Stage: stage, Level: level, Message: message}
+	if err := s.sceneManager.AppendSceneLog(ctx, sceneID, entry); err != nil {
+		s.logger.Errorf("Failed to append to log of scene %s: %v", sceneID.Hex(), err)
+	}
+}
+
+// notifySceneOwner adds a notification of the given type to the inbox of the scene's owner. Failures to notify are
+// reported but otherwise ignored, like failures to log, as the notification inbox should never break the pipeline.
+func (s *AMPQService) notifySceneOwner(ctx context.Context, sceneID primitive.ObjectID, notificationType, message string) {
+	if s.notifications == nil {
+		return
+	}
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		s.logger.Errorf("Failed to notify owner of scene %s: %v", sceneID.Hex(), err)
+		return
+	}
+	notification := &user.Notification{
+		UserID:    sc.UserID,
+		Type:      notificationType,
+		SceneID:   sceneID,
+		SceneName: sc.Name,
+		Message:   message,
+	}
+	if err := s.notifications.AddNotification(ctx, notification); err != nil {
+		s.logger.Errorf("Failed to notify owner of scene %s: %v", sceneID.Hex(), err)
+	}
+}
+
+// sceneDeleted checks if the scene was deleted (i.e cancelled by its owner) while its job was queued.
+// Worker output for deleted scenes is discarded, rather than requeued or saved.
+func (s *AMPQService) sceneDeleted(ctx context.Context, sceneID primitive.ObjectID) (bool, error) {
+	_, err := s.sceneManager.GetScene(ctx, sceneID)
+	if errors.Is(err, scene.ErrSceneNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get scene: %v", err)
+	}
+	return false, nil
+}
+
+// failScene marks the scene as failed at the given stage and removes it from all processing queues.
+func (s *AMPQService) failScene(ctx context.Context, sceneID primitive.ObjectID, stage, reason string) error {
+	s.logger.Infof("Scene %s failed during %s: %s", sceneID.Hex(), stage, reason)
+
+	if err := s.sceneManager.MarkSceneFailed(ctx, sceneID, stage, reason); err != nil {
+		return fmt.Errorf("failed to mark scene as failed: %v", err)
+	}
+	s.notifySceneOwner(ctx, sceneID, user.NotificationSceneFailed, reason)
+
+	for _, queueName := range s.queueManager.GetQueueNames() {
+		err := s.queueManager.DeleteFromQueue(ctx, queueName, sceneID)
+		if err != nil && err != queue.ErrIDNotFoundInQueue && err != queue.ErrInvalidOpOnEmptyQueue {
+			s.logger.Errorf("Error removing failed scene from %s: %v", queueName, err)
+		}
+	}
+	return nil
 }
 
 // PublishSFMJob publishes a new SFM job to the AMPQ message broker.
@@ -197,10 +347,11 @@ func (s *AMPQService) toAPIUrl(filePath string) string {
 // The job is published to the 'sfm-in' queue, and the scene ID is appended to the 'sfm_list' and 'queue_list' queues.
 //
 // Returns an error if the job could not be published.
-func (s *AMPQService) PublishSFMJob(ctx context.Context, scene *scene.Scene) error {
+func (s *AMPQService) PublishSFMJob(ctx context.Context, sc *scene.Scene) error {
 	job := map[string]interface{}{
-		"id":        scene.ID.Hex(),
-		"file_path": s.toAPIUrl(scene.Video.FilePath),
+		"id":        sc.ID.Hex(),
+		"file_path": s.toAPIUrl(sc.Video.FilePath),
+		"sfm_only":  sc.IsSfmOnly(),
 	}
 
 	jsonJob, err := json.Marshal(job)
@@ -216,24 +367,28 @@ func (s *AMPQService) PublishSFMJob(ctx context.Context, scene *scene.Scene) err
 		return fmt.Errorf("failed to publish SFM job: %v", err)
 	}
 
-	err = s.queueManager.AppendToQueue(ctx, "sfm_list", scene.ID)
+	err = s.queueManager.AppendToQueue(ctx, "sfm_list", sc.ID)
 	if err != nil {
 		return fmt.Errorf("failed to append to sfm_list: %v", err)
 	}
 
-	err = s.queueManager.AppendToQueue(ctx, "queue_list", scene.ID)
+	err = s.queueManager.AppendToQueue(ctx, "queue_list", sc.ID)
 	if err != nil {
 		return fmt.Errorf("failed to append to queue_list: %v", err)
 	}
 
-	s.logger.Infof("SFM Job Published with ID %s", scene.ID.Hex())
+	s.logSceneEvent(ctx, sc.ID, scene.StageSfm, "info", "Queued for SfM")
+	s.logger.Infof("SFM Job Published with ID %s", sc.ID.Hex())
 	return nil
 }
 
 // processSFMJob processes a message from the 'sfm-out' queue.
 //
 // The message is expected to contain the output of the SFM worker, which is then processed and saved to the database.
-// Upon successful processing, the scene is removed from the 'sfm_list' queue and a new NERF job is published.
+// Upon successful processing, the scene is removed from the 'sfm_list' queue and a new NERF job is published, or, for
+// SfM only scenes, the scene is removed from the 'queue_list' queue and marked complete.
+// If the worker reports a non-zero flag, the scene is marked as failed and removed from all queues.
+// Output types configured in AMPQServiceConfig.OutputCompression are compressed after download.
 //
 // This function TRUSTS the output of the SFM worker, and does not perform any validation on the message.
 // The expected message format is:
@@ -242,6 +397,11 @@ func (s *AMPQService) PublishSFMJob(ctx context.Context, scene *scene.Scene) err
 //  	"id": string (primitive.ObjectID.Hex()),
 //  	"vid_width": int,
 //  	"vid_height": int,
+//  	"vid_fps": int,                             (optional)
+//  	"vid_duration": int,                        (optional, seconds)
+//  	"vid_frame_count": int,                     (optional)
+//  	"vid_codec": string,                        (optional)
+//  	"point_cloud": string (url),                (optional, sparse point cloud)
 //  	"sfm": {
 //  	    "intrinsic_matrix": [[float64]] 3x3,
 //  	    "frames": [
@@ -251,17 +411,28 @@ func (s *AMPQService) PublishSFMJob(ctx context.Context, scene *scene.Scene) err
 //  	        },
 //  	        ...
 //  	    ],
-//  	    "white_background": bool
+//  	    "white_background": bool,
+//  	    "quality_report": {                     (optional)
+//  	        "frames_used": int,
+//  	        "frames_total": int,
+//  	        "registered_cameras": int,
+//  	        "mean_reprojection_error": float64
+//  	    }
 //  	},
 //  	"flag": someInt
 //	}
 func (s *AMPQService) processSFMJob(d amqp.Delivery) error {
 	type SfmWorkerData struct {
 		SceneID   string    `json:"id"`
-		VidWidth  int       `json:"vid_width"`
-		VidHeight int       `json:"vid_height"`
-		Sfm       scene.Sfm `json:"sfm"`
-		Flag      int       `json:"flag"`
+		VidWidth      int       `json:"vid_width"`
+		VidHeight     int       `json:"vid_height"`
+		VidFPS        int       `json:"vid_fps"`
+		VidDuration   int       `json:"vid_duration"`
+		VidFrameCount int       `json:"vid_frame_count"`
+		VidCodec      string    `json:"vid_codec"`
+		PointCloud    string    `json:"point_cloud"`
+		Sfm           scene.Sfm `json:"sfm"`
+		Flag          int       `json:"flag"`
 	}
 
 	var data SfmWorkerData
@@ -270,7 +441,6 @@ func (s *AMPQService) processSFMJob(d amqp.Delivery) error {
 	err := json.Unmarshal(d.Body, &data)
 	if err != nil {
 		s.logger.Errorf("Error unmarshalling SFM data: %v", err)
-		d.Nack(false, true)
 		return err
 	}
 
@@ -279,12 +449,23 @@ func (s *AMPQService) processSFMJob(d amqp.Delivery) error {
 	sceneID, err := primitive.ObjectIDFromHex(data.SceneID)
 	if err != nil {
 		s.logger.Errorf("Invalid ID format: %v", err)
-		d.Nack(false, true)
 		return err
 	}
 
 	ctx := context.Background()
 
+	if deleted, err := s.sceneDeleted(ctx, sceneID); err != nil {
+		return err
+	} else if deleted {
+		s.logger.Infof("Discarding SFM output of deleted scene %s", sceneID.Hex())
+		return nil
+	}
+
+	// A non-zero flag means the sfm-worker could not process the video
+	if data.Flag != 0 {
+		return s.failScene(ctx, sceneID, scene.StageSfm, fmt.Sprintf("sfm worker reported failure (flag %d)", data.Flag))
+	}
+
 	// Create sfm output directory
 	saveDir := filepath.Join("data", "sfm", sceneID.Hex())
 	err = os.MkdirAll(saveDir, os.ModePerm)
@@ -321,29 +502,76 @@ func (s *AMPQService) processSFMJob(d amqp.Delivery) error {
 			s.logger.Errorf("Error saving file: %v", err)
 			return fmt.Errorf("error saving file: %v", err)
 		}
+		if err := s.syncWrite(filePath); err != nil {
+			s.logger.Errorf("Error syncing file: %v", err)
+			return fmt.Errorf("error syncing file: %v", err)
+		}
 
 		s.logger.Infof("File saved at %s", filePath)
 
 		data.Sfm.Frames[i].FilePath = s.toAPIUrl(filePath)
 	}
 
+	if data.PointCloud != "" {
+		filePath := filepath.Join(saveDir, "point_cloud"+filepath.Ext(data.PointCloud))
+		if err := downloadFile(data.PointCloud, filePath); err != nil {
+			s.logger.Errorf("Error downloading point cloud: %v", err)
+			return fmt.Errorf("error downloading point cloud: %v", err)
+		}
+		if err := s.syncWrite(filePath); err != nil {
+			s.logger.Errorf("Error syncing point cloud: %v", err)
+			return fmt.Errorf("error syncing point cloud: %v", err)
+		}
+		data.Sfm.PointCloudFilePath = filePath
+	}
+
 	// Update the scene with the new SFM Worker data
 	currentScene, err := s.sceneManager.GetScene(ctx, sceneID)
 	if err != nil {
 		s.logger.Errorf("Error getting scene: %v", err)
-		d.Nack(false, true)
 		return err
 	}
 
+	// A retried sfm-worker may send its output twice, which is discarded rather than queueing training again.
+	// If the scene is still waiting for SfM, the output was recorded by a delivery that failed before training was
+	// queued, which is resumed with the recorded output.
+	written, err := s.sceneManager.SetSfm(ctx, sceneID, &data.Sfm)
+	if err != nil && !errors.Is(err, scene.ErrDuplicateWrite) {
+		s.logger.Errorf("Error setting sfm data: %v", err)
+		return err
+	}
+	if !written {
+		if currentScene.Status != scene.StatusSfmProcessing {
+			s.logger.Infof("Discarding duplicate SFM output of scene %s", sceneID.Hex())
+			return nil
+		}
+		s.logger.Infof("Resuming recorded SFM output of scene %s", sceneID.Hex())
+		if currentScene.Sfm != nil {
+			data.Sfm = *currentScene.Sfm
+		}
+	}
+
 	// Assumes that scene, scene.Video, and scene.Config are already populated
 	currentScene.Sfm = &data.Sfm
 	currentScene.Video.Width = data.VidWidth
 	currentScene.Video.Height = data.VidHeight
+	// Optional probe results, not reported by all workers
+	if data.VidFPS > 0 {
+		currentScene.Video.FPS = data.VidFPS
+	}
+	if data.VidDuration > 0 {
+		currentScene.Video.Duration = data.VidDuration
+	}
+	if data.VidFrameCount > 0 {
+		currentScene.Video.FrameCount = data.VidFrameCount
+	}
+	if data.VidCodec != "" {
+		currentScene.Video.Codec = data.VidCodec
+	}
 
-	err = s.sceneManager.SetScene(ctx, sceneID, currentScene)
+	err = s.sceneManager.SetVideo(ctx, sceneID, currentScene.Video)
 	if err != nil {
-		s.logger.Errorf("Error setting scene data: %v", err)
-		d.Nack(false, true)
+		s.logger.Errorf("Error setting video data: %v", err)
 		return err
 	}
 
@@ -355,15 +583,35 @@ func (s *AMPQService) processSFMJob(d amqp.Delivery) error {
 
 	s.logger.Debug("Saved finished SFM job")
 
+	// SfM only scenes are complete without training
+	if currentScene.IsSfmOnly() {
+		err = s.queueManager.DeleteFromQueue(ctx, "queue_list", sceneID)
+		if err != nil && err != queue.ErrIDNotFoundInQueue && err != queue.ErrInvalidOpOnEmptyQueue {
+			s.logger.Errorf("Error popping from queue_list queue: %v", err)
+		}
+		if err := s.sceneManager.SetSceneStatus(ctx, sceneID, scene.StatusComplete); err != nil {
+			s.logger.Errorf("Error setting scene status: %v", err)
+			return err
+		}
+		s.logSceneEvent(ctx, sceneID, scene.StageSfm, "info", fmt.Sprintf("SfM completed with %d frames, no NeRF training for SfM only scene", len(data.Sfm.Frames)))
+		s.notifySceneOwner(ctx, sceneID, user.NotificationSceneCompleted, "")
+
+		return nil
+	}
+
 	// Publish new job to nerf-in
 	err = s.PublishNERFJob(ctx, currentScene)
 	if err != nil {
 		s.logger.Errorf("Error publishing NERF job: %v", err)
-		d.Nack(false, true)
 		return err
 	}
 
-	d.Ack(false)
+	// The scene only moves past SfM once training is queued, so a failed delivery is resumed when redelivered
+	if err := s.sceneManager.SetSceneStatus(ctx, sceneID, scene.StatusNerfProcessing); err != nil {
+		s.logger.Errorf("Error setting scene status: %v", err)
+	}
+	s.logSceneEvent(ctx, sceneID, scene.StageSfm, "info", fmt.Sprintf("SfM completed with %d frames", len(data.Sfm.Frames)))
+
 	return nil
 }
 
@@ -371,12 +619,12 @@ func (s *AMPQService) processSFMJob(d amqp.Delivery) error {
 // The job is published to the 'nerf-in' queue, and the scene ID is appended to the 'nerf_list' queue.
 //
 // Returns an error if the job could not be published.
-func (s *AMPQService) PublishNERFJob(ctx context.Context, scene *scene.Scene) error {
+func (s *AMPQService) PublishNERFJob(ctx context.Context, sc *scene.Scene) error {
 	// Extract data from scene
-	sceneID := scene.ID
-	vid := scene.Video
-	sfm := scene.Sfm
-	config := scene.Config
+	sceneID := sc.ID
+	vid := sc.Video
+	sfm := sc.Sfm
+	config := sc.Config
 
 	// Construct job
 	jobMap := map[string]interface{}{
@@ -416,6 +664,7 @@ func (s *AMPQService) PublishNERFJob(ctx context.Context, scene *scene.Scene) er
 		return fmt.Errorf("failed to append to nerf_list: %v", err)
 	}
 
+	s.logSceneEvent(ctx, sceneID, scene.StageNerf, "info", "Queued for NeRF training")
 	s.logger.Debug("NERF Job Published with ID ", sceneID.Hex())
 	return nil
 }
@@ -423,7 +672,8 @@ func (s *AMPQService) PublishNERFJob(ctx context.Context, scene *scene.Scene) er
 // processNERFJob processes a message from the 'nerf-out' queue
 //
 // The message is expected to contain the output of the NERF worker, which is then processed and saved to the file system & database.
-// Upon successful processing, the scene is removed from the 'nerf_list' and 'queue_list' queues.
+// Upon successful processing, the scene is removed from the 'nerf_list' and 'queue_list' queues and marked complete.
+// If the worker reports a non-zero flag, the scene is marked as failed and removed from all queues.
 //
 // This function TRUSTS the output of the nerf worker, and only validates the output types
 // and iterations against the scene config.
@@ -432,6 +682,7 @@ func (s *AMPQService) PublishNERFJob(ctx context.Context, scene *scene.Scene) er
 //
 //	{
 //	    "id": string (primitive.ObjectID.Hex()),
+//	    "flag": int (optional, non-zero on failure),
 //	    "file_paths": {
 //	        "typeA": {
 //	            int (iteration): string (url),
@@ -441,7 +692,8 @@ func (s *AMPQService) PublishNERFJob(ctx context.Context, scene *scene.Scene) er
 //				...
 //	        },
 //	        ...
-//		}
+//		},
+//	    "turntable": [string (url), ...] (optional, turntable preview frames in playback order)
 //	}
 func (s *AMPQService) processNERFJob(msg amqp.Delivery) error {
 	type IterationPaths map[int]string
@@ -449,6 +701,8 @@ func (s *AMPQService) processNERFJob(msg amqp.Delivery) error {
 	type NerfWorkerData struct {
 		SceneID   string    `json:"id"`
 		FilePaths FilePaths `json:"file_paths"`
+		Turntable []string  `json:"turntable"`
+		Flag      int       `json:"flag"`
 	}
 
 	var data NerfWorkerData
@@ -466,6 +720,18 @@ func (s *AMPQService) processNERFJob(msg amqp.Delivery) error {
 
 	ctx := context.Background()
 
+	if deleted, err := s.sceneDeleted(ctx, sceneID); err != nil {
+		return err
+	} else if deleted {
+		s.logger.Infof("Discarding NERF output of deleted scene %s", sceneID.Hex())
+		return nil
+	}
+
+	// A non-zero flag means the nerf-worker could not train the scene
+	if data.Flag != 0 {
+		return s.failScene(ctx, sceneID, scene.StageNerf, fmt.Sprintf("nerf worker reported failure (flag %d)", data.Flag))
+	}
+
 	currentScene, err := s.sceneManager.GetScene(ctx, sceneID)
 	if err != nil {
 		return fmt.Errorf("failed to get scene: %v", err)
@@ -532,6 +798,20 @@ func (s *AMPQService) processNERFJob(msg amqp.Delivery) error {
 			if err != nil {
 				return fmt.Errorf("error saving file: %v", err)
 			}
+			if err := file.Close(); err != nil {
+				return fmt.Errorf("error saving file: %v", err)
+			}
+
+			// Compress the file if configured for its type. The stored path then carries the compression extension
+			if algorithm := s.config.OutputCompression[outputType]; algorithm != "" {
+				filePath, err = compressFile(filePath, algorithm)
+				if err != nil {
+					return fmt.Errorf("error compressing file: %v", err)
+				}
+			}
+			if err := s.syncWrite(filePath); err != nil {
+				return fmt.Errorf("error syncing file: %v", err)
+			}
 
 			switch outputType {
 			case "splat_cloud":
@@ -562,20 +842,148 @@ func (s *AMPQService) processNERFJob(msg amqp.Delivery) error {
 		}
 	}
 
-	err = s.sceneManager.SetNerf(ctx, sceneID, nerf)
-	if err != nil {
+	// Download the turntable preview frames, if the worker rendered them
+	if len(data.Turntable) > 0 {
+		turntableDir := filepath.Join(saveDir, "turntable")
+		err = os.MkdirAll(turntableDir, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create turntable directory: %v", err)
+		}
+
+		for i, URL := range data.Turntable {
+			// Prefix the frame index, so frames keep their order on disk
+			filePath := filepath.Join(turntableDir, fmt.Sprintf("%04d_%s", i, filepath.Base(URL)))
+			if err := downloadFile(URL, filePath); err != nil {
+				return fmt.Errorf("error downloading turntable frame %d: %v", i, err)
+			}
+			if err := s.syncWrite(filePath); err != nil {
+				return fmt.Errorf("error syncing turntable frame %d: %v", i, err)
+			}
+			nerf.TurntableFramePaths = append(nerf.TurntableFramePaths, filePath)
+		}
+		s.logger.Debugf("Saved %d turntable frames in %s", len(nerf.TurntableFramePaths), turntableDir)
+	}
+
+	// A retried nerf-worker may send its output twice, which is discarded rather than completing the scene again.
+	// If the scene is still training, the output was recorded by a delivery that failed before completing the scene,
+	// which is resumed. Stale output (of an earlier iteration) is always discarded.
+	written, err := s.sceneManager.SetNerf(ctx, sceneID, nerf)
+	if errors.Is(err, scene.ErrStaleWrite) {
+		s.logger.Infof("Discarding NERF output of scene %s: %v", sceneID.Hex(), err)
+		return nil
+	}
+	if err != nil && !errors.Is(err, scene.ErrDuplicateWrite) {
 		return fmt.Errorf("failed to set Nerf: %v", err)
 	}
+	if !written {
+		if currentScene.Status != scene.StatusNerfProcessing {
+			s.logger.Infof("Discarding duplicate NERF output of scene %s", sceneID.Hex())
+			return nil
+		}
+		s.logger.Infof("Resuming recorded NERF output of scene %s", sceneID.Hex())
+	}
 
+	// The queues may have been left by a delivery that failed before completing the scene
 	err = s.queueManager.DeleteFromQueue(ctx, "nerf_list", sceneID)
-	if err != nil {
+	if err != nil && err != queue.ErrIDNotFoundInQueue && err != queue.ErrInvalidOpOnEmptyQueue {
 		return fmt.Errorf("failed to pop from nerf_list: %v", err)
 	}
 
 	err = s.queueManager.DeleteFromQueue(ctx, "queue_list", sceneID)
-	if err != nil {
+	if err != nil && err != queue.ErrIDNotFoundInQueue && err != queue.ErrInvalidOpOnEmptyQueue {
 		return fmt.Errorf("failed to pop from queue_list: %v", err)
 	}
 
+	if err := s.sceneManager.SetSceneStatus(ctx, sceneID, scene.StatusComplete); err != nil {
+		return fmt.Errorf("failed to set scene status: %v", err)
+	}
+	s.logSceneEvent(ctx, sceneID, scene.StageNerf, "info", "NeRF training completed")
+	s.notifySceneOwner(ctx, sceneID, user.NotificationSceneCompleted, "")
+
+	return nil
+}
+
+// processProgress processes a message from the 'progress-out' queue.
+//
+// Workers may report their progress within the current stage while processing a scene. Progress is only moved
+// forward (see SceneManager.SetStageProgress), so late or duplicate messages are ignored. Invalid messages are
+// dropped, as requeueing them would not make them valid.
+//
+// The expected message format is:
+//
+//	{
+//	    "id": string (primitive.ObjectID.Hex()),
+//	    "stage": string ("sfm" or "nerf"),
+//	    "progress": float64 (0-100)
+//	}
+func (s *AMPQService) processProgress(msg amqp.Delivery) error {
+	type ProgressData struct {
+		SceneID  string  `json:"id"`
+		Stage    string  `json:"stage"`
+		Progress float64 `json:"progress"`
+	}
+
+	var data ProgressData
+	if err := json.Unmarshal(msg.Body, &data); err != nil {
+		s.logger.Errorf("Dropping invalid progress message: %v", err)
+		return nil
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(data.SceneID)
+	if err != nil {
+		s.logger.Errorf("Dropping progress message with invalid ID: %v", err)
+		return nil
+	}
+
+	updated, err := s.sceneManager.SetStageProgress(context.Background(), sceneID, data.Stage, data.Progress)
+	if err != nil {
+		if errors.Is(err, scene.ErrInvalidStageProgress) {
+			s.logger.Errorf("Dropping invalid progress for scene %s: %s %v%%", sceneID.Hex(), data.Stage, data.Progress)
+			return nil
+		}
+		return fmt.Errorf("failed to set stage progress: %v", err)
+	}
+	if !updated {
+		s.logger.Debugf("Ignoring stale progress for scene %s: %s %v%%", sceneID.Hex(), data.Stage, data.Progress)
+	}
 	return nil
 }
+
+// processHeartbeat processes a message from the 'heartbeat-out' queue, published periodically by each worker.
+// Expects json of the form {"worker_id": string, "stage": string (optional)}.
+func (s *AMPQService) processHeartbeat(msg amqp.Delivery) error {
+	type HeartbeatData struct {
+		WorkerID string `json:"worker_id"`
+		Stage    string `json:"stage"`
+	}
+
+	var data HeartbeatData
+	if err := json.Unmarshal(msg.Body, &data); err != nil || data.WorkerID == "" {
+		s.logger.Errorf("Dropping invalid heartbeat message: %s", msg.Body)
+		return nil
+	}
+
+	s.workers.Beat(data.WorkerID, data.Stage, time.Now())
+	return nil
+}
+
+// downloadFile downloads the file at url and saves it at filePath.
+func downloadFile(url, filePath string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
@@ -0,0 +1,36 @@
+// This file contains the AMPQServiceConfig struct, which holds the tunable settings of an AMPQService.
+// Values are expected to be populated by the caller (usually from environment variables in main), falling back
+// to DefaultAMPQServiceConfig for anything not provided.
+
+package services
+
+import "time"
+
+// AMPQServiceConfig holds the tunable settings of an AMPQService.
+type AMPQServiceConfig struct {
+	// OutputCompression maps a nerf output type (i.e "point_cloud") to the compression ("gzip" or "zstd") it is
+	// stored with. Output types without an entry are stored as received.
+	OutputCompression map[string]string
+	// WorkerURLSecret is the key the worker data URLs sent to workers are signed with (see WorkerURLSigner). It must
+	// match the WebServer's. If empty, URLs are sent unsigned, and workers need the worker token to fetch them.
+	WorkerURLSecret string
+	// WorkerURLTTL is how long signed worker data URLs are valid for. It should cover the time a job may wait in
+	// its queue before a worker picks it up.
+	WorkerURLTTL time.Duration
+	// WorkerHeartbeatTimeout is how long a worker is considered healthy after its last heartbeat. It should be a few
+	// times the interval workers send heartbeats at.
+	WorkerHeartbeatTimeout time.Duration
+	// SyncWrites enables flushing worker outputs to stable storage (fsync) before they are recorded, so they survive
+	// a power failure once the scene is reported complete.
+	SyncWrites bool
+}
+
+// DefaultAMPQServiceConfig returns the default AMPQService configuration.
+func DefaultAMPQServiceConfig() AMPQServiceConfig {
+	return AMPQServiceConfig{
+		OutputCompression:      map[string]string{},
+		WorkerURLTTL:           12 * time.Hour,
+		WorkerHeartbeatTimeout: time.Minute,
+		SyncWrites:             true,
+	}
+}
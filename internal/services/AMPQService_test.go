@@ -0,0 +1,167 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/queue"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// countingAcknowledger counts the acknowledgements of deliveries.
+type countingAcknowledger struct {
+	acks, nacks int
+}
+
+func (a *countingAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acks++
+	return nil
+}
+
+func (a *countingAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.nacks++
+	return nil
+}
+
+func (a *countingAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.nacks++
+	return nil
+}
+
+// newMockedAMPQService returns an AMPQService on the mocked client, without a broker connection, so publishing a
+// job panics.
+func newMockedAMPQService(mt *mtest.T) *AMPQService {
+	return &AMPQService{
+		sceneManager: scene.NewSceneManager(mt.Client, scene.DefaultSceneManagerConfig(), nopLogger(), true),
+		queueManager: queue.NewQueueListManager(mt.Client, queue.QueueListManagerConfig{}, nopLogger(), true),
+		workerURLs:   NewWorkerURLSigner(""),
+		logger:       nopLogger(),
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// sfmDelivery returns a delivery of sfm-worker output without frames for the scene.
+func sfmDelivery(t *testing.T, sceneID primitive.ObjectID, ack amqp.Acknowledger) amqp.Delivery {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"id": sceneID.Hex(), "vid_width": 1920, "vid_height": 1080})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Body: body}
+}
+
+// inTempDir changes the working directory to a temporary directory for the test, as worker output is saved
+// relative to it.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestProcessSFMJobLeavesAcknowledgementToConsume(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("duplicate output", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		sceneID := primitive.NewObjectID()
+		sceneDoc := bson.D{{Key: "_id", Value: sceneID}, {Key: "status", Value: scene.StatusNerfProcessing}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, sceneDoc),
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, sceneDoc),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}},
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+		)
+		s := newMockedAMPQService(mt)
+		ack := &countingAcknowledger{}
+
+		if err := s.processSFMJob(sfmDelivery(mt.T, sceneID, ack)); err != nil {
+			mt.Fatalf("processSFMJob: %v", err)
+		}
+		if ack.acks != 0 || ack.nacks != 0 {
+			mt.Fatalf("processSFMJob acknowledged the delivery (%d acks, %d nacks), consume acknowledges it", ack.acks, ack.nacks)
+		}
+	})
+
+	mt.Run("error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		s := newMockedAMPQService(mt)
+		ack := &countingAcknowledger{}
+
+		if err := s.processSFMJob(sfmDelivery(mt.T, primitive.NewObjectID(), ack)); err == nil {
+			mt.Fatal("processSFMJob succeeded, want the database error")
+		}
+		if ack.acks != 0 || ack.nacks != 0 {
+			mt.Fatalf("processSFMJob acknowledged the delivery (%d acks, %d nacks), consume acknowledges it", ack.acks, ack.nacks)
+		}
+	})
+}
+
+func TestProcessSFMJobCompletesSfmOnlyScenes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("sfm only", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		sceneID := primitive.NewObjectID()
+		sceneDoc := bson.D{
+			{Key: "_id", Value: sceneID},
+			{Key: "status", Value: scene.StatusSfmProcessing},
+			{Key: "video", Value: bson.D{{Key: "file_path", Value: "data/raw/videos/video.mp4"}}},
+			{Key: "config", Value: bson.D{{Key: "sfm_only", Value: true}}},
+		}
+		updated := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}}
+		queued := func(name string) bson.D {
+			return mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: name},
+				{Key: "queue", Value: bson.A{sceneID}},
+			})
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, sceneDoc),
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, sceneDoc),
+			updated,              // SetSfm
+			updated,              // SetVideo
+			queued("sfm_list"),   // DeleteFromQueue
+			updated,              //
+			queued("queue_list"), // DeleteFromQueue
+			updated,              //
+			updated,              // SetSceneStatus
+			updated,              // AppendSceneLog
+		)
+		// The service has no broker channel, so publishing a NeRF job would panic
+		s := newMockedAMPQService(mt)
+		ack := &countingAcknowledger{}
+
+		if err := s.processSFMJob(sfmDelivery(mt.T, sceneID, ack)); err != nil {
+			mt.Fatalf("processSFMJob: %v", err)
+		}
+		if ack.acks != 0 || ack.nacks != 0 {
+			mt.Fatalf("processSFMJob acknowledged the delivery (%d acks, %d nacks), consume acknowledges it", ack.acks, ack.nacks)
+		}
+
+		var status bson.RawValue
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "update" {
+				continue
+			}
+			update := event.Command.Lookup("updates").Array().Index(0).Value().Document()
+			if value, err := update.LookupErr("u", "$set", "status"); err == nil {
+				status = value
+			}
+		}
+		if got, ok := status.AsInt64OK(); !ok || got != scene.StatusComplete {
+			mt.Fatalf("scene status set to %v, want StatusComplete (%d)", status, scene.StatusComplete)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+// This file contains the deletion of user accounts, along with everything they own: their scenes, the files of those
+// scenes, their sessions, their notifications, and their access to scenes shared with them.
+//
+// Deletion is not a single transaction, so it is ordered to be safely retried: files are removed first, while the
+// scenes listing them still exist, then the scenes, and the user record last. If a step fails, the steps after it
+// have not run, and repeating the request resumes the deletion (removing files and scenes that are already gone is
+// a no-op).
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/queue"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// UserDeletion summarizes what was deleted along with a user account.
+type UserDeletion struct {
+	// ScenesDeleted is the number of the user's scenes deleted.
+	ScenesDeleted int64 `json:"scenes_deleted"`
+	// BytesFreed is the total size of the files removed.
+	BytesFreed int64 `json:"bytes_freed"`
+	// SharesRemoved is the number of other users' scenes the user lost access to.
+	SharesRemoved int64 `json:"shares_removed"`
+	// SessionsDeleted is the number of refresh tokens deleted.
+	SessionsDeleted int64 `json:"sessions_deleted"`
+	// NotificationsDeleted is the number of notifications deleted from the user's inbox.
+	NotificationsDeleted int64 `json:"notifications_deleted"`
+}
+
+// UserDeletionError is returned when the deletion of a user account stopped part way. The account still exists,
+// and the deletion may be retried.
+type UserDeletionError struct {
+	// Step is the step that failed (i.e "remove files").
+	Step string
+	// Deleted is what was deleted before the failure.
+	Deleted *UserDeletion
+	Err     error
+}
+
+func (e *UserDeletionError) Error() string {
+	return fmt.Sprintf("account deletion incomplete, failed to %s: %v", e.Step, e.Err)
+}
+
+func (e *UserDeletionError) Unwrap() error {
+	return e.Err
+}
+
+// DeleteUser deletes the user with the given ID, all of their scenes (including ones still processing, whose results
+// are then discarded) and the files of those scenes, ends all of their sessions, deletes their notifications, and
+// removes them from the scenes shared with them. Their tokens are rejected once the user is gone.
+//
+// Returns a summary of what was deleted, user.ErrUserNotFound if the user does not exist, or a *UserDeletionError if
+// the deletion stopped part way.
+func (s *ClientService) DeleteUser(ctx context.Context, userID primitive.ObjectID) (*UserDeletion, error) {
+	s.logger.Debug("Delete user request received")
+
+	u, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		s.logger.Info("Error getting user:", err.Error())
+		return nil, err
+	}
+
+	deleted := &UserDeletion{}
+	fail := func(step string, err error) (*UserDeletion, error) {
+		s.logger.Errorf("Failed to %s of deleted user %s: %v", step, userID.Hex(), err)
+		return nil, &UserDeletionError{Step: step, Deleted: deleted, Err: err}
+	}
+
+	scenes, err := s.sceneManager.GetOwnedScenes(ctx, userID, u.SceneIDs)
+	if err != nil {
+		return fail("get scenes", err)
+	}
+
+	// Files first: once the scenes are deleted, nothing lists them anymore
+	var fileErrs []error
+	for _, path := range userScenePaths(scenes) {
+		size, _ := directorySize(path)
+		if err := os.RemoveAll(path); err != nil {
+			fileErrs = append(fileErrs, err)
+			continue
+		}
+		deleted.BytesFreed += size
+	}
+	s.storageUsage.Add(-deleted.BytesFreed)
+	if len(fileErrs) > 0 {
+		return fail("remove files", errors.Join(fileErrs...))
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(scenes))
+	for _, sc := range scenes {
+		ids = append(ids, sc.ID)
+	}
+	for _, queueName := range s.queueManager.GetQueueNames() {
+		for _, id := range ids {
+			err := s.queueManager.DeleteFromQueue(ctx, queueName, id)
+			if err != nil && err != queue.ErrIDNotFoundInQueue && err != queue.ErrInvalidOpOnEmptyQueue {
+				return fail("remove scenes from "+queueName, err)
+			}
+		}
+	}
+	if deleted.ScenesDeleted, err = s.sceneManager.DeleteScenes(ctx, ids); err != nil {
+		return fail("delete scenes", err)
+	}
+
+	if deleted.SharesRemoved, err = s.sceneManager.RemoveSharedUserFromAll(ctx, userID); err != nil {
+		return fail("remove shared scene access", err)
+	}
+	if deleted.SessionsDeleted, err = s.refreshTokens.DeleteUserTokens(ctx, userID); err != nil {
+		return fail("delete sessions", err)
+	}
+	if deleted.NotificationsDeleted, err = s.notifications.DeleteUserNotifications(ctx, userID); err != nil {
+		return fail("delete notifications", err)
+	}
+
+	// The user record is the commit point: once it is gone, the deletion cannot be retried
+	if err := s.userManager.DeleteUser(ctx, userID); err != nil {
+		return fail("delete user", err)
+	}
+
+	s.logger.Info("User deleted successfully")
+	return deleted, nil
+}
+
+// userScenePaths returns the paths of the files of the given scenes: uploaded videos, and sfm and nerf outputs.
+// Scenes are only promoted from scenes of the same owner, so files shared through promotion are all included.
+func userScenePaths(scenes []*scene.Scene) []string {
+	var paths []string
+	add := func(path string) {
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	for _, sc := range scenes {
+		ids := []primitive.ObjectID{sc.ID}
+		if sc.PromotedFrom != nil {
+			ids = append(ids, *sc.PromotedFrom)
+		}
+		for _, id := range ids {
+			add(filepath.Join("data", "raw", "videos", id.Hex()+".mp4"))
+			add(filepath.Join("data", "sfm", id.Hex()))
+			add(filepath.Join("data", "nerf", id.Hex()))
+		}
+		if sc.Video != nil && sc.Video.FilePath != "" {
+			add(sc.Video.FilePath)
+		}
+		if sc.Video != nil && sc.Video.OriginalFilePath != "" {
+			add(sc.Video.OriginalFilePath)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,362 @@
+// This file contains the ChunkedUploadStore, which assembles videos uploaded in chunks. Large videos uploaded in a
+// single request have to be sent again from the start if the connection drops; chunked uploads can be resumed from
+// the last chunk the server received instead.
+//
+// A chunked upload is initialized with the name and total size of the video, and the options of the scene to create.
+// Chunks are then appended in order, each starting where the previous one ended, to a part file on disk. Once all
+// bytes are received, the upload is completed: the part file is handed to HandleIncomingVideo like any other upload.
+//
+// The state of uploads is kept in memory, so uploads in progress are lost on restart. Uploads that receive no chunk
+// for a while are abandoned, and removed along with their part files by the MaintenanceService, which also removes the
+// part files left by a previous run when it starts.
+
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// chunkedUploadExt is the extension of the part files of chunked uploads.
+const chunkedUploadExt = ".part"
+
+var (
+	// ErrChunkedUploadNotFound is returned when a chunked upload does not exist, belongs to another user, or was
+	// abandoned.
+	ErrChunkedUploadNotFound = errors.New("chunked upload not found")
+	// ErrChunkedUploadBusy is returned when a chunk is sent while another chunk of the same upload is being written.
+	ErrChunkedUploadBusy = errors.New("another chunk of this upload is in progress")
+	// ErrChunkedUploadIncomplete is returned when completing an upload before all of its bytes were received.
+	ErrChunkedUploadIncomplete = errors.New("chunked upload is incomplete")
+	// ErrChunkTooLarge is returned when a chunk extends past the declared size of the upload.
+	ErrChunkTooLarge = errors.New("chunk extends past the upload size")
+)
+
+// ChunkOffsetError is returned when a chunk does not start where the previous chunk ended.
+type ChunkOffsetError struct {
+	// Expected is the offset the next chunk must start at.
+	Expected int64
+}
+
+func (e *ChunkOffsetError) Error() string {
+	return fmt.Sprintf("chunk out of order, the next chunk must start at byte %d", e.Expected)
+}
+
+// ChunkedUploadStatus is a snapshot of a chunked upload.
+type ChunkedUploadStatus struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Received int64  `json:"received"`
+}
+
+// chunkedUpload is the tracked state of a single chunked upload.
+type chunkedUpload struct {
+	userID   primitive.ObjectID
+	filename string
+	size     int64
+	received int64
+	opts     NewSceneOptions
+	// busy is set while a chunk is written or the upload is completed
+	busy      bool
+	updatedAt time.Time
+}
+
+// ChunkedUploadStore tracks chunked uploads and their part files.
+type ChunkedUploadStore struct {
+	dir     string
+	mu      sync.Mutex
+	uploads map[string]*chunkedUpload
+}
+
+// NewChunkedUploadStore creates an empty ChunkedUploadStore, keeping part files in dir.
+func NewChunkedUploadStore(dir string) *ChunkedUploadStore {
+	return &ChunkedUploadStore{dir: dir, uploads: make(map[string]*chunkedUpload)}
+}
+
+// partPath returns the path of the part file of the upload with the given ID.
+func (st *ChunkedUploadStore) partPath(id string) string {
+	return filepath.Join(st.dir, id+chunkedUploadExt)
+}
+
+// status returns the snapshot of an upload. The caller must hold st.mu.
+func (u *chunkedUpload) status(id string) *ChunkedUploadStatus {
+	return &ChunkedUploadStatus{ID: id, Filename: u.filename, Size: u.size, Received: u.received}
+}
+
+// create starts tracking a new upload, with an empty part file.
+func (st *ChunkedUploadStore) create(userID primitive.ObjectID, filename string, size int64, opts NewSceneOptions) (*ChunkedUploadStatus, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(raw)
+
+	if err := os.MkdirAll(st.dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	part, err := os.Create(st.partPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if err := part.Close(); err != nil {
+		return nil, err
+	}
+
+	upload := &chunkedUpload{userID: userID, filename: filename, size: size, opts: opts, updatedAt: time.Now()}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.uploads[id] = upload
+	return upload.status(id), nil
+}
+
+// get returns the user's upload with the given ID. The caller must hold st.mu.
+func (st *ChunkedUploadStore) get(userID primitive.ObjectID, id string) (*chunkedUpload, error) {
+	upload, ok := st.uploads[id]
+	if !ok || upload.userID != userID {
+		return nil, ErrChunkedUploadNotFound
+	}
+	return upload, nil
+}
+
+// acquire returns the user's upload with the given ID, and marks it busy until release is called.
+func (st *ChunkedUploadStore) acquire(userID primitive.ObjectID, id string) (*chunkedUpload, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	upload, err := st.get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.busy {
+		return nil, ErrChunkedUploadBusy
+	}
+	upload.busy = true
+	return upload, nil
+}
+
+// release clears the busy mark of an upload returned by acquire.
+func (st *ChunkedUploadStore) release(upload *chunkedUpload) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	upload.busy = false
+	upload.updatedAt = time.Now()
+}
+
+// remove stops tracking the upload with the given ID, and removes its part file.
+func (st *ChunkedUploadStore) remove(id string) error {
+	st.mu.Lock()
+	delete(st.uploads, id)
+	st.mu.Unlock()
+
+	if err := os.Remove(st.partPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Expire removes the uploads that received no chunk since before, along with their part files. Part files left
+// without an upload (i.e after a restart) are removed once they were last modified before it.
+//
+// Returns the number of part files removed.
+func (st *ChunkedUploadStore) Expire(before time.Time) (int, error) {
+	st.mu.Lock()
+	for id, upload := range st.uploads {
+		if !upload.busy && upload.updatedAt.Before(before) {
+			delete(st.uploads, id)
+		}
+	}
+	st.mu.Unlock()
+
+	return st.removeUntracked(before)
+}
+
+// RemoveOrphans removes all part files without an upload. Uploads are only tracked in memory, so the part files left
+// by a previous run (i.e one that crashed) can never be completed; this removes them without waiting for Expire.
+//
+// Returns the number of part files removed.
+func (st *ChunkedUploadStore) RemoveOrphans() (int, error) {
+	return st.removeUntracked(time.Now())
+}
+
+// removeUntracked removes the part files without an upload that were last modified before the given time.
+//
+// Returns the number of part files removed.
+func (st *ChunkedUploadStore) removeUntracked(before time.Time) (int, error) {
+	entries, err := os.ReadDir(st.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), chunkedUploadExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		st.mu.Lock()
+		_, tracked := st.uploads[id]
+		st.mu.Unlock()
+		if tracked {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(st.partPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// InitChunkedUpload starts a chunked upload of a video of the given name and total size, to create a scene with the
+// given options once completed. Uploads are rejected up front for the same reasons as HandleIncomingVideo would.
+//
+// Returns the status of the new upload, holding its ID, or error if uploads are not accepted or an error occurred.
+func (s *ClientService) InitChunkedUpload(ctx context.Context, userID primitive.ObjectID, filename string, size int64, opts NewSceneOptions) (*ChunkedUploadStatus, error) {
+	s.logger.Debug("Init chunked upload request received")
+
+	if err := s.checkUploadsAccepted(); err != nil {
+		s.logger.Info("Rejecting upload:", err.Error())
+		return nil, err
+	}
+	if !slices.Contains(videoExtensions, strings.ToLower(filepath.Ext(filename))) {
+		return nil, fmt.Errorf("improper file extension")
+	}
+
+	status, err := s.chunkedUploads.create(userID, filename, size, opts)
+	if err != nil {
+		s.logger.Error("Error creating chunked upload:", err.Error())
+		return nil, err
+	}
+
+	s.logger.Info("Chunked upload initialized successfully")
+	return status, nil
+}
+
+// GetChunkedUpload returns the status of the user's chunked upload, i.e to find where to resume it from.
+//
+// Returns ErrChunkedUploadNotFound if the user has no such upload.
+func (s *ClientService) GetChunkedUpload(userID primitive.ObjectID, uploadID string) (*ChunkedUploadStatus, error) {
+	s.chunkedUploads.mu.Lock()
+	defer s.chunkedUploads.mu.Unlock()
+
+	upload, err := s.chunkedUploads.get(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return upload.status(uploadID), nil
+}
+
+// AppendChunk appends the next length bytes of the user's chunked upload, read from chunk. The chunk must start at
+// offset, where the previous chunk ended, and must not extend past the size of the upload.
+//
+// If chunk ends early, the bytes read are kept, and the upload can be resumed from where it ended.
+//
+// Returns the status of the upload, or a *ChunkOffsetError if the chunk is out of order, ErrChunkTooLarge if it is
+// too large, ErrChunkedUploadNotFound if the user has no such upload, or another error if one occurred.
+func (s *ClientService) AppendChunk(ctx context.Context, userID primitive.ObjectID, uploadID string, offset, length int64, chunk io.Reader) (*ChunkedUploadStatus, error) {
+	s.logger.Debug("Append chunk request received")
+
+	upload, err := s.chunkedUploads.acquire(userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.chunkedUploads.release(upload)
+
+	if offset != upload.received {
+		return nil, &ChunkOffsetError{Expected: upload.received}
+	}
+	if length < 0 || offset+length > upload.size {
+		return nil, ErrChunkTooLarge
+	}
+
+	part, err := os.OpenFile(s.chunkedUploads.partPath(uploadID), os.O_WRONLY, 0)
+	if err != nil {
+		// The part file was removed, so the upload cannot be resumed
+		s.logger.Error("Error opening chunked upload part file:", err.Error())
+		s.chunkedUploads.remove(uploadID)
+		return nil, ErrChunkedUploadNotFound
+	}
+	defer part.Close()
+
+	// Anything past the received bytes is left over from a chunk that ended early
+	if err := part.Truncate(offset); err != nil {
+		return nil, err
+	}
+	if _, err := part.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	written, err := io.Copy(part, io.LimitReader(chunk, length))
+	if err == nil && written < length {
+		err = io.ErrUnexpectedEOF
+	}
+	s.chunkedUploads.mu.Lock()
+	upload.received += written
+	status := upload.status(uploadID)
+	s.chunkedUploads.mu.Unlock()
+
+	if err != nil {
+		s.logger.Info("Chunk ended early:", err.Error())
+		return status, err
+	}
+
+	s.logger.Debugf("Chunk appended, %d of %d bytes received", status.Received, status.Size)
+	return status, nil
+}
+
+// CompleteChunkedUpload completes the user's chunked upload once all of its bytes were received, creating its scene
+// with HandleIncomingVideo. The upload and its part file are removed once the scene is created; if creating it fails,
+// the upload is kept so completing it can be retried.
+//
+// Returns the scene ID if successful, ErrChunkedUploadIncomplete if bytes are missing, ErrChunkedUploadNotFound if
+// the user has no such upload, or any error HandleIncomingVideo returns.
+func (s *ClientService) CompleteChunkedUpload(ctx context.Context, userID primitive.ObjectID, uploadID string) (string, error) {
+	s.logger.Debug("Complete chunked upload request received")
+
+	upload, err := s.chunkedUploads.acquire(userID, uploadID)
+	if err != nil {
+		return "", err
+	}
+	defer s.chunkedUploads.release(upload)
+
+	if upload.received != upload.size {
+		return "", fmt.Errorf("%w: %d of %d bytes received", ErrChunkedUploadIncomplete, upload.received, upload.size)
+	}
+
+	partPath := s.chunkedUploads.partPath(uploadID)
+	sceneID, err := s.HandleIncomingVideo(ctx, userID, &VideoFile{
+		Name: upload.filename,
+		Size: upload.size,
+		Open: func() (io.ReadCloser, error) { return os.Open(partPath) },
+	}, upload.opts)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.chunkedUploads.remove(uploadID); err != nil {
+		s.logger.Error("Error removing chunked upload part file:", err.Error())
+	}
+
+	s.logger.Info("Chunked upload completed successfully")
+	return sceneID, nil
+}
@@ -10,14 +10,20 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
@@ -28,28 +34,116 @@ import (
 )
 
 type ClientService struct {
-	mqService    *AMPQService
-	sceneManager *scene.SceneManager
-	userManager  *user.UserManager
-	queueManager *queue.QueueListManager
-	logger       *log.Logger
+	mqService      *AMPQService
+	sceneManager   *scene.SceneManager
+	userManager    *user.UserManager
+	queueManager   *queue.QueueListManager
+	refreshTokens  *user.RefreshTokenManager
+	notifications  *user.NotificationManager
+	revoker        user.TokenRevoker
+	config         ClientServiceConfig
+	statsCache     *platformStatsCache
+	etaCache       *completionIntervalCache
+	outputSizes    *outputSizeCache
+	uploads        *UploadProgressTracker
+	webhooks       *webhookSender
+	tasks          *TaskPool
+	chunkedUploads *ChunkedUploadStore
+	storage        *StorageChecker
+	storageUsage   *StorageTracker
+	storageCleanup atomic.Bool
+	logins         *LoginLockout
+	logger         *log.Logger
+	// opens critical files to flush them, openFile if nil
+	openFile fileOpener
 }
 
 // NewClientService creates a new ClientService. Dependencies are injected via the constructor.
-func NewClientService(mqs *AMPQService, sm *scene.SceneManager, um *user.UserManager, qlm *queue.QueueListManager, logger *log.Logger) *ClientService {
+func NewClientService(mqs *AMPQService, sm *scene.SceneManager, um *user.UserManager, qlm *queue.QueueListManager, rtm *user.RefreshTokenManager, lfm *user.LoginFailureManager, nm *user.NotificationManager, revoker user.TokenRevoker, tasks *TaskPool, chunkedUploads *ChunkedUploadStore, config ClientServiceConfig, logger *log.Logger) *ClientService {
 	return &ClientService{
-		mqService:    mqs,
-		sceneManager: sm,
-		userManager:  um,
-		queueManager: qlm,
-		logger:       logger,
+		mqService:      mqs,
+		sceneManager:   sm,
+		userManager:    um,
+		queueManager:   qlm,
+		refreshTokens:  rtm,
+		notifications:  nm,
+		revoker:        revoker,
+		config:         config,
+		statsCache:     &platformStatsCache{},
+		etaCache:       &completionIntervalCache{},
+		outputSizes:    &outputSizeCache{},
+		uploads:        NewUploadProgressTracker(),
+		webhooks:       newWebhookSender(config.WebhookTimeout, config.WebhookAllowPrivate),
+		tasks:          tasks,
+		chunkedUploads: chunkedUploads,
+		storage:        NewStorageChecker("data", logger),
+		storageUsage:   NewStorageTracker("data", config.StorageUsageRefresh),
+		logins:         NewLoginLockout(lfm, config.LoginLockoutThreshold, config.LoginLockoutDuration),
+		logger:         logger,
 	}
 }
 
-// verifyUserAccess checks if the given user has access to the given scene.
+// CheckStorage checks that the data directory is writable, if StorageCheck is enabled.
+//
+// Returns nil if it is writable or the check is disabled, or ErrStorageReadOnly if it is not writable.
+func (s *ClientService) CheckStorage() error {
+	if !s.config.StorageCheck {
+		return nil
+	}
+	return s.storage.Check()
+}
+
+// verifyUserAccess checks if the given user has read access to the given scene.
+// A user has read access if they own the scene, or if the scene has been shared with them.
 //
 // Returns nil if the user has access, error if the user does not have access or an error occurred.
 func (s *ClientService) verifyUserAccess(ctx context.Context, userID, sceneID primitive.ObjectID) error {
+	_, err := s.sceneAccess(ctx, userID, sceneID)
+	return err
+}
+
+// sceneAccess checks if the given user has read access to the given scene, like verifyUserAccess, and whether they own
+// it.
+//
+// Returns true if the user owns the scene, false if it has been shared with them, or error if the user does not have
+// access or an error occurred.
+func (s *ClientService) sceneAccess(ctx context.Context, userID, sceneID primitive.ObjectID) (bool, error) {
+	authorized, err := s.userManager.UserHasJobAccess(ctx, userID, sceneID)
+	if err != nil {
+		return false, err
+	}
+	if authorized {
+		return true, nil
+	}
+
+	shared, err := s.sceneManager.IsSharedWith(ctx, sceneID, userID)
+	if err != nil {
+		return false, err
+	}
+	if !shared {
+		return false, user.ErrUserNoAccess
+	}
+	return false, nil
+}
+
+// userSceneIDs returns the scene list of the given user. Scenes created before owners were recorded on scenes are
+// only linked to their owner by this list. A user that does not exist has an empty list.
+func (s *ClientService) userSceneIDs(ctx context.Context, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	u, err := s.userManager.GetUserByID(ctx, userID)
+	if errors.Is(err, user.ErrUserNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u.SceneIDs, nil
+}
+
+// verifyUserOwnership checks if the given user owns the given scene. Shared access is not sufficient.
+// Use this for any operation that modifies or deletes a scene.
+//
+// Returns nil if the user owns the scene, error if the user does not own the scene or an error occurred.
+func (s *ClientService) verifyUserOwnership(ctx context.Context, userID, sceneID primitive.ObjectID) error {
 	authorized, err := s.userManager.UserHasJobAccess(ctx, userID, sceneID)
 	if err != nil {
 		return err
@@ -60,27 +154,216 @@ func (s *ClientService) verifyUserAccess(ctx context.Context, userID, sceneID pr
 	return nil
 }
 
+// verifySceneOwner checks if the given user owns the given scene, like verifyUserOwnership, but reports scenes the
+// user does not own as scene.ErrSceneNotFound, so the scenes of other users are indistinguishable from missing ones.
+// Use this for owner-only operations on scenes that may be shared with the user.
+func (s *ClientService) verifySceneOwner(ctx context.Context, userID, sceneID primitive.ObjectID) error {
+	err := s.verifyUserOwnership(ctx, userID, sceneID)
+	if errors.Is(err, user.ErrUserNoAccess) {
+		return scene.ErrSceneNotFound
+	}
+	return err
+}
+
 // LoginUser checks if the given username and password are correct and returns the user's ID, nil if successful.
+// After LoginLockoutThreshold consecutive failures the account is locked for LoginLockoutDuration, during which
+// logins are refused without checking the password. Failures are stored, so lockouts hold across restarts and
+// server instances.
 //
-// Returns "", error if the username or password is incorrect.
+// Returns "", error if the username or password is incorrect, or an AccountLockedError if the account is locked.
 func (s *ClientService) LoginUser(ctx context.Context, username, password string) (string, error) {
-	user, err := s.userManager.GetUserByUsername(ctx, username)
-	if err != nil {
+	if err := s.logins.Check(ctx, username); err != nil {
+		s.logger.Info("Login refused:", err.Error())
 		return "", err
 	}
 
-	err = user.CheckPassword(password)
+	user, err := s.userManager.GetUserByUsername(ctx, username)
+	if err == nil {
+		err = user.CheckPassword(password)
+	}
 	if err != nil {
+		lockErr := s.logins.Fail(ctx, username)
+		if errors.Is(lockErr, ErrAccountLocked) {
+			s.logger.Info("Account locked after repeated failed logins:", username)
+			return "", lockErr
+		}
+		if lockErr != nil {
+			s.logger.Error("Failed to record failed login:", lockErr.Error())
+		}
 		return "", err
 	}
+	if err := s.logins.Succeed(ctx, username); err != nil {
+		s.logger.Error("Failed to reset failed logins:", err.Error())
+	}
+
+	// Upgrade hashes created by a previously configured algorithm. Failure here should not block the login.
+	if err := s.userManager.RehashPasswordIfNeeded(ctx, user, password); err != nil {
+		s.logger.Error("Failed to migrate password hash:", err.Error())
+	}
 
 	return user.ID.Hex(), nil
 }
 
+// ErrTokenRevoked is returned when a token was issued before the user's tokens were revoked.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// TokenClaims is the current state of a user that is embedded in their tokens.
+type TokenClaims struct {
+	UserID       string
+	Role         string
+	TokenVersion int
+}
+
+// GetTokenClaims returns the claims a newly issued token for the given user should carry, reflecting the user's
+// current role.
+//
+// Returns error if the user does not exist or an error occurred.
+func (s *ClientService) GetTokenClaims(ctx context.Context, userID primitive.ObjectID) (*TokenClaims, error) {
+	u, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	role := u.Role
+	if role == "" {
+		role = user.RoleUser
+	}
+	return &TokenClaims{
+		UserID:       u.ID.Hex(),
+		Role:         role,
+		TokenVersion: u.TokenVersion,
+	}, nil
+}
+
+// VerifyTokenVersion checks that a token issued with the given token version has not been revoked.
+//
+// Returns ErrTokenRevoked if it has, or error if the user does not exist or an error occurred.
+func (s *ClientService) VerifyTokenVersion(ctx context.Context, userID primitive.ObjectID, version int) error {
+	current, err := s.userManager.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if version != current {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RevokeToken revokes the token with the given ID (its `jti` claim), i.e on logout. The revocation is kept until
+// expiresAt, when the token expires; a zero expiresAt keeps it forever.
+func (s *ClientService) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	return s.revoker.Revoke(ctx, tokenID, expiresAt)
+}
+
+// IsTokenRevoked checks if the token with the given ID (its `jti` claim) was revoked with RevokeToken, or the session
+// with the given ID (its `sid` claim) was revoked with RevokeSession, in a single lookup. Tokens issued before
+// sessions were tracked have an empty session ID, and only the token is checked.
+func (s *ClientService) IsTokenRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	if sessionID == "" {
+		return s.revoker.IsRevoked(ctx, tokenID)
+	}
+	return s.revoker.IsRevoked(ctx, tokenID, sessionRevocationID(sessionID))
+}
+
+// IssueRefreshToken issues a new refresh token for the given user, valid for the configured RefreshTokenTTL.
+// It starts a new session, labelled with the given device.
+//
+// Returns the refresh token and the ID of the session. Returns error if the user does not exist or an error occurred.
+func (s *ClientService) IssueRefreshToken(ctx context.Context, userID primitive.ObjectID, device string) (string, string, error) {
+	version, err := s.userManager.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	token, sessionID, err := s.refreshTokens.Issue(ctx, userID, version, device, s.config.RefreshTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+	return token, sessionID.Hex(), nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. The given token can not be used again.
+// Refresh tokens issued before the user's tokens were revoked (see VerifyTokenVersion) are rejected.
+//
+// Returns the ID of the token's user, the ID of its session and the new refresh token. Returns
+// user.ErrRefreshTokenInvalid if the token is unknown, expired or revoked, user.ErrRefreshTokenReused if it was
+// already used, or error if an error occurred.
+func (s *ClientService) RotateRefreshToken(ctx context.Context, refreshToken string) (string, string, string, error) {
+	record, newToken, err := s.refreshTokens.Rotate(ctx, refreshToken, s.config.RefreshTokenTTL)
+	if err != nil {
+		s.logger.Info("Refresh token rejected:", err.Error())
+		return "", "", "", err
+	}
+
+	if err := s.VerifyTokenVersion(ctx, record.UserID, record.TokenVersion); err != nil {
+		s.logger.Info("Refresh token rejected:", err.Error())
+		if !errors.Is(err, ErrTokenRevoked) && !errors.Is(err, user.ErrUserNotFound) {
+			return "", "", "", err
+		}
+		if err := s.refreshTokens.RevokeFamily(ctx, record.FamilyID); err != nil {
+			s.logger.Errorf("Failed to revoke refresh token family: %v", err)
+		}
+		return "", "", "", user.ErrRefreshTokenInvalid
+	}
+
+	return record.UserID.Hex(), record.FamilyID.Hex(), newToken, nil
+}
+
+// GetUserSessions returns the active sessions (logins) of the user, most recently used first.
+func (s *ClientService) GetUserSessions(ctx context.Context, userID primitive.ObjectID) ([]user.Session, error) {
+	return s.refreshTokens.Sessions(ctx, userID)
+}
+
+// RevokeSession ends the user's session with the given ID: its refresh tokens are revoked, and the access tokens
+// issued to it are rejected until accessTokenExpiry, by when they have expired. A zero accessTokenExpiry rejects
+// them forever, for access tokens that never expire.
+//
+// Returns user.ErrSessionNotFound if the user has no active session with the ID, or error if an error occurred.
+func (s *ClientService) RevokeSession(ctx context.Context, userID, sessionID primitive.ObjectID, accessTokenExpiry time.Time) error {
+	s.logger.Debug("Revoking session", sessionID.Hex(), "of user", userID.Hex())
+
+	if err := s.refreshTokens.RevokeSession(ctx, userID, sessionID); err != nil {
+		s.logger.Info("Failed to revoke session:", err.Error())
+		return err
+	}
+	if err := s.revoker.Revoke(ctx, sessionRevocationID(sessionID.Hex()), accessTokenExpiry); err != nil {
+		return err
+	}
+
+	s.logger.Info("Session revoked successfully")
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere: all of their previously issued access and refresh tokens are
+// rejected, as they carry an older token version (see VerifyTokenVersion). Tokens issued afterwards (i.e by logging
+// in again) are accepted.
+//
+// Returns user.ErrUserNotFound if the user does not exist, or error if an error occurred.
+func (s *ClientService) RevokeAllSessions(ctx context.Context, userID primitive.ObjectID) error {
+	s.logger.Debug("Revoking all sessions of user", userID.Hex())
+
+	if _, err := s.userManager.RevokeTokens(ctx, userID); err != nil {
+		s.logger.Info("Failed to revoke all sessions:", err.Error())
+		return err
+	}
+
+	s.logger.Info("All sessions revoked successfully")
+	return nil
+}
+
+// sessionRevocationID returns the ID a revoked session is stored under in the token revoker, distinct from token IDs.
+func sessionRevocationID(sessionID string) string {
+	return "session:" + sessionID
+}
+
 // RegisterUser generates a new user document with the given username and password, and inserts it into the database.
 //
-// Returns nil if successful, error if the username is already taken or an error occurred while inserting the user.
+// Returns nil if successful, an error wrapping user.ErrWeakPassword if the password is too weak, user.ErrUsernameTaken
+// if the username is already taken, or error if an error occurred while inserting the user.
 func (s *ClientService) RegisterUser(ctx context.Context, username, password string) error {
+	if err := s.config.PasswordPolicy.Check(password); err != nil {
+		return err
+	}
+
 	_, err := s.userManager.GenerateUser(ctx, username, password)
 	if err != nil {
 		return err
@@ -96,50 +379,182 @@ func (s *ClientService) UpdateUserUsername(ctx context.Context, userID primitive
 	return s.userManager.UpdateUsername(ctx, userID, password, newUsername)
 }
 
-// UpdateUserPassword updates the password of the user with the given ID.
+// UpdateUserPassword updates the password of the user with the given ID, after verifying their old password. The new
+// password must meet the PasswordPolicy. All of the user's tokens and sessions are revoked, so anyone who knew the
+// old password is logged out, and the user has to log in again with the new one.
 //
-// Returns nil if successful, error if the user does not exist or an error occurred.
+// Returns nil if successful, an error wrapping user.ErrWeakPassword if the new password is too weak,
+// user.ErrIncorrectPassword if the old password is wrong, or error if the user does not exist or an error occurred.
 func (s *ClientService) UpdateUserPassword(ctx context.Context, userID primitive.ObjectID, oldPassword, newPassword string) error {
-	return s.userManager.UpdatePassword(ctx, userID, oldPassword, newPassword)
+	s.logger.Debug("Update password request received")
+
+	if err := s.config.PasswordPolicy.Check(newPassword); err != nil {
+		return err
+	}
+	if err := s.userManager.UpdatePassword(ctx, userID, oldPassword, newPassword); err != nil {
+		s.logger.Info("Failed to update password:", err.Error())
+		return err
+	}
+
+	if _, err := s.userManager.RevokeTokens(ctx, userID); err != nil {
+		s.logger.Error("Failed to revoke tokens after password change:", err.Error())
+		return err
+	}
+
+	s.logger.Info("Password updated successfully")
+	return nil
+}
+
+// UserProfile is the public profile of a user, as returned to the user themself.
+type UserProfile struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// GetUserByID returns the profile of the user with the given ID.
+//
+// Returns user.ErrUserNotFound if the user does not exist (i.e was deleted after their token was issued),
+// or error if an error occurred.
+func (s *ClientService) GetUserByID(ctx context.Context, userID primitive.ObjectID) (*UserProfile, error) {
+	s.logger.Debug("Get user request received")
+
+	u, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		s.logger.Info("Failed to get user:", err.Error())
+		return nil, err
+	}
+
+	return &UserProfile{
+		ID:       u.ID.Hex(),
+		Username: u.Username,
+	}, nil
+}
+
+// ResourceInfo is information about a single resource available for a scene.
+type ResourceInfo struct {
+	Exists        bool   `json:"exists"`
+	Size          int64  `json:"size,omitempty"`
+	Chunks        int    `json:"chunks,omitempty"`
+	LastChunkSize int64  `json:"last_chunk_size,omitempty"`
+	Compression   string `json:"compression,omitempty"`
+	// Downloads is the number of times the resource was downloaded, last at LastAccessedAt.
+	Downloads      int64      `json:"downloads"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+}
+
+// SceneMetadata is metadata about all resources available for a scene.
+type SceneMetadata struct {
+	Resources map[string]map[string]ResourceInfo `json:"resources"`
+	Thumbnail *scene.ImageSize                   `json:"thumbnail,omitempty"`
+	// SfmOnly is set for scenes that only run SfM, which have no resources but their sfm point cloud.
+	SfmOnly       bool          `json:"sfm_only,omitempty"`
+	SfmPointCloud *ResourceInfo `json:"sfm_point_cloud,omitempty"`
 }
 
 // GetSceneMetadata returns metadata about the resources available for the given scene.
 //
-// Returns error if the user does not have access to the scene or an error occurred.
+// Returns scene.ErrSceneNotFound if the scene does not exist or the user does not have access to it,
+// scene.ErrNerfNotFound if it has no outputs yet (scene.ErrSfmNotFound for SfM only scenes), or error if an error
+// occurred.
 // For each available output file type, it returns a map of iteration numbers to file information.
 // Specifically, it returns whether the file exists, its size, number of (1 MB) chunks, and size of the last chunk.
-func (s *ClientService) GetSceneMetadata(ctx context.Context, userID, sceneID primitive.ObjectID) (interface{}, error) {
-	// Information about a single resource available for a scene.
-	type ResourceInfo struct {
-		Exists        bool  `json:"exists"`
-		Size          int64 `json:"size,omitempty"`
-		Chunks        int   `json:"chunks,omitempty"`
-		LastChunkSize int64 `json:"last_chunk_size,omitempty"`
-	}
-	// Metadata about all resources available for a scene.
-	type SceneMetadata struct {
-		Resources map[string]map[string]ResourceInfo `json:"resources"`
+func (s *ClientService) GetSceneMetadata(ctx context.Context, userID, sceneID primitive.ObjectID) (*SceneMetadata, error) {
+	sceneIDs, err := s.userSceneIDs(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
-
-	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+	sc, err := s.sceneManager.GetSceneForUser(ctx, userID, sceneID, sceneIDs)
+	if err != nil {
 		return nil, err
 	}
+	return s.sceneMetadata(ctx, sc)
+}
 
-	nerf, err := s.sceneManager.GetNerf(ctx, sceneID)
+// ScenesMetadata is the metadata of several scenes, keyed by scene ID.
+type ScenesMetadata struct {
+	Scenes map[string]*SceneMetadata `json:"scenes"`
+	// Skipped lists the requested scenes without metadata: ones that do not exist, are not owned by the user, or
+	// have no outputs yet.
+	Skipped []string `json:"skipped"`
+}
+
+// GetScenesMetadata returns the metadata of each of the given scenes the user owns (see GetSceneMetadata), fetching
+// the scenes in a single query. Scenes the user does not own, and scenes without outputs yet, are skipped.
+//
+// Returns error if an error occurred.
+func (s *ClientService) GetScenesMetadata(ctx context.Context, userID primitive.ObjectID, sceneIDs []primitive.ObjectID) (*ScenesMetadata, error) {
+	s.logger.Debug("Get scenes metadata request received")
+
+	ownedIDs, err := s.userSceneIDs(ctx, userID)
 	if err != nil {
+		s.logger.Info("Error getting scenes:", err.Error())
 		return nil, err
 	}
-
-	config, err := s.sceneManager.GetTrainingConfig(ctx, sceneID)
+	scenes, err := s.sceneManager.GetScenesByIDs(ctx, userID, ownedIDs, sceneIDs)
 	if err != nil {
+		s.logger.Info("Error getting scenes:", err.Error())
 		return nil, err
 	}
 
+	result := &ScenesMetadata{
+		Scenes:  make(map[string]*SceneMetadata, len(scenes)),
+		Skipped: make([]string, 0),
+	}
+	for _, sc := range scenes {
+		metadata, err := s.sceneMetadata(ctx, sc)
+		if errors.Is(err, scene.ErrNerfNotFound) || errors.Is(err, scene.ErrTrainingConfigNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Scenes[sc.ID.Hex()] = metadata
+	}
+	for _, id := range sceneIDs {
+		if _, ok := result.Scenes[id.Hex()]; !ok && !slices.Contains(result.Skipped, id.Hex()) {
+			result.Skipped = append(result.Skipped, id.Hex())
+		}
+	}
+
+	s.logger.Info("Scenes metadata retrieved successfully")
+	return result, nil
+}
+
+// sceneMetadata returns metadata about the resources available for the given scene (see GetSceneMetadata).
+func (s *ClientService) sceneMetadata(ctx context.Context, sc *scene.Scene) (*SceneMetadata, error) {
+	if sc.IsSfmOnly() {
+		if sc.Sfm == nil {
+			return nil, scene.ErrSfmNotFound
+		}
+		metadata := &SceneMetadata{
+			Resources: make(map[string]map[string]ResourceInfo),
+			SfmOnly:   true,
+		}
+		if sc.Sfm.PointCloudFilePath != "" {
+			info := resourceInfo(sc.Sfm.PointCloudFilePath)
+			metadata.SfmPointCloud = &info
+		}
+		return metadata, nil
+	}
+
+	nerf := sc.Nerf
+	if nerf == nil {
+		return nil, scene.ErrNerfNotFound
+	}
+	if sc.Config == nil || sc.Config.NerfTrainingConfig == nil {
+		return nil, scene.ErrTrainingConfigNotFound
+	}
+
 	metadata := &SceneMetadata{
 		Resources: make(map[string]map[string]ResourceInfo),
 	}
 
-	for _, ot := range config.NerfTrainingConfig.OutputTypes {
+	// The thumbnail is optional; a scene without one still has metadata
+	if thumbnailPath, err := s.sceneThumbnailPath(sc); err == nil {
+		metadata.Thumbnail = s.sceneThumbnailSize(ctx, sc, thumbnailPath)
+	}
+
+	for _, ot := range sc.Config.NerfTrainingConfig.OutputTypes {
 
 		s.logger.Debug("Getting file paths for output type:", ot)
 
@@ -154,23 +569,11 @@ func (s *ClientService) GetSceneMetadata(ctx context.Context, userID, sceneID pr
 
 			s.logger.Debug("Getting file info for iteration:", iteration)
 
-			info := ResourceInfo{Exists: false}
-
-			if fileInfo, err := os.Stat(path); err == nil {
-
-				fileSize := fileInfo.Size()
-				chunks := (fileSize + 1024*1024 - 1) / (1024 * 1024)
-				lastChunkSize := fileSize % (1024 * 1024)
-				if lastChunkSize == 0 {
-					lastChunkSize = 1024 * 1024
-				}
+			info := resourceInfo(path)
 
-				info = ResourceInfo{
-					Exists:        true,
-					Size:          fileSize,
-					Chunks:        int(chunks),
-					LastChunkSize: lastChunkSize,
-				}
+			if downloads := sc.DownloadStats[ot][strconv.Itoa(iteration)]; downloads != nil {
+				info.Downloads = downloads.Count
+				info.LastAccessedAt = downloads.LastAccessedAt
 			}
 
 			metadata.Resources[ot][strconv.Itoa(iteration)] = info
@@ -179,40 +582,219 @@ func (s *ClientService) GetSceneMetadata(ctx context.Context, userID, sceneID pr
 	return metadata, nil
 }
 
+// resourceInfo returns the information about the resource stored at the given path.
+func resourceInfo(path string) ResourceInfo {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return ResourceInfo{Exists: false}
+	}
+
+	fileSize := fileInfo.Size()
+	chunks := (fileSize + 1024*1024 - 1) / (1024 * 1024)
+	lastChunkSize := fileSize % (1024 * 1024)
+	if lastChunkSize == 0 {
+		lastChunkSize = 1024 * 1024
+	}
+
+	info := ResourceInfo{
+		Exists:        true,
+		Size:          fileSize,
+		Chunks:        int(chunks),
+		LastChunkSize: lastChunkSize,
+	}
+
+	// Compressed resources can not be fetched in ranges, so they are a single chunk of their stored size
+	if compression := OutputCompression(path); compression != "" {
+		info.Chunks = 1
+		info.LastChunkSize = fileSize
+		info.Compression = compression
+	}
+	return info
+}
+
+// NewSceneOptions holds the user provided settings of a new scene. Zero values are replaced by defaults.
+type NewSceneOptions struct {
+	TrainingMode    string
+	OutputTypes     []string
+	SaveIterations  []int
+	TotalIterations int
+	SceneName       string
+	Tags            []string
+	// SfmOnly runs SfM only, producing camera poses and a point cloud without NeRF training. The training settings
+	// are ignored.
+	SfmOnly bool
+	// Downscale scales the video down to MaxVideoDimension before processing, if it is larger. Videos are always
+	// downscaled if DownscaleVideos is enabled.
+	Downscale bool
+	// UploadID optionally identifies the upload, so its progress can be followed with SubscribeUploadProgress.
+	UploadID string
+	// IdempotencyKey optionally identifies the request, so retries and concurrent duplicates create a single scene.
+	IdempotencyKey string
+}
+
+// VideoFile is a video file a new scene is created from: a multipart upload, or an assembled chunked upload.
+type VideoFile struct {
+	// Name is the name the client uploaded the file as. Its extension tells the video container.
+	Name string
+	// Size is the size of the file, in bytes.
+	Size int64
+	// Open opens the file for reading.
+	Open func() (io.ReadCloser, error)
+}
+
+// NewVideoFile returns the VideoFile of a multipart file upload.
+func NewVideoFile(header *multipart.FileHeader) *VideoFile {
+	return &VideoFile{
+		Name: header.Filename,
+		Size: header.Size,
+		Open: func() (io.ReadCloser, error) { return header.Open() },
+	}
+}
+
+// videoExtensions are the extensions of the video containers the pipeline can process.
+var videoExtensions = []string{".mp4", ".m4v", ".mov", ".avi"}
+
+// ErrIdempotencyKeyInProgress is returned when a request with the same idempotency key is still creating its scene.
+var ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+
+// idempotencyPollInterval is how often a duplicate request checks on the request holding its idempotency key.
+const idempotencyPollInterval = 250 * time.Millisecond
+
 // HandleIncomingVideo processes the video file uploaded by the user and starts the processing pipeline.
 //
 // If a training config value is not provided, a default value is used.
 //
+// If DeduplicateUploads is enabled and the user already has a scene with the same name, created from identical video
+// content, that scene's ID is returned instead of creating a new scene.
+//
+// If opts.IdempotencyKey is set, only the first request with the key creates a scene. Duplicates that arrive while
+// it is in flight wait for it, and all of them return the same scene ID. If creating the scene fails, the key is
+// released, so a waiting duplicate may create the scene instead.
+//
+// If RejectUploadsWithoutWorkers is enabled, uploads are rejected with ErrNoWorkersAvailable while no worker is healthy.
+//
 // Returns the scene ID if successful, error otherwise.
 func (s *ClientService) HandleIncomingVideo(
 	ctx context.Context,
 	userID primitive.ObjectID,
-	file *multipart.FileHeader,
-	trainingMode string,
-	outputTypes []string,
-	saveIterations []int,
-	totalIterations int,
-	sceneName string,
+	file *VideoFile,
+	opts NewSceneOptions,
 ) (string, error) {
+	if err := s.checkUploadsAccepted(); err != nil {
+		s.logger.Info("Rejecting upload:", err.Error())
+		return "", err
+	}
+
+	sceneID := primitive.NewObjectID()
+	if opts.IdempotencyKey == "" {
+		return s.createScene(ctx, userID, sceneID, file, opts)
+	}
+
+	existingID, claimed, err := s.claimIdempotencyKey(ctx, userID, opts.IdempotencyKey, sceneID)
+	if err != nil {
+		s.logger.Info("Failed to claim idempotency key:", err.Error())
+		return "", err
+	}
+	if !claimed {
+		s.logger.Debugf("Idempotency key already used for scene %s", existingID.Hex())
+		return existingID.Hex(), nil
+	}
+
+	id, err := s.createScene(ctx, userID, sceneID, file, opts)
+	if err != nil || id != sceneID.Hex() {
+		// Also released if the upload was a duplicate of an existing scene, as the key's scene was not created
+		if releaseErr := s.sceneManager.ReleaseIdempotencyKey(ctx, userID, opts.IdempotencyKey, sceneID); releaseErr != nil {
+			s.logger.Errorf("Failed to release idempotency key: %v", releaseErr)
+		}
+		return id, err
+	}
+	if err := s.sceneManager.CompleteIdempotencyKey(ctx, userID, opts.IdempotencyKey, sceneID); err != nil {
+		s.logger.Errorf("Failed to complete idempotency key: %v", err)
+	}
+	return id, nil
+}
+
+// checkUploadsAccepted checks that new uploads can currently be accepted: storage is writable and below the
+// high-water mark, and, if RejectUploadsWithoutWorkers is enabled, a worker is healthy.
+//
+// Returns nil if uploads are accepted, or the error to reject them with.
+func (s *ClientService) checkUploadsAccepted() error {
+	if err := s.CheckStorage(); err != nil {
+		return err
+	}
+	if err := s.checkStorageCapacity(); err != nil {
+		return err
+	}
+	if s.config.RejectUploadsWithoutWorkers && len(s.mqService.HealthyWorkers()) == 0 {
+		return ErrNoWorkersAvailable
+	}
+	return nil
+}
+
+// claimIdempotencyKey claims the user's idempotency key for sceneID. If another request holds the key,
+// it waits (up to IdempotencyWaitTimeout) for that request to create its scene.
+//
+// Returns (sceneID, true, nil) if the key was claimed, or (existing scene ID, false, nil) if the key was already used.
+func (s *ClientService) claimIdempotencyKey(ctx context.Context, userID primitive.ObjectID, key string, sceneID primitive.ObjectID) (primitive.ObjectID, bool, error) {
+	deadline := time.Now().Add(s.config.IdempotencyWaitTimeout)
+	for {
+		record, err := s.sceneManager.ClaimIdempotencyKey(ctx, userID, key, sceneID, s.config.IdempotencyKeyTTL)
+		if err != nil {
+			return primitive.NilObjectID, false, err
+		}
+		if record != nil {
+			if record.SceneID == sceneID {
+				return sceneID, true, nil
+			}
+			if record.Done {
+				return record.SceneID, false, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return primitive.NilObjectID, false, ErrIdempotencyKeyInProgress
+		}
+		select {
+		case <-ctx.Done():
+			return primitive.NilObjectID, false, ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+	}
+}
+
+// createScene saves the uploaded video, creates the scene with the given ID and starts the processing pipeline.
+//
+// Returns the scene ID if successful, error otherwise.
+func (s *ClientService) createScene(
+	ctx context.Context,
+	userID primitive.ObjectID,
+	sceneID primitive.ObjectID,
+	file *VideoFile,
+	opts NewSceneOptions,
+) (string, error) {
+	trainingMode := opts.TrainingMode
+	outputTypes := opts.OutputTypes
+	saveIterations := opts.SaveIterations
+	totalIterations := opts.TotalIterations
+	sceneName := opts.SceneName
+
 	// Validate video file
 	if file == nil {
 		return "", fmt.Errorf("file not received")
 	}
 
-	fileName := file.Filename
+	fileName := file.Name
 	if fileName == "" {
 		return "", fmt.Errorf("file not received")
 	}
 
-	fileExt := filepath.Ext(fileName)
-	if fileExt != ".mp4" {
+	fileExt := strings.ToLower(filepath.Ext(fileName))
+	if !slices.Contains(videoExtensions, fileExt) {
 		return "", fmt.Errorf("improper file extension")
 	}
 
-	sceneID := primitive.NewObjectID()
-
-	// Save video to file storage
-	videoName := sceneID.Hex() + ".mp4"
+	// Save video to file storage, keeping its extension so workers know its container
+	videoName := sceneID.Hex() + fileExt
 	videosFolder := "data/raw/videos"
 	if err := os.MkdirAll(videosFolder, os.ModePerm); err != nil {
 		return "", err
@@ -223,6 +805,24 @@ func (s *ClientService) HandleIncomingVideo(
 	if err != nil {
 		return "", err
 	}
+	// Until the scene is handed to the pipeline, a failed (or deduplicated) upload leaves nothing behind
+	var written int64
+	inserted, started := false, false
+	defer func() {
+		if started {
+			return
+		}
+		if inserted {
+			if err := s.sceneManager.DeleteScene(ctx, sceneID); err != nil {
+				s.logger.Errorf("Failed to remove scene of failed upload: %v", err)
+			}
+		}
+		if err := os.Remove(videoFilePath); err != nil {
+			s.logger.Errorf("Failed to remove video of failed upload: %v", err)
+			return
+		}
+		s.storageUsage.Add(-written)
+	}()
 	defer dst.Close()
 
 	src, err := file.Open()
@@ -231,31 +831,63 @@ func (s *ClientService) HandleIncomingVideo(
 	}
 	defer src.Close()
 
-	if _, err = io.Copy(dst, src); err != nil {
+	// Report received bytes to anyone following the upload
+	var progress io.Writer = io.Discard
+	if opts.UploadID != "" {
+		progress = s.uploads.Start(userID, opts.UploadID, file.Size)
+	}
+	hash := sha256.New()
+	written, err = io.Copy(io.MultiWriter(dst, hash, progress), src)
+	s.storageUsage.Add(written)
+	if opts.UploadID != "" {
+		s.uploads.Finish(userID, opts.UploadID, err)
+	}
+	s.RecordTransfer(ctx, userID, written, 0)
+	if err != nil {
+		return "", err
+	}
+	if err := s.syncWrite(videoFilePath); err != nil {
 		return "", err
 	}
 
 	// Handle non-provided configuration values
 	if sceneName == "" {
-		sceneName = "Untitled Scene"
+		sceneName = scene.DefaultSceneName
 	}
 	if trainingMode == "" {
-		trainingMode = "gaussian"
+		trainingMode = scene.DefaultTrainingMode
 	}
 	if len(outputTypes) == 0 {
-		outputTypes = []string{"video"}
+		outputTypes = scene.DefaultOutputTypes
 	}
 	if len(saveIterations) == 0 {
-		saveIterations = []int{1000, 7000, 30000}
+		saveIterations = scene.DefaultSaveIterations
+	}
+
+	// Identical content uploaded again under the same name is not reprocessed
+	contentHash := hex.EncodeToString(hash.Sum(nil))
+	if s.config.DeduplicateUploads {
+		existingID, err := s.sceneManager.FindSceneByContent(ctx, userID, sceneName, contentHash, opts.SfmOnly)
+		if err == nil {
+			// The duplicate upload is removed on return
+			s.logger.Infof("Upload is identical to scene %s, not creating a new scene", existingID.Hex())
+			return existingID.Hex(), nil
+		}
+		if !errors.Is(err, scene.ErrSceneNotFound) {
+			return "", err
+		}
 	}
 
+	video := &scene.Video{
+		FilePath:    videoFilePath,
+		ContentHash: contentHash,
+		Size:        written,
+	}
 
 	// Partially Initialize new scene
 	newScene := &scene.Scene{
-		ID: sceneID,
-		Video: &scene.Video{
-			FilePath: videoFilePath,
-		},
+		ID:    sceneID,
+		Video: video,
 		Config: &scene.TrainingConfig{
 			NerfTrainingConfig: &scene.NerfTrainingConfig{
 				TrainingMode:    trainingMode,
@@ -264,7 +896,12 @@ func (s *ClientService) HandleIncomingVideo(
 				TotalIterations: totalIterations,
 			},
 		},
-		Name: sceneName,
+		Name:   sceneName,
+		UserID: userID,
+		Tags:   opts.Tags,
+	}
+	if opts.SfmOnly {
+		newScene.Config = &scene.TrainingConfig{SfmOnly: true}
 	}
 
 	// Insert scene into database
@@ -272,174 +909,1812 @@ func (s *ClientService) HandleIncomingVideo(
 		s.logger.Errorf("Failed to insert new scene into database: %v", err)
 		return "", err
 	}
-
-	// Start pipeline
-	if err := s.mqService.PublishSFMJob(ctx, newScene); err != nil {
-		s.logger.Errorf("Failed to publish SFM job: %v", err)
+	inserted = true
+
+	// Start pipeline. Videos to downscale are queued for SfM once downscaled, in the background, so the upload does
+	// not wait for the transcode. Oversized videos are processed at their original resolution if the downscaling
+	// can not be queued.
+	downscaling := false
+	if opts.Downscale || s.config.DownscaleVideos {
+		err := s.tasks.Submit(TaskTypeDownscale, func(ctx context.Context) error {
+			return s.downscaleAndPublish(ctx, newScene)
+		})
+		if err != nil {
+			s.logger.Errorf("Failed to queue video downscaling, processing it at its original resolution: %v", err)
+		}
+		downscaling = err == nil
+	}
+	if !downscaling {
+		if err := s.mqService.PublishSFMJob(ctx, newScene); err != nil {
+			s.logger.Errorf("Failed to publish SFM job: %v", err)
+			return "", err
+		}
+	}
+	started = true
+
+	// Update user with new scene
+	user, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if err := user.AddScene(sceneID); err != nil {
+		return "", err
+	}
+	if err := s.userManager.UpdateUser(ctx, user); err != nil {
+		return "", err
+	}
+
+	return sceneID.Hex(), nil
+}
+
+// SubscribeUploadProgress follows the progress of the user's upload with the given upload ID.
+// See UploadProgressTracker.Subscribe.
+func (s *ClientService) SubscribeUploadProgress(userID primitive.ObjectID, uploadID string) (<-chan UploadProgress, func()) {
+	s.logger.Debug("Upload progress subscription received")
+	return s.uploads.Subscribe(userID, uploadID)
+}
+
+// GetUserSceneHistory returns a page of the scene IDs that the user has access to.
+// It is tolerant of scenes that have been deleted / not finished processing by ignoring them.
+// If since or until are non-nil, only scenes created within [since, until] are included.
+//
+// Returns at most limit scene IDs, in the order the user created them, skipping the first offset, and the total number
+// of scenes across all pages. Returns error if the user does not exist or non scene-existence errors occur.
+func (s *ClientService) GetUserSceneHistory(ctx context.Context, userID primitive.ObjectID, since, until *time.Time, offset, limit int) ([]string, int64, error) {
+	s.logger.Debug("Get user history request received")
+
+	user, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		s.logger.Info("Failed to get user history:", err.Error())
+		return nil, 0, err
+	}
+
+	resources := make([]string, 0)
+	if len(user.SceneIDs) == 0 {
+		return resources, 0, nil
+	}
+
+	// Scenes that have been deleted / not finished processing are not returned. Scene IDs are ObjectIDs, so
+	// ordering by ID is the order the user created them.
+	page, total, err := s.sceneManager.GetFinishedScenesPage(ctx, user.SceneIDs, since, until, int64(offset), int64(limit))
+	if err != nil {
+		s.logger.Info("Failed to get user history:", err.Error())
+		return nil, 0, err
+	}
+	for _, sceneID := range page {
+		resources = append(resources, sceneID.Hex())
+	}
+
+	s.logger.Info("User history retrieved successfully")
+	return resources, total, nil
+}
+
+// CountUserScenes returns the number of scenes the user owns, including scenes still processing or failed, and
+// scenes outside of any history date range.
+//
+// Returns error if a database error occurred.
+func (s *ClientService) CountUserScenes(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	s.logger.Debug("Count user scenes request received")
+
+	sceneIDs, err := s.userSceneIDs(ctx, userID)
+	if err != nil {
+		s.logger.Info("Failed to count user scenes:", err.Error())
+		return 0, err
+	}
+
+	count, err := s.sceneManager.CountScenesForUser(ctx, userID, sceneIDs)
+	if err != nil {
+		s.logger.Info("Failed to count user scenes:", err.Error())
+		return 0, err
+	}
+	return count, nil
+}
+
+// SceneExportRow is a scene of a user's scene history export.
+type SceneExportRow struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	StatusName string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Size is the size of the uploaded video, in bytes.
+	Size int64    `json:"size"`
+	Tags []string `json:"tags"`
+}
+
+// ExportSceneHistory calls fn with each scene of the given user, including scenes still processing or failed, oldest
+// first. Scenes are streamed from the database, so exporting a long history does not hold it in memory.
+//
+// Returns error if an error occurred, or the error returned by fn, which stops the export.
+func (s *ClientService) ExportSceneHistory(ctx context.Context, userID primitive.ObjectID, fn func(*SceneExportRow) error) error {
+	s.logger.Debug("Export scene history request received")
+
+	sceneIDs, err := s.userSceneIDs(ctx, userID)
+	if err != nil {
+		s.logger.Info("Failed to export scene history:", err.Error())
+		return err
+	}
+
+	err = s.sceneManager.ForEachUserScene(ctx, userID, sceneIDs, func(sc *scene.Scene) error {
+		row := &SceneExportRow{
+			ID:         sc.ID.Hex(),
+			Name:       sc.Name,
+			StatusName: scene.StatusName(sc.Status),
+			CreatedAt:  sc.ID.Timestamp().UTC(),
+			Tags:       sc.Tags,
+		}
+		if sc.Video != nil {
+			row.Size = sc.Video.Size
+		}
+		if row.Tags == nil {
+			row.Tags = []string{}
+		}
+		return fn(row)
+	})
+	if err != nil {
+		s.logger.Info("Failed to export scene history:", err.Error())
+		return err
+	}
+
+	s.logger.Info("Scene history exported successfully")
+	return nil
+}
+
+// SharedScene is a scene another user shared with the requesting user.
+type SharedScene struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Status     int        `json:"status"`
+	StatusName string     `json:"status_name"`
+	Tags       []string   `json:"tags"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Owner      SceneOwner `json:"owner"`
+	// ReadOnly is always true: shared users may view, but not modify or delete, a scene.
+	ReadOnly bool `json:"read_only"`
+}
+
+// SceneOwner identifies the owner of a scene.
+type SceneOwner struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// GetScenesSharedWithUser returns the scenes other users have shared with the given user, newest first.
+//
+// Returns error if an error occurred.
+func (s *ClientService) GetScenesSharedWithUser(ctx context.Context, userID primitive.ObjectID) ([]SharedScene, error) {
+	s.logger.Debug("Get scenes shared with user request received")
+
+	scenes, err := s.sceneManager.GetScenesSharedWith(ctx, userID)
+	if err != nil {
+		s.logger.Info("Error getting shared scenes:", err.Error())
+		return nil, err
+	}
+
+	// Scenes created before owners were recorded on the scene are resolved through the owner's scene list
+	ownerIDs := make([]primitive.ObjectID, 0, len(scenes))
+	for _, sc := range scenes {
+		if sc.UserID.IsZero() {
+			if sc.UserID, err = s.userManager.GetSceneOwnerID(ctx, sc.ID); err != nil && !errors.Is(err, user.ErrUserNotFound) {
+				s.logger.Info("Error getting scene owner:", err.Error())
+				return nil, err
+			}
+		}
+		ownerIDs = append(ownerIDs, sc.UserID)
+	}
+	usernames, err := s.userManager.GetUsernames(ctx, ownerIDs)
+	if err != nil {
+		s.logger.Info("Error getting scene owners:", err.Error())
+		return nil, err
+	}
+
+	shared := make([]SharedScene, 0, len(scenes))
+	for _, sc := range scenes {
+		// A legacy scene may still be owned by the requesting user
+		if sc.UserID == userID {
+			continue
+		}
+		tags := sc.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		shared = append(shared, SharedScene{
+			ID:         sc.ID.Hex(),
+			Name:       sc.Name,
+			Status:     sc.Status,
+			StatusName: scene.StatusName(sc.Status),
+			Tags:       tags,
+			FinishedAt: sc.FinishedAt,
+			Owner: SceneOwner{
+				ID:       sc.UserID.Hex(),
+				Username: usernames[sc.UserID],
+			},
+			ReadOnly: true,
+		})
+	}
+
+	s.logger.Info("Shared scenes retrieved successfully")
+	return shared, nil
+}
+
+// GetUserTags returns the distinct tags used across the user's scenes, with the number of scenes each is used on,
+// sorted by descending frequency.
+//
+// Returns error if the user does not exist or an error occurred.
+func (s *ClientService) GetUserTags(ctx context.Context, userID primitive.ObjectID) ([]scene.TagCount, error) {
+	s.logger.Debug("Get user tags request received")
+
+	u, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		s.logger.Info("Failed to get user tags:", err.Error())
+		return nil, err
+	}
+
+	tags, err := s.sceneManager.GetUserTagCounts(ctx, userID, u.SceneIDs)
+	if err != nil {
+		s.logger.Info("Failed to get user tags:", err.Error())
+		return nil, err
+	}
+
+	s.logger.Info("User tags retrieved successfully")
+	return tags, nil
+}
+
+// SceneFailure is a report of a single failed scene, including its processing log.
+type SceneFailure struct {
+	SceneID  string           `json:"id"`
+	Name     string           `json:"name"`
+	Stage    string           `json:"stage"`
+	Reason   string           `json:"reason"`
+	FailedAt *time.Time       `json:"failed_at,omitempty"`
+	Logs     []scene.LogEntry `json:"logs"`
+}
+
+// GetUserFailures returns failure reports (reason and processing log) for all of the user's failed scenes.
+// If since or until are non-nil, only scenes that failed within [since, until] are included.
+//
+// Returns error if the user does not exist or an error occurred.
+func (s *ClientService) GetUserFailures(ctx context.Context, userID primitive.ObjectID, since, until *time.Time) ([]SceneFailure, error) {
+	s.logger.Debug("Get user failures request received")
+
+	user, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		s.logger.Info("Failed to get user failures:", err.Error())
+		return nil, err
+	}
+
+	failures := make([]SceneFailure, 0)
+	if len(user.SceneIDs) == 0 {
+		return failures, nil
+	}
+
+	scenes, err := s.sceneManager.GetFailedScenes(ctx, user.SceneIDs, since, until)
+	if err != nil {
+		s.logger.Info("Failed to get user failures:", err.Error())
+		return nil, err
+	}
+
+	for _, sc := range scenes {
+		failure := SceneFailure{
+			SceneID:  sc.ID.Hex(),
+			Name:     sc.Name,
+			FailedAt: sc.FinishedAt,
+			Logs:     sc.Logs,
+		}
+		if sc.Failure != nil {
+			failure.Stage = sc.Failure.Stage
+			failure.Reason = sc.Failure.Reason
+		}
+		if failure.Logs == nil {
+			failure.Logs = []scene.LogEntry{}
+		}
+		failures = append(failures, failure)
+	}
+
+	s.logger.Info("User failures retrieved successfully")
+	return failures, nil
+}
+
+// GetSceneThumbnailPath returns the path to the thumbnail image for the given scene, and its size if known.
+// Paths are relative to the main *.go executable.
+//
+// If a thumbnail has been rendered from the trained model (see RefreshSceneThumbnailFromRender), it is preferred.
+// Otherwise, sfm frame data is used to determine the thumbnail path. THese are stored as http endpoints.
+// So, a little bit of string manipulation is required.
+//
+// Returns ("", nil, scene.ErrSceneNotFound) if the scene does not exist or the user does not have access to it,
+// or ("", nil, error) if an error occurred.
+func (s *ClientService) GetSceneThumbnailPath(ctx context.Context, userID, sceneID primitive.ObjectID) (string, *scene.ImageSize, error) {
+	s.logger.Debug("Get scene thumbnail request received")
+
+	sceneIDs, err := s.userSceneIDs(ctx, userID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return "", nil, err
+	}
+
+	// Access is checked by the query
+	sc, err := s.sceneManager.GetSceneForUser(ctx, userID, sceneID, sceneIDs)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return "", nil, err
+	}
+
+	thumbnailPath, err := s.sceneThumbnailPath(sc)
+	if err != nil {
+		s.logger.Info("Invalid thumbnail:", err.Error())
+		return "", nil, err
+	}
+
+	s.logger.Info("Thumbnail retrieved successfully")
+	return thumbnailPath, s.sceneThumbnailSize(ctx, sc, thumbnailPath), nil
+}
+
+// sceneThumbnailPath returns the local path of the scene's thumbnail. See GetSceneThumbnailPath.
+func (s *ClientService) sceneThumbnailPath(sc *scene.Scene) (string, error) {
+	if sc.ThumbnailPath != "" {
+		return sc.ThumbnailPath, nil
+	}
+
+	sfm := sc.Sfm
+	if sfm == nil {
+		return "", scene.ErrSfmNotFound
+	}
+
+	if len(sfm.Frames) == 0 {
+		return "", fmt.Errorf("no frames found in SFM data")
+	}
+
+	// Use the first frame as the thumbnail
+	thumbnailPath := sfm.Frames[0].FilePath
+
+	if filepath.Ext(thumbnailPath) != ".png" {
+		return "", fmt.Errorf("first frame is not a PNG file")
+	}
+
+	// Convert API endpoint path to local file system path
+	u, err := url.Parse(thumbnailPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %v", err)
+	}
+
+	// Extract the path and remove "/worker-data" prefix if it exists
+	localPath := strings.TrimPrefix(u.Path, "/worker-data/")
+
+	// Ensure the path starts with "/data"
+	if !strings.HasPrefix(localPath, "data") {
+		return "", fmt.Errorf("invalid path: does not start with data")
+	}
+
+	return localPath, nil
+}
+
+// sceneThumbnailSize returns the size of the scene's thumbnail at thumbnailPath. Sizes are measured once,
+// and stored on the scene. Returns nil if thumbnail dimensions are disabled or the size cannot be measured.
+func (s *ClientService) sceneThumbnailSize(ctx context.Context, sc *scene.Scene, thumbnailPath string) *scene.ImageSize {
+	if !s.config.ThumbnailDimensions {
+		return nil
+	}
+	if sc.ThumbnailSize != nil {
+		return sc.ThumbnailSize
+	}
+
+	size, err := imageSize(thumbnailPath)
+	if err != nil {
+		s.logger.Info("Failed to measure thumbnail:", err.Error())
+		return nil
+	}
+	if err := s.sceneManager.SetThumbnailSize(ctx, sc.ID, size); err != nil {
+		s.logger.Info("Failed to save thumbnail size:", err.Error())
+	}
+	return size
+}
+
+// RefreshSceneThumbnailFromRender replaces the scene's thumbnail with a frame rendered from the trained model.
+// The frame is taken from the latest rendered video output and saved alongside the scene's nerf outputs.
+// Only the owner of the scene may refresh its thumbnail.
+//
+// Returns the new thumbnail path if successful. Returns ("", scene.ErrSceneNotReady) if the scene has not finished
+// training or has no rendered output, or ("", error) if the user does not own the scene or an error occurred.
+func (s *ClientService) RefreshSceneThumbnailFromRender(ctx context.Context, userID, sceneID primitive.ObjectID) (string, error) {
+	s.logger.Debug("Refresh scene thumbnail request received")
+
+	// Verify user owns scene
+	if err := s.verifyUserOwnership(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return "", err
+	}
+
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return "", err
+	}
+	if sc.Status != scene.StatusComplete || sc.Nerf == nil {
+		s.logger.Info("Scene not ready for render thumbnail")
+		return "", scene.ErrSceneNotReady
+	}
+
+	videoPath, err := sc.Nerf.GetFilePathForTypeAndIter("video", -1)
+	if err != nil {
+		s.logger.Info("No rendered video for thumbnail:", err.Error())
+		return "", scene.ErrSceneNotReady
+	}
+
+	thumbnailPath := filepath.Join("data", "nerf", sceneID.Hex(), "thumbnail.png")
+	// Rendering runs ffmpeg, so it goes through the task pool to bound the number of concurrent renders
+	err = s.tasks.Run(ctx, TaskTypeThumbnail, func(ctx context.Context) error {
+		if err := renderThumbnail(ctx, s.config.FFmpegPath, videoPath, thumbnailPath); err != nil {
+			return err
+		}
+		return s.syncWrite(thumbnailPath)
+	})
+	if err != nil {
+		s.logger.Info("Failed to render thumbnail:", err.Error())
+		return "", err
+	}
+
+	var size *scene.ImageSize
+	if s.config.ThumbnailDimensions {
+		if size, err = imageSize(thumbnailPath); err != nil {
+			s.logger.Info("Failed to measure thumbnail:", err.Error())
+		}
+	}
+
+	if err := s.sceneManager.SetSceneThumbnail(ctx, sceneID, thumbnailPath, size); err != nil {
+		s.logger.Info("Failed to save thumbnail path:", err.Error())
+		return "", err
+	}
+
+	s.logger.Info("Thumbnail refreshed from render successfully")
+	return thumbnailPath, nil
+}
+
+// GetSfmQualityReport returns the SfM quality report of the given scene. The owner of the scene and the users it is
+// shared with may view it.
+//
+// Returns error if the user does not have access to the scene, the scene has no sfm data or quality report
+// (scene.ErrSfmNotFound, scene.ErrSfmReportNotFound), or an error occurred.
+func (s *ClientService) GetSfmQualityReport(ctx context.Context, userID, sceneID primitive.ObjectID) (*scene.SfmQualityReport, error) {
+	s.logger.Debug("Get sfm quality report request received")
+
+	// Verify user has access to scene
+	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return nil, err
+	}
+
+	sfm, err := s.sceneManager.GetSfm(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return nil, err
+	}
+	if sfm.QualityReport == nil {
+		return nil, scene.ErrSfmReportNotFound
+	}
+
+	s.logger.Info("Sfm quality report retrieved successfully")
+	return sfm.QualityReport, nil
+}
+
+// SfmPoses are the camera poses reconstructed by SfM, in the format the sfm-worker reports them.
+type SfmPoses struct {
+	IntrinsicMatrix [][]float64   `json:"intrinsic_matrix"`
+	Frames          []scene.Frame `json:"frames"`
+	WhiteBackground bool          `json:"white_background"`
+}
+
+// GetSfmPoses returns the camera poses SfM reconstructed for the given scene. The owner of the scene and the users it
+// is shared with may view them.
+//
+// Returns error if the user does not have access to the scene, the scene has no sfm data (scene.ErrSfmNotFound), or an
+// error occurred.
+func (s *ClientService) GetSfmPoses(ctx context.Context, userID, sceneID primitive.ObjectID) (*SfmPoses, error) {
+	s.logger.Debug("Get sfm poses request received")
+
+	// Verify user has access to scene
+	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return nil, err
+	}
+
+	sfm, err := s.sceneManager.GetSfm(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return nil, err
+	}
+
+	s.logger.Info("Sfm poses retrieved successfully")
+	return &SfmPoses{
+		IntrinsicMatrix: sfm.IntrinsicMatrix,
+		Frames:          sfm.Frames,
+		WhiteBackground: sfm.WhiteBackground,
+	}, nil
+}
+
+// GetSfmPointCloudPath returns the path to the point cloud SfM reconstructed for the given scene. The owner of the
+// scene and the users it is shared with may download it.
+//
+// Returns error if the user does not have access to the scene, the scene has no sfm data or point cloud
+// (scene.ErrSfmNotFound, scene.ErrSfmPointCloudNotFound), or an error occurred.
+func (s *ClientService) GetSfmPointCloudPath(ctx context.Context, userID, sceneID primitive.ObjectID) (string, error) {
+	s.logger.Debug("Get sfm point cloud request received")
+
+	// Verify user has access to scene
+	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return "", err
+	}
+
+	sfm, err := s.sceneManager.GetSfm(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return "", err
+	}
+	if sfm.PointCloudFilePath == "" {
+		return "", scene.ErrSfmPointCloudNotFound
+	}
+
+	s.logger.Info("Sfm point cloud retrieved successfully")
+	return sfm.PointCloudFilePath, nil
+}
+
+// logLevels orders the log entry levels by severity.
+var logLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// stageDisplayNames are the names used for pipeline stages in stage transition markers.
+var stageDisplayNames = map[string]string{
+	scene.StageSfm:  "SfM",
+	scene.StageNerf: "NeRF",
+}
+
+// CombinedLogEntry is a line of a scene's combined log: either a log entry, or a stage transition marker.
+type CombinedLogEntry struct {
+	Time    time.Time
+	Stage   string
+	Level   string
+	Message string
+	// Marker is set for stage transition markers, whose Message is the marker text (i.e "--- NeRF stage started ---").
+	Marker bool
+}
+
+// GetSceneCombinedLog returns the processing log of the given scene in time order, with a marker before the first entry
+// of each stage. If minLevel is not empty, only entries of at least that level (debug, info, warn, error) are returned;
+// markers are always kept. Only the owner of the scene may view it: the log records the scene's processing diagnostics,
+// which are not shared with collaborators.
+//
+// Compacted scenes only keep their most recent entries; a leading marker gives the number of removed entries.
+//
+// Returns error if the user does not own the scene, or an error occurred.
+func (s *ClientService) GetSceneCombinedLog(ctx context.Context, userID, sceneID primitive.ObjectID, minLevel string) ([]CombinedLogEntry, error) {
+	s.logger.Debug("Get scene combined log request received")
+
+	// Verify user owns scene
+	if err := s.verifyUserOwnership(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return nil, err
+	}
+
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return nil, err
+	}
+
+	entries := slices.Clone(sc.Logs)
+	slices.SortStableFunc(entries, func(a, b scene.LogEntry) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	combined := make([]CombinedLogEntry, 0, len(entries)+2)
+	if sc.LogSummary != nil && sc.LogSummary.Entries > len(entries) {
+		combined = append(combined, CombinedLogEntry{
+			Marker:  true,
+			Message: fmt.Sprintf("--- %d earlier entries removed ---", sc.LogSummary.Entries-len(entries)),
+		})
+	}
+
+	stage := ""
+	for _, entry := range entries {
+		// Stage transitions are detected on the full log, so markers do not depend on the level filter
+		if entry.Stage != stage {
+			stage = entry.Stage
+			name, ok := stageDisplayNames[stage]
+			if !ok {
+				name = stage
+			}
+			combined = append(combined, CombinedLogEntry{
+				Time:    entry.Time,
+				Stage:   stage,
+				Marker:  true,
+				Message: fmt.Sprintf("--- %s stage started ---", name),
+			})
+		}
+		if minLevel != "" && logLevels[entry.Level] < logLevels[minLevel] {
+			continue
+		}
+		combined = append(combined, CombinedLogEntry{
+			Time:    entry.Time,
+			Stage:   entry.Stage,
+			Level:   entry.Level,
+			Message: entry.Message,
+		})
+	}
+
+	s.logger.Info("Scene combined log retrieved successfully")
+	return combined, nil
+}
+
+// GetSceneTurntableFrames returns the local paths of the turntable preview frames of the given scene, in playback
+// order. The owner of the scene and the users it is shared with may view them.
+//
+// Returns error if the user does not have access to the scene, the scene has no nerf or turntable preview
+// (scene.ErrNerfNotFound, scene.ErrTurntableNotFound), or an error occurred.
+func (s *ClientService) GetSceneTurntableFrames(ctx context.Context, userID, sceneID primitive.ObjectID) ([]string, error) {
+	s.logger.Debug("Get scene turntable request received")
+
+	// Verify user has access to scene
+	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return nil, err
+	}
+
+	nerf, err := s.sceneManager.GetNerf(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return nil, err
+	}
+	if len(nerf.TurntableFramePaths) == 0 {
+		return nil, scene.ErrTurntableNotFound
+	}
+
+	// A partially missing preview would play back incorrectly, so treat it as unavailable
+	for _, framePath := range nerf.TurntableFramePaths {
+		if _, err := os.Stat(framePath); err != nil {
+			s.logger.Info("Turntable frame missing:", err.Error())
+			return nil, scene.ErrTurntableNotFound
+		}
+	}
+
+	s.logger.Info("Scene turntable retrieved successfully")
+	return nerf.TurntableFramePaths, nil
+}
+
+// SceneDetails is the client facing view of a whole scene. Server internals, such as file paths,
+// sfm frames and processing logs, are left out.
+type SceneDetails struct {
+	ID         string                    `json:"id"`
+	Name       string                    `json:"name"`
+	Status     int                       `json:"status"`
+	StatusName string                    `json:"status_name"`
+	Tags       []string                  `json:"tags"`
+	CreatedAt  time.Time                 `json:"created_at"`
+	FinishedAt *time.Time                `json:"finished_at,omitempty"`
+	Failure    *scene.Failure            `json:"failure,omitempty"`
+	Config     *scene.NerfTrainingConfig `json:"config,omitempty"`
+	Video      *SceneVideoDetails        `json:"video,omitempty"`
+	Sfm        *SceneSfmDetails          `json:"sfm,omitempty"`
+	SharedWith []string                  `json:"shared_with"`
+	// Outputs maps each output type with at least one saved iteration to its saved iterations, in ascending order.
+	Outputs map[string][]int `json:"outputs"`
+	// Downloadable is set when the scene is complete and has outputs that can be downloaded.
+	Downloadable bool `json:"downloadable"`
+	// Thumbnail is the size of the scene's thumbnail, if known.
+	Thumbnail *scene.ImageSize `json:"thumbnail,omitempty"`
+	// StageProgress is the worker reported progress within the scene's current stage, if any.
+	StageProgress *scene.StageProgress `json:"stage_progress,omitempty"`
+	// SfmOnly is set for scenes that only run SfM. They have no config, and complete without outputs.
+	SfmOnly bool `json:"sfm_only,omitempty"`
+}
+
+// SceneVideoDetails describes the uploaded video of a scene.
+type SceneVideoDetails struct {
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	FPS        int    `json:"fps"`
+	Duration   int    `json:"duration"`
+	FrameCount int    `json:"frame_count"`
+	Codec      string `json:"codec,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	// Scaling describes how the video was downscaled before processing, if it was. The other details are those of
+	// the downscaled video, except for Size, which is the size of the upload.
+	Scaling *scene.VideoScaling `json:"scaling,omitempty"`
+}
+
+// newSceneVideoDetails returns the details of the given video.
+func newSceneVideoDetails(video *scene.Video) *SceneVideoDetails {
+	return &SceneVideoDetails{
+		Width:      video.Width,
+		Height:     video.Height,
+		FPS:        video.FPS,
+		Duration:   video.Duration,
+		FrameCount: video.FrameCount,
+		Codec:      video.Codec,
+		Size:       video.Size,
+		Scaling:    video.Scaling,
+	}
+}
+
+// SceneSfmDetails summarizes the sfm results of a scene.
+type SceneSfmDetails struct {
+	FrameCount      int                     `json:"frame_count"`
+	WhiteBackground bool                    `json:"white_background"`
+	QualityReport   *scene.SfmQualityReport `json:"quality_report,omitempty"`
+	// PointCloud is set when the sfm point cloud can be downloaded.
+	PointCloud bool `json:"point_cloud"`
+}
+
+// GetSceneDetails returns the whole scene with the given ID, so clients do not have to assemble it from the name,
+// config, progress and metadata routes. The owner of the scene and the users it is shared with may view it; only the
+// owner sees who it is shared with.
+//
+// Returns error if the user does not have access to the scene or an error occurred.
+func (s *ClientService) GetSceneDetails(ctx context.Context, userID, sceneID primitive.ObjectID) (*SceneDetails, error) {
+	s.logger.Debug("Get scene details request received")
+
+	// Verify user has access to scene
+	owner, err := s.sceneAccess(ctx, userID, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return nil, err
+	}
+
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return nil, err
+	}
+
+	details := &SceneDetails{
+		ID:            sc.ID.Hex(),
+		Name:          sc.Name,
+		Status:        sc.Status,
+		StatusName:    scene.StatusName(sc.Status),
+		Tags:          sc.Tags,
+		CreatedAt:     sc.ID.Timestamp().UTC(),
+		FinishedAt:    sc.FinishedAt,
+		Failure:       sc.Failure,
+		SharedWith:    make([]string, 0, len(sc.SharedWith)),
+		Outputs:       make(map[string][]int),
+		StageProgress: sc.CurrentStageProgress(),
+	}
+	if details.Tags == nil {
+		details.Tags = []string{}
+	}
+	if sc.Config != nil {
+		details.Config = sc.Config.NerfTrainingConfig
+		details.SfmOnly = sc.Config.SfmOnly
+	}
+	if sc.Video != nil {
+		details.Video = newSceneVideoDetails(sc.Video)
+	}
+	if sc.Sfm != nil {
+		details.Sfm = &SceneSfmDetails{
+			FrameCount:      len(sc.Sfm.Frames),
+			WhiteBackground: sc.Sfm.WhiteBackground,
+			QualityReport:   sc.Sfm.QualityReport,
+			PointCloud:      sc.Sfm.PointCloudFilePath != "",
+		}
+	}
+	if owner {
+		for _, id := range sc.SharedWith {
+			details.SharedWith = append(details.SharedWith, id.Hex())
+		}
+	}
+	if sc.Nerf != nil && details.Config != nil {
+		for _, ot := range details.Config.OutputTypes {
+			iterations, err := sc.Nerf.SavedIterations(ot)
+			if err != nil || len(iterations) == 0 {
+				continue
+			}
+			details.Outputs[ot] = iterations
+		}
+	}
+	details.Downloadable = sc.Status == scene.StatusComplete && len(details.Outputs) > 0
+	if thumbnailPath, err := s.sceneThumbnailPath(sc); err == nil {
+		details.Thumbnail = s.sceneThumbnailSize(ctx, sc, thumbnailPath)
+	}
+
+	s.logger.Info("Scene details retrieved successfully")
+	return details, nil
+}
+
+// GetSceneName returns the name of the scene with the given ID.
+//
+// Returns (string) if scene valid. Returns ("", scene.ErrSceneNotFound) if the scene does not exist or the user does
+// not have access to it, or ("", error) if an error occurred.
+func (s *ClientService) GetSceneName(ctx context.Context, userID, sceneID primitive.ObjectID) (string, error) {
+	s.logger.Debug("Get scene name request received")
+
+	sceneIDs, err := s.userSceneIDs(ctx, userID)
+	if err != nil {
+		s.logger.Info("Error getting scene name:", err.Error())
 		return "", err
 	}
 
-	// Update user with new scene
-	user, err := s.userManager.GetUserByID(ctx, userID)
+	// Access is checked by the query
+	sc, err := s.sceneManager.GetSceneForUser(ctx, userID, sceneID, sceneIDs)
+	if err != nil {
+		s.logger.Info("Error getting scene name:", err.Error())
+		return "", err
+	}
+
+	s.logger.Info("Scene name retrieved successfully")
+	return sc.Name, nil
+}
+
+// GetSceneOutputPath returns the relative path to the output file for the given scene, and the iteration it was
+// saved at. Paths are relative to the main *.go executable. An iteration of 0 selects the latest saved iteration.
+//
+// Returns (string, int) if successful. Returns ("", 0, error) if the user does not have access to the scene or an
+// error occurred.
+func (s *ClientService) GetSceneOutputPath(ctx context.Context, userID, sceneID primitive.ObjectID, outputType string, iteration int) (string, int, error) {
+	s.logger.Debug("Get scene output request received")
+
+	// Verify user access to scene
+	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return "", 0, err
+	}
+
+	nerf, err := s.sceneManager.GetNerf(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return "", 0, err
+	}
+
+	if iteration == 0 {
+		if available, err := nerf.SavedIterations(outputType); err == nil && len(available) > 0 {
+			iteration = available[len(available)-1]
+		}
+	}
+
+	outputPath, err := nerf.GetFilePathForTypeAndIter(outputType, iteration)
+	if err != nil {
+		s.logger.Info("Error getting output file:", err.Error())
+		return "", 0, err
+	}
+
+	return outputPath, iteration, nil
+}
+
+// IterationNotSavedError is returned when a scene output is requested at an iteration that was not saved.
+// It lists the iterations that were saved, so clients can pick one.
+type IterationNotSavedError struct {
+	Iteration int
+	Available []int
+}
+
+func (e *IterationNotSavedError) Error() string {
+	return fmt.Sprintf("%s: %d", scene.ErrIterationNotSaved.Error(), e.Iteration)
+}
+
+// Unwrap allows matching the error with errors.Is(err, scene.ErrIterationNotSaved).
+func (e *IterationNotSavedError) Unwrap() error {
+	return scene.ErrIterationNotSaved
+}
+
+// GetSceneOutputIterationPath returns the path to the output file of the given type, saved at the given iteration, and
+// the iteration. An iteration of 0 selects the final saved iteration. The owner of the scene and the users it is shared
+// with may download it.
+//
+// Returns error if the user does not have access to the scene, the scene has no nerf (scene.ErrNerfNotFound), the
+// output was not saved at the iteration (*IterationNotSavedError), or an error occurred.
+func (s *ClientService) GetSceneOutputIterationPath(ctx context.Context, userID, sceneID primitive.ObjectID, outputType string, iteration int) (string, int, error) {
+	s.logger.Debug("Get scene output iteration request received")
+
+	// Verify user has access to scene
+	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return "", 0, err
+	}
+
+	outputPath, iteration, err := s.outputIterationPath(ctx, sceneID, outputType, iteration)
+	if err != nil {
+		return "", 0, err
+	}
+
+	s.logger.Info("Scene output iteration retrieved successfully")
+	return outputPath, iteration, nil
+}
+
+// outputIterationPath returns the local path of the given output type of the scene, at the given iteration,
+// or the latest saved iteration if iteration is 0, and the iteration. Access is not checked.
+func (s *ClientService) outputIterationPath(ctx context.Context, sceneID primitive.ObjectID, outputType string, iteration int) (string, int, error) {
+	nerf, err := s.sceneManager.GetNerf(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return "", 0, err
+	}
+
+	available, err := nerf.SavedIterations(outputType)
+	if err != nil {
+		s.logger.Info("Invalid output type:", err.Error())
+		return "", 0, err
+	}
+	if iteration == 0 && len(available) > 0 {
+		iteration = available[len(available)-1]
+	}
+
+	outputPath, err := nerf.GetFilePathForTypeAndIter(outputType, iteration)
+	if err != nil {
+		s.logger.Info("Error getting output file:", err.Error())
+		return "", 0, &IterationNotSavedError{Iteration: iteration, Available: available}
+	}
+	return outputPath, iteration, nil
+}
+
+// RecordOutputDownload counts a download of the output of the given type of the scene, saved at the given iteration.
+// The count is recorded in the background, so it never delays the download; if the task pool is full, the download
+// is not counted.
+func (s *ClientService) RecordOutputDownload(sceneID primitive.ObjectID, outputType string, iteration int) {
+	err := s.tasks.Submit(TaskTypeStats, func(ctx context.Context) error {
+		return s.sceneManager.RecordOutputDownload(ctx, sceneID, outputType, iteration)
+	})
+	if err != nil {
+		s.logger.Warn("Failed to record output download:", err.Error())
+	}
+}
+
+// OutputStats is the download statistics of an output file.
+type OutputStats struct {
+	Iteration      int        `json:"iteration"`
+	Downloads      int64      `json:"downloads"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+}
+
+// GetSceneOutputStats returns the download statistics of the outputs of the given type of the scene, one per saved
+// iteration in ascending order. Only the owner of the scene may view them, as they count the downloads of collaborators
+// too.
+//
+// Returns error if the user does not own the scene, the scene has no nerf (scene.ErrNerfNotFound), or an error
+// occurred.
+func (s *ClientService) GetSceneOutputStats(ctx context.Context, userID, sceneID primitive.ObjectID, outputType string) ([]OutputStats, error) {
+	s.logger.Debug("Get scene output stats request received")
+
+	// Verify user owns scene
+	if err := s.verifyUserOwnership(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return nil, err
+	}
+
+	nerf, err := s.sceneManager.GetNerf(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Invalid scene ID:", err.Error())
+		return nil, err
+	}
+	available, err := nerf.SavedIterations(outputType)
+	if err != nil {
+		s.logger.Info("Invalid output type:", err.Error())
+		return nil, err
+	}
+
+	downloads, err := s.sceneManager.GetOutputDownloadStats(ctx, sceneID, outputType)
+	if err != nil {
+		s.logger.Info("Error getting output download stats:", err.Error())
+		return nil, err
+	}
+
+	stats := make([]OutputStats, 0, len(available))
+	for _, iteration := range available {
+		entry := OutputStats{Iteration: iteration}
+		if recorded := downloads[strconv.Itoa(iteration)]; recorded != nil {
+			entry.Downloads = recorded.Count
+			entry.LastAccessedAt = recorded.LastAccessedAt
+		}
+		stats = append(stats, entry)
+	}
+
+	s.logger.Info("Scene output stats retrieved successfully")
+	return stats, nil
+}
+
+// OutputArchiveEntry is an output file to include in an archive of scene outputs.
+type OutputArchiveEntry struct {
+	// Path is the stored file. It may be compressed (see OpenOutput).
+	Path string
+	// Name is the file's path within the archive: `<scene_id>/<output_type>/iteration_<n>/<file name>`.
+	Name string
+}
+
+// GetScenesOutputArchive lists the output files of the given scenes, all of which the user must own or have been
+// shared, to download them as a single archive. Only the given output types are included, or all of them if none are
+// given. Scenes without outputs (i.e still processing) contribute no files; files missing on disk are left to the
+// caller to skip.
+//
+// Returns user.ErrUserNoAccess if the user does not have access to one of the scenes, scene.ErrSceneNotFound if one
+// does not exist, or error if an error occurred. No files are listed unless all scenes are accessible.
+func (s *ClientService) GetScenesOutputArchive(ctx context.Context, userID primitive.ObjectID, sceneIDs []primitive.ObjectID, outputTypes []string) ([]OutputArchiveEntry, error) {
+	s.logger.Debug("Get scenes output archive request received")
+
+	if len(outputTypes) == 0 {
+		outputTypes = []string{"model", "splat_cloud", "point_cloud", "video"}
+	}
+
+	entries := make([]OutputArchiveEntry, 0)
+	for _, sceneID := range sceneIDs {
+		if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+			s.logger.Info("Invalid user ID access:", err.Error())
+			return nil, err
+		}
+
+		nerf, err := s.sceneManager.GetNerf(ctx, sceneID)
+		if errors.Is(err, scene.ErrNerfNotFound) {
+			continue
+		}
+		if err != nil {
+			s.logger.Info("Invalid scene ID:", err.Error())
+			return nil, err
+		}
+
+		for _, outputType := range outputTypes {
+			iterations, err := nerf.SavedIterations(outputType)
+			if err != nil {
+				return nil, err
+			}
+			paths, _ := nerf.GetFilePathsForType(outputType)
+			for _, iteration := range iterations {
+				path := paths[iteration]
+				entries = append(entries, OutputArchiveEntry{
+					Path: path,
+					Name: fmt.Sprintf("%s/%s/iteration_%d/%s", sceneID.Hex(), outputType, iteration, filepath.Base(UncompressedName(path))),
+				})
+			}
+		}
+	}
+
+	s.logger.Info("Scenes output archive listed successfully")
+	return entries, nil
+}
+
+// CheckSceneShareable checks that the user may create a share link to the given scene: only the owner may share
+// a scene by link, and only once it has completed.
+//
+// Returns nil if the scene can be shared, scene.ErrNerfNotFound if it has not completed, scene.ErrSceneNotFound if
+// it does not exist or the user does not own it, or error if an error occurred.
+func (s *ClientService) CheckSceneShareable(ctx context.Context, userID, sceneID primitive.ObjectID) error {
+	s.logger.Debug("Check scene shareable request received")
+
+	// Verify user owns scene
+	if err := s.verifySceneOwner(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return err
+	}
+
+	if _, err := s.sceneManager.GetNerf(ctx, sceneID); err != nil {
+		s.logger.Info("Scene not shareable:", err.Error())
+		return err
+	}
+	return nil
+}
+
+// SharedSceneInfo describes the scene a share link points to.
+type SharedSceneInfo struct {
+	ID   string `json:"scene_id"`
+	Name string `json:"name"`
+	// Outputs maps each available output type to the iterations it was saved at, in ascending order.
+	Outputs map[string][]int `json:"outputs"`
+}
+
+// GetSharedSceneInfo returns the name and available outputs of the scene a share link points to. The share link
+// is expected to have been verified by the caller, so access is not checked.
+//
+// Returns scene.ErrSceneNotFound or scene.ErrNerfNotFound if the scene no longer exists (or is in the trash), or has
+// no outputs.
+func (s *ClientService) GetSharedSceneInfo(ctx context.Context, sceneID primitive.ObjectID) (*SharedSceneInfo, error) {
+	s.logger.Debug("Get shared scene info request received")
+
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Error getting shared scene:", err.Error())
+		return nil, err
+	}
+	// Share links of scenes in the trash stop working until the scene is restored
+	if sc.DeletedAt != nil {
+		return nil, scene.ErrSceneNotFound
+	}
+	if sc.Nerf == nil {
+		return nil, scene.ErrNerfNotFound
+	}
+
+	info := &SharedSceneInfo{
+		ID:      sceneID.Hex(),
+		Name:    sc.Name,
+		Outputs: make(map[string][]int),
+	}
+	for _, outputType := range []string{"model", "splat_cloud", "point_cloud", "video"} {
+		iterations, err := sc.Nerf.SavedIterations(outputType)
+		if err == nil && len(iterations) > 0 {
+			info.Outputs[outputType] = iterations
+		}
+	}
+	return info, nil
+}
+
+// GetSharedSceneOutputPath returns the local path of an output of the scene a share link points to, at the given
+// iteration, or the latest saved iteration if iteration is 0, and the iteration. The share link is expected to have been verified by
+// the caller, so access is not checked.
+//
+// Returns scene.ErrSceneNotFound if the scene no longer exists (or is in the trash), or an *IterationNotSavedError if
+// the output was not saved at the iteration.
+func (s *ClientService) GetSharedSceneOutputPath(ctx context.Context, sceneID primitive.ObjectID, outputType string, iteration int) (string, int, error) {
+	s.logger.Debug("Get shared scene output request received")
+
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Error getting shared scene:", err.Error())
+		return "", 0, err
+	}
+	if sc.DeletedAt != nil {
+		return "", 0, scene.ErrSceneNotFound
+	}
+	return s.outputIterationPath(ctx, sceneID, outputType, iteration)
+}
+
+// ErrPromotionSourceMissing is returned when promoting a scene whose raw video is no longer available.
+var ErrPromotionSourceMissing = errors.New("source video of the scene is no longer available")
+
+// isPreview checks if the given scene was trained for fewer iterations than a full run.
+func (s *ClientService) isPreview(sc *scene.Scene) bool {
+	if sc.Config == nil || sc.Config.NerfTrainingConfig == nil {
+		return false
+	}
+	return sc.Config.NerfTrainingConfig.TotalIterations < s.config.FullRunIterations
+}
+
+// PromoteScene creates a full run of a completed preview scene, without re-uploading. The new scene reuses the raw
+// video of the preview, and its sfm output if it is still available, in which case it is queued straight for
+// training. Only the owner of the scene may promote it.
+//
+// If SfM is redone and IsolateSharedInputs is enabled, the new scene reads its own read-only copy of the raw video, so
+// promoting the same preview again does not have several jobs reading the same file.
+//
+// Returns the ID of the new scene if successful. Returns scene.ErrSceneNotReady if the scene has not completed,
+// scene.ErrSceneNotPreview if it is not a preview, ErrPromotionSourceMissing if SfM has to be redone but the raw
+// video is gone, or error if the user does not own the scene or an error occurred.
+func (s *ClientService) PromoteScene(ctx context.Context, userID, sceneID primitive.ObjectID) (string, error) {
+	s.logger.Debug("Promote scene request received")
+
+	// Verify user owns scene
+	if err := s.verifyUserOwnership(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return "", err
+	}
+
+	source, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Error getting scene:", err.Error())
+		return "", err
+	}
+	if source.Status != scene.StatusComplete {
+		s.logger.Info("Scene not ready for promotion")
+		return "", scene.ErrSceneNotReady
+	}
+	// Promoted scenes are full runs, even if the full run iterations were raised since
+	if !s.isPreview(source) || source.PromotedFrom != nil || source.Video == nil {
+		s.logger.Info("Scene is not a preview")
+		return "", scene.ErrSceneNotPreview
+	}
+
+	sourceConfig := source.Config.NerfTrainingConfig
+	saveIterations := slices.Clone(sourceConfig.SaveIterations)
+	if !slices.Contains(saveIterations, s.config.FullRunIterations) {
+		saveIterations = append(saveIterations, s.config.FullRunIterations)
+	}
+
+	video := *source.Video
+	newScene := &scene.Scene{
+		ID:    primitive.NewObjectID(),
+		Video: &video,
+		Config: &scene.TrainingConfig{
+			NerfTrainingConfig: &scene.NerfTrainingConfig{
+				TrainingMode:    sourceConfig.TrainingMode,
+				OutputTypes:     slices.Clone(sourceConfig.OutputTypes),
+				SaveIterations:  saveIterations,
+				TotalIterations: s.config.FullRunIterations,
+			},
+		},
+		Name:         source.Name,
+		UserID:       userID,
+		Tags:         source.Tags,
+		PromotedFrom: &source.ID,
+	}
+
+	// SfM is reused if its frames are still on disk
+	reuseSfm := false
+	if source.Sfm != nil && len(source.Sfm.Frames) > 0 {
+		if _, err := os.Stat(filepath.Join("data", "sfm", source.ID.Hex())); err == nil {
+			reuseSfm = true
+		}
+	}
+	if !reuseSfm {
+		if _, err := os.Stat(video.FilePath); err != nil {
+			s.logger.Info("Source video of promoted scene not found:", err.Error())
+			return "", ErrPromotionSourceMissing
+		}
+		// Promotions of the same preview would otherwise all read the preview's video
+		if s.config.IsolateSharedInputs {
+			if err := s.isolateSharedVideo(newScene); err != nil {
+				s.logger.Errorf("Failed to copy source video of promoted scene: %v", err)
+				return "", err
+			}
+		}
+	}
+
+	if reuseSfm {
+		newScene.Sfm = source.Sfm
+		newScene.Status = scene.StatusNerfProcessing
+	}
+	if err := s.sceneManager.SetScene(ctx, newScene.ID, newScene); err != nil {
+		s.logger.Errorf("Failed to insert promoted scene into database: %v", err)
+		return "", err
+	}
+
+	if reuseSfm {
+		err = s.mqService.PublishNERFJob(ctx, newScene)
+		if err == nil {
+			err = s.queueManager.AppendToQueue(ctx, "queue_list", newScene.ID)
+		}
+	} else {
+		err = s.mqService.PublishSFMJob(ctx, newScene)
+	}
+	if err != nil {
+		s.logger.Errorf("Failed to publish promoted scene: %v", err)
+		return "", err
+	}
+
+	// Update user with new scene
+	owner, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if err := owner.AddScene(newScene.ID); err != nil {
+		return "", err
+	}
+	if err := s.userManager.UpdateUser(ctx, owner); err != nil {
+		return "", err
+	}
+
+	s.logger.Infof("Scene %s promoted to full run %s", sceneID.Hex(), newScene.ID.Hex())
+	return newScene.ID.Hex(), nil
+}
+
+// RenameScene sets the name of the given scene. Only the owner of the scene may rename it.
+//
+// Returns nil if successful, scene.ErrSceneNotFound if the scene does not exist, is in the trash or the user does not
+// own it, or error if an error occurred.
+func (s *ClientService) RenameScene(ctx context.Context, userID, sceneID primitive.ObjectID, name string) error {
+	s.logger.Debug("Rename scene request received")
+
+	// Verify user owns scene
+	if err := s.verifySceneOwner(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return err
+	}
+
+	if err := s.sceneManager.SetSceneName(ctx, sceneID, name); err != nil {
+		s.logger.Info("Error renaming scene:", err.Error())
+		return err
+	}
+
+	s.logger.Info("Scene renamed successfully")
+	return nil
+}
+
+// UpdateScene applies a partial update (name, description, tags, favorite) to the given scene, all at once.
+// Only the owner of the scene may update it.
+//
+// Returns nil if successful, error if the user does not own the scene, the scene does not exist
+// (scene.ErrSceneNotFound), or an error occurred.
+func (s *ClientService) UpdateScene(ctx context.Context, userID, sceneID primitive.ObjectID, update scene.SceneUpdate) error {
+	s.logger.Debug("Update scene request received")
+
+	// Verify user owns scene
+	if err := s.verifyUserOwnership(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return err
+	}
+
+	if err := s.sceneManager.UpdateScene(ctx, sceneID, update); err != nil {
+		s.logger.Info("Error updating scene:", err.Error())
+		return err
+	}
+
+	s.logger.Info("Scene updated successfully")
+	return nil
+}
+
+// UpdateSceneACL grants or revokes read access to the given scene for the user with the given username.
+// Only the owner of the scene may change who it is shared with.
+//
+// Returns nil if successful, scene.ErrSceneNotFound if the scene does not exist or the requesting user does not own
+// it, user.ErrUserNotFound if the target user does not exist, or error if an error occurred.
+func (s *ClientService) UpdateSceneACL(ctx context.Context, ownerID, sceneID primitive.ObjectID, username string, grant bool) error {
+	s.logger.Debug("Update scene ACL request received")
+
+	// Verify user owns scene
+	if err := s.verifySceneOwner(ctx, ownerID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return err
+	}
+
+	target, err := s.userManager.GetUserByUsername(ctx, username)
+	if err != nil {
+		s.logger.Info("Error getting ACL target user:", err.Error())
+		return err
+	}
+	if target.ID == ownerID {
+		return scene.ErrShareWithOwner
+	}
+
+	if grant {
+		err = s.sceneManager.AddSharedUser(ctx, sceneID, target.ID)
+	} else {
+		err = s.sceneManager.RemoveSharedUser(ctx, sceneID, target.ID)
+	}
+	if err != nil {
+		s.logger.Info("Error updating scene ACL:", err.Error())
+		return err
+	}
+
+	s.logger.Info("Scene ACL updated successfully")
+	return nil
+}
+
+// CancelAndDeleteScene cancels the processing of a queued scene and deletes it, along with its files.
+// A scene can only be cancelled while it waits for SfM: the first scene of the sfm_list queue is the one the
+// sfm-worker is processing, and scenes past SfM have started training.
+//
+// Returns nil if successful, scene.ErrInvalidOpOnProcessingScene if processing has already started, or error if
+// the user does not own the scene or an error occurred.
+func (s *ClientService) CancelAndDeleteScene(ctx context.Context, userID, sceneID primitive.ObjectID) error {
+	s.logger.Debug("Cancel and delete scene request received")
+
+	// Verify user owns scene
+	if err := s.verifyUserOwnership(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return err
+	}
+
+	position, _, err := s.queueManager.GetQueuePosition(ctx, "sfm_list", sceneID)
+	if err != nil && err != queue.ErrIDNotFoundInQueue {
+		s.logger.Info("Error getting sfm queue position:", err.Error())
+		return err
+	}
+	if err == nil && position == 0 {
+		s.logger.Info("Scene is being processed by the sfm-worker, cannot cancel")
+		return scene.ErrInvalidOpOnProcessingScene
+	}
+
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
 	if err != nil {
-		return "", err
-	}
-	if err := user.AddScene(sceneID); err != nil {
-		return "", err
+		s.logger.Info("Error getting scene:", err.Error())
+		return err
 	}
-	if err := s.userManager.UpdateUser(ctx, user); err != nil {
-		return "", err
+
+	// Deleting the document is the commit point: once it is gone, results for the scene are discarded by AMPQService
+	if err := s.sceneManager.DeleteQueuedScene(ctx, sceneID); err != nil {
+		s.logger.Info("Error deleting queued scene:", err.Error())
+		return err
 	}
 
-	return sceneID.Hex(), nil
+	s.removeSceneData(ctx, userID, sc)
+
+	s.logger.Info("Scene cancelled and deleted successfully")
+	return nil
 }
 
-// GetUserSceneHistory returns a list of scene IDS that the user has access to.
-// It is tolerant of scenes that have been deleted / not finished processing by ignoring them.
+// DeleteScene deletes a scene that has finished processing (complete or failed). Only the owner of the scene may
+// delete it. Scenes still waiting for SfM can be deleted with CancelAndDeleteScene.
 //
-// Returns a list of primitive.ObjectID's. Returns error if the user does not exist or non scene-existence errors occur.
-func (s *ClientService) GetUserSceneHistory(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
-	s.logger.Debug("Get user history request received")
+// If TrashRetention is set, the scene is moved to the trash: it is hidden from the owner and the users it is shared
+// with, and can be restored with RestoreScene until PurgeTrash deletes it along with its files. Otherwise the scene
+// is deleted right away, along with its files.
+//
+// Returns nil if successful, scene.ErrSceneNotFound if the scene does not exist, is already in the trash, or the user
+// does not own it, scene.ErrInvalidOpOnProcessingScene if it is still processing, or error if an error occurred.
+func (s *ClientService) DeleteScene(ctx context.Context, userID, sceneID primitive.ObjectID) error {
+	s.logger.Debug("Delete scene request received")
 
-	user, err := s.userManager.GetUserByID(ctx, userID)
+	// Verify user owns scene before reading it, so the scenes of other users are indistinguishable from missing ones
+	if err := s.verifySceneOwner(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return err
+	}
+
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
 	if err != nil {
-		s.logger.Info("Failed to get user history:", err.Error())
-		return nil, err
+		s.logger.Info("Error getting scene:", err.Error())
+		return err
+	}
+	if sc.DeletedAt != nil {
+		s.logger.Info("Scene is already in the trash")
+		return scene.ErrSceneNotFound
 	}
 
-	resources := make([]string, 0)
-	for _, sceneID := range user.SceneIDs {
-		_, err := s.sceneManager.GetNerf(ctx, sceneID)
+	if !scene.IsTerminalStatus(sc.Status) {
+		s.logger.Info("Scene is still processing, cannot delete")
+		return scene.ErrInvalidOpOnProcessingScene
+	}
 
-		// Ignore scenes that have been deleted / not finished processing
-		if err == scene.ErrSceneNotFound || err == scene.ErrNerfNotFound {
-			continue
+	if s.config.TrashRetention > 0 {
+		if err := s.sceneManager.SoftDeleteScene(ctx, sceneID, userID); err != nil {
+			s.logger.Info("Error moving scene to the trash:", err.Error())
+			return err
 		}
-		if err != nil {
-			s.logger.Info("Failed to get user history:", err.Error())
-			return nil, err
+		// Removed from the owner's scenes, so the scene is no longer listed or accessible
+		if err := s.userManager.RemoveUserScene(ctx, userID, sceneID); err != nil {
+			s.logger.Errorf("Error removing trashed scene from user: %v", err)
 		}
+		s.logger.Info("Scene moved to the trash successfully")
+		return nil
+	}
 
-		resources = append(resources, sceneID.Hex())
+	if err := s.sceneManager.DeleteScene(ctx, sceneID); err != nil {
+		s.logger.Info("Error deleting scene:", err.Error())
+		return err
 	}
+	s.removeSceneData(ctx, userID, sc)
 
-	s.logger.Info("User history retrieved successfully")
-	return resources, nil
+	s.logger.Info("Scene deleted successfully")
+	return nil
 }
 
-// GetSceneThumbnailPath returns the path to the thumbnail image for the given scene.
-// Paths are relative to the main *.go executable.
+// RestoreScene takes a scene the user deleted out of the trash, if it was deleted within TrashRetention. Only the
+// owner of the scene may restore it.
 //
-// Internally, sfm frame data is used to determine the thumbnail path. THese are stored as http endpoints.
-// So, a little bit of string manipulation is required.
+// Returns nil if successful, scene.ErrSceneNotFound if the scene does not exist (i.e it was purged) or the user does
+// not own it, scene.ErrSceneNotInTrash if it is not in the trash or was deleted longer than TrashRetention ago, or
+// error if an error occurred.
+func (s *ClientService) RestoreScene(ctx context.Context, userID, sceneID primitive.ObjectID) error {
+	s.logger.Debug("Restore scene request received")
+
+	sceneIDs, err := s.userSceneIDs(ctx, userID)
+	if err != nil {
+		s.logger.Info("Error getting user scenes:", err.Error())
+		return err
+	}
+	// Scenes in the trash are no longer in the owner's scene list, but their owner is recorded on them when trashed
+	sc, err := s.sceneManager.GetOwnedScene(ctx, userID, sceneID, sceneIDs)
+	if err != nil {
+		s.logger.Info("Error getting scene:", err.Error())
+		return err
+	}
+	if sc.DeletedAt == nil {
+		s.logger.Info("Scene is not in the trash")
+		return scene.ErrSceneNotInTrash
+	}
+
+	if err := s.sceneManager.RestoreScene(ctx, sceneID, time.Now().Add(-s.config.TrashRetention)); err != nil {
+		s.logger.Info("Error restoring scene:", err.Error())
+		return err
+	}
+	if err := s.userManager.AddUserScene(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Error adding restored scene to user:", err.Error())
+		return err
+	}
+
+	s.logger.Info("Scene restored successfully")
+	return nil
+}
+
+// PurgeTrash deletes the scenes that have been in the trash for longer than TrashRetention, along with their files.
+// Scenes left in the trash after TrashRetention was disabled are all deleted.
 //
-// Returns ("", error) if the user does not have access to the scene or an error occurred.
-func (s *ClientService) GetSceneThumbnailPath(ctx context.Context, userID, sceneID primitive.ObjectID) (string, error) {
-	s.logger.Debug("Get scene thumbnail request received")
+// Returns the number of scenes deleted, or error if an error occurred.
+func (s *ClientService) PurgeTrash(ctx context.Context) (int, error) {
+	deletedBefore := time.Now().Add(-s.config.TrashRetention)
+	purged := 0
+	for {
+		scenes, err := s.sceneManager.GetTrashedScenes(ctx, deletedBefore, cleanupBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		for _, sc := range scenes {
+			if err := s.sceneManager.DeleteScene(ctx, sc.ID); err != nil && !errors.Is(err, scene.ErrSceneNotFound) {
+				return purged, err
+			}
+			s.removeSceneData(ctx, sc.UserID, sc)
+			purged++
+		}
+		if len(scenes) < cleanupBatchSize {
+			return purged, nil
+		}
+	}
+}
 
-	// Verify user access to scene
-	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
-		s.logger.Info("Invalid user ID access:", err.Error())
-		return "", err
+// removeSceneData removes everything referring to a deleted scene: its queue entries, its entry in the owner's scene
+// list, and its files (uploaded video, sfm and nerf outputs). Failures are logged, as the scene is already deleted.
+//
+// Returns the number of bytes freed.
+func (s *ClientService) removeSceneData(ctx context.Context, ownerID primitive.ObjectID, sc *scene.Scene) int64 {
+	for _, queueName := range s.queueManager.GetQueueNames() {
+		err := s.queueManager.DeleteFromQueue(ctx, queueName, sc.ID)
+		if err != nil && err != queue.ErrIDNotFoundInQueue && err != queue.ErrInvalidOpOnEmptyQueue {
+			s.logger.Errorf("Error removing deleted scene from %s: %v", queueName, err)
+		}
 	}
 
-	sfm, err := s.sceneManager.GetSfm(ctx, sceneID)
-	if err != nil {
-		s.logger.Info("Invalid scene ID:", err.Error())
-		return "", err
+	if err := s.userManager.RemoveUserScene(ctx, ownerID, sc.ID); err != nil {
+		s.logger.Errorf("Error removing deleted scene from user: %v", err)
 	}
 
-	if len(sfm.Frames) == 0 {
-		s.logger.Info("No frames found in SFM data")
-		return "", fmt.Errorf("no frames found in SFM data")
+	// Remove the uploaded video, and anything the workers wrote
+	paths := []string{filepath.Join("data", "nerf", sc.ID.Hex())}
+
+	// Promoted scenes share the raw video and sfm output of their source, which are only removed once neither
+	// the source nor any scene promoted from it remains. A promoted scene's own sfm output (if SfM was redone)
+	// is never shared.
+	sourceID := sc.ID
+	if sc.PromotedFrom != nil {
+		sourceID = *sc.PromotedFrom
+		paths = append(paths, filepath.Join("data", "sfm", sc.ID.Hex()))
+		// Its own copy of the source video (see IsolateSharedInputs) is never shared either
+		if ownsVideoFile(sc) {
+			paths = append(paths, sc.Video.FilePath)
+		}
+	}
+	inUse, err := s.sceneManager.IsPromotionSourceInUse(ctx, sourceID)
+	if err != nil {
+		s.logger.Errorf("Error checking if files of deleted scene are in use: %v", err)
+		inUse = true
 	}
+	if !inUse {
+		paths = append(paths,
+			filepath.Join("data", "raw", "videos", sourceID.Hex()+".mp4"),
+			filepath.Join("data", "sfm", sourceID.Hex()),
+		)
+		if sc.Video != nil && sc.Video.FilePath != "" && !slices.Contains(paths, sc.Video.FilePath) {
+			paths = append(paths, sc.Video.FilePath)
+		}
+		if sc.Video != nil && sc.Video.OriginalFilePath != "" && !slices.Contains(paths, sc.Video.OriginalFilePath) {
+			paths = append(paths, sc.Video.OriginalFilePath)
+		}
+	}
+	var freed int64
+	for _, path := range paths {
+		size, _ := directorySize(path)
+		if err := os.RemoveAll(path); err != nil {
+			s.logger.Errorf("Error removing files of deleted scene at %s: %v", path, err)
+			continue
+		}
+		freed += size
+	}
+	s.storageUsage.Add(-freed)
+	return freed
+}
 
-	// Use the first frame as the thumbnail
-	thumbnailPath := sfm.Frames[0].FilePath
+// cleanupBatchSize is the number of scenes fetched at once by cleanupStorage.
+const cleanupBatchSize = 50
 
-	if filepath.Ext(thumbnailPath) != ".png" {
-		s.logger.Info("First frame is not a PNG file")
-		return "", fmt.Errorf("first frame is not a PNG file")
+// checkStorageCapacity checks that the platform's total storage usage is below the configured high-water mark.
+// If it is not, a cleanup of old scenes is started in the background.
+//
+// Returns nil if there is room, or if no high-water mark is configured. Returns ErrStorageFull otherwise.
+func (s *ClientService) checkStorageCapacity() error {
+	if s.config.StorageHighWaterMark <= 0 {
+		return nil
+	}
+	usage, err := s.storageUsage.Usage()
+	if err != nil {
+		return err
+	}
+	if usage < s.config.StorageHighWaterMark {
+		return nil
 	}
 
-	// Convert API endpoint path to local file system path
-	u, err := url.Parse(thumbnailPath)
+	if s.storageCleanup.CompareAndSwap(false, true) {
+		s.logger.Infof("Storage usage %d bytes is above the high-water mark, cleaning up old scenes", usage)
+		if err := s.tasks.Submit(TaskTypeMaintenance, s.cleanupStorage); err != nil {
+			s.storageCleanup.Store(false)
+			s.logger.Errorf("Failed to start storage cleanup: %v", err)
+		}
+	}
+	return ErrStorageFull
+}
+
+// cleanupStorage deletes scenes until the platform's storage usage is below the high-water mark. Scenes in the trash
+// are purged first, oldest deletion first, regardless of TrashRetention, as their owners already deleted them. If
+// StorageEvictScenes is enabled, failed scenes and then scenes that finished more than StorageCleanupAfter ago are
+// deleted next, oldest first, and their owners are notified through their inbox.
+func (s *ClientService) cleanupStorage(ctx context.Context) error {
+	defer s.storageCleanup.Store(false)
+
+	usage, err := s.storageUsage.Usage()
 	if err != nil {
-		s.logger.Info("Invalid URL:", err.Error())
-		return "", fmt.Errorf("invalid URL: %v", err)
+		return err
 	}
 
-	// Extract the path and remove "/worker-data" prefix if it exists
-	localPath := strings.TrimPrefix(u.Path, "/worker-data/")
+	var deleted int
+	defer func() {
+		s.logger.Infof("Storage cleanup deleted %d scenes, usage is now %d bytes", deleted, usage)
+	}()
+	evicting := false
+	for usage >= s.config.StorageHighWaterMark {
+		var candidates []*scene.Scene
+		if evicting {
+			finishedBefore := time.Now().Add(-s.config.StorageCleanupAfter)
+			candidates, err = s.sceneManager.GetCleanupCandidates(ctx, finishedBefore, cleanupBatchSize)
+		} else {
+			candidates, err = s.sceneManager.GetTrashedScenes(ctx, time.Now(), cleanupBatchSize)
+		}
+		if err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			if !evicting && s.config.StorageEvictScenes {
+				evicting = true
+				continue
+			}
+			s.logger.Error("Storage is above the high-water mark, but no more scenes can be cleaned up")
+			return nil
+		}
 
-	// Ensure the path starts with "/data"
-	if !strings.HasPrefix(localPath, "data") {
-		s.logger.Info("Invalid path: does not start with data")
-		return "", fmt.Errorf("invalid path: does not start with data")
+		for _, sc := range candidates {
+			if err := s.sceneManager.DeleteScene(ctx, sc.ID); err != nil {
+				if errors.Is(err, scene.ErrSceneNotFound) {
+					continue
+				}
+				return err
+			}
+			ownerID := sc.UserID
+			if ownerID.IsZero() {
+				ownerID, _ = s.userManager.GetSceneOwnerID(ctx, sc.ID)
+			}
+			s.removeSceneData(ctx, ownerID, sc)
+			if evicting {
+				s.notifySceneEvicted(ctx, ownerID, sc)
+			}
+			deleted++
+
+			if usage, err = s.storageUsage.Usage(); err != nil {
+				return err
+			}
+			if usage < s.config.StorageHighWaterMark {
+				break
+			}
+		}
 	}
+	return nil
+}
 
-	s.logger.Info("Thumbnail retrieved successfully")
-	return localPath, nil
+// notifySceneEvicted adds a notification to the owner's inbox that their scene was deleted by the storage cleanup.
+// Failures to notify are logged, as the scene is already deleted.
+func (s *ClientService) notifySceneEvicted(ctx context.Context, ownerID primitive.ObjectID, sc *scene.Scene) {
+	if ownerID.IsZero() {
+		return
+	}
+	notification := &user.Notification{
+		UserID:    ownerID,
+		Type:      user.NotificationSceneEvicted,
+		SceneID:   sc.ID,
+		SceneName: sc.Name,
+		Message:   "scene was deleted to free platform storage",
+	}
+	if err := s.notifications.AddNotification(ctx, notification); err != nil {
+		s.logger.Errorf("Failed to notify owner of evicted scene %s: %v", sc.ID.Hex(), err)
+	}
 }
-// GetSceneName returns the name of the scene with the given ID.
+
+// ErrVideoNotProbed is returned when the metadata of a scene's video is requested before the video was probed.
+var ErrVideoNotProbed = errors.New("video has not been probed yet")
+
+// GetSceneVideoInfo returns the probed metadata of the given scene's uploaded video (resolution, fps, duration, codec,
+// size), so clients can show it without downloading the video. The owner of the scene and the users it is shared with
+// may view it.
 //
-// Returns (string) if scene valid. Returns ("", error) if the user does not have access to the scene or an error occurred.
-func (s *ClientService) GetSceneName(ctx context.Context, userID, sceneID primitive.ObjectID) (string, error) {
-	s.logger.Debug("Get scene name request received")
+// Returns ErrVideoNotProbed if the video has not been probed yet, or error if the user does not have access to the
+// scene, the scene does not exist (scene.ErrSceneNotFound), or an error occurred.
+func (s *ClientService) GetSceneVideoInfo(ctx context.Context, userID, sceneID primitive.ObjectID) (*SceneVideoDetails, error) {
+	s.logger.Debug("Get scene video info request received")
 
-	// Verify user access to scene
+	// Verify user has access to scene
 	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
 		s.logger.Info("Invalid user ID access:", err.Error())
-		return "", err
+		return nil, err
 	}
 
-	sceneName, err := s.sceneManager.GetSceneName(ctx, sceneID)
-	if err != nil {
-		s.logger.Info("Error getting scene name:", err.Error())
-		return "", err
+	video, err := s.sceneManager.GetVideo(ctx, sceneID)
+	if err != nil && !errors.Is(err, scene.ErrVideoNotFound) {
+		s.logger.Info("Error getting video:", err.Error())
+		return nil, err
+	}
+	if video == nil || !video.IsProbed() {
+		s.logger.Info("Video not probed yet")
+		return nil, ErrVideoNotProbed
 	}
 
-	s.logger.Info("Scene name retrieved successfully")
-	return sceneName, nil
+	s.logger.Info("Scene video info retrieved successfully")
+	return newSceneVideoDetails(video), nil
 }
 
-// GetSceneOutputPath returns the relative path to the output file for the given scene.
-// Paths are relative to the main *.go executable.
+// GetSceneStatus returns a structured processing status of the given scene (see scene.Scene.ProcessingStatus), so
+// clients do not have to guess from the metadata whether processing finished. The owner of the scene and the users it
+// is shared with may view it.
 //
-// Returns (string) if successful. Returns ("", error) if the user does not have access to the scene or an error occurred.
-func (s *ClientService) GetSceneOutputPath(ctx context.Context, userID, sceneID primitive.ObjectID, outputType, iteration string) (string, error) {
-	s.logger.Debug("Get scene output request received")
+// Returns error if the user does not have access to the scene, the scene does not exist (scene.ErrSceneNotFound), or an
+// error occurred.
+func (s *ClientService) GetSceneStatus(ctx context.Context, userID, sceneID primitive.ObjectID) (*scene.ProcessingStatus, error) {
+	s.logger.Debug("Get scene status request received")
 
-	// Verify user access to scene
+	// Verify user has access to scene
 	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
 		s.logger.Info("Invalid user ID access:", err.Error())
-		return "", err
+		return nil, err
 	}
 
-	nerf, err := s.sceneManager.GetNerf(ctx, sceneID)
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
 	if err != nil {
-		s.logger.Info("Invalid scene ID:", err.Error())
-		return "", err
+		s.logger.Info("Error getting scene:", err.Error())
+		return nil, err
 	}
 
-	intIteration := -1
-	if iteration == "" {
-		intIteration = -1
-	} else {
-		intIteration, err = strconv.Atoi(iteration)
-		if err != nil {
-			s.logger.Info("Invalid iteration:", err.Error())
-			return "", err
-		}
+	status := sc.ProcessingStatus()
+	s.logger.Info("Scene status retrieved successfully")
+	return &status, nil
+}
+
+// WatchSceneStatus follows the processing status of the given scene, polling the scene every interval. The owner of the
+// scene and the users it is shared with may follow it.
+//
+// The current status is sent first, then every change. The channel is closed once the scene reaches a terminal status,
+// if the scene can no longer be read (i.e it was deleted), or when the returned function is called, which must be done
+// once the caller stops reading.
+//
+// Returns error if the user does not have access to the scene, the scene does not exist (scene.ErrSceneNotFound), or an
+// error occurred.
+func (s *ClientService) WatchSceneStatus(ctx context.Context, userID, sceneID primitive.ObjectID, interval time.Duration) (<-chan scene.ProcessingStatus, func(), error) {
+	s.logger.Debug("Watch scene status request received")
+
+	// Verify user has access to scene
+	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return nil, nil, err
 	}
 
-	outputPath, err := nerf.GetFilePathForTypeAndIter(outputType, intIteration)
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
 	if err != nil {
-		s.logger.Info("Error getting output file:", err.Error())
-		return "", err
+		s.logger.Info("Error getting scene:", err.Error())
+		return nil, nil, err
+	}
+
+	if interval <= 0 {
+		interval = time.Second
 	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	updates := make(chan scene.ProcessingStatus, 1)
+	updates <- sc.ProcessingStatus()
+
+	go func() {
+		defer close(updates)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := sc.ProcessingStatus()
+		for !scene.IsTerminalStatus(sc.Status) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if sc, err = s.sceneManager.GetScene(ctx, sceneID); err != nil {
+				s.logger.Info("Stopped watching scene status:", err.Error())
+				return
+			}
+			status := sc.ProcessingStatus()
+			if status == last {
+				continue
+			}
+			select {
+			case updates <- status:
+				last = status
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-	return outputPath, nil
+	return updates, cancel, nil
 }
 
 // GetSceneProgress returns the progress of the scene processing pipeline for the given scene.
@@ -455,6 +2730,7 @@ func (s *ClientService) GetSceneOutputPath(ctx context.Context, userID, sceneID
 //	    "stage": string,
 //	    "stage_position": int,
 //	    "stage_size": int,
+//	    "stage_progress": float64 | null, (percent within the stage, as reported by the worker)
 //	}
 func (s *ClientService) GetSceneProgress(ctx context.Context, userID, sceneID primitive.ObjectID) (map[string]interface{}, error) {
 	s.logger.Debug("Get scene progress handler")
@@ -519,6 +2795,17 @@ func (s *ClientService) GetSceneProgress(ctx context.Context, userID, sceneID pr
 		}, nil
 	}
 
+	// Worker reported progress within the stage, if any
+	var stageProgress interface{}
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Error getting scene:", err.Error())
+		return nil, err
+	}
+	if progress := sc.CurrentStageProgress(); progress != nil {
+		stageProgress = progress.Percent
+	}
+
 	return map[string]interface{}{
 		"processing":       processing,
 		"overall_position": overallPosition,
@@ -526,5 +2813,191 @@ func (s *ClientService) GetSceneProgress(ctx context.Context, userID, sceneID pr
 		"stage":            queueNames[stageIdx],
 		"stage_position":   stagePosition,
 		"stage_size":       stageSize,
+		"stage_progress":   stageProgress,
 	}, nil
 }
+
+// RecordTransfer adds the given number of uploaded and downloaded bytes to the user's transfer totals.
+// It is a no-op if usage accounting is disabled. Failures are logged, and never fail the transfer itself.
+func (s *ClientService) RecordTransfer(ctx context.Context, userID primitive.ObjectID, uploaded, downloaded int64) {
+	if !s.config.UsageAccounting || (uploaded == 0 && downloaded == 0) {
+		return
+	}
+	if err := s.userManager.AddTransferUsage(ctx, userID, uploaded, downloaded); err != nil {
+		s.logger.Error("Failed to record transfer usage:", err.Error())
+	}
+}
+
+// GetUserUsage returns the total number of bytes the user has uploaded and downloaded.
+//
+// Returns error if the user does not exist or an error occurred.
+func (s *ClientService) GetUserUsage(ctx context.Context, userID primitive.ObjectID) (*user.TransferUsage, error) {
+	s.logger.Debug("Get user usage request received")
+
+	if _, err := s.userManager.GetUserByID(ctx, userID); err != nil {
+		s.logger.Info("Failed to get user usage:", err.Error())
+		return nil, err
+	}
+
+	usage, err := s.userManager.GetTransferUsage(ctx, userID)
+	if err != nil {
+		s.logger.Info("Failed to get user usage:", err.Error())
+		return nil, err
+	}
+
+	s.logger.Info("User usage retrieved successfully")
+	return usage, nil
+}
+
+// SetUserWebhook sets the URL notifications are sent to for the user, and generates a new signing secret.
+// An empty URL removes the webhook.
+//
+// Returns the signing secret if successful, error if the URL is invalid, the user does not exist or an error occurred.
+func (s *ClientService) SetUserWebhook(ctx context.Context, userID primitive.ObjectID, webhookURL string) (string, error) {
+	s.logger.Debug("Set user webhook request received")
+
+	if webhookURL == "" {
+		if err := s.userManager.SetWebhook(ctx, userID, nil); err != nil {
+			s.logger.Info("Failed to remove webhook:", err.Error())
+			return "", err
+		}
+		s.logger.Info("Webhook removed successfully")
+		return "", nil
+	}
+
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return "", err
+	}
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		s.logger.Error("Failed to generate webhook secret:", err.Error())
+		return "", err
+	}
+	if err := s.userManager.SetWebhook(ctx, userID, &user.Webhook{URL: webhookURL, Secret: secret}); err != nil {
+		s.logger.Info("Failed to set webhook:", err.Error())
+		return "", err
+	}
+
+	s.logger.Info("Webhook set successfully")
+	return secret, nil
+}
+
+// TestUserWebhook sends a signed sample payload to the user's webhook, and reports the delivery result.
+// An unreachable or failing endpoint is not an error; it is reported in the result.
+//
+// Returns ErrWebhookNotConfigured if the user has no webhook, or error if the user does not exist or an error occurred.
+func (s *ClientService) TestUserWebhook(ctx context.Context, userID primitive.ObjectID) (*WebhookDelivery, error) {
+	s.logger.Debug("Test user webhook request received")
+
+	u, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		s.logger.Info("Failed to test webhook:", err.Error())
+		return nil, err
+	}
+	if u.Webhook == nil || u.Webhook.URL == "" {
+		return nil, ErrWebhookNotConfigured
+	}
+
+	payload := map[string]interface{}{
+		"event":    "test",
+		"message":  "This is a test notification.",
+		"sent_at":  time.Now().UTC(),
+		"scene_id": primitive.NilObjectID.Hex(),
+		"status":   scene.StatusName(scene.StatusComplete),
+	}
+	delivery := s.webhooks.Send(ctx, u.Webhook.URL, u.Webhook.Secret, payload)
+
+	s.logger.Infof("Test webhook sent, delivered: %v", delivery.Delivered)
+	return &delivery, nil
+}
+
+// inboxLimit is the maximum number of unread notifications returned by GetUserNotifications.
+const inboxLimit = 100
+
+// GetUserNotifications returns the unread notifications of the user's inbox, newest first, at most inboxLimit.
+// Notifications are added when the user's scenes complete or fail, for clients that can not receive webhooks.
+//
+// Returns error if an error occurred.
+func (s *ClientService) GetUserNotifications(ctx context.Context, userID primitive.ObjectID) ([]*user.Notification, error) {
+	s.logger.Debug("Get user notifications request received")
+
+	notifications, err := s.notifications.GetUnreadNotifications(ctx, userID, inboxLimit)
+	if err != nil {
+		s.logger.Info("Failed to get user notifications:", err.Error())
+		return nil, err
+	}
+
+	s.logger.Info("User notifications retrieved successfully")
+	return notifications, nil
+}
+
+// MarkUserNotificationsRead marks the given unread notifications of the user's inbox read, or all of them if ids is
+// empty. Read notifications are no longer returned by GetUserNotifications, and are removed after
+// NotificationRetention.
+//
+// Returns the number of notifications marked read, or error if an error occurred.
+func (s *ClientService) MarkUserNotificationsRead(ctx context.Context, userID primitive.ObjectID, ids []primitive.ObjectID) (int64, error) {
+	s.logger.Debug("Mark user notifications read request received")
+
+	marked, err := s.notifications.MarkNotificationsRead(ctx, userID, ids, s.config.NotificationRetention)
+	if err != nil {
+		s.logger.Info("Failed to mark user notifications read:", err.Error())
+		return 0, err
+	}
+
+	s.logger.Infof("Marked %d user notifications read", marked)
+	return marked, nil
+}
+
+// ErrBrokerDisconnected is reported by CheckReadiness when the message broker connection is down.
+var ErrBrokerDisconnected = errors.New("message broker disconnected")
+
+// readinessCheckTimeout bounds each dependency check of CheckReadiness.
+const readinessCheckTimeout = 2 * time.Second
+
+// ReadinessReport is the result of CheckReadiness. Checks maps each dependency to "ok", or the reason it failed.
+type ReadinessReport struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// CheckReadiness checks the dependencies needed to serve requests: the database, the queues, the message broker
+// and, if StorageCheck is enabled, the data directory. Each check is bounded by readinessCheckTimeout.
+func (s *ClientService) CheckReadiness(ctx context.Context) ReadinessReport {
+	checks := map[string]func(context.Context) error{
+		"database": s.sceneManager.Ping,
+		"queues":   s.queueManager.Ping,
+		"broker": func(context.Context) error {
+			if !s.mqService.Connected() {
+				return ErrBrokerDisconnected
+			}
+			return nil
+		},
+		"storage": func(context.Context) error { return s.CheckStorage() },
+	}
+
+	report := ReadinessReport{Ready: true, Checks: make(map[string]string, len(checks))}
+	for name, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+		err := check(checkCtx)
+		cancel()
+
+		if err != nil {
+			s.logger.Infof("Readiness check %s failed: %v", name, err)
+			report.Ready = false
+			report.Checks[name] = err.Error()
+			continue
+		}
+		report.Checks[name] = "ok"
+	}
+	return report
+}
+
+// GetMetrics returns a snapshot of internal server metrics, such as cache effectiveness.
+// The returned map is intended to be serialized directly as the metrics endpoint response.
+func (s *ClientService) GetMetrics() map[string]interface{} {
+	return map[string]interface{}{
+		"scene_name_cache": s.sceneManager.NameCacheStats(),
+		"task_pool":        s.tasks.Stats(),
+	}
+}
@@ -0,0 +1,298 @@
+// This file contains the admin-only ClientService methods. Callers (the WebServer) are responsible for
+// only dispatching requests from admins to these methods; IsAdmin can be used to check.
+//
+// Aggregate statistics are computed by the database wherever possible, and are cached briefly
+// so that dashboards polling the stats endpoint do not hammer the database.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
+)
+
+// PlatformStats is a high-level overview of platform usage.
+type PlatformStats struct {
+	TotalUsers        int64            `json:"total_users"`
+	TotalScenes       int64            `json:"total_scenes"`
+	ScenesByStatus    map[string]int64 `json:"scenes_by_status"`
+	TotalStorageBytes int64            `json:"total_storage_bytes"`
+	JobsCompleted24h  int64            `json:"jobs_completed_24h"`
+	JobsFailed24h     int64            `json:"jobs_failed_24h"`
+	UploadedBytes     int64            `json:"uploaded_bytes"`
+	DownloadedBytes   int64            `json:"downloaded_bytes"`
+	GeneratedAt       time.Time        `json:"generated_at"`
+
+	// StorageHighWaterMarkBytes is the configured storage limit, if any. StorageFull is set once it is reached.
+	StorageHighWaterMarkBytes int64 `json:"storage_high_water_mark_bytes,omitempty"`
+	StorageFull               bool  `json:"storage_full"`
+}
+
+// Throughput bucket sizes, by name.
+var throughputBuckets = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// ErrInvalidThroughputBucket is returned when queue throughput is requested with an unknown bucket size.
+var ErrInvalidThroughputBucket = errors.New("invalid throughput bucket, expected hour or day")
+
+// QueueThroughput is the number of processing jobs that finished in each time bucket of a window.
+type QueueThroughput struct {
+	// Bucket is the size of the buckets ("hour" or "day").
+	Bucket  string             `json:"bucket"`
+	Since   time.Time          `json:"since"`
+	Until   time.Time          `json:"until"`
+	Buckets []ThroughputBucket `json:"buckets"`
+	// Completed and Failed are the totals over the window.
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+}
+
+// ThroughputBucket is the number of processing jobs that finished within [Start, Start + bucket size).
+type ThroughputBucket struct {
+	Start     time.Time `json:"start"`
+	Completed int64     `json:"completed"`
+	Failed    int64     `json:"failed"`
+}
+
+// platformStatsCache holds the most recently computed PlatformStats.
+type platformStatsCache struct {
+	mu        sync.Mutex
+	stats     *PlatformStats
+	expiresAt time.Time
+}
+
+// IsAdmin checks if the user with the given ID has the admin role.
+//
+// Returns false, error if the user does not exist or an error occurred.
+func (s *ClientService) IsAdmin(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	u, err := s.userManager.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return u.IsAdmin(), nil
+}
+
+// SetUserRole sets the role of the user with the given username. If revokeTokens is true, all of the user's
+// previously issued tokens are revoked, so the user has to log in (or refresh their token) again.
+//
+// Returns error if the user does not exist, the role is invalid (user.ErrInvalidRole), or an error occurred.
+func (s *ClientService) SetUserRole(ctx context.Context, username, role string, revokeTokens bool) error {
+	s.logger.Debug("Set user role request received")
+
+	u, err := s.userManager.GetUserByUsername(ctx, username)
+	if err != nil {
+		s.logger.Info("Invalid username:", err.Error())
+		return err
+	}
+
+	if err := s.userManager.SetRole(ctx, u.ID, role); err != nil {
+		s.logger.Info("Failed to set user role:", err.Error())
+		return err
+	}
+
+	if revokeTokens {
+		if _, err := s.userManager.RevokeTokens(ctx, u.ID); err != nil {
+			s.logger.Info("Failed to revoke user tokens:", err.Error())
+			return err
+		}
+	}
+
+	s.logger.Infof("Role of user %s set to %s", u.ID.Hex(), role)
+	return nil
+}
+
+// GetPlatformStats returns aggregate platform statistics. Results are cached for the configured AdminStatsCacheTTL.
+//
+// Returns error if any of the underlying aggregations fail.
+func (s *ClientService) GetPlatformStats(ctx context.Context) (*PlatformStats, error) {
+	s.statsCache.mu.Lock()
+	defer s.statsCache.mu.Unlock()
+
+	if s.statsCache.stats != nil && time.Now().Before(s.statsCache.expiresAt) {
+		s.logger.Debug("Serving cached platform stats")
+		return s.statsCache.stats, nil
+	}
+
+	totalUsers, err := s.userManager.CountUsers(ctx)
+	if err != nil {
+		s.logger.Info("Failed to count users:", err.Error())
+		return nil, err
+	}
+
+	byStatus, err := s.sceneManager.CountScenesByStatus(ctx)
+	if err != nil {
+		s.logger.Info("Failed to count scenes by status:", err.Error())
+		return nil, err
+	}
+
+	finished, err := s.sceneManager.CountScenesFinishedSince(ctx, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		s.logger.Info("Failed to count finished scenes:", err.Error())
+		return nil, err
+	}
+
+	usage, err := s.userManager.SumTransferUsage(ctx)
+	if err != nil {
+		s.logger.Info("Failed to sum transfer usage:", err.Error())
+		return nil, err
+	}
+
+	storage, err := s.storageUsage.Usage()
+	if err != nil {
+		s.logger.Info("Failed to compute storage usage:", err.Error())
+		return nil, err
+	}
+
+	stats := &PlatformStats{
+		TotalUsers:        totalUsers,
+		ScenesByStatus:    make(map[string]int64),
+		TotalStorageBytes: storage,
+		JobsCompleted24h:  finished[scene.StatusComplete],
+		JobsFailed24h:     finished[scene.StatusFailed],
+		UploadedBytes:     usage.UploadedBytes,
+		DownloadedBytes:   usage.DownloadedBytes,
+		GeneratedAt:       time.Now().UTC(),
+
+		StorageHighWaterMarkBytes: s.config.StorageHighWaterMark,
+		StorageFull:               s.config.StorageHighWaterMark > 0 && storage >= s.config.StorageHighWaterMark,
+	}
+	for status, count := range byStatus {
+		stats.ScenesByStatus[scene.StatusName(status)] += count
+		stats.TotalScenes += count
+	}
+
+	s.statsCache.stats = stats
+	s.statsCache.expiresAt = time.Now().Add(s.config.AdminStatsCacheTTL)
+
+	s.logger.Info("Platform stats computed successfully")
+	return stats, nil
+}
+
+// GetQueueThroughput returns the number of processing jobs that finished (completed or failed) in each hour or day
+// bucket of the given window, ending now. Buckets are aligned to UTC hours or days, so the first and last buckets
+// may extend beyond the window.
+//
+// Returns ErrInvalidThroughputBucket if bucket is not "hour" or "day", or error if the aggregation fails.
+func (s *ClientService) GetQueueThroughput(ctx context.Context, window time.Duration, bucket string) (*QueueThroughput, error) {
+	s.logger.Debug("Get queue throughput request received")
+
+	size, ok := throughputBuckets[bucket]
+	if !ok {
+		return nil, ErrInvalidThroughputBucket
+	}
+
+	// The last bucket is the one containing now
+	now := time.Now().UTC()
+	until := now.Truncate(size).Add(size)
+	buckets := int((window + size - 1) / size)
+	if buckets < 1 {
+		buckets = 1
+	}
+	since := until.Add(-time.Duration(buckets) * size)
+
+	counts, err := s.sceneManager.CountScenesFinishedPerBucket(ctx, since, size, buckets)
+	if err != nil {
+		s.logger.Info("Failed to count finished scenes:", err.Error())
+		return nil, err
+	}
+
+	throughput := &QueueThroughput{
+		Bucket:  bucket,
+		Since:   since,
+		Until:   until,
+		Buckets: make([]ThroughputBucket, buckets),
+	}
+	for i, count := range counts {
+		throughput.Buckets[i] = ThroughputBucket{
+			Start:     since.Add(time.Duration(i) * size),
+			Completed: count[scene.StatusComplete],
+			Failed:    count[scene.StatusFailed],
+		}
+		throughput.Completed += count[scene.StatusComplete]
+		throughput.Failed += count[scene.StatusFailed]
+	}
+
+	s.logger.Info("Queue throughput computed successfully")
+	return throughput, nil
+}
+
+// RepairScene validates the scene document against the expected schema and fills missing fields with defaults.
+// A missing owner is recovered from the user whose scene list contains the scene. If dryRun is true, the repairs
+// are only reported.
+//
+// Returns the repair report if successful, error if the scene does not exist or an error occurred.
+func (s *ClientService) RepairScene(ctx context.Context, sceneID primitive.ObjectID, dryRun bool) (*scene.RepairReport, error) {
+	s.logger.Debug("Repair scene request received")
+
+	owner, err := s.userManager.GetSceneOwnerID(ctx, sceneID)
+	if err != nil && !errors.Is(err, user.ErrUserNotFound) {
+		s.logger.Info("Failed to look up scene owner:", err.Error())
+		return nil, err
+	}
+
+	report, err := s.sceneManager.RepairScene(ctx, sceneID, owner, dryRun)
+	if err != nil {
+		s.logger.Info("Failed to repair scene:", err.Error())
+		return nil, err
+	}
+
+	s.logger.Infof("Scene %s repaired successfully, %d fields repaired (dry run: %v)", sceneID.Hex(), len(report.Repaired), dryRun)
+	return report, nil
+}
+
+// RepairScenes runs RepairScene for each of the given scenes. A failure to repair one scene does not stop
+// the batch; it is recorded in that scene's report instead.
+func (s *ClientService) RepairScenes(ctx context.Context, sceneIDs []primitive.ObjectID, dryRun bool) []*scene.RepairReport {
+	reports := make([]*scene.RepairReport, 0, len(sceneIDs))
+	for _, sceneID := range sceneIDs {
+		report, err := s.RepairScene(ctx, sceneID, dryRun)
+		if err != nil {
+			report = &scene.RepairReport{
+				SceneID:  sceneID.Hex(),
+				DryRun:   dryRun,
+				Repaired: map[string]interface{}{},
+				Error:    err.Error(),
+			}
+			if errors.Is(err, scene.ErrDatabaseUnavailable) {
+				report.Error = scene.ErrDatabaseUnavailable.Error()
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// directorySize returns the total size in bytes of all regular files under root.
+// A missing root is treated as empty.
+func directorySize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,114 @@
+// This file contains the ClientServiceConfig struct, which holds the tunable settings of a ClientService.
+// Values are expected to be populated by the caller (usually from environment variables in main), falling back
+// to DefaultClientServiceConfig for anything not provided.
+
+package services
+
+import (
+	"time"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
+)
+
+// ClientServiceConfig holds the tunable settings of a ClientService.
+type ClientServiceConfig struct {
+	// AdminStatsCacheTTL is how long aggregate platform statistics are cached before being recomputed.
+	AdminStatsCacheTTL time.Duration
+	// FFmpegPath is the ffmpeg executable used to render thumbnails from trained outputs, and to downscale videos.
+	FFmpegPath string
+	// FFprobePath is the ffprobe executable used to read the resolution of uploaded videos, to downscale them.
+	FFprobePath string
+	// DownscaleVideos enables downscaling all uploaded videos larger than MaxVideoDimension before processing.
+	// Otherwise only uploads that request it are downscaled.
+	DownscaleVideos bool
+	// MaxVideoDimension is the longest side, in pixels, uploaded videos are downscaled to. Zero disables downscaling.
+	MaxVideoDimension int
+	// ThumbnailDimensions enables measuring and storing thumbnail sizes, so they can be reported without
+	// downloading the thumbnail.
+	ThumbnailDimensions bool
+	// UsageAccounting enables recording the number of bytes each user uploads and downloads.
+	UsageAccounting bool
+	// WebhookTimeout bounds a single webhook delivery, including connecting.
+	WebhookTimeout time.Duration
+	// NotificationRetention is how long notifications are kept once the user marked them read.
+	NotificationRetention time.Duration
+	// WebhookAllowPrivate allows webhooks to loopback and private addresses. Only intended for development.
+	WebhookAllowPrivate bool
+	// IdempotencyKeyTTL is how long a new scene idempotency key is remembered.
+	IdempotencyKeyTTL time.Duration
+	// IdempotencyWaitTimeout bounds how long a duplicate request waits for the request holding its idempotency key.
+	IdempotencyWaitTimeout time.Duration
+	// RefreshTokenTTL is how long a refresh token is valid for. Each use issues a new one.
+	RefreshTokenTTL time.Duration
+	// DeduplicateUploads enables returning the existing scene when a user uploads identical video content under
+	// the same scene name, instead of processing it again.
+	DeduplicateUploads bool
+	// IsolateSharedInputs enables giving each promoted scene that redoes SfM its own read-only copy of the raw video
+	// it shares with its preview, so concurrent jobs never read the same file.
+	IsolateSharedInputs bool
+	// SyncWrites enables flushing uploaded videos and thumbnails to stable storage (fsync) before they are recorded,
+	// so they survive a power failure.
+	SyncWrites bool
+	// StorageCheck enables checking that the data directory is writable before accepting uploads. Uploads are
+	// rejected with ErrStorageReadOnly if it is not, and the server reports itself unhealthy.
+	StorageCheck bool
+	// FullRunIterations is the number of training iterations of a full quality run. Completed scenes trained for
+	// fewer iterations are previews, and can be promoted to a full run.
+	FullRunIterations int
+	// StorageHighWaterMark is the total number of bytes the data directory may use. Once usage reaches it, uploads
+	// are rejected with ErrStorageFull, and scenes in the trash are purged until usage is below it again (see
+	// StorageEvictScenes). Zero disables the limit.
+	StorageHighWaterMark int64
+	// StorageUsageRefresh is how often the data directory is re-measured for StorageHighWaterMark. In between,
+	// usage is tracked from the files the server writes and removes.
+	StorageUsageRefresh time.Duration
+	// TrashRetention is how long deleted scenes are kept in the trash, from which their owner can restore them, before
+	// they are purged along with their files. Zero deletes scenes right away.
+	TrashRetention time.Duration
+	// StorageEvictScenes enables the storage cleanup to delete users' scenes once the trash is empty: failed scenes
+	// first, then completed scenes, oldest first. Owners are notified through their inbox. Disabled by default, so
+	// only scenes already in the trash are deleted.
+	StorageEvictScenes bool
+	// StorageCleanupAfter is how long a completed scene must have been finished before it may be deleted by the
+	// storage cleanup, if StorageEvictScenes is enabled. Zero allows deleting any finished scene.
+	StorageCleanupAfter time.Duration
+	// LoginLockoutThreshold is the number of consecutive failed logins after which an account is locked.
+	// Zero disables lockouts.
+	LoginLockoutThreshold int
+	// LoginLockoutDuration is how long an account stays locked. Failures further apart than this are not counted
+	// as consecutive.
+	LoginLockoutDuration time.Duration
+	// RejectUploadsWithoutWorkers enables rejecting uploads with ErrNoWorkersAvailable while no worker is healthy
+	// (see WorkerHealth), instead of queueing jobs no worker will process.
+	RejectUploadsWithoutWorkers bool
+	// PasswordPolicy is the strength required of passwords set at registration or when changing a password.
+	PasswordPolicy user.PasswordPolicy
+}
+
+// DefaultClientServiceConfig returns the default ClientService configuration.
+func DefaultClientServiceConfig() ClientServiceConfig {
+	return ClientServiceConfig{
+		AdminStatsCacheTTL:     30 * time.Second,
+		FFmpegPath:             "ffmpeg",
+		FFprobePath:            "ffprobe",
+		MaxVideoDimension:      1920,
+		ThumbnailDimensions:    true,
+		UsageAccounting:        true,
+		WebhookTimeout:         10 * time.Second,
+		NotificationRetention:  7 * 24 * time.Hour,
+		IdempotencyKeyTTL:      24 * time.Hour,
+		IdempotencyWaitTimeout: 30 * time.Second,
+		RefreshTokenTTL:        30 * 24 * time.Hour,
+		IsolateSharedInputs:    true,
+		SyncWrites:             true,
+		StorageCheck:           true,
+		FullRunIterations:      scene.DefaultTotalIterations,
+		StorageUsageRefresh:    time.Minute,
+		StorageCleanupAfter:    30 * 24 * time.Hour,
+		TrashRetention:         7 * 24 * time.Hour,
+		LoginLockoutThreshold:  10,
+		LoginLockoutDuration:   15 * time.Minute,
+		PasswordPolicy:         user.DefaultPasswordPolicy(),
+	}
+}
@@ -0,0 +1,73 @@
+// This file contains the durable writes of critical files: uploaded videos, worker outputs and thumbnails. Closing a
+// written file does not flush it to disk, so a power failure shortly after a scene is reported complete could lose
+// files the database already points at. With SyncWrites, these files and the directories naming them are flushed
+// (fsync) before they are recorded.
+//
+// Syncing costs a few milliseconds per file, which deployments favoring speed over durability can disable.
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// syncedFile is a file or directory opened to be flushed to stable storage. *os.File implements it.
+type syncedFile interface {
+	Sync() error
+	Close() error
+}
+
+// fileOpener opens the file or directory at path to be flushed. Services use openFile unless tests inject their own.
+type fileOpener func(path string) (syncedFile, error)
+
+// openFile opens the file or directory at path on the local filesystem.
+func openFile(path string) (syncedFile, error) {
+	return os.Open(path)
+}
+
+// syncFile flushes the file at path, and the directory entry naming it, to stable storage. The file and directory
+// are opened with open, or openFile if it is nil.
+func syncFile(open fileOpener, path string) error {
+	if open == nil {
+		open = openFile
+	}
+	file, err := open(path)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(open, filepath.Dir(path))
+}
+
+// syncDir flushes the entries of the directory at path (i.e a created or renamed file) to stable storage.
+func syncDir(open fileOpener, path string) error {
+	dir, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// syncWrite flushes the critical file at path to stable storage if SyncWrites is enabled.
+func (s *ClientService) syncWrite(path string) error {
+	if !s.config.SyncWrites {
+		return nil
+	}
+	return syncFile(s.openFile, path)
+}
+
+// syncWrite flushes the critical file at path to stable storage if SyncWrites is enabled.
+func (s *AMPQService) syncWrite(path string) error {
+	if !s.config.SyncWrites {
+		return nil
+	}
+	return syncFile(s.openFile, path)
+}
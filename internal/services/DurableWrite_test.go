@@ -0,0 +1,176 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// recordingOpener records the calls made on the files it opens, without touching the filesystem.
+type recordingOpener struct {
+	calls   []string
+	syncErr error
+	// onSync is called when a file is synced, if set
+	onSync func(path string)
+}
+
+type recordedFile struct {
+	opener *recordingOpener
+	path   string
+}
+
+func (o *recordingOpener) open(path string) (syncedFile, error) {
+	o.calls = append(o.calls, "open "+path)
+	return &recordedFile{opener: o, path: path}, nil
+}
+
+func (f *recordedFile) Sync() error {
+	f.opener.calls = append(f.opener.calls, "sync "+f.path)
+	if f.opener.onSync != nil {
+		f.opener.onSync(f.path)
+	}
+	return f.opener.syncErr
+}
+
+func (f *recordedFile) Close() error {
+	f.opener.calls = append(f.opener.calls, "close "+f.path)
+	return nil
+}
+
+func TestSyncWrite(t *testing.T) {
+	path := filepath.Join("data", "raw", "videos", "video.mp4")
+
+	t.Run("disabled", func(t *testing.T) {
+		opener := &recordingOpener{}
+		s := &ClientService{openFile: opener.open}
+		if err := s.syncWrite(path); err != nil {
+			t.Fatalf("syncWrite: %v", err)
+		}
+		if len(opener.calls) != 0 {
+			t.Errorf("calls = %v, want nothing synced", opener.calls)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		opener := &recordingOpener{}
+		s := &ClientService{config: ClientServiceConfig{SyncWrites: true}, openFile: opener.open}
+		if err := s.syncWrite(path); err != nil {
+			t.Fatalf("syncWrite: %v", err)
+		}
+		dir := filepath.Dir(path)
+		want := []string{"open " + path, "sync " + path, "close " + path, "open " + dir, "sync " + dir, "close " + dir}
+		if !reflect.DeepEqual(opener.calls, want) {
+			t.Errorf("calls = %v, want %v", opener.calls, want)
+		}
+	})
+
+	t.Run("sync fails", func(t *testing.T) {
+		syncErr := errors.New("disk gone")
+		opener := &recordingOpener{syncErr: syncErr}
+		s := &AMPQService{config: AMPQServiceConfig{SyncWrites: true}, openFile: opener.open}
+		if err := s.syncWrite(path); !errors.Is(err, syncErr) {
+			t.Fatalf("syncWrite() = %v, want the sync error", err)
+		}
+		// The file is closed, and its directory is not synced
+		if want := []string{"open " + path, "sync " + path, "close " + path}; !reflect.DeepEqual(opener.calls, want) {
+			t.Errorf("calls = %v, want %v", opener.calls, want)
+		}
+	})
+}
+
+func TestProcessSFMJobSyncsFramesBeforeRecording(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("sfm only", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("frame"))
+		}))
+		defer worker.Close()
+
+		sceneID := primitive.NewObjectID()
+		sceneDoc := bson.D{
+			{Key: "_id", Value: sceneID},
+			{Key: "status", Value: scene.StatusSfmProcessing},
+			{Key: "video", Value: bson.D{{Key: "file_path", Value: "data/raw/videos/video.mp4"}}},
+			{Key: "config", Value: bson.D{{Key: "sfm_only", Value: true}}},
+		}
+		updated := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}}
+		queued := func(name string) bson.D {
+			return mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: name},
+				{Key: "queue", Value: bson.A{sceneID}},
+			})
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, sceneDoc),
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, sceneDoc),
+			updated, // SetSfm
+			updated, // SetVideo
+			queued("sfm_list"),
+			updated,
+			queued("queue_list"),
+			updated,
+			updated, // SetSceneStatus
+			updated, // AppendSceneLog
+		)
+
+		s := newMockedAMPQService(mt)
+		s.config.SyncWrites = true
+		framePath := filepath.Join("data", "sfm", sceneID.Hex(), "0001.png")
+		// The number of commands sent when the frame was synced
+		sentAtSync := -1
+		opener := &recordingOpener{onSync: func(path string) {
+			if path == framePath {
+				sentAtSync = len(mt.GetAllStartedEvents())
+			}
+		}}
+		s.openFile = opener.open
+
+		body, err := json.Marshal(map[string]interface{}{
+			"id":  sceneID.Hex(),
+			"sfm": map[string]interface{}{"frames": []map[string]interface{}{{"file_path": worker.URL + "/0001.png"}}},
+		})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		d := sfmDelivery(mt.T, sceneID, &countingAcknowledger{})
+		d.Body = body
+		if err := s.processSFMJob(d); err != nil {
+			mt.Fatalf("processSFMJob: %v", err)
+		}
+
+		if sentAtSync < 0 {
+			mt.Fatalf("frame %s was not synced, calls = %v", framePath, opener.calls)
+		}
+		for i, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "update" {
+				continue
+			}
+			update := event.Command.Lookup("updates").Array().Index(0).Value().Document()
+			frames, err := update.LookupErr("u", "$set", "sfm", "frames")
+			if err != nil {
+				continue
+			}
+			if got := frames.Array().Index(0).Value().Document().Lookup("file_path").StringValue(); !strings.Contains(got, framePath) {
+				mt.Errorf("recorded frame path %q, want it to point at %s", got, framePath)
+			}
+			if i < sentAtSync {
+				mt.Errorf("frame was recorded by command %d, before it was synced after %d commands", i, sentAtSync)
+			}
+			return
+		}
+		mt.Fatal("frame path was never recorded")
+	})
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
+)
+
+// nopLogger returns a logger discarding its entries.
+func nopLogger() *log.Logger {
+	return &log.Logger{SugaredLogger: zap.NewNop().Sugar()}
+}
+
+// loginFailures returns a mocked login_failures record of alice, locked until lockedUntil.
+func loginFailures(lockedUntil time.Time) bson.D {
+	return bson.D{
+		{Key: "_id", Value: "alice"},
+		{Key: "count", Value: 0},
+		{Key: "locked_until", Value: lockedUntil},
+	}
+}
+
+func TestLoginLockoutCheck(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("locked", func(mt *mtest.T) {
+		until := time.Now().Add(time.Minute).UTC().Truncate(time.Millisecond)
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "nerfdb.login_failures", mtest.FirstBatch, loginFailures(until)))
+		lockout := NewLoginLockout(user.NewLoginFailureManager(mt.Client, nopLogger(), true), 3, time.Minute)
+
+		err := lockout.Check(context.Background(), "alice")
+		var lockedErr *AccountLockedError
+		if !errors.As(err, &lockedErr) {
+			mt.Fatalf("Check() = %v, want an AccountLockedError", err)
+		}
+		if !lockedErr.Until.Equal(until) {
+			mt.Errorf("locked until %v, want %v", lockedErr.Until, until)
+		}
+		if !errors.Is(err, ErrAccountLocked) {
+			mt.Error("error does not match ErrAccountLocked")
+		}
+	})
+
+	mt.Run("lockout ended", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "nerfdb.login_failures", mtest.FirstBatch, loginFailures(time.Now().Add(-time.Second))))
+		lockout := NewLoginLockout(user.NewLoginFailureManager(mt.Client, nopLogger(), true), 3, time.Minute)
+
+		if err := lockout.Check(context.Background(), "alice"); err != nil {
+			mt.Errorf("Check() = %v, want nil", err)
+		}
+	})
+
+	mt.Run("no failures", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.login_failures", mtest.FirstBatch))
+		lockout := NewLoginLockout(user.NewLoginFailureManager(mt.Client, nopLogger(), true), 3, time.Minute)
+
+		if err := lockout.Check(context.Background(), "alice"); err != nil {
+			mt.Errorf("Check() = %v, want nil", err)
+		}
+	})
+
+	mt.Run("disabled", func(mt *mtest.T) {
+		// No mocked response: the database must not be read
+		lockout := NewLoginLockout(user.NewLoginFailureManager(mt.Client, nopLogger(), true), 0, time.Minute)
+
+		if err := lockout.Check(context.Background(), "alice"); err != nil {
+			mt.Errorf("Check() = %v, want nil", err)
+		}
+		if err := lockout.Fail(context.Background(), "alice"); err != nil {
+			mt.Errorf("Fail() = %v, want nil", err)
+		}
+	})
+}
+
+func TestLoginLockoutFail(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("below threshold", func(mt *mtest.T) {
+		record := bson.D{{Key: "_id", Value: "alice"}, {Key: "count", Value: 1}, {Key: "last_failure", Value: time.Now()}}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: record}})
+		lockout := NewLoginLockout(user.NewLoginFailureManager(mt.Client, nopLogger(), true), 3, time.Minute)
+
+		if err := lockout.Fail(context.Background(), "alice"); err != nil {
+			mt.Errorf("Fail() = %v, want nil", err)
+		}
+	})
+
+	mt.Run("previous lockout", func(mt *mtest.T) {
+		// A lockout triggered by an earlier failure is not reported again
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: loginFailures(time.Now().Add(-time.Hour))}})
+		lockout := NewLoginLockout(user.NewLoginFailureManager(mt.Client, nopLogger(), true), 3, time.Minute)
+
+		if err := lockout.Fail(context.Background(), "alice"); err != nil {
+			mt.Errorf("Fail() = %v, want nil", err)
+		}
+	})
+
+	mt.Run("database error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		lockout := NewLoginLockout(user.NewLoginFailureManager(mt.Client, nopLogger(), true), 3, time.Minute)
+
+		err := lockout.Fail(context.Background(), "alice")
+		if err == nil || errors.Is(err, ErrAccountLocked) {
+			mt.Errorf("Fail() = %v, want the database error", err)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+// This file contains the MaintenanceService implementation, which runs periodic background jobs that keep the
+// database and data directory tidy, such as compacting old scene documents, removing abandoned chunked uploads, and
+// purging the trash.
+//
+// Each job runs on its own ticker, in its own goroutine. A job with a zero interval is disabled. Jobs are run through
+// the shared TaskPool, so they do not compete with other background tasks unbounded. Jobs are expected to be
+// idempotent, as a job interrupted by shutdown is simply run again on the next start.
+
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// maintenanceJob is a single periodic background job.
+type maintenanceJob struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+type MaintenanceService struct {
+	sceneManager   *scene.SceneManager
+	clientService  *ClientService
+	chunkedUploads *ChunkedUploadStore
+	config         MaintenanceServiceConfig
+	jobs           []maintenanceJob
+	tasks          *TaskPool
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	logger         *log.Logger
+}
+
+// NewMaintenanceService creates a new MaintenanceService. Jobs are not run until Start is called.
+func NewMaintenanceService(sm *scene.SceneManager, clientService *ClientService, chunkedUploads *ChunkedUploadStore, tasks *TaskPool, config MaintenanceServiceConfig, logger *log.Logger) *MaintenanceService {
+	s := &MaintenanceService{
+		sceneManager:   sm,
+		clientService:  clientService,
+		chunkedUploads: chunkedUploads,
+		tasks:          tasks,
+		config:         config,
+		logger:         logger,
+	}
+	s.jobs = []maintenanceJob{
+		{name: "scene compaction", interval: config.CompactionInterval, run: s.compactScenes},
+		{name: "chunked upload cleanup", interval: config.ChunkedUploadCleanupInterval, run: s.expireChunkedUploads},
+		{name: "trash purge", interval: config.TrashPurgeInterval, run: s.purgeTrash},
+	}
+	return s
+}
+
+// Start starts all enabled jobs in the background. Chunked uploads left by a previous run are removed first.
+func (s *MaintenanceService) Start() {
+	if removed, err := s.chunkedUploads.RemoveOrphans(); err != nil {
+		s.logger.Errorf("Failed to remove chunked uploads left by a previous run: %v", err)
+	} else if removed > 0 {
+		s.logger.Infof("Removed %d chunked uploads left by a previous run", removed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, job := range s.jobs {
+		if job.interval <= 0 {
+			s.logger.Infof("Maintenance job %s disabled", job.name)
+			continue
+		}
+		s.wg.Add(1)
+		go s.runJob(ctx, job)
+	}
+}
+
+// Stop stops all jobs, and waits for any running job to return.
+func (s *MaintenanceService) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// runJob runs job every job.interval until ctx is cancelled.
+func (s *MaintenanceService) runJob(ctx context.Context, job maintenanceJob) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.tasks.Run(ctx, TaskTypeMaintenance, job.run); err != nil && ctx.Err() == nil {
+				s.logger.Errorf("Maintenance job %s failed: %v", job.name, err)
+			}
+		}
+	}
+}
+
+// compactScenes compacts all scenes that have been terminal for longer than the configured CompactAfter.
+func (s *MaintenanceService) compactScenes(ctx context.Context) error {
+	before := time.Now().Add(-s.config.CompactAfter)
+	compacted, err := s.sceneManager.CompactScenes(ctx, before, s.config.CompactKeepLogs)
+	if err != nil {
+		return err
+	}
+	if compacted > 0 {
+		s.logger.Infof("Compacted %d scenes", compacted)
+	}
+	return nil
+}
+
+// expireChunkedUploads removes the chunked uploads that received no chunk for longer than the configured
+// ChunkedUploadTTL, along with their part files.
+func (s *MaintenanceService) expireChunkedUploads(ctx context.Context) error {
+	removed, err := s.chunkedUploads.Expire(time.Now().Add(-s.config.ChunkedUploadTTL))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		s.logger.Infof("Removed %d abandoned chunked uploads", removed)
+	}
+	return nil
+}
+
+// purgeTrash deletes the scenes that have been in the trash for longer than the trash retention, along with their
+// files. See ClientService.PurgeTrash.
+func (s *MaintenanceService) purgeTrash(ctx context.Context) error {
+	purged, err := s.clientService.PurgeTrash(ctx)
+	if purged > 0 {
+		s.logger.Infof("Purged %d scenes from the trash", purged)
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+// This file contains the MaintenanceServiceConfig struct, which holds the tunable settings of a MaintenanceService.
+// Values are expected to be populated by the caller (usually from environment variables in main), falling back
+// to DefaultMaintenanceServiceConfig for anything not provided.
+
+package services
+
+import "time"
+
+// MaintenanceServiceConfig holds the tunable settings of a MaintenanceService.
+type MaintenanceServiceConfig struct {
+	// CompactionInterval is how often terminal scenes are checked for compaction. Zero disables compaction.
+	CompactionInterval time.Duration
+	// CompactAfter is how long a scene must have been terminal (complete or failed) before it is compacted.
+	CompactAfter time.Duration
+	// CompactKeepLogs is the number of most recent log entries kept when a scene is compacted.
+	CompactKeepLogs int
+	// ChunkedUploadCleanupInterval is how often abandoned chunked uploads are removed. Zero disables the cleanup.
+	ChunkedUploadCleanupInterval time.Duration
+	// ChunkedUploadTTL is how long a chunked upload may go without receiving a chunk before it is abandoned.
+	ChunkedUploadTTL time.Duration
+	// TrashPurgeInterval is how often scenes that have been in the trash for longer than the ClientService's
+	// TrashRetention are purged. Zero disables the purge.
+	TrashPurgeInterval time.Duration
+}
+
+// DefaultMaintenanceServiceConfig returns the default MaintenanceService configuration.
+func DefaultMaintenanceServiceConfig() MaintenanceServiceConfig {
+	return MaintenanceServiceConfig{
+		CompactionInterval:           time.Hour,
+		CompactAfter:                 7 * 24 * time.Hour,
+		CompactKeepLogs:              5,
+		ChunkedUploadCleanupInterval: 10 * time.Minute,
+		ChunkedUploadTTL:             24 * time.Hour,
+		TrashPurgeInterval:           time.Hour,
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMaintenanceServiceStartRemovesLeftoverUploads(t *testing.T) {
+	dir := t.TempDir()
+	store := NewChunkedUploadStore(dir)
+
+	// Part files of a previous run, an upload of this run, and a file that is not a part file
+	leftover := filepath.Join(dir, "0123456789abcdef"+chunkedUploadExt)
+	if err := os.WriteFile(leftover, []byte("partial video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(leftover, past, past); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := store.create(primitive.NewObjectID(), "video.mp4", 1024, NewSceneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// All jobs are disabled, only the leftovers are removed
+	s := NewMaintenanceService(nil, nil, store, nil, MaintenanceServiceConfig{}, nopLogger())
+	s.Start()
+	s.Stop()
+
+	if _, err := os.Stat(leftover); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("part file of a previous run was not removed: %v", err)
+	}
+	if _, err := os.Stat(store.partPath(upload.ID)); err != nil {
+		t.Errorf("part file of an upload in progress was removed: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("file that is not a part file was removed: %v", err)
+	}
+}
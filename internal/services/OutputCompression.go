@@ -0,0 +1,163 @@
+// This file contains the compression of nerf outputs on storage. Outputs like point and splat clouds are large and
+// compress well, so the AMPQService can store configured output types compressed (see AMPQServiceConfig). A compressed
+// output is stored with the extension of its compression appended (i.e "point_cloud.ply.gz"), which is how readers
+// know to decompress it; outputs stored before compression was configured keep working as they are.
+//
+// Video outputs can not be compressed: they are compressed already, and thumbnails are rendered from them by ffmpeg.
+
+package services
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported output compressions.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressionExtensions maps each supported compression to the extension of files stored with it.
+var compressionExtensions = map[string]string{
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+// compressibleOutputTypes are the nerf output types that may be stored compressed.
+var compressibleOutputTypes = []string{"splat_cloud", "point_cloud", "model"}
+
+// ErrUnknownCompression is returned when an output compression is not supported.
+var ErrUnknownCompression = errors.New("unknown compression, expected gzip or zstd")
+
+// ValidateOutputCompression checks that every entry maps a compressible output type to a supported compression.
+func ValidateOutputCompression(compression map[string]string) error {
+	for outputType, algorithm := range compression {
+		if _, ok := compressionExtensions[algorithm]; !ok {
+			return fmt.Errorf("output type %s: %w", outputType, ErrUnknownCompression)
+		}
+		compressible := false
+		for _, t := range compressibleOutputTypes {
+			compressible = compressible || t == outputType
+		}
+		if !compressible {
+			return fmt.Errorf("output type %s can not be compressed", outputType)
+		}
+	}
+	return nil
+}
+
+// OutputCompression returns the compression a stored output file is compressed with, or "" if it is not.
+func OutputCompression(path string) string {
+	for algorithm, ext := range compressionExtensions {
+		if strings.HasSuffix(path, ext) {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// UncompressedName returns the name of a stored output file without its compression extension.
+func UncompressedName(path string) string {
+	if algorithm := OutputCompression(path); algorithm != "" {
+		return strings.TrimSuffix(path, compressionExtensions[algorithm])
+	}
+	return path
+}
+
+// OpenOutput opens a stored output file for reading its uncompressed content, decompressing it if needed.
+func OpenOutput(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch OutputCompression(path) {
+	case CompressionGzip:
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &decompressingReader{Reader: reader, closers: []io.Closer{reader, file}}, nil
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &decompressingReader{Reader: decoder, closers: []io.Closer{decoder.IOReadCloser(), file}}, nil
+	default:
+		return file, nil
+	}
+}
+
+// decompressingReader reads from a decompressor, closing it and the underlying file when closed.
+type decompressingReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *decompressingReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// compressFile compresses the file at path with the given compression, and removes the original.
+//
+// Returns the path of the compressed file.
+func compressFile(path string, algorithm string) (string, error) {
+	ext, ok := compressionExtensions[algorithm]
+	if !ok {
+		return "", ErrUnknownCompression
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	compressedPath := path + ext
+	dst, err := os.Create(compressedPath)
+	if err != nil {
+		return "", err
+	}
+
+	var writer io.WriteCloser
+	if algorithm == CompressionGzip {
+		writer = gzip.NewWriter(dst)
+	} else if writer, err = zstd.NewWriter(dst); err != nil {
+		dst.Close()
+		os.Remove(compressedPath)
+		return "", err
+	}
+
+	_, err = io.Copy(writer, src)
+	if cerr := writer.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(compressedPath)
+		return "", err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return "", err
+	}
+	return compressedPath, nil
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
+)
+
+func TestSceneAccess(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID, sceneID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	newService := func(mt *mtest.T) *ClientService {
+		return &ClientService{
+			userManager:  user.NewUserManager(mt.Client, user.NewBcryptHasher(), nopLogger(), true),
+			sceneManager: scene.NewSceneManager(mt.Client, scene.DefaultSceneManagerConfig(), nopLogger(), true),
+			logger:       nopLogger(),
+		}
+	}
+	userResponse := func(sceneIDs ...primitive.ObjectID) bson.D {
+		return mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: userID},
+			{Key: "username", Value: "alice"},
+			{Key: "scene_ids", Value: sceneIDs},
+		})
+	}
+	countResponse := func(n int) bson.D {
+		if n == 0 {
+			return mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch)
+		}
+		return mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{{Key: "_id", Value: 1}, {Key: "n", Value: n}})
+	}
+
+	mt.Run("owner", func(mt *mtest.T) {
+		mt.AddMockResponses(userResponse(sceneID))
+		owner, err := newService(mt).sceneAccess(context.Background(), userID, sceneID)
+		if err != nil || !owner {
+			mt.Errorf("sceneAccess() = %v, %v, want owner", owner, err)
+		}
+	})
+
+	mt.Run("shared", func(mt *mtest.T) {
+		mt.AddMockResponses(userResponse(), countResponse(1))
+		s := newService(mt)
+		owner, err := s.sceneAccess(context.Background(), userID, sceneID)
+		if err != nil || owner {
+			mt.Errorf("sceneAccess() = %v, %v, want shared access", owner, err)
+		}
+
+		// Shared users may read the scene, but not change it
+		mt.AddMockResponses(userResponse())
+		if err := s.verifyUserOwnership(context.Background(), userID, sceneID); !errors.Is(err, user.ErrUserNoAccess) {
+			mt.Errorf("verifyUserOwnership() = %v, want ErrUserNoAccess", err)
+		}
+	})
+
+	mt.Run("no access", func(mt *mtest.T) {
+		mt.AddMockResponses(userResponse(), countResponse(0))
+		if err := newService(mt).verifyUserAccess(context.Background(), userID, sceneID); !errors.Is(err, user.ErrUserNoAccess) {
+			mt.Errorf("verifyUserAccess() = %v, want ErrUserNoAccess", err)
+		}
+	})
+}
@@ -0,0 +1,216 @@
+// This file contains the estimation of when a queued scene finishes processing. The estimate assumes jobs keep
+// finishing at the rate they recently did: the average interval between the last completions (not the time a single
+// job takes, which workers processing in parallel would overstate) is multiplied by the number of jobs ahead of the
+// scene, plus the part of its own job that remains.
+//
+// The average interval is shared by all scenes, so it is cached for a short while rather than recomputed for every
+// estimate.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/queue"
+)
+
+const (
+	// etaHistorySize is the number of recent completions the average completion interval is computed from.
+	etaHistorySize = 20
+	// etaIntervalCacheTTL is how long the average completion interval is reused before it is recomputed.
+	etaIntervalCacheTTL = 30 * time.Second
+	// etaMinChange is the smallest change of an estimate that is pushed to watchers, unless the position changed.
+	etaMinChange = 30 * time.Second
+	// etaMinChangeRatio is the smallest change of an estimate, relative to the time remaining, that is pushed to
+	// watchers. The larger of this and etaMinChange applies.
+	etaMinChangeRatio = 0.05
+)
+
+// SceneETA is the estimated completion of a scene being processed.
+type SceneETA struct {
+	// Processing is false once the scene left the processing queue; the other fields are then unset.
+	Processing bool `json:"processing"`
+	// Position is the number of jobs ahead of the scene in the processing queue.
+	Position int `json:"position"`
+	// QueueSize is the number of jobs in the processing queue.
+	QueueSize int `json:"queue_size"`
+	// AverageInterval is the recent average interval between completions, in seconds. Zero without enough history.
+	AverageInterval float64 `json:"average_interval,omitempty"`
+	// EstimatedCompletion is when the scene is estimated to finish. Nil without enough history to estimate.
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+}
+
+// significantChange reports whether next differs enough from prev to be pushed to a watcher: the scene left the
+// queue, its position changed, or the estimate moved by more than etaMinChange and etaMinChangeRatio.
+func (prev *SceneETA) significantChange(next *SceneETA) bool {
+	if prev.Processing != next.Processing || prev.Position != next.Position {
+		return true
+	}
+	if (prev.EstimatedCompletion == nil) != (next.EstimatedCompletion == nil) {
+		return true
+	}
+	if next.EstimatedCompletion == nil {
+		return false
+	}
+
+	diff := next.EstimatedCompletion.Sub(*prev.EstimatedCompletion).Abs()
+	threshold := time.Duration(float64(time.Until(*next.EstimatedCompletion)) * etaMinChangeRatio)
+	return diff > max(threshold, etaMinChange)
+}
+
+// completionIntervalCache holds the most recently computed average completion interval.
+type completionIntervalCache struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	expiresAt time.Time
+}
+
+// averageCompletionInterval returns the average interval between the recent completions, or 0 if there are too few
+// to tell. The result is cached for etaIntervalCacheTTL.
+func (s *ClientService) averageCompletionInterval(ctx context.Context) (time.Duration, error) {
+	s.etaCache.mu.Lock()
+	defer s.etaCache.mu.Unlock()
+
+	if time.Now().Before(s.etaCache.expiresAt) {
+		return s.etaCache.interval, nil
+	}
+
+	times, err := s.sceneManager.GetRecentCompletionTimes(ctx, etaHistorySize)
+	if err != nil {
+		return 0, err
+	}
+
+	// Times are newest first, so the average interval is the span divided by the number of intervals
+	var interval time.Duration
+	if len(times) >= 2 {
+		interval = times[0].Sub(times[len(times)-1]) / time.Duration(len(times)-1)
+	}
+
+	s.etaCache.interval = interval
+	s.etaCache.expiresAt = time.Now().Add(etaIntervalCacheTTL)
+	return interval, nil
+}
+
+// estimateSceneETA estimates the completion of the given scene. It does not check access to the scene.
+func (s *ClientService) estimateSceneETA(ctx context.Context, sceneID primitive.ObjectID) (*SceneETA, error) {
+	queueNames := s.queueManager.GetQueueNames()
+	if len(queueNames) == 0 {
+		return nil, errors.New("no processing queue")
+	}
+
+	// The first queue is the overall progress (see GetSceneProgress)
+	position, size, err := s.queueManager.GetQueuePosition(ctx, queueNames[0], sceneID)
+	if errors.Is(err, queue.ErrIDNotFoundInQueue) {
+		return &SceneETA{Processing: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	eta := &SceneETA{Processing: true, Position: position, QueueSize: size}
+
+	interval, err := s.averageCompletionInterval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return eta, nil
+	}
+
+	sc, err := s.sceneManager.GetScene(ctx, sceneID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The jobs ahead, and what remains of the scene's own job
+	remaining := float64(position) + 1 - sc.ProcessingStatus().Progress
+	completion := time.Now().Add(time.Duration(remaining * float64(interval))).UTC().Truncate(time.Second)
+	eta.AverageInterval = math.Round(interval.Seconds())
+	eta.EstimatedCompletion = &completion
+	return eta, nil
+}
+
+// GetSceneETA returns the estimated completion of the given scene. The owner of the scene and the users it is shared
+// with may view it.
+//
+// Returns error if the user does not have access to the scene, or an error occurred.
+func (s *ClientService) GetSceneETA(ctx context.Context, userID, sceneID primitive.ObjectID) (*SceneETA, error) {
+	s.logger.Debug("Get scene ETA request received")
+
+	// Verify user has access to scene
+	if err := s.verifyUserAccess(ctx, userID, sceneID); err != nil {
+		s.logger.Info("Invalid user ID access:", err.Error())
+		return nil, err
+	}
+
+	eta, err := s.estimateSceneETA(ctx, sceneID)
+	if err != nil {
+		s.logger.Info("Error estimating scene ETA:", err.Error())
+		return nil, err
+	}
+
+	s.logger.Info("Scene ETA estimated successfully")
+	return eta, nil
+}
+
+// WatchSceneETA follows the estimated completion of the given scene, recomputing it every interval. Only the owner
+// of the scene may follow it.
+//
+// The current estimate is sent first, then every significant change (see SceneETA.significantChange), so watchers
+// are not flooded as the estimate drifts. The channel is closed after the estimate of a scene that left the
+// processing queue is sent, if the estimate can no longer be computed, or when the returned function is called,
+// which must be done once the caller stops reading.
+//
+// Returns error if the user does not own the scene, or an error occurred.
+func (s *ClientService) WatchSceneETA(ctx context.Context, userID, sceneID primitive.ObjectID, interval time.Duration) (<-chan SceneETA, func(), error) {
+	s.logger.Debug("Watch scene ETA request received")
+
+	last, err := s.GetSceneETA(ctx, userID, sceneID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	updates := make(chan SceneETA, 1)
+	updates <- *last
+
+	go func() {
+		defer close(updates)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for last.Processing {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			eta, err := s.estimateSceneETA(ctx, sceneID)
+			if err != nil {
+				s.logger.Info("Stopped watching scene ETA:", err.Error())
+				return
+			}
+			if !last.significantChange(eta) {
+				continue
+			}
+			select {
+			case updates <- *eta:
+				last = eta
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return updates, cancel, nil
+}
@@ -0,0 +1,72 @@
+// This file contains the isolation of raw videos shared by several scenes. Scenes promoted from a preview reuse its
+// raw video, so promoting a preview more than once can have several SfM jobs reading the same file at the same time.
+// With IsolateSharedInputs, each promoted scene redoing SfM reads its own read-only copy of the video instead. The copy
+// is a separate file, so it costs the video's size in storage, but neither scene's jobs nor deletion can affect the
+// other's input.
+
+package services
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// readOnlyCopy makes a read-only copy of the file at src at dst. The copy is written to a temporary file first, so dst
+// only exists on success.
+//
+// Returns the size of the copy.
+func readOnlyCopy(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	tmpPath := dst + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o444)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return written, nil
+}
+
+// isolateSharedVideo points the given scene at its own read-only copy of its raw video, stored next to the video and
+// named after the scene's ID. The shared video is left in place for the scenes sharing it.
+func (s *ClientService) isolateSharedVideo(sc *scene.Scene) error {
+	ext := filepath.Ext(sc.Video.FilePath)
+	copyPath := filepath.Join(filepath.Dir(sc.Video.FilePath), sc.ID.Hex()+ext)
+	size, err := readOnlyCopy(sc.Video.FilePath, copyPath)
+	if err != nil {
+		return err
+	}
+	if err := s.syncWrite(copyPath); err != nil {
+		os.Remove(copyPath)
+		return err
+	}
+	s.storageUsage.Add(size)
+
+	sc.Video.FilePath = copyPath
+	return nil
+}
+
+// ownsVideoFile checks if the raw video of the given scene is the scene's own file, named after its ID, rather than
+// the video of the scene it was promoted from.
+func ownsVideoFile(sc *scene.Scene) bool {
+	return sc.Video != nil && strings.HasPrefix(filepath.Base(sc.Video.FilePath), sc.ID.Hex())
+}
@@ -0,0 +1,76 @@
+// This file contains the StorageChecker, which checks that the data directory is writable. A common failure mode is
+// the data mount becoming read-only, in which case uploads would fail with cryptic errors. Checking with a temporary
+// write lets uploads be rejected with a clear error, and readiness report the problem, while reads keep working.
+
+package services
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// ErrStorageReadOnly is returned when the data directory is not writable.
+var ErrStorageReadOnly = errors.New("storage read-only")
+
+// StorageChecker checks whether a directory is writable, remembering the result of the last check.
+type StorageChecker struct {
+	dir      string
+	mu       sync.Mutex
+	writable bool
+	logger   *log.Logger
+}
+
+// NewStorageChecker creates a StorageChecker for dir. The directory is assumed writable until checked.
+func NewStorageChecker(dir string, logger *log.Logger) *StorageChecker {
+	return &StorageChecker{dir: dir, writable: true, logger: logger}
+}
+
+// Check attempts a temporary write in the directory, creating the directory if needed.
+//
+// Returns nil if the directory is writable, or ErrStorageReadOnly if it is not.
+func (sc *StorageChecker) Check() error {
+	err := sc.tryWrite()
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if err != nil {
+		if sc.writable {
+			sc.logger.Errorf("Storage at %s is not writable: %v", sc.dir, err)
+		}
+		sc.writable = false
+		return ErrStorageReadOnly
+	}
+	if !sc.writable {
+		sc.logger.Infof("Storage at %s is writable again", sc.dir)
+	}
+	sc.writable = true
+	return nil
+}
+
+// Writable returns the result of the last check.
+func (sc *StorageChecker) Writable() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.writable
+}
+
+// tryWrite writes and removes a temporary file in the directory.
+func (sc *StorageChecker) tryWrite() error {
+	if err := os.MkdirAll(sc.dir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(sc.dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write([]byte{0}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/queue"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
+)
+
+// newStorageCleanupService returns a ClientService on the mocked client whose storage limit is 10 bytes, and whose
+// data directory (in the working directory) is measured on every check.
+func newStorageCleanupService(mt *mtest.T, evict bool) *ClientService {
+	config := DefaultClientServiceConfig()
+	config.StorageHighWaterMark = 10
+	config.StorageEvictScenes = evict
+	return &ClientService{
+		sceneManager:  scene.NewSceneManager(mt.Client, scene.DefaultSceneManagerConfig(), nopLogger(), true),
+		userManager:   user.NewUserManager(mt.Client, &user.BcryptHasher{Cost: bcrypt.MinCost}, nopLogger(), true),
+		queueManager:  queue.NewQueueListManager(mt.Client, queue.QueueListManagerConfig{}, nopLogger(), true),
+		notifications: user.NewNotificationManager(mt.Client, nopLogger(), true),
+		storageUsage:  NewStorageTracker("data", 0),
+		config:        config,
+		logger:        nopLogger(),
+	}
+}
+
+// writeSceneOutput writes 100 bytes of nerf output of the scene, and returns its directory.
+func writeSceneOutput(t *testing.T, sceneID primitive.ObjectID) string {
+	t.Helper()
+	dir := filepath.Join("data", "nerf", sceneID.Hex())
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "splat.ply"), []byte(strings.Repeat("x", 100)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// removedSceneResponses returns the mocked responses to deleting a scene and removing its data: its deletion,
+// its removal from the (empty) queues and from its owner's scene list, and the check for scenes promoted from it.
+func removedSceneResponses() []bson.D {
+	ok := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}}
+	return []bson.D{
+		ok,
+		mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch),
+		mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch),
+		mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch),
+		ok,
+		mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch),
+	}
+}
+
+func TestCleanupStorage(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ownerID := primitive.NewObjectID()
+
+	mt.Run("purges the trash", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		trashedID := primitive.NewObjectID()
+		trashed := writeSceneOutput(mt.T, trashedID)
+		s := newStorageCleanupService(mt, false)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: trashedID},
+			{Key: "user_id", Value: ownerID},
+			{Key: "deleted_at", Value: time.Now()},
+		}))
+		mt.AddMockResponses(removedSceneResponses()...)
+		if err := s.cleanupStorage(context.Background()); err != nil {
+			mt.Fatalf("cleanupStorage: %v", err)
+		}
+
+		if _, err := os.Stat(trashed); !errors.Is(err, os.ErrNotExist) {
+			mt.Errorf("output of the trashed scene was not removed: %v", err)
+		}
+		// Usage is below the mark once the trashed scene is purged, so no other scenes are looked up
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "find" && event.Command.Lookup("find").StringValue() == "scenes" &&
+				event.Command.Lookup("filter", "deleted_at").Type == 0 {
+				mt.Errorf("cleanup looked up scenes outside the trash: %v", event.Command)
+			}
+		}
+	})
+
+	mt.Run("keeps users' scenes by default", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		completed := writeSceneOutput(mt.T, primitive.NewObjectID())
+		s := newStorageCleanupService(mt, false)
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch))
+		if err := s.cleanupStorage(context.Background()); err != nil {
+			mt.Fatalf("cleanupStorage: %v", err)
+		}
+
+		if _, err := os.Stat(completed); err != nil {
+			mt.Errorf("output of a completed scene was removed: %v", err)
+		}
+		if events := mt.GetAllStartedEvents(); len(events) != 1 {
+			mt.Errorf("got %d commands, want only the trash looked up", len(events))
+		}
+	})
+
+	mt.Run("evicts scenes and notifies their owners", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		completedID := primitive.NewObjectID()
+		completed := writeSceneOutput(mt.T, completedID)
+		s := newStorageCleanupService(mt, true)
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: completedID},
+				{Key: "user_id", Value: ownerID},
+				{Key: "name", Value: "garden"},
+				{Key: "status", Value: scene.StatusComplete},
+			}),
+		)
+		mt.AddMockResponses(removedSceneResponses()...)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		if err := s.cleanupStorage(context.Background()); err != nil {
+			mt.Fatalf("cleanupStorage: %v", err)
+		}
+
+		if _, err := os.Stat(completed); !errors.Is(err, os.ErrNotExist) {
+			mt.Errorf("output of the evicted scene was not removed: %v", err)
+		}
+		events := mt.GetAllStartedEvents()
+		last := events[len(events)-1]
+		if last.CommandName != "update" || last.Command.Lookup("update").StringValue() != "notifications" {
+			mt.Fatalf("last command is %s, want the owner notified", last.Command)
+		}
+		update := last.Command.Lookup("updates").Array().Index(0).Value().Document()
+		if got := update.Lookup("q", "type").StringValue(); got != user.NotificationSceneEvicted {
+			mt.Errorf("notification type = %q, want %q", got, user.NotificationSceneEvicted)
+		}
+		if got := update.Lookup("u", "$setOnInsert", "user_id").ObjectID(); got != ownerID {
+			mt.Errorf("notified user %s, want the owner %s", got.Hex(), ownerID.Hex())
+		}
+	})
+}
+
+func TestCheckStorageCapacityStartsCleanup(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("above the mark", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		writeSceneOutput(mt.T, primitive.NewObjectID())
+		s := newStorageCleanupService(mt, false)
+		s.tasks = NewTaskPool(TaskPoolConfig{}, nopLogger())
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch))
+
+		if err := s.checkStorageCapacity(); !errors.Is(err, ErrStorageFull) {
+			mt.Fatalf("checkStorageCapacity() = %v, want ErrStorageFull", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for s.storageCleanup.Load() {
+			if time.Now().After(deadline) {
+				mt.Fatal("storage cleanup did not finish")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		s.tasks.Close()
+
+		events := mt.GetAllStartedEvents()
+		if len(events) != 1 || events[0].CommandName != "find" {
+			mt.Fatalf("got %d commands, want the cleanup to look up the trash", len(events))
+		}
+	})
+
+	mt.Run("below the mark", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		s := newStorageCleanupService(mt, false)
+
+		if err := s.checkStorageCapacity(); err != nil {
+			mt.Fatalf("checkStorageCapacity() = %v, want nil", err)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+// This file contains the estimation of the storage a training run consumes, so users can plan runs against their
+// quota before uploading. The estimate assumes new runs produce files the size of recent ones: the sizes of the
+// output files (one per output type and saved iteration) and sfm frames of the last completed scenes are averaged,
+// then multiplied by the outputs the run requests.
+//
+// The averages are shared by all estimates, and stat every file of the sampled scenes, so they are cached for a while
+// rather than recomputed for every estimate.
+
+package services
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+const (
+	// storageEstimateHistorySize is the number of recently completed scenes the average sizes are computed from.
+	storageEstimateHistorySize = 50
+	// storageEstimateCacheTTL is how long the average sizes are reused before they are recomputed.
+	storageEstimateCacheTTL = 10 * time.Minute
+)
+
+// StorageEstimate is the estimated storage a training run consumes.
+type StorageEstimate struct {
+	// TotalBytes is the estimated size of all files the run produces.
+	TotalBytes int64 `json:"total_bytes"`
+	// SfmBytes is the estimated size of the sfm frames.
+	SfmBytes int64 `json:"sfm_bytes"`
+	// OutputBytes is the estimated size of each requested output type, over all saved iterations.
+	OutputBytes map[string]int64 `json:"output_bytes"`
+	// NoHistory lists the requested output types no recent scene produced, which are not part of the estimate.
+	NoHistory []string `json:"no_history,omitempty"`
+	// Samples is the number of completed scenes the estimate is based on.
+	Samples int `json:"samples"`
+}
+
+// outputSizeAverages are the average sizes of the files recent scenes produced.
+type outputSizeAverages struct {
+	// perFile is the average size of a single output file (one saved iteration), per output type.
+	perFile map[string]int64
+	// sfm is the average total size of the sfm frames of a scene.
+	sfm     int64
+	samples int
+}
+
+// outputSizeCache holds the most recently computed outputSizeAverages.
+type outputSizeCache struct {
+	mu        sync.Mutex
+	averages  *outputSizeAverages
+	expiresAt time.Time
+}
+
+// averageOutputSizes returns the average sizes of the files recently completed scenes produced. Files that no longer
+// exist (i.e removed by the storage cleanup) are not counted. The result is cached for storageEstimateCacheTTL.
+func (s *ClientService) averageOutputSizes(ctx context.Context) (*outputSizeAverages, error) {
+	s.outputSizes.mu.Lock()
+	defer s.outputSizes.mu.Unlock()
+
+	if s.outputSizes.averages != nil && time.Now().Before(s.outputSizes.expiresAt) {
+		return s.outputSizes.averages, nil
+	}
+
+	scenes, err := s.sceneManager.GetRecentCompletedScenes(ctx, storageEstimateHistorySize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Output types shared by training modes (i.e "video") are only counted once
+	var outputTypes []string
+	for _, modeTypes := range scene.ValidOutputTypes {
+		for _, outputType := range modeTypes {
+			if !slices.Contains(outputTypes, outputType) {
+				outputTypes = append(outputTypes, outputType)
+			}
+		}
+	}
+
+	totals := make(map[string]int64)
+	counts := make(map[string]int64)
+	var sfmTotal, sfmCount int64
+	for _, sc := range scenes {
+		if sc.Nerf != nil {
+			for _, outputType := range outputTypes {
+				paths, err := sc.Nerf.GetFilePathsForType(outputType)
+				if err != nil {
+					continue
+				}
+				for _, path := range paths {
+					if info, err := os.Stat(path); err == nil {
+						totals[outputType] += info.Size()
+						counts[outputType]++
+					}
+				}
+			}
+		}
+
+		if sc.Sfm != nil && len(sc.Sfm.Frames) > 0 {
+			var frames int64
+			for _, frame := range sc.Sfm.Frames {
+				if info, err := os.Stat(frame.FilePath); err == nil {
+					frames += info.Size()
+				}
+			}
+			if frames > 0 {
+				sfmTotal += frames
+				sfmCount++
+			}
+		}
+	}
+
+	averages := &outputSizeAverages{perFile: make(map[string]int64), samples: len(scenes)}
+	for outputType, total := range totals {
+		averages.perFile[outputType] = total / counts[outputType]
+	}
+	if sfmCount > 0 {
+		averages.sfm = sfmTotal / sfmCount
+	}
+
+	s.outputSizes.averages = averages
+	s.outputSizes.expiresAt = time.Now().Add(storageEstimateCacheTTL)
+	return averages, nil
+}
+
+// EstimateStorage estimates the storage consumed by a training run saving the given output types at each of the
+// given iterations, from the sizes of the files recently completed scenes produced.
+//
+// Returns the estimate, or error if an error occurred.
+func (s *ClientService) EstimateStorage(ctx context.Context, outputTypes []string, saveIterations []int) (*StorageEstimate, error) {
+	s.logger.Debug("Estimate storage request received")
+
+	averages, err := s.averageOutputSizes(ctx)
+	if err != nil {
+		s.logger.Info("Error computing average output sizes:", err.Error())
+		return nil, err
+	}
+
+	estimate := &StorageEstimate{
+		SfmBytes:    averages.sfm,
+		TotalBytes:  averages.sfm,
+		OutputBytes: make(map[string]int64),
+		Samples:     averages.samples,
+	}
+
+	// Saving the same iteration twice produces a single file
+	iterations := slices.Clone(saveIterations)
+	slices.Sort(iterations)
+	iterations = slices.Compact(iterations)
+
+	for _, outputType := range outputTypes {
+		perFile, ok := averages.perFile[outputType]
+		if !ok {
+			estimate.NoHistory = append(estimate.NoHistory, outputType)
+			continue
+		}
+		bytes := perFile * int64(len(iterations))
+		estimate.OutputBytes[outputType] = bytes
+		estimate.TotalBytes += bytes
+	}
+
+	s.logger.Info("Storage estimated successfully")
+	return estimate, nil
+}
@@ -0,0 +1,59 @@
+// This file contains the StorageTracker, which tracks the total storage used by the data directory. Measuring the
+// directory walks every file, so measurements are cached, and writes and removals made through the server are
+// accounted for in between measurements.
+
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrStorageFull is returned when the platform's total storage usage is above the configured high-water mark.
+var ErrStorageFull = errors.New("platform storage is full")
+
+// StorageTracker tracks the number of bytes used by a directory.
+type StorageTracker struct {
+	dir        string
+	maxAge     time.Duration
+	mu         sync.Mutex
+	used       int64
+	measuredAt time.Time
+}
+
+// NewStorageTracker creates a StorageTracker for dir, re-measuring the directory at most every maxAge.
+func NewStorageTracker(dir string, maxAge time.Duration) *StorageTracker {
+	return &StorageTracker{dir: dir, maxAge: maxAge}
+}
+
+// Usage returns the number of bytes used by the directory. The directory is measured if the last measurement is
+// older than maxAge, otherwise the last measurement adjusted by Add is returned.
+func (t *StorageTracker) Usage() (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.measuredAt.IsZero() && time.Since(t.measuredAt) < t.maxAge {
+		return t.used, nil
+	}
+	used, err := directorySize(t.dir)
+	if err != nil {
+		return 0, err
+	}
+	t.used = used
+	t.measuredAt = time.Now()
+	return t.used, nil
+}
+
+// Add records n bytes written to (or, if negative, removed from) the directory since the last measurement.
+// Returns the adjusted usage.
+func (t *StorageTracker) Add(n int64) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.used += n
+	if t.used < 0 {
+		t.used = 0
+	}
+	return t.used
+}
@@ -0,0 +1,229 @@
+// This file contains the TaskPool, a bounded pool of workers shared by server-side background tasks
+// (thumbnail rendering, video downscaling, maintenance jobs, ...), so they cannot overwhelm the server.
+//
+// Tasks are queued, and run by a fixed number of workers. Each task has a type, and the number of tasks of a type
+// running at once can be limited further (i.e only one ffmpeg process at a time). Tasks are run in submission order,
+// except that a task whose type is at its limit is skipped until a task of that type finishes.
+//
+// Submit queues a task without waiting for it, while Run queues a task and waits for its result.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+var (
+	// ErrTaskQueueFull is returned when a task is submitted while the task queue is full.
+	ErrTaskQueueFull = errors.New("task queue is full")
+	// ErrTaskPoolClosed is returned when a task is submitted to, or still queued in, a closed pool.
+	ErrTaskPoolClosed = errors.New("task pool is closed")
+)
+
+// Task types used by the server.
+const (
+	TaskTypeThumbnail   = "thumbnail"
+	TaskTypeMaintenance = "maintenance"
+	TaskTypeStats       = "stats"
+	TaskTypeDownscale   = "downscale"
+)
+
+// TaskPoolStats is a snapshot of the state of a TaskPool.
+type TaskPoolStats struct {
+	Workers int `json:"workers"`
+	// Queued is the number of tasks waiting for a worker.
+	Queued  int `json:"queued"`
+	Running int `json:"running"`
+	// RunningByType is the number of running tasks of each type.
+	RunningByType map[string]int `json:"running_by_type"`
+}
+
+// task is a single queued task. done is nil for tasks that nobody waits on.
+type task struct {
+	taskType string
+	ctx      context.Context
+	run      func(ctx context.Context) error
+	done     chan error
+}
+
+// TaskPool runs background tasks on a bounded number of workers.
+type TaskPool struct {
+	config  TaskPoolConfig
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []*task
+	running map[string]int
+	closed  bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	logger  *log.Logger
+}
+
+// NewTaskPool creates a TaskPool and starts its workers. Close must be called to stop them.
+func NewTaskPool(config TaskPoolConfig, logger *log.Logger) *TaskPool {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &TaskPool{
+		config:  config,
+		running: make(map[string]int),
+		ctx:     ctx,
+		cancel:  cancel,
+		logger:  logger,
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	for i := 0; i < config.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues fn to run in the background. Errors returned by fn are logged.
+//
+// Returns ErrTaskQueueFull if the queue is full, or ErrTaskPoolClosed if the pool is closed.
+func (p *TaskPool) Submit(taskType string, fn func(ctx context.Context) error) error {
+	return p.enqueue(&task{taskType: taskType, ctx: p.ctx, run: fn})
+}
+
+// Run queues fn and waits for it to finish. fn is called with ctx, and is skipped if ctx is done before
+// a worker is available.
+//
+// Returns the error returned by fn, ctx.Err() if ctx is done first, ErrTaskQueueFull if the queue is full,
+// or ErrTaskPoolClosed if the pool is closed.
+func (p *TaskPool) Run(ctx context.Context, taskType string, fn func(ctx context.Context) error) error {
+	t := &task{taskType: taskType, ctx: ctx, run: fn, done: make(chan error, 1)}
+	if err := p.enqueue(t); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-t.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the pool's queue and workers.
+func (p *TaskPool) Stats() TaskPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := TaskPoolStats{
+		Workers:       p.config.Workers,
+		Queued:        len(p.queue),
+		RunningByType: make(map[string]int, len(p.running)),
+	}
+	for taskType, n := range p.running {
+		if n > 0 {
+			stats.Running += n
+			stats.RunningByType[taskType] = n
+		}
+	}
+	return stats
+}
+
+// Close stops accepting tasks, drops queued tasks and waits for running tasks to return.
+// Running tasks are signalled to stop through their context.
+func (p *TaskPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	queued := p.queue
+	p.queue = nil
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	for _, t := range queued {
+		if t.done != nil {
+			t.done <- ErrTaskPoolClosed
+		}
+	}
+	p.cancel()
+	p.wg.Wait()
+}
+
+// enqueue adds t to the queue, and wakes up the workers.
+func (p *TaskPool) enqueue(t *task) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrTaskPoolClosed
+	}
+	if p.config.QueueSize > 0 && len(p.queue) >= p.config.QueueSize {
+		return ErrTaskQueueFull
+	}
+	p.queue = append(p.queue, t)
+	p.cond.Broadcast()
+	return nil
+}
+
+// next blocks until a queued task can run, marks it as running and returns it. Returns nil once the pool is closed.
+func (p *TaskPool) next() *task {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if p.closed {
+			return nil
+		}
+		for i, t := range p.queue {
+			limit, limited := p.config.TypeLimits[t.taskType]
+			if limited && limit > 0 && p.running[t.taskType] >= limit {
+				continue
+			}
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			p.running[t.taskType]++
+			return t
+		}
+		p.cond.Wait()
+	}
+}
+
+// work runs queued tasks until the pool is closed.
+func (p *TaskPool) work() {
+	defer p.wg.Done()
+
+	for {
+		t := p.next()
+		if t == nil {
+			return
+		}
+
+		var err error
+		if err = t.ctx.Err(); err == nil {
+			err = p.runTask(t)
+		}
+
+		p.mu.Lock()
+		p.running[t.taskType]--
+		p.cond.Broadcast()
+		p.mu.Unlock()
+
+		if t.done != nil {
+			t.done <- err
+		} else if err != nil && p.ctx.Err() == nil {
+			p.logger.Errorf("Background %s task failed: %v", t.taskType, err)
+		}
+	}
+}
+
+// runTask runs t, turning a panic into an error so a faulty task cannot take down the server.
+func (p *TaskPool) runTask(t *task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	return t.run(t.ctx)
+}
@@ -0,0 +1,31 @@
+// This file contains the TaskPoolConfig struct, which holds the tunable settings of a TaskPool.
+// Values are expected to be populated by the caller (usually from environment variables in main), falling back
+// to DefaultTaskPoolConfig for anything not provided.
+
+package services
+
+// TaskPoolConfig holds the tunable settings of a TaskPool.
+type TaskPoolConfig struct {
+	// Workers is the maximum number of tasks running at once.
+	Workers int
+	// QueueSize is the maximum number of tasks waiting for a worker. Tasks submitted beyond it are rejected.
+	// Zero means unbounded.
+	QueueSize int
+	// TypeLimits is the maximum number of tasks of a type running at once. Types without a limit
+	// are only bounded by Workers.
+	TypeLimits map[string]int
+}
+
+// DefaultTaskPoolConfig returns the default TaskPool configuration.
+func DefaultTaskPoolConfig() TaskPoolConfig {
+	return TaskPoolConfig{
+		Workers:   4,
+		QueueSize: 256,
+		TypeLimits: map[string]int{
+			TaskTypeThumbnail:   2,
+			TaskTypeMaintenance: 1,
+			TaskTypeStats:       1,
+			TaskTypeDownscale:   1,
+		},
+	}
+}
@@ -0,0 +1,55 @@
+// This file contains helpers for generating scene thumbnails from rendered outputs, and for measuring thumbnails.
+// Rendering is delegated to an external ffmpeg executable, which must be available at runtime.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// renderThumbnail extracts a representative frame from the video at videoPath and writes it as a PNG to outPath.
+// The frame is written to a temporary file first, so an existing thumbnail is only replaced on success.
+func renderThumbnail(ctx context.Context, ffmpegPath, videoPath, outPath string) error {
+	if err := os.MkdirAll(filepath.Dir(outPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmpPath := outPath + ".tmp.png"
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-y", "-loglevel", "error",
+		"-i", videoPath,
+		"-vf", "thumbnail",
+		"-frames:v", "1",
+		tmpPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, output)
+	}
+
+	return os.Rename(tmpPath, outPath)
+}
+
+// imageSize reads the size of the PNG or JPEG image at path, without decoding the whole image.
+func imageSize(path string) (*scene.ImageSize, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	return &scene.ImageSize{Width: config.Width, Height: config.Height}, nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
+)
+
+func TestUpdateUserPassword(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	hasher := &user.BcryptHasher{Cost: bcrypt.MinCost}
+	encoded, err := hasher.Hash("old password 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newService := func(mt *mtest.T) *ClientService {
+		return &ClientService{
+			userManager: user.NewUserManager(mt.Client, hasher, nopLogger(), true),
+			config:      DefaultClientServiceConfig(),
+			logger:      nopLogger(),
+		}
+	}
+	userResponse := mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: userID},
+		{Key: "username", Value: "alice"},
+		{Key: "encrypted_password", Value: encoded},
+	})
+
+	mt.Run("weak password", func(mt *mtest.T) {
+		// No mocked response: the user must not be read
+		err := newService(mt).UpdateUserPassword(context.Background(), userID, "old password 1", "short")
+		if !errors.Is(err, user.ErrWeakPassword) {
+			mt.Errorf("UpdateUserPassword() = %v, want ErrWeakPassword", err)
+		}
+	})
+
+	mt.Run("incorrect old password", func(mt *mtest.T) {
+		mt.AddMockResponses(userResponse)
+		err := newService(mt).UpdateUserPassword(context.Background(), userID, "wrong password 1", "new password 1")
+		if !errors.Is(err, user.ErrIncorrectPassword) {
+			mt.Errorf("UpdateUserPassword() = %v, want ErrIncorrectPassword", err)
+		}
+	})
+
+	mt.Run("updated", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			userResponse,
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "token_version", Value: 1}}}},
+		)
+		if err := newService(mt).UpdateUserPassword(context.Background(), userID, "old password 1", "new password 1"); err != nil {
+			mt.Fatalf("UpdateUserPassword() = %v, want nil", err)
+		}
+
+		// The new password is stored, and the user's tokens are revoked
+		events := mt.GetAllStartedEvents()
+		if len(events) != 3 || events[1].CommandName != "update" || events[2].CommandName != "findAndModify" {
+			mt.Fatalf("got %d commands, want the user read, updated and its tokens revoked", len(events))
+		}
+		update := events[1].Command.Lookup("updates").Array().Index(0).Value().Document()
+		stored := update.Lookup("u", "$set", "encrypted_password").StringValue()
+		if err := hasher.Verify(stored, "new password 1"); err != nil {
+			mt.Errorf("stored hash does not match the new password: %v", err)
+		}
+	})
+}
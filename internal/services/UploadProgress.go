@@ -0,0 +1,164 @@
+// This file contains the UploadProgressTracker, which reports how many bytes of an uploaded video the server has
+// received. Clients opt in by tagging an upload with an upload ID (chosen by the client), and can then follow the
+// upload's progress on a separate channel (see WebServer.getUploadProgress) while the upload request is in flight.
+//
+// Progress is tracked in memory only, and is keyed by both the user and the upload ID, so users can only follow
+// their own uploads.
+
+package services
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// minProgressStep is the minimum number of bytes between two progress notifications,
+// so small writes do not flood subscribers.
+const minProgressStep = 64 * 1024
+
+// UploadProgress is a snapshot of the progress of a single upload.
+type UploadProgress struct {
+	Received int64  `json:"received"`
+	Total    int64  `json:"total"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error,omitempty"`
+}
+
+// uploadKey identifies an upload. Upload IDs are only unique per user.
+type uploadKey struct {
+	userID   primitive.ObjectID
+	uploadID string
+}
+
+// uploadEntry is the tracked state of a single upload and the channels following it.
+type uploadEntry struct {
+	progress    UploadProgress
+	subscribers map[chan UploadProgress]struct{}
+}
+
+// UploadProgressTracker tracks the progress of in-flight uploads and fans progress out to subscribers.
+type UploadProgressTracker struct {
+	mu      sync.Mutex
+	uploads map[uploadKey]*uploadEntry
+}
+
+// NewUploadProgressTracker creates an empty UploadProgressTracker.
+func NewUploadProgressTracker() *UploadProgressTracker {
+	return &UploadProgressTracker{
+		uploads: make(map[uploadKey]*uploadEntry),
+	}
+}
+
+// entry returns the entry for key, creating it if needed. The caller must hold t.mu.
+func (t *UploadProgressTracker) entry(key uploadKey) *uploadEntry {
+	e, ok := t.uploads[key]
+	if !ok {
+		e = &uploadEntry{subscribers: make(map[chan UploadProgress]struct{})}
+		t.uploads[key] = e
+	}
+	return e
+}
+
+// Subscribe follows the progress of the given upload. The upload does not need to have started yet.
+// The returned channel always holds the latest progress, and is closed once the upload is done.
+// The returned cancel function must be called when the subscriber stops listening.
+func (t *UploadProgressTracker) Subscribe(userID primitive.ObjectID, uploadID string) (<-chan UploadProgress, func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := uploadKey{userID, uploadID}
+	e := t.entry(key)
+	ch := make(chan UploadProgress, 1)
+	e.subscribers[ch] = struct{}{}
+	if e.progress.Total > 0 {
+		ch <- e.progress
+	}
+
+	cancel := func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if e, ok := t.uploads[key]; ok {
+			if _, ok := e.subscribers[ch]; ok {
+				delete(e.subscribers, ch)
+				close(ch)
+			}
+			if len(e.subscribers) == 0 && e.progress.Total == 0 {
+				delete(t.uploads, key)
+			}
+		}
+	}
+	return ch, cancel
+}
+
+// update applies fn to the upload's progress and notifies all subscribers. If the upload is done,
+// subscribers are closed and the upload is forgotten.
+func (t *UploadProgressTracker) update(key uploadKey, fn func(p *UploadProgress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.entry(key)
+	fn(&e.progress)
+	for ch := range e.subscribers {
+		// Keep only the latest progress in the channel; slow subscribers skip intermediate updates.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- e.progress
+		if e.progress.Done {
+			close(ch)
+		}
+	}
+	if e.progress.Done {
+		delete(t.uploads, key)
+	}
+}
+
+// Start begins tracking an upload of total bytes, and returns a writer that reports bytes written to it as received.
+func (t *UploadProgressTracker) Start(userID primitive.ObjectID, uploadID string, total int64) *ProgressWriter {
+	key := uploadKey{userID, uploadID}
+	t.update(key, func(p *UploadProgress) {
+		*p = UploadProgress{Total: total}
+	})
+
+	step := total / 100
+	if step < minProgressStep {
+		step = minProgressStep
+	}
+	return &ProgressWriter{tracker: t, key: key, total: total, step: step}
+}
+
+// Finish marks the upload as done. A non-nil err is reported to subscribers as the upload's error.
+func (t *UploadProgressTracker) Finish(userID primitive.ObjectID, uploadID string, err error) {
+	t.update(uploadKey{userID, uploadID}, func(p *UploadProgress) {
+		p.Done = true
+		if err != nil {
+			p.Error = err.Error()
+		}
+	})
+}
+
+// ProgressWriter is an io.Writer that counts the bytes written to it and reports them to an UploadProgressTracker.
+// It is meant to be used with io.TeeReader or io.MultiWriter alongside the actual destination.
+type ProgressWriter struct {
+	tracker      *UploadProgressTracker
+	key          uploadKey
+	total        int64
+	step         int64
+	written      int64
+	lastReported int64
+}
+
+// Write counts len(p) bytes as received. Subscribers are notified every step bytes, and when all bytes are received.
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	if w.written-w.lastReported >= w.step || w.written >= w.total {
+		w.lastReported = w.written
+		written := w.written
+		w.tracker.update(w.key, func(p *UploadProgress) {
+			p.Received = written
+		})
+	}
+	return len(p), nil
+}
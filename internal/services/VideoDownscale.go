@@ -0,0 +1,147 @@
+// This file contains the downscaling of oversized input videos. SfM slows down dramatically with the resolution of
+// the frames it extracts, with little quality gain, so uploads larger than MaxVideoDimension may be scaled down
+// before they are processed. The uploaded video is kept next to the downscaled one.
+// Downscaling runs in the TaskPool after the upload request returned, and the scene is queued for SfM once it is done.
+// Probing and scaling are delegated to external ffprobe and ffmpeg executables, which must be available at runtime.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// probeVideoSize reads the width and height of the first video stream of the video at path.
+func probeVideoSize(ctx context.Context, ffprobePath, path string) (int, int, error) {
+	cmd := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-of", "csv=p=0:s=x",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	var width, height int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(output)), "%dx%d", &width, &height); err != nil {
+		return 0, 0, fmt.Errorf("unexpected ffprobe output %q: %w", output, err)
+	}
+	return width, height, nil
+}
+
+// downscaledSize returns the size a video of the given size is scaled to, so its longest side is at most
+// maxDimension. The aspect ratio is kept, and sizes are rounded down to even numbers, as most encoders require.
+//
+// Returns false if the video is within the limit, and is not scaled.
+func downscaledSize(width, height, maxDimension int) (int, int, bool) {
+	longest := max(width, height)
+	if maxDimension <= 0 || longest <= maxDimension {
+		return width, height, false
+	}
+	scaledWidth := max(width*maxDimension/longest/2*2, 2)
+	scaledHeight := max(height*maxDimension/longest/2*2, 2)
+	return scaledWidth, scaledHeight, true
+}
+
+// scaleVideo writes the video at srcPath scaled to the given size to dstPath, in the container of dstPath's extension.
+// Audio is dropped, as the workers only use the frames. The video is written to a temporary file first, so dstPath
+// only exists on success.
+func scaleVideo(ctx context.Context, ffmpegPath, srcPath, dstPath string, width, height int) error {
+	ext := filepath.Ext(dstPath)
+	tmpPath := strings.TrimSuffix(dstPath, ext) + ".tmp" + ext
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-y", "-loglevel", "error",
+		"-i", srcPath,
+		"-vf", fmt.Sprintf("scale=%d:%d", width, height),
+		"-an",
+		tmpPath,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, output)
+	}
+
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// downscaleVideo scales the given uploaded video down to MaxVideoDimension if it is larger, and points it at the
+// downscaled file, recording the original path and the applied scaling. Videos within the limit are left untouched.
+//
+// Returns error if the video could not be probed or scaled, in which case it is left untouched.
+func (s *ClientService) downscaleVideo(ctx context.Context, video *scene.Video) error {
+	width, height, err := probeVideoSize(ctx, s.config.FFprobePath, video.FilePath)
+	if err != nil {
+		return err
+	}
+	scaledWidth, scaledHeight, ok := downscaledSize(width, height, s.config.MaxVideoDimension)
+	if !ok {
+		return nil
+	}
+
+	ext := filepath.Ext(video.FilePath)
+	scaledPath := strings.TrimSuffix(video.FilePath, ext) + "_downscaled" + ext
+	if err := scaleVideo(ctx, s.config.FFmpegPath, video.FilePath, scaledPath, scaledWidth, scaledHeight); err != nil {
+		return err
+	}
+	if err := s.syncWrite(scaledPath); err != nil {
+		os.Remove(scaledPath)
+		return err
+	}
+	if info, err := os.Stat(scaledPath); err == nil {
+		s.storageUsage.Add(info.Size())
+	}
+
+	s.logger.Infof("Downscaled video from %dx%d to %dx%d", width, height, scaledWidth, scaledHeight)
+	video.OriginalFilePath = video.FilePath
+	video.FilePath = scaledPath
+	video.Scaling = &scene.VideoScaling{
+		OriginalWidth:  width,
+		OriginalHeight: height,
+		Width:          scaledWidth,
+		Height:         scaledHeight,
+	}
+	return nil
+}
+
+// downscaleAndPublish downscales the video of the given new scene (see downscaleVideo), records the downscaled video,
+// and publishes the scene's SfM job. Videos that can not be downscaled are processed at their original resolution.
+// It runs in the TaskPool, so uploads do not wait for the transcode.
+//
+// Returns error if the scene was deleted in the meantime, or could not be queued for SfM, in which case it is
+// marked failed.
+func (s *ClientService) downscaleAndPublish(ctx context.Context, sc *scene.Scene) error {
+	video := *sc.Video
+	if err := s.downscaleVideo(ctx, &video); err != nil {
+		s.logger.Errorf("Failed to downscale video, processing it at its original resolution: %v", err)
+	} else if video.Scaling != nil {
+		if err := s.sceneManager.UpdateVideo(ctx, sc.ID, &video); err != nil {
+			// The downscaled video is only known to this task
+			if info, statErr := os.Stat(video.FilePath); statErr == nil && os.Remove(video.FilePath) == nil {
+				s.storageUsage.Add(-info.Size())
+			}
+			return fmt.Errorf("failed to record downscaled video of scene %s: %w", sc.ID.Hex(), err)
+		}
+		sc.Video = &video
+	}
+
+	if err := s.mqService.PublishSFMJob(ctx, sc); err != nil {
+		if markErr := s.sceneManager.MarkSceneFailed(ctx, sc.ID, scene.StageSfm, "failed to queue for SfM"); markErr != nil {
+			s.logger.Errorf("Failed to mark scene %s failed: %v", sc.ID.Hex(), markErr)
+		}
+		return fmt.Errorf("failed to publish SFM job of scene %s: %w", sc.ID.Hex(), err)
+	}
+	return nil
+}
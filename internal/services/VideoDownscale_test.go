@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+func TestDownscaledSize(t *testing.T) {
+	tests := []struct {
+		name                        string
+		width, height, maxDimension int
+		wantWidth, wantHeight       int
+		scaled                      bool
+	}{
+		{"within the limit", 1280, 720, 1920, 1280, 720, false},
+		{"at the limit", 1920, 1080, 1920, 1920, 1080, false},
+		{"limit disabled", 3840, 2160, 0, 3840, 2160, false},
+		{"landscape", 3840, 2160, 1920, 1920, 1080, true},
+		{"portrait", 2160, 3840, 1920, 1080, 1920, true},
+		{"rounded down to even sizes", 1001, 999, 500, 500, 498, true},
+		{"thin video keeps two pixels", 4000, 2, 1000, 1000, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, scaled := downscaledSize(tt.width, tt.height, tt.maxDimension)
+			if width != tt.wantWidth || height != tt.wantHeight || scaled != tt.scaled {
+				t.Errorf("downscaledSize(%d, %d, %d) = %d, %d, %v, want %d, %d, %v", tt.width, tt.height, tt.maxDimension,
+					width, height, scaled, tt.wantWidth, tt.wantHeight, tt.scaled)
+			}
+		})
+	}
+}
+
+// fakeTool writes an executable shell script running the given commands, standing in for ffmpeg or ffprobe, and
+// returns its path. `$last` holds the script's last argument, the output path of ffmpeg.
+func fakeTool(t *testing.T, name, commands string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), name)
+	script := "#!/bin/sh\nfor last; do :; done\n" + commands + "\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newDownscaleService returns a ClientService downscaling videos larger than maxDimension with the given tools.
+func newDownscaleService(ffmpegPath, ffprobePath string, maxDimension int) *ClientService {
+	config := DefaultClientServiceConfig()
+	config.FFmpegPath = ffmpegPath
+	config.FFprobePath = ffprobePath
+	config.MaxVideoDimension = maxDimension
+	return &ClientService{
+		storageUsage: NewStorageTracker(os.TempDir(), 0),
+		config:       config,
+		logger:       nopLogger(),
+	}
+}
+
+func TestDownscaleVideo(t *testing.T) {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+	ffprobePath, err := exec.LookPath("ffprobe")
+	if err != nil {
+		t.Skip("ffprobe is not installed")
+	}
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	generate := exec.Command(ffmpegPath, "-loglevel", "error", "-f", "lavfi", "-i", "testsrc=size=2560x1440:rate=5",
+		"-t", "1", "-pix_fmt", "yuv420p", path)
+	if output, err := generate.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate test video: %v: %s", err, output)
+	}
+
+	s := newDownscaleService(ffmpegPath, ffprobePath, 1280)
+	video := &scene.Video{FilePath: path}
+	if err := s.downscaleVideo(context.Background(), video); err != nil {
+		t.Fatalf("downscaleVideo: %v", err)
+	}
+
+	if video.OriginalFilePath != path || video.FilePath == path {
+		t.Fatalf("video points at %s (original %s), want the downscaled file", video.FilePath, video.OriginalFilePath)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("uploaded video was not kept: %v", err)
+	}
+	width, height, err := probeVideoSize(context.Background(), ffprobePath, video.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 1280 || height != 720 {
+		t.Errorf("downscaled video is %dx%d, want 1280x720", width, height)
+	}
+	want := scene.VideoScaling{OriginalWidth: 2560, OriginalHeight: 1440, Width: 1280, Height: 720}
+	if video.Scaling == nil || *video.Scaling != want {
+		t.Errorf("scaling = %+v, want %+v", video.Scaling, want)
+	}
+}
+
+func TestDownscaleVideoAboveLimit(t *testing.T) {
+	dir := t.TempDir()
+	argsPath := filepath.Join(dir, "args")
+	ffprobe := fakeTool(t, "ffprobe", "echo 3840x2160")
+	ffmpeg := fakeTool(t, "ffmpeg", `echo "$@" > "`+argsPath+`"; echo video > "$last"`)
+	path := filepath.Join(dir, "video.mp4")
+
+	video := &scene.Video{FilePath: path}
+	if err := newDownscaleService(ffmpeg, ffprobe, 1920).downscaleVideo(context.Background(), video); err != nil {
+		t.Fatalf("downscaleVideo: %v", err)
+	}
+
+	args, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "scale=1920:1080") {
+		t.Errorf("ffmpeg ran with %s, want the video scaled to 1920x1080", args)
+	}
+	if want := filepath.Join(dir, "video_downscaled.mp4"); video.FilePath != want || video.OriginalFilePath != path {
+		t.Errorf("video points at %s (original %s), want %s (original %s)", video.FilePath, video.OriginalFilePath, want, path)
+	}
+	if _, err := os.Stat(video.FilePath); err != nil {
+		t.Errorf("downscaled video was not written: %v", err)
+	}
+}
+
+func TestDownscaleVideoWithinLimit(t *testing.T) {
+	ffprobe := fakeTool(t, "ffprobe", "echo 1280x720")
+	ffmpeg := fakeTool(t, "ffmpeg", "exit 1")
+	path := filepath.Join(t.TempDir(), "video.mp4")
+
+	video := &scene.Video{FilePath: path}
+	if err := newDownscaleService(ffmpeg, ffprobe, 1920).downscaleVideo(context.Background(), video); err != nil {
+		t.Fatalf("downscaleVideo: %v", err)
+	}
+	if video.FilePath != path || video.Scaling != nil {
+		t.Errorf("video within the limit was changed: %+v", video)
+	}
+}
+
+func TestScaleVideoRemovesTemporaryFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dstPath string)
+	}{
+		// ffmpeg fails after it started writing its output
+		{"ffmpeg fails", nil},
+		// The output can not be moved into place, as a directory is in the way
+		{"rename fails", func(t *testing.T, dstPath string) {
+			if err := os.MkdirAll(filepath.Join(dstPath, "taken"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands := `echo video > "$last"`
+			if tt.setup == nil {
+				commands += "\nexit 1"
+			}
+			ffmpeg := fakeTool(t, "ffmpeg", commands)
+			dir := t.TempDir()
+			dstPath := filepath.Join(dir, "video_downscaled.mp4")
+			if tt.setup != nil {
+				tt.setup(t, dstPath)
+			}
+
+			if err := scaleVideo(context.Background(), ffmpeg, "video.mp4", dstPath, 1280, 720); err == nil {
+				t.Fatal("scaleVideo succeeded, want an error")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "video_downscaled.tmp.mp4")); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("temporary file was left behind: %v", err)
+			}
+		})
+	}
+}
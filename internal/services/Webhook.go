@@ -0,0 +1,166 @@
+// This file contains the webhook delivery implementation. Users may configure a single webhook URL, which
+// receives JSON notifications signed with a per-user secret.
+//
+// Every payload is signed with HMAC-SHA256 over "<timestamp>.<body>", and sent with the headers:
+//
+//	X-Webhook-Timestamp: <unix seconds>
+//	X-Webhook-Signature: sha256=<hex digest>
+//
+// Webhook URLs are user controlled, so deliveries are protected against SSRF: only http(s) URLs are accepted,
+// and connections to loopback, private, link-local and otherwise non-public addresses are refused at dial time.
+// Checking at dial time (rather than resolving the host up front) also covers redirects and DNS rebinding.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrInvalidWebhookURL is returned when a webhook URL is malformed or uses an unsupported scheme.
+	ErrInvalidWebhookURL = errors.New("invalid webhook URL")
+	// ErrWebhookNotConfigured is returned when a webhook operation is attempted by a user without a webhook.
+	ErrWebhookNotConfigured = errors.New("no webhook configured")
+	// ErrForbiddenWebhookAddress is returned when a webhook resolves to a non-public address.
+	ErrForbiddenWebhookAddress = errors.New("webhook address is not allowed")
+)
+
+// WebhookDelivery is the result of a single webhook delivery attempt.
+type WebhookDelivery struct {
+	Delivered  bool   `json:"delivered"`
+	StatusCode int    `json:"status_code,omitempty"`
+	LatencyMS  int64  `json:"latency_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// webhookSender delivers signed webhook payloads.
+type webhookSender struct {
+	client *http.Client
+}
+
+// newWebhookSender creates a webhookSender. If allowPrivate is false, deliveries to non-public addresses are refused.
+func newWebhookSender(timeout time.Duration, allowPrivate bool) *webhookSender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublicIP(ip) {
+				return ErrForbiddenWebhookAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &webhookSender{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 3 {
+					return errors.New("too many redirects")
+				}
+				return validateWebhookURL(req.URL.String())
+			},
+		},
+	}
+}
+
+// Send signs and posts payload to webhookURL, and reports the outcome. Non-2xx responses are reported as undelivered.
+func (w *webhookSender) Send(ctx context.Context, webhookURL, secret string, payload interface{}) WebhookDelivery {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return WebhookDelivery{Error: err.Error()}
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return WebhookDelivery{Error: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhookPayload(secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := w.client.Do(req)
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		if errors.Is(err, ErrForbiddenWebhookAddress) {
+			err = ErrForbiddenWebhookAddress
+		}
+		return WebhookDelivery{LatencyMS: latency, Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	delivery := WebhookDelivery{
+		Delivered:  resp.StatusCode >= 200 && resp.StatusCode < 300,
+		StatusCode: resp.StatusCode,
+		LatencyMS:  latency,
+	}
+	if !delivery.Delivered {
+		delivery.Error = fmt.Sprintf("endpoint responded with %s", resp.Status)
+	}
+	return delivery
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with secret.
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookURL checks that rawURL is an absolute http(s) URL with a host.
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+// generateWebhookSecret returns a random, hex encoded webhook signing secret.
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// isPublicIP checks if ip is a globally routable unicast address.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	// Carrier-grade NAT (100.64.0.0/10) is not covered by IsPrivate
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64 {
+		return false
+	}
+	return true
+}
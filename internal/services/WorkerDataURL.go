@@ -0,0 +1,91 @@
+// This file contains the signing and verification of worker data URLs. The AMPQService hands workers URLs to the
+// files of a job (the uploaded video, the sfm frames), and the web server serves them at /worker-data. Rather than
+// trusting any request for any path, URLs are signed for the one path they point to, and expire after a short while.
+//
+// Signatures are HMAC-SHA256 over the path and expiry, with a secret shared by the AMPQService and the WebServer.
+// A signed URL carries them as query parameters: `<path>?expires=<unix seconds>&signature=<base64url>`.
+
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Query parameters of a signed worker data URL.
+const (
+	WorkerURLExpiresParam   = "expires"
+	WorkerURLSignatureParam = "signature"
+)
+
+var (
+	// ErrWorkerURLInvalid is returned when a worker data URL is unsigned, malformed, or its signature does not match.
+	ErrWorkerURLInvalid = errors.New("invalid worker data signature")
+	// ErrWorkerURLExpired is returned when a validly signed worker data URL has expired.
+	ErrWorkerURLExpired = errors.New("worker data URL has expired")
+)
+
+// WorkerURLSigner signs and verifies worker data URLs with a shared secret.
+type WorkerURLSigner struct {
+	secret []byte
+}
+
+// NewWorkerURLSigner creates a WorkerURLSigner using the given secret. An empty secret disables signing: Sign leaves
+// URLs unsigned, and Verify rejects everything.
+func NewWorkerURLSigner(secret string) *WorkerURLSigner {
+	return &WorkerURLSigner{secret: []byte(secret)}
+}
+
+// Enabled reports whether the signer has a secret to sign URLs with.
+func (s *WorkerURLSigner) Enabled() bool {
+	return len(s.secret) > 0
+}
+
+// Sign returns the query string (without "?") signing path until expiresAt, or "" if signing is disabled.
+func (s *WorkerURLSigner) Sign(path string, expiresAt time.Time) string {
+	if !s.Enabled() {
+		return ""
+	}
+
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{}
+	query.Set(WorkerURLExpiresParam, expires)
+	query.Set(WorkerURLSignatureParam, base64.RawURLEncoding.EncodeToString(s.signature(path, expires)))
+	return query.Encode()
+}
+
+// Verify checks the expires and signature query parameters of a request for path.
+//
+// Returns ErrWorkerURLInvalid if they are missing, malformed or do not match the path, or ErrWorkerURLExpired if the
+// URL has expired.
+func (s *WorkerURLSigner) Verify(path, expires, signature string) error {
+	if !s.Enabled() || expires == "" || signature == "" {
+		return ErrWorkerURLInvalid
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, s.signature(path, expires)) {
+		return ErrWorkerURLInvalid
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrWorkerURLInvalid
+	}
+	if !time.Now().Before(time.Unix(unix, 0)) {
+		return ErrWorkerURLExpired
+	}
+	return nil
+}
+
+// signature returns the HMAC-SHA256 of the path and expiry.
+func (s *WorkerURLSigner) signature(path, expires string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(path + "\n" + expires))
+	return mac.Sum(nil)
+}
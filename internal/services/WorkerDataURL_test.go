@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signedQuery returns the expires and signature parameters signer signs path with until expiresAt.
+func signedQuery(t *testing.T, signer *WorkerURLSigner, path string, expiresAt time.Time) (string, string) {
+	t.Helper()
+	query, err := url.ParseQuery(signer.Sign(path, expiresAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query.Get(WorkerURLExpiresParam), query.Get(WorkerURLSignatureParam)
+}
+
+func TestWorkerURLSigner(t *testing.T) {
+	signer := NewWorkerURLSigner("secret")
+	const path = "data/raw/videos/a.mp4"
+
+	t.Run("valid", func(t *testing.T) {
+		expires, signature := signedQuery(t, signer, path, time.Now().Add(time.Minute))
+		if err := signer.Verify(path, expires, signature); err != nil {
+			t.Errorf("Verify() = %v, want nil", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expires, signature := signedQuery(t, signer, path, time.Now().Add(-time.Second))
+		if err := signer.Verify(path, expires, signature); !errors.Is(err, ErrWorkerURLExpired) {
+			t.Errorf("Verify() = %v, want ErrWorkerURLExpired", err)
+		}
+	})
+
+	t.Run("replayed against another path", func(t *testing.T) {
+		expires, signature := signedQuery(t, signer, path, time.Now().Add(time.Minute))
+		if err := signer.Verify("data/raw/videos/b.mp4", expires, signature); !errors.Is(err, ErrWorkerURLInvalid) {
+			t.Errorf("Verify() = %v, want ErrWorkerURLInvalid", err)
+		}
+	})
+
+	t.Run("extended expiry", func(t *testing.T) {
+		_, signature := signedQuery(t, signer, path, time.Now().Add(time.Minute))
+		later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+		if err := signer.Verify(path, later, signature); !errors.Is(err, ErrWorkerURLInvalid) {
+			t.Errorf("Verify() = %v, want ErrWorkerURLInvalid", err)
+		}
+	})
+
+	t.Run("other secret", func(t *testing.T) {
+		expires, signature := signedQuery(t, NewWorkerURLSigner("other secret"), path, time.Now().Add(time.Minute))
+		if err := signer.Verify(path, expires, signature); !errors.Is(err, ErrWorkerURLInvalid) {
+			t.Errorf("Verify() = %v, want ErrWorkerURLInvalid", err)
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		if err := signer.Verify(path, "", ""); !errors.Is(err, ErrWorkerURLInvalid) {
+			t.Errorf("Verify() = %v, want ErrWorkerURLInvalid", err)
+		}
+	})
+
+	t.Run("signing disabled", func(t *testing.T) {
+		disabled := NewWorkerURLSigner("")
+		if query := disabled.Sign(path, time.Now().Add(time.Minute)); query != "" {
+			t.Errorf("Sign() = %q, want no signature", query)
+		}
+		expires, signature := signedQuery(t, signer, path, time.Now().Add(time.Minute))
+		if err := disabled.Verify(path, expires, signature); !errors.Is(err, ErrWorkerURLInvalid) {
+			t.Errorf("Verify() = %v, want ErrWorkerURLInvalid", err)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// This file contains the WorkerHealth tracker, which follows which workers are alive from the heartbeats they publish
+// to the 'heartbeat-out' queue. A worker is healthy while its last heartbeat is more recent than the heartbeat
+// timeout; workers that stop sending heartbeats are forgotten once they time out.
+//
+// Heartbeats are only tracked in memory, so after a restart no worker is healthy until it sends its next heartbeat.
+
+package services
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoWorkersAvailable is returned when rejecting an upload because no worker is healthy.
+var ErrNoWorkersAvailable = errors.New("no workers available")
+
+// WorkerStatus is the last heartbeat received from a worker.
+type WorkerStatus struct {
+	ID string `json:"id"`
+	// Stage is the pipeline stage the worker processes (i.e "sfm"), if it reported one.
+	Stage    string    `json:"stage,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// WorkerHealth tracks the heartbeats of workers.
+type WorkerHealth struct {
+	timeout time.Duration
+	mu      sync.Mutex
+	workers map[string]WorkerStatus
+}
+
+// NewWorkerHealth creates a WorkerHealth considering workers healthy for timeout after their last heartbeat.
+func NewWorkerHealth(timeout time.Duration) *WorkerHealth {
+	return &WorkerHealth{timeout: timeout, workers: make(map[string]WorkerStatus)}
+}
+
+// Beat records a heartbeat of the worker with the given ID, processing the given stage.
+func (h *WorkerHealth) Beat(id, stage string, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.workers[id] = WorkerStatus{ID: id, Stage: stage, LastSeen: at}
+}
+
+// Healthy returns the workers whose last heartbeat is within the timeout, sorted by ID. Timed out workers are
+// forgotten.
+func (h *WorkerHealth) Healthy() []WorkerStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := time.Now().Add(-h.timeout)
+	healthy := make([]WorkerStatus, 0, len(h.workers))
+	for id, worker := range h.workers {
+		if worker.LastSeen.Before(cutoff) {
+			delete(h.workers, id)
+			continue
+		}
+		healthy = append(healthy, worker)
+	}
+	sort.Slice(healthy, func(i, j int) bool { return healthy[i].ID < healthy[j].ID })
+	return healthy
+}
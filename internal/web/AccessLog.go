@@ -0,0 +1,147 @@
+// This file contains the access log, which logs a line per request with its method, path, status, response size,
+// duration and client IP. Its verbosity is configured per route (see AccessLogConfig): operators usually want the
+// upload and account routes logged in detail, but not the health checks and metrics scrapes that arrive every few
+// seconds.
+//
+// Only the path is logged, never the query string, as share links and signed worker URLs carry their token in it.
+
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Access log levels, from most to least verbose. AccessLogLevelOff disables the access log of a route.
+const (
+	AccessLogLevelDebug = "debug"
+	AccessLogLevelInfo  = "info"
+	AccessLogLevelWarn  = "warn"
+	AccessLogLevelError = "error"
+	AccessLogLevelOff   = "off"
+)
+
+var accessLogLevels = []string{AccessLogLevelDebug, AccessLogLevelInfo, AccessLogLevelWarn, AccessLogLevelError, AccessLogLevelOff}
+
+// AccessLogConfig holds the verbosity of the access log.
+type AccessLogConfig struct {
+	// Level is the level requests to routes without a RouteLevels entry are logged at.
+	Level string
+	// RouteLevels maps route patterns to the level their requests are logged at. A pattern is either a route path as
+	// registered (i.e "/user/scene/new"), matching all methods, "<METHOD> <path>" (i.e "POST /user/account/login"),
+	// or a path ending in "*" matching every route it prefixes (i.e "/admin/*"). Exact patterns take precedence over
+	// prefixes, and longer prefixes over shorter ones.
+	RouteLevels map[string]string
+}
+
+// validateAccessLogConfig checks that all levels of the config are known.
+func validateAccessLogConfig(config AccessLogConfig) error {
+	if !slices.Contains(accessLogLevels, config.Level) {
+		return fmt.Errorf("invalid access log level %q, expected one of %s", config.Level, strings.Join(accessLogLevels, ", "))
+	}
+	for pattern, level := range config.RouteLevels {
+		if pattern == "" {
+			return errors.New("access log route pattern must not be empty")
+		}
+		if !slices.Contains(accessLogLevels, level) {
+			return fmt.Errorf("invalid access log level %q for %s, expected one of %s", level, pattern, strings.Join(accessLogLevels, ", "))
+		}
+	}
+	return nil
+}
+
+// accessLogLevel returns the level requests with the given method to the route registered at path are logged at.
+func (config AccessLogConfig) accessLogLevel(method, path string) string {
+	if level, ok := config.RouteLevels[method+" "+path]; ok {
+		return level
+	}
+	if level, ok := config.RouteLevels[path]; ok {
+		return level
+	}
+
+	level, longest := config.Level, -1
+	for pattern, patternLevel := range config.RouteLevels {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if !ok || len(pattern) <= longest {
+			continue
+		}
+		if m, p, ok := strings.Cut(prefix, " "); ok {
+			if m != method {
+				continue
+			}
+			prefix = p
+		}
+		if strings.HasPrefix(path, prefix) {
+			level, longest = patternLevel, len(pattern)
+		}
+	}
+	return level
+}
+
+// accessLog is a middleware logging each request once it is handled, at the level configured for its route, with the
+// fields of its request context (i.e its request_id). Requests that matched no route are matched against the
+// configuration by their path.
+func (s *WebServer) accessLog(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	// The route is only known once the request was routed
+	path := c.Route().Path
+	if path == "/" && c.Path() != "/" {
+		path = c.Path()
+	}
+	level := s.config.AccessLog.accessLogLevel(c.Method(), path)
+	if level == AccessLogLevelOff {
+		return err
+	}
+
+	// Errors returned by the handler are only turned into a response by the error handler, after this middleware
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = http.StatusInternalServerError
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+	}
+
+	fields := []interface{}{
+		"method", c.Method(),
+		"path", c.Path(),
+		"route", path,
+		"status", status,
+		"duration", time.Since(start).String(),
+		"ip", c.IP(),
+	}
+	// The response of a returned error is not written yet, so its size is unknown
+	if size := responseSize(c); err == nil && size >= 0 {
+		fields = append(fields, "size", size)
+	}
+	logger := s.logFor(c)
+	switch level {
+	case AccessLogLevelDebug:
+		logger.Debugw("Request handled", fields...)
+	case AccessLogLevelWarn:
+		logger.Warnw("Request handled", fields...)
+	case AccessLogLevelError:
+		logger.Errorw("Request handled", fields...)
+	default:
+		logger.Infow("Request handled", fields...)
+	}
+	return err
+}
+
+// responseSize returns the size of the response body in bytes, or -1 if it is unknown (i.e a response streamed
+// without a Content-Length). Streamed bodies are only written after the middlewares ran, so they are not read here.
+func responseSize(c *fiber.Ctx) int {
+	if c.Response().IsBodyStream() {
+		return c.Response().Header.ContentLength()
+	}
+	return len(c.Response().Body())
+}
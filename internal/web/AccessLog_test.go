@@ -0,0 +1,156 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// newAccessLogServer returns a WebServer logging requests with the given access log config, and the entries it logs.
+// Its routes respond with an empty 200.
+func newAccessLogServer(t *testing.T, config AccessLogConfig, routes ...string) (*WebServer, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zap.DebugLevel)
+	webConfig := DefaultWebServerConfig()
+	webConfig.JWTSecret = "secret"
+	webConfig.AccessLog = config
+	s, err := NewWebServer(webConfig, nil, &log.Logger{SugaredLogger: zap.New(core).Sugar()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range routes {
+		s.app.All(route, func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+	}
+	return s, logs
+}
+
+// accessLogEntries sends a request to s and returns the access log entries it logged.
+func accessLogEntries(t *testing.T, s *WebServer, logs *observer.ObservedLogs, method, target string) []observer.LoggedEntry {
+	t.Helper()
+	logs.TakeAll()
+	if _, err := s.app.Test(httptest.NewRequest(method, target, nil), -1); err != nil {
+		t.Fatal(err)
+	}
+	return logs.FilterMessage("Request handled").TakeAll()
+}
+
+func TestAccessLogHealthChecksQuiet(t *testing.T) {
+	s, logs := newAccessLogServer(t, DefaultWebServerConfig().AccessLog, "/health", "/health/ready", "/user/scene/history")
+
+	for _, target := range []string{"/health", "/health/ready"} {
+		if entries := accessLogEntries(t, s, logs, http.MethodGet, target); len(entries) != 0 {
+			t.Errorf("GET %s logged %d entries, want none", target, len(entries))
+		}
+	}
+	if entries := accessLogEntries(t, s, logs, http.MethodGet, "/user/scene/history"); len(entries) != 1 {
+		t.Errorf("GET /user/scene/history logged %d entries, want 1", len(entries))
+	}
+}
+
+func TestAccessLogRouteLevels(t *testing.T) {
+	config := AccessLogConfig{
+		Level: AccessLogLevelInfo,
+		RouteLevels: map[string]string{
+			"/metrics":                 AccessLogLevelDebug,
+			"POST /user/account/login": AccessLogLevelWarn,
+			"/admin/*":                 AccessLogLevelError,
+			"/admin/queue/*":           AccessLogLevelDebug,
+			"/admin/stats":             AccessLogLevelWarn,
+			"/missing":                 AccessLogLevelOff,
+		},
+	}
+	s, logs := newAccessLogServer(t, config,
+		"/metrics", "/user/account/login", "/admin/stats", "/admin/repair", "/admin/queue/throughput", "/user/scene/:scene_id")
+
+	tests := []struct {
+		method, target string
+		want           zapcore.Level
+	}{
+		{http.MethodGet, "/metrics", zapcore.DebugLevel},
+		// Method patterns only match their method
+		{http.MethodPost, "/user/account/login", zapcore.WarnLevel},
+		{http.MethodGet, "/user/account/login", zapcore.InfoLevel},
+		// Exact patterns take precedence over prefixes, and longer prefixes over shorter ones
+		{http.MethodGet, "/admin/stats", zapcore.WarnLevel},
+		{http.MethodGet, "/admin/repair", zapcore.ErrorLevel},
+		{http.MethodGet, "/admin/queue/throughput", zapcore.DebugLevel},
+		// Routes are matched as registered, not by the requested path
+		{http.MethodGet, "/user/scene/metrics", zapcore.InfoLevel},
+	}
+	for _, tt := range tests {
+		entries := accessLogEntries(t, s, logs, tt.method, tt.target)
+		if len(entries) != 1 {
+			t.Errorf("%s %s logged %d entries, want 1", tt.method, tt.target, len(entries))
+			continue
+		}
+		if entries[0].Level != tt.want {
+			t.Errorf("%s %s logged at %s, want %s", tt.method, tt.target, entries[0].Level, tt.want)
+		}
+	}
+
+	// Requests that matched no route are matched by their path
+	if entries := accessLogEntries(t, s, logs, http.MethodGet, "/missing"); len(entries) != 0 {
+		t.Errorf("GET /missing logged %d entries, want none", len(entries))
+	}
+}
+
+func TestValidateAccessLogConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AccessLogConfig
+		valid  bool
+	}{
+		{"default", DefaultWebServerConfig().AccessLog, true},
+		{"unknown level", AccessLogConfig{Level: "verbose"}, false},
+		{"unknown route level", AccessLogConfig{Level: AccessLogLevelInfo, RouteLevels: map[string]string{"/health": "quiet"}}, false},
+		{"empty pattern", AccessLogConfig{Level: AccessLogLevelInfo, RouteLevels: map[string]string{"": AccessLogLevelOff}}, false},
+	}
+	for _, tt := range tests {
+		if err := validateAccessLogConfig(tt.config); (err == nil) != tt.valid {
+			t.Errorf("%s: validateAccessLogConfig() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestAccessLogResponseSize(t *testing.T) {
+	s, logs := newAccessLogServer(t, AccessLogConfig{Level: AccessLogLevelInfo})
+	s.app.Get("/body", func(c *fiber.Ctx) error { return c.SendString("hello") })
+	s.app.Get("/stream", func(c *fiber.Ctx) error {
+		return c.SendStream(strings.NewReader("streamed"), len("streamed"))
+	})
+	s.app.Get("/stream/unknown", func(c *fiber.Ctx) error {
+		return c.SendStream(strings.NewReader("streamed"))
+	})
+	s.app.Get("/error", func(c *fiber.Ctx) error { return fiber.NewError(http.StatusTeapot, "short and stout") })
+
+	tests := []struct {
+		target string
+		size   int64
+		known  bool
+	}{
+		{"/body", 5, true},
+		// Streamed bodies are sized by their Content-Length
+		{"/stream", 8, true},
+		{"/stream/unknown", 0, false},
+		// The response of a returned error is written after the access log
+		{"/error", 0, false},
+	}
+	for _, tt := range tests {
+		entries := accessLogEntries(t, s, logs, http.MethodGet, tt.target)
+		if len(entries) != 1 {
+			t.Fatalf("GET %s logged %d entries, want 1", tt.target, len(entries))
+		}
+		size, known := entries[0].ContextMap()["size"]
+		if known != tt.known || (known && size != tt.size) {
+			t.Errorf("GET %s logged size %v (%v), want %d (%v)", tt.target, size, known, tt.size, tt.known)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestAdminRequired(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+
+	mt.Run("not admin", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		mt.AddMockResponses(tokenVersionResponse(userID), userResponse(userID))
+		resp, body := request(mt.T, s, http.MethodGet, "/admin/stats", bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusForbidden {
+			mt.Fatalf("status = %d, want 403: %s", resp.StatusCode, body)
+		}
+	})
+
+	mt.Run("role lookup fails", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}),
+		)
+		resp, body := request(mt.T, s, http.MethodGet, "/admin/stats", bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusInternalServerError {
+			mt.Fatalf("status = %d, want 500: %s", resp.StatusCode, body)
+		}
+		if strings.Contains(body, "boom") {
+			mt.Errorf("database error was sent to the client: %s", body)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseByteRange(t *testing.T) {
+	const size = 100
+
+	tests := []struct {
+		header      string
+		start, end  int64
+		partial     bool
+		satisfiable bool
+	}{
+		{"", 0, size, false, true},
+		{"bytes=0-9", 0, 10, true, true},
+		{"bytes=90-", 90, size, true, true},
+		{"bytes=90-200", 90, size, true, true},
+		{"bytes=-10", 90, size, true, true},
+		{"bytes=-200", 0, size, true, true},
+		{"bytes=99-99", 99, size, true, true},
+		{"bytes=100-", 0, 0, true, false},
+		{"bytes=-0", 0, 0, true, false},
+		// Malformed and multiple ranges are ignored, sending the whole file
+		{"bytes=0-9,20-29", 0, size, false, true},
+		{"bytes=9-0", 0, size, false, true},
+		{"bytes=a-9", 0, size, false, true},
+		{"bytes=-a", 0, size, false, true},
+		{"bytes=5", 0, size, false, true},
+		{"items=0-9", 0, size, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, end, partial, satisfiable := parseByteRange(tt.header, size)
+			if start != tt.start || end != tt.end || partial != tt.partial || satisfiable != tt.satisfiable {
+				t.Errorf("parseByteRange(%q) = %d, %d, %v, %v, want %d, %d, %v, %v", tt.header,
+					start, end, partial, satisfiable, tt.start, tt.end, tt.partial, tt.satisfiable)
+			}
+		})
+	}
+}
+
+func TestSendFileWithRangeSupport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.splat")
+	content := []byte("0123456789abcdefghij")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(DefaultWebServerConfig())
+	app := fiber.New()
+	app.Get("/file", func(c *fiber.Ctx) error {
+		return s.sendFileWithRangeSupport(c, path)
+	})
+
+	tests := []struct {
+		rangeHeader  string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"", http.StatusOK, string(content), ""},
+		{"bytes=5-9", http.StatusPartialContent, "56789", "bytes 5-9/20"},
+		{"bytes=-3", http.StatusPartialContent, "hij", "bytes 17-19/20"},
+		{"bytes=20-", http.StatusRequestedRangeNotSatisfiable, "Invalid range", "bytes */20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rangeHeader, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/file", nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set(fiber.HeaderRange, tt.rangeHeader)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.status || string(body) != tt.body {
+				t.Errorf("got %d %q, want %d %q", resp.StatusCode, body, tt.status, tt.body)
+			}
+			if got := resp.Header.Get(fiber.HeaderContentRange); got != tt.contentRange {
+				t.Errorf("Content-Range = %q, want %q", got, tt.contentRange)
+			}
+			if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+				t.Errorf("Accept-Ranges = %q, want bytes", got)
+			}
+		})
+	}
+}
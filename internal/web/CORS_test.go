@@ -0,0 +1,77 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// preflight sends a CORS preflight request for a GET of the scene history from origin to s.
+func preflight(t *testing.T, s *WebServer, origin string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodOptions, "/user/scene/history", nil)
+	req.Header.Set(fiber.HeaderOrigin, origin)
+	req.Header.Set(fiber.HeaderAccessControlRequestMethod, http.MethodGet)
+	req.Header.Set(fiber.HeaderAccessControlRequestHeaders, "Authorization")
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCORS(t *testing.T) {
+	config := DefaultWebServerConfig()
+	config.CORS = CORSConfig{AllowOrigins: []string{"https://app.example.com"}, AllowCredentials: true}
+	s := newRoutedServer(t, config)
+
+	t.Run("allowed origin", func(t *testing.T) {
+		resp := preflight(t, s, "https://app.example.com")
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("status = %d, want 204", resp.StatusCode)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "https://app.example.com" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want the origin", got)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials); got != "true" {
+			t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+		}
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		resp := preflight(t, s, "https://evil.example.com")
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); got != "" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+		}
+		if got := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials); got != "" {
+			t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+		}
+	})
+}
+
+func TestCORSCredentialsRequireOrigins(t *testing.T) {
+	logger := &log.Logger{SugaredLogger: zap.NewNop().Sugar()}
+	for name, origins := range map[string][]string{
+		"all origins by default": nil,
+		"wildcard origin":        {"https://app.example.com", "*"},
+	} {
+		config := DefaultWebServerConfig()
+		config.JWTSecret = "secret"
+		config.CORS = CORSConfig{AllowOrigins: origins, AllowCredentials: true}
+		if _, err := NewWebServer(config, nil, logger); err == nil {
+			t.Errorf("%s: NewWebServer accepted credentials for all origins", name)
+		}
+	}
+
+	// Without credentials, all origins may be allowed
+	config := DefaultWebServerConfig()
+	config.JWTSecret = "secret"
+	if _, err := NewWebServer(config, nil, logger); err != nil {
+		t.Errorf("NewWebServer() without credentials = %v, want nil", err)
+	}
+}
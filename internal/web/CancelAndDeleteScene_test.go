@@ -0,0 +1,126 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+// queueResponse returns a mocked response to a lookup of the queue holding the given scenes, in order.
+func queueResponse(name string, sceneIDs ...primitive.ObjectID) bson.D {
+	return mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: name},
+		{Key: "queue", Value: sceneIDs},
+	})
+}
+
+func TestCancelAndDeleteScene(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ok := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}}
+	userID, sceneID := primitive.NewObjectID(), primitive.NewObjectID()
+	target := "/data/scene/cancel-and-delete/" + sceneID.Hex()
+
+	mt.Run("queued", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		paths := writeSceneFiles(mt.T, sceneID)
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		// The scene waits behind another one for SfM
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneID),
+			queueResponse("sfm_list", primitive.NewObjectID(), sceneID),
+			sceneResponse(sceneID, userID, scene.StatusSfmProcessing),
+			ok, // DeleteQueuedScene
+			queueResponse("queue_list", sceneID),
+			ok, // removed from queue_list
+			ok, // removed from sfm_list
+			queueResponse("nerf_list"),
+			ok, // RemoveUserScene
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch),
+		)
+		resp, body := request(mt.T, s, http.MethodPost, target, bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+
+		removed := map[string]bool{}
+		for _, event := range mt.GetAllStartedEvents() {
+			switch event.CommandName {
+			case "delete":
+				if got := event.Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q", "_id").ObjectID(); got != sceneID {
+					mt.Errorf("deleted scene %s, want %s", got.Hex(), sceneID.Hex())
+				}
+				removed["scene"] = true
+			case "update":
+				update := event.Command.Lookup("updates").Array().Index(0).Value().Document()
+				if event.Command.Lookup("update").StringValue() == "queues" {
+					queue, _ := update.Lookup("u", "$set", "queue").Array().Values()
+					for _, id := range queue {
+						if id.ObjectID() == sceneID {
+							mt.Errorf("scene is still in queue %s", update.Lookup("q", "_id"))
+						}
+					}
+					removed[update.Lookup("q", "_id").StringValue()] = true
+				} else if event.Command.Lookup("update").StringValue() == "users" {
+					removed["user"] = true
+				}
+			}
+		}
+		for _, name := range []string{"scene", "queue_list", "sfm_list", "user"} {
+			if !removed[name] {
+				mt.Errorf("scene was not removed from %s, got %v", name, removed)
+			}
+		}
+		for _, path := range paths {
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				mt.Errorf("%s was not removed: %v", path, err)
+			}
+		}
+	})
+
+	mt.Run("processed by the sfm-worker", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneID),
+			queueResponse("sfm_list", sceneID, primitive.NewObjectID()),
+		)
+		resp, body := request(mt.T, s, http.MethodPost, target, bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusConflict {
+			mt.Fatalf("status = %d, want 409: %s", resp.StatusCode, body)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "delete" {
+				mt.Errorf("scene being processed was deleted: %s", event.Command)
+			}
+		}
+	})
+
+	mt.Run("past SfM", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		// The scene has left the sfm queue, so it is not deleted as it is no longer waiting for SfM
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneID),
+			queueResponse("sfm_list"),
+			sceneResponse(sceneID, userID, scene.StatusNerfProcessing),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}},
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+		)
+		resp, body := request(mt.T, s, http.MethodPost, target, bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusConflict {
+			mt.Fatalf("status = %d, want 409: %s", resp.StatusCode, body)
+		}
+	})
+}
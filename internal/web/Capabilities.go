@@ -0,0 +1,151 @@
+// This file contains the server capabilities, which let clients discover in a single request what the server accepts:
+// its training modes and output types, the bounds of uploads, the formats it exports, and the version it runs.
+//
+// Like the upload schema, capabilities are not written by hand: they are read from the upload schema, the request
+// structs and the WebServerConfig that requests are validated against, so they always match the enforced limits.
+
+package web
+
+import (
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Version is the build version reported by /capabilities. It is set at build time with
+// -ldflags "-X github.com/NeRF-or-Nothing/go-web-server/internal/web.Version=<version>". If unset, the module
+// version or VCS revision the binary was built from is reported instead.
+var Version string
+
+// Capabilities describes what the server accepts and produces.
+type Capabilities struct {
+	Version CapabilitiesVersion `json:"version"`
+	// TrainingModes are the training modes accepted by uploads, and OutputTypes the output types of each.
+	TrainingModes []string            `json:"training_modes"`
+	OutputTypes   map[string][]string `json:"output_types"`
+	Iterations    IterationBounds     `json:"iterations"`
+	Upload        UploadLimits        `json:"upload"`
+	Quota         QuotaLimits         `json:"quota"`
+	// ExportFormats are the formats scene history can be exported in.
+	ExportFormats []string `json:"export_formats"`
+}
+
+// CapabilitiesVersion holds the versions the server was built with.
+type CapabilitiesVersion struct {
+	Server string `json:"server"`
+	Go     string `json:"go"`
+}
+
+// IterationBounds holds the accepted `total_iterations` and `save_iterations` values.
+type IterationBounds struct {
+	Minimum int `json:"minimum"`
+	Maximum int `json:"maximum"`
+	// MinimumTotalByTrainingMode raises the minimum `total_iterations` for the given training modes.
+	MinimumTotalByTrainingMode map[string]int `json:"minimum_total_by_training_mode,omitempty"`
+}
+
+// UploadLimits holds the limits of video uploads.
+type UploadLimits struct {
+	// MaxFileSize is the largest accepted video, and MaxBodySize the largest accepted request, in bytes.
+	MaxFileSize int64 `json:"max_file_size"`
+	MaxBodySize int   `json:"max_body_size"`
+	// Formats and Extensions are the accepted video containers, and the file extensions of each.
+	Formats    []string `json:"formats"`
+	Extensions []string `json:"extensions"`
+	// MaxTags is the number of tags a scene may have.
+	MaxTags int `json:"max_tags,omitempty"`
+}
+
+// QuotaLimits holds the limits on how much clients may do at once. Zero values are not limited.
+type QuotaLimits struct {
+	// MaxConcurrentUploads is the number of uploads received at once, across all users.
+	MaxConcurrentUploads int `json:"max_concurrent_uploads"`
+	// AuthRateLimit is the number of login and registration attempts allowed per AuthRateLimitWindow (in seconds).
+	AuthRateLimit       int `json:"auth_rate_limit"`
+	AuthRateLimitWindow int `json:"auth_rate_limit_window"`
+}
+
+// BuildCapabilities returns the capabilities of a server with the given config.
+func BuildCapabilities(config WebServerConfig) Capabilities {
+	capabilities := Capabilities{
+		Version: CapabilitiesVersion{
+			Server: buildVersion(),
+			Go:     runtime.Version(),
+		},
+		Upload: UploadLimits{
+			MaxBodySize: config.BodyLimit,
+		},
+		Quota: QuotaLimits{
+			MaxConcurrentUploads: config.MaxConcurrentUploads,
+			AuthRateLimit:        config.AuthRateLimit,
+			AuthRateLimitWindow:  int(config.AuthRateLimitWindow / time.Second),
+		},
+		ExportFormats: oneofValues(ExportSceneHistoryRequest{}, "Format"),
+	}
+
+	for _, field := range BuildUploadSchema(config.Upload).Fields {
+		switch field.Name {
+		case "file":
+			capabilities.Upload.MaxFileSize = field.MaxSize
+			capabilities.Upload.Formats = field.Formats
+			capabilities.Upload.Extensions = field.Extensions
+		case "training_mode":
+			capabilities.TrainingModes = field.Enum
+		case "output_types":
+			capabilities.OutputTypes = field.Items.EnumByTrainingMode
+		case "total_iterations":
+			capabilities.Iterations = IterationBounds{
+				Minimum:                    *field.Minimum,
+				Maximum:                    *field.Maximum,
+				MinimumTotalByTrainingMode: field.MinimumByTrainingMode,
+			}
+		case "tags":
+			if field.MaxItems != nil {
+				capabilities.Upload.MaxTags = *field.MaxItems
+			}
+		}
+	}
+	return capabilities
+}
+
+// oneofValues returns the values allowed by the `oneof` rule of the validate tag of the named field of the struct v.
+func oneofValues(v any, fieldName string) []string {
+	field, ok := reflect.TypeOf(v).FieldByName(fieldName)
+	if !ok {
+		return nil
+	}
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		if values, ok := strings.CutPrefix(rule, "oneof="); ok {
+			return strings.Fields(values)
+		}
+	}
+	return nil
+}
+
+// buildVersion returns Version, or the version of the main module, or the VCS revision the binary was built from.
+func buildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	settings := make(map[string]string)
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	revision, ok := settings["vcs.revision"]
+	if !ok {
+		return "devel"
+	}
+	if settings["vcs.modified"] == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
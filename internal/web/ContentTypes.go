@@ -0,0 +1,39 @@
+// This file contains the content types files are served with. Types are looked up by file extension, first in the
+// configured ContentTypes, then in the system's MIME table. NeRF formats (i.e .splat and .ply) are unknown to the
+// system table, and would otherwise be served as application/octet-stream, which viewers can not tell apart.
+
+package web
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// validateContentTypes checks that all extensions of the map start with a dot, and all content types are valid.
+func validateContentTypes(contentTypes map[string]string) error {
+	for ext, contentType := range contentTypes {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			return fmt.Errorf("invalid content type extension %q, expected a leading dot (i.e \".ply\")", ext)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("invalid content type %q for %s: %w", contentType, ext, err)
+		}
+	}
+	return nil
+}
+
+// contentType returns the content type the file at the given path is served with, by its extension.
+func (s *WebServer) contentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for configured, contentType := range s.config.ContentTypes {
+		if strings.ToLower(configured) == ext {
+			return contentType
+		}
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
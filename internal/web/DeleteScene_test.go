@@ -0,0 +1,167 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+// userResponse returns a mocked response to a lookup of the user owning the given scenes.
+func userResponse(userID primitive.ObjectID, sceneIDs ...primitive.ObjectID) bson.D {
+	if sceneIDs == nil {
+		sceneIDs = []primitive.ObjectID{}
+	}
+	return mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: userID},
+		{Key: "username", Value: "alice"},
+		{Key: "scene_ids", Value: sceneIDs},
+	})
+}
+
+// sceneResponse returns a mocked response to a lookup of the scene of the owner with the given status.
+func sceneResponse(sceneID, ownerID primitive.ObjectID, status int) bson.D {
+	return mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: sceneID},
+		{Key: "user_id", Value: ownerID},
+		{Key: "name", Value: "garden"},
+		{Key: "status", Value: status},
+	})
+}
+
+// removedSceneResponses returns the mocked responses to deleting a scene and removing its data: its deletion,
+// its removal from the (empty) queues and from its owner's scene list, and the check for scenes promoted from it.
+func removedSceneResponses() []bson.D {
+	ok := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}}
+	return []bson.D{
+		ok,
+		mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch),
+		mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch),
+		mtest.CreateCursorResponse(0, "nerfdb.queues", mtest.FirstBatch),
+		ok,
+		mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch),
+	}
+}
+
+// writeSceneFiles writes the uploaded video, sfm and nerf output of the scene, and returns their paths.
+func writeSceneFiles(t *testing.T, sceneID primitive.ObjectID) []string {
+	t.Helper()
+	paths := []string{
+		filepath.Join("data", "raw", "videos", sceneID.Hex()+".mp4"),
+		filepath.Join("data", "sfm", sceneID.Hex(), "frame.png"),
+		filepath.Join("data", "nerf", sceneID.Hex(), "splat.ply"),
+	}
+	for _, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestDeleteScene(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	config := services.DefaultClientServiceConfig()
+	config.TrashRetention = 0
+	userID, sceneID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("owner", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		paths := writeSceneFiles(mt.T, sceneID)
+		s := newMockedServer(mt, config)
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneID),
+			sceneResponse(sceneID, userID, scene.StatusComplete),
+		)
+		mt.AddMockResponses(removedSceneResponses()...)
+		resp, body := request(mt.T, s, http.MethodDelete, "/data/scene/"+sceneID.Hex(), bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+		for _, path := range paths {
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				mt.Errorf("%s was not removed: %v", path, err)
+			}
+		}
+	})
+
+	mt.Run("still processing", func(mt *mtest.T) {
+		s := newMockedServer(mt, config)
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneID),
+			sceneResponse(sceneID, userID, scene.StatusNerfProcessing),
+		)
+		resp, body := request(mt.T, s, http.MethodDelete, "/data/scene/"+sceneID.Hex(), bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusConflict {
+			mt.Fatalf("status = %d, want 409: %s", resp.StatusCode, body)
+		}
+	})
+
+	mt.Run("not owner", func(mt *mtest.T) {
+		s := newMockedServer(mt, config)
+		otherID := primitive.NewObjectID()
+
+		// Another user's scene and a missing scene get the same response, and neither is read
+		var bodies []string
+		for _, target := range []primitive.ObjectID{sceneID, primitive.NewObjectID()} {
+			mt.AddMockResponses(tokenVersionResponse(otherID), userResponse(otherID))
+			resp, body := request(mt.T, s, http.MethodDelete, "/data/scene/"+target.Hex(), bearerToken(mt, s, otherID), nil)
+			if resp.StatusCode != http.StatusNotFound {
+				mt.Fatalf("status = %d, want 404: %s", resp.StatusCode, body)
+			}
+			bodies = append(bodies, body)
+		}
+		if bodies[0] != bodies[1] {
+			mt.Errorf("another user's scene got %s, a missing scene got %s", bodies[0], bodies[1])
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.Command.Lookup("find").StringValue() == "scenes" {
+				mt.Errorf("scene was read before ownership was checked: %s", event.Command)
+			}
+		}
+	})
+
+	mt.Run("read-only data directory", func(mt *mtest.T) {
+		if os.Geteuid() == 0 {
+			mt.Skip("permissions are not enforced for root")
+		}
+		inTempDir(mt.T)
+		writeSceneFiles(mt.T, sceneID)
+		nerfDir := filepath.Join("data", "nerf")
+		if err := os.Chmod(nerfDir, 0o555); err != nil {
+			mt.Fatal(err)
+		}
+		mt.Cleanup(func() { os.Chmod(nerfDir, 0o755) })
+		s := newMockedServer(mt, config)
+
+		// The scene is deleted even if its files can not be removed, which is logged
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneID),
+			sceneResponse(sceneID, userID, scene.StatusComplete),
+		)
+		mt.AddMockResponses(removedSceneResponses()...)
+		resp, body := request(mt.T, s, http.MethodDelete, "/data/scene/"+sceneID.Hex(), bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+		if _, err := os.Stat(filepath.Join("data", "raw", "videos", sceneID.Hex()+".mp4")); !errors.Is(err, os.ErrNotExist) {
+			mt.Errorf("video was not removed: %v", err)
+		}
+	})
+}
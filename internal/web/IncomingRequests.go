@@ -19,6 +19,7 @@ import (
 type LoginRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
+	Device   string `json:"device" validate:"max=64"`
 }
 
 type RegisterRequest struct {
@@ -26,6 +27,14 @@ type RegisterRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type RevokeSessionRequest struct {
+	SessionID string `params:"session_id" validate:"required,hexadecimal,len=24"`
+}
+
 type UpdatePasswordRequest struct {
 	OldPassword string `json:"old_password" validate:"required"`
 	NewPassword string `json:"new_password" validate:"required"`
@@ -37,7 +46,7 @@ type UpdateUsernameRequest struct {
 }
 
 type DeleteSceneRequest struct {
-	SceneID string `params:"scene_id" validate:"required"`
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
 }
 
 type DeleteUserRequest struct {
@@ -46,11 +55,57 @@ type DeleteUserRequest struct {
 
 type NewSceneRequest struct {
 	File            *multipart.FileHeader `form:"file" validate:"required"`
-	TrainingMode    string                `form:"training_mode" validate:"required,oneof=gaussian tensorf"`
-	OutputTypes     []string              `form:"output_types" validate:"required,dive,validOutputType"`
-	SaveIterations  []int                 `form:"save_iterations" validate:"required,dive,min=1,max=30000"`
-	TotalIterations int                   `form:"total_iterations" validate:"required,min=1,max=30000"`
+	TrainingMode    string                `form:"training_mode" validate:"required_unless=SfmOnly true,omitempty,oneof=gaussian tensorf"`
+	OutputTypes     []string              `form:"output_types" validate:"required_unless=SfmOnly true,omitempty,dive,validOutputType"`
+	SaveIterations  []int                 `form:"save_iterations" validate:"required_unless=SfmOnly true,omitempty,dive,min=1"`
+	TotalIterations int                   `form:"total_iterations" validate:"required_unless=SfmOnly true,omitempty,min=1"`
 	SceneName       string                `form:"scene_name"`
+	Tags            []string              `form:"tags" validate:"max=16,dive,min=1,max=32"`
+	SfmOnly         bool                  `form:"sfm_only"`
+	Downscale       bool                  `form:"downscale"`
+	UploadID        string                `validate:"omitempty,max=64,uploadID"`
+	IdempotencyKey  string                `validate:"omitempty,max=255,printascii"`
+}
+
+type InitChunkedUploadRequest struct {
+	Filename        string   `json:"filename" validate:"required,max=255"`
+	Size            int64    `json:"size" validate:"required,min=1"`
+	TrainingMode    string   `json:"training_mode" validate:"required_unless=SfmOnly true,omitempty,oneof=gaussian tensorf"`
+	OutputTypes     []string `json:"output_types" validate:"required_unless=SfmOnly true,omitempty,dive,validOutputType"`
+	SaveIterations  []int    `json:"save_iterations" validate:"required_unless=SfmOnly true,omitempty,dive,min=1"`
+	TotalIterations int      `json:"total_iterations" validate:"required_unless=SfmOnly true,omitempty,min=1"`
+	SceneName       string   `json:"scene_name"`
+	Tags            []string `json:"tags" validate:"max=16,dive,min=1,max=32"`
+	SfmOnly         bool     `json:"sfm_only"`
+	Downscale       bool     `json:"downscale"`
+}
+
+type EstimateStorageRequest struct {
+	TrainingMode    string   `json:"training_mode" validate:"required,oneof=gaussian tensorf"`
+	OutputTypes     []string `json:"output_types" validate:"required,dive,validOutputType"`
+	SaveIterations  []int    `json:"save_iterations" validate:"required,dive,min=1"`
+	TotalIterations int      `json:"total_iterations" validate:"required,min=1"`
+}
+
+type ChunkedUploadRequest struct {
+	UploadID string `params:"upload_id" validate:"required,hexadecimal,len=32"`
+}
+
+type GetUploadProgressRequest struct {
+	UploadID string `params:"upload_id" validate:"required,max=64,uploadID"`
+}
+
+type GetSceneRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
+type GetSceneCombinedLogRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+	Level   string `query:"level" validate:"omitempty,oneof=debug info warn error"`
+}
+
+type CancelAndDeleteSceneRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
 }
 
 type GetSceneMetadataRequest struct {
@@ -60,21 +115,155 @@ type GetSceneMetadataRequest struct {
 type GetSceneOutputRequest struct {
 	SceneID    string `params:"scene_id" validate:"required"`
 	OutputType string `params:"output_type" validate:"required,oneof=splat_cloud point_cloud video model"`
-	Iteration  string `query:"iteration"`
+	Iteration  int    `query:"iteration" validate:"omitempty,min=1"`
+}
+
+type GetSceneOutputIterationRequest struct {
+	SceneID    string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+	OutputType string `params:"output_type" validate:"required,oneof=splat_cloud point_cloud video model"`
+	Iteration  int    `query:"iteration" validate:"omitempty,min=1"`
+}
+
+type GetSceneOutputStatsRequest struct {
+	SceneID    string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+	OutputType string `params:"output_type" validate:"required,oneof=splat_cloud point_cloud video model"`
 }
 
 type GetSceneThumbnailRequest struct {
 	SceneID string `params:"scene_id" validate:"required"`
 }
 
+type RefreshSceneThumbnailRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
+type GetSfmReportRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
+type GetSfmOutputRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
+type GetSceneTurntableRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
 type GetSceneNameRequest struct {
 	SceneID string `params:"scene_id" validate:"required"`
 }
 
+type UpdateSceneRequest struct {
+	SceneID     string    `params:"scene_id" validate:"required,hexadecimal,len=24"`
+	Name        *string   `json:"name" validate:"omitempty,min=1,max=128"`
+	Description *string   `json:"description" validate:"omitempty,max=2048"`
+	Tags        *[]string `json:"tags" validate:"omitempty,max=16,dive,min=1,max=32"`
+	Favorite    *bool     `json:"favorite"`
+}
+
+type RenameSceneRequest struct {
+	SceneID   string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+	SceneName string `json:"scene_name" validate:"required,min=1,max=128"`
+}
+
+type PromoteSceneRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
+type CreateShareLinkRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+	TTL     string `json:"ttl"`
+}
+
+type GetSharedSceneInfoRequest struct {
+	Token string `params:"token" validate:"required,max=512"`
+}
+
+type GetSharedSceneOutputRequest struct {
+	Token      string `params:"token" validate:"required,max=512"`
+	OutputType string `params:"output_type" validate:"required,oneof=splat_cloud point_cloud video model"`
+	Iteration  int    `query:"iteration" validate:"omitempty,min=1"`
+}
+
+type GetSceneVideoInfoRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
+type GetSceneStatusRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
+type StreamSceneProgressRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
+type StreamSceneETARequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+}
+
 type GetSceneProgressRequest struct {
 	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
 }
 
 type GetWorkerDataRequest struct {
 	Path string `params:"path" validate:"required"`
-}
\ No newline at end of file
+}
+type UpdateSceneACLRequest struct {
+	SceneID  string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+	Username string `json:"username" validate:"required"`
+	Action   string `json:"action" validate:"required,oneof=grant revoke"`
+}
+
+type SetUserRoleRequest struct {
+	Username     string `json:"username" validate:"required"`
+	Role         string `json:"role" validate:"required,oneof=user admin"`
+	RevokeTokens bool   `json:"revoke_tokens"`
+}
+
+type GetQueueThroughputRequest struct {
+	Window string `query:"window"`
+	Bucket string `query:"bucket" validate:"omitempty,oneof=hour day"`
+}
+
+type RepairSceneRequest struct {
+	SceneID string `params:"scene_id" validate:"required,hexadecimal,len=24"`
+	DryRun  bool   `query:"dry_run"`
+}
+
+type DownloadScenesRequest struct {
+	SceneIDs    []string `json:"scene_ids" validate:"required,min=1,max=50,unique,dive,hexadecimal,len=24"`
+	OutputTypes []string `json:"output_types" validate:"omitempty,dive,validOutputType"`
+}
+
+type GetScenesMetadataRequest struct {
+	SceneIDs []string `json:"scene_ids" validate:"required,min=1,max=100,unique,dive,hexadecimal,len=24"`
+}
+
+type RepairScenesRequest struct {
+	SceneIDs []string `json:"scene_ids" validate:"required,min=1,max=100,dive,hexadecimal,len=24"`
+	DryRun   bool     `query:"dry_run"`
+}
+
+type ExportSceneHistoryRequest struct {
+	Format string `query:"format" validate:"omitempty,oneof=csv json"`
+}
+
+type GetUserSceneHistoryRequest struct {
+	Since  string `query:"since"`
+	Until  string `query:"until"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=100"`
+	Offset int    `query:"offset" validate:"omitempty,min=0"`
+}
+
+type SetWebhookRequest struct {
+	URL string `json:"url" validate:"omitempty,url,max=2048"`
+}
+
+type MarkNotificationsReadRequest struct {
+	IDs []string `json:"ids" validate:"max=100,dive,hexadecimal,len=24"`
+}
+
+type GetUserFailuresRequest struct {
+	Since string `query:"since"`
+	Until string `query:"until"`
+}
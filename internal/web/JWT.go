@@ -0,0 +1,102 @@
+// This file contains the signing and verification of JWT tokens. Tokens are either signed with a shared secret
+// (HS256, the default), or with an RSA key pair (RS256). With RS256, tokens issued by another service (i.e a central
+// auth service) can be verified with its public key; this server only issues tokens itself if it has the private key.
+//
+// Only the configured algorithm is accepted when verifying, so a forged token cannot pick its own (i.e "none", or
+// HS256 "signed" with the RS256 public key).
+//
+// Tokens must carry the user's token version in their `ver` claim, including tokens issued by another service, so
+// revoking all of a user's tokens (see ClientService.RevokeAllSessions) rejects them.
+
+package web
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Supported JWT signing algorithms.
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+)
+
+var (
+	// ErrUnknownJWTAlgorithm is returned when a JWT signing algorithm is not supported.
+	ErrUnknownJWTAlgorithm = errors.New("unknown JWT algorithm, expected HS256 or RS256")
+	// ErrTokenSigningUnavailable is returned when issuing a token with RS256, without a private key.
+	ErrTokenSigningUnavailable = errors.New("token signing is not available without a private key")
+)
+
+// LoadRSAPublicKey reads a PEM encoded RSA public key (or certificate) from the file at path.
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(data)
+}
+
+// LoadRSAPrivateKey reads a PEM encoded RSA private key from the file at path.
+func LoadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseRSAPrivateKeyFromPEM(data)
+}
+
+// validateJWTConfig checks that the token TTL is positive, and that the keys needed by the configured algorithm are
+// present.
+func validateJWTConfig(config WebServerConfig) error {
+	if config.TokenTTL <= 0 {
+		return errors.New("TokenTTL must be positive")
+	}
+	switch config.JWTAlgorithm {
+	case JWTAlgorithmHS256, "":
+		return nil
+	case JWTAlgorithmRS256:
+		if config.JWTPublicKey == nil {
+			return errors.New("RS256 requires a public key")
+		}
+		if config.JWTPrivateKey != nil && config.JWTPrivateKey.PublicKey.N.Cmp(config.JWTPublicKey.N) != 0 {
+			return errors.New("RS256 private key does not match the public key")
+		}
+		return nil
+	default:
+		return ErrUnknownJWTAlgorithm
+	}
+}
+
+// jwtKey is the jwt.Keyfunc used to verify tokens. It only accepts tokens signed with the configured algorithm.
+func (s *WebServer) jwtKey(token *jwt.Token) (interface{}, error) {
+	if s.config.JWTAlgorithm == JWTAlgorithmRS256 {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); ok && token.Method.Alg() == jwt.SigningMethodRS256.Alg() {
+			return s.config.JWTPublicKey, nil
+		}
+	} else {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+			return []byte(s.jwtSecret), nil
+		}
+	}
+
+	s.logger.Debugf("Rejected token signed with unexpected method %v", token.Header["alg"])
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+}
+
+// signToken signs a token with the given claims, using the configured algorithm.
+//
+// Returns ErrTokenSigningUnavailable if RS256 is configured without a private key.
+func (s *WebServer) signToken(claims jwt.MapClaims) (string, error) {
+	if s.config.JWTAlgorithm == JWTAlgorithmRS256 {
+		if s.config.JWTPrivateKey == nil {
+			return "", ErrTokenSigningUnavailable
+		}
+		return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(s.config.JWTPrivateKey)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.jwtSecret))
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// testClaims returns the claims of a token for a new user, expiring in an hour.
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": primitive.NewObjectID().Hex(),
+		"ver": 0,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// authStatus returns the status tokenRequired responds to a request carrying the given bearer token with, or 200 if
+// the token was accepted.
+func authStatus(t *testing.T, s *WebServer, token string) int {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", s.tokenRequired(func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	}))
+
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+// newRSAKey returns a new RSA key for signing test tokens.
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestTokenRequiredRejectsForgedTokens(t *testing.T) {
+	s := newTestServer(WebServerConfig{JWTSecret: "secret"})
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSigned, err := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims()).SignedString(newRSAKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSecret, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("other secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, testClaims()).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"alg none":                      unsigned,
+		"RS256 against an HS256 config": rsaSigned,
+		"bad signature":                 otherSecret,
+		"HS512 with the secret":         hs512,
+		"malformed":                     "not-a-token",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if status := authStatus(t, s, token); status != fiber.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", status, fiber.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestTokenRequiredRejectsExpiredTokens(t *testing.T) {
+	s := newTestServer(WebServerConfig{JWTSecret: "secret"})
+
+	claims := testClaims()
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := authStatus(t, s, token); status != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+}
+
+func TestNewWebServerRequiresTokenTTL(t *testing.T) {
+	for _, ttl := range []time.Duration{0, -time.Hour} {
+		config := DefaultWebServerConfig()
+		config.JWTSecret = "secret"
+		config.TokenTTL = ttl
+		if _, err := NewWebServer(config, nil, newTestServer(config).logger); err == nil {
+			t.Errorf("NewWebServer() with TokenTTL %v succeeded, want an error", ttl)
+		}
+	}
+}
+
+func TestRS256Tokens(t *testing.T) {
+	key := newRSAKey(t)
+	s := newTestServer(WebServerConfig{JWTAlgorithm: JWTAlgorithmRS256, JWTPublicKey: &key.PublicKey, JWTPrivateKey: key})
+
+	t.Run("accepted", func(t *testing.T) {
+		token, err := s.signToken(testClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed, err := jwt.Parse(token, s.jwtKey); err != nil || !parsed.Valid {
+			t.Errorf("Parse() = %v, want a valid token", err)
+		}
+	})
+
+	t.Run("mismatched key", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims()).SignedString(newRSAKey(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jwt.Parse(token, s.jwtKey); err == nil {
+			t.Error("Parse() accepted a token signed with another key")
+		}
+		if status := authStatus(t, s, token); status != fiber.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", status, fiber.StatusUnauthorized)
+		}
+	})
+
+	t.Run("HS256 signed with the public key", func(t *testing.T) {
+		public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString(public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := authStatus(t, s, token); status != fiber.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", status, fiber.StatusUnauthorized)
+		}
+	})
+
+	t.Run("no private key", func(t *testing.T) {
+		verifyOnly := newTestServer(WebServerConfig{JWTAlgorithm: JWTAlgorithmRS256, JWTPublicKey: &key.PublicKey})
+		if _, err := verifyOnly.signToken(testClaims()); !errors.Is(err, ErrTokenSigningUnavailable) {
+			t.Errorf("signToken() = %v, want ErrTokenSigningUnavailable", err)
+		}
+	})
+}
+
+func TestTokenRequiredDoesNotLogToken(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	s := newTestServer(WebServerConfig{JWTSecret: "secret"})
+	s.logger = &log.Logger{SugaredLogger: zap.New(core).Sugar()}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("other secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authStatus(t, s, token)
+
+	if logs.Len() == 0 {
+		t.Fatal("nothing logged")
+	}
+	for _, entry := range logs.All() {
+		if strings.Contains(entry.Message, token) || strings.Contains(entry.Message, strings.Split(token, ".")[2]) {
+			t.Errorf("log entry %q holds the token", entry.Message)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestLogoutRevokesToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("logged out", func(mt *mtest.T) {
+		userID := primitive.NewObjectID()
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		token, other := bearerToken(mt, s, userID), bearerToken(mt, s, userID)
+
+		mt.AddMockResponses(tokenVersionResponse(userID))
+		if resp, body := request(mt.T, s, http.MethodPost, "/logout", token, nil); resp.StatusCode != http.StatusOK {
+			mt.Fatalf("logout status = %d (%s), want %d", resp.StatusCode, body, http.StatusOK)
+		}
+
+		mt.AddMockResponses(tokenVersionResponse(userID))
+		if resp, _ := request(mt.T, s, http.MethodPost, "/logout", token, nil); resp.StatusCode != http.StatusUnauthorized {
+			mt.Errorf("status with the logged out token = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+
+		// Other tokens of the user still work
+		mt.AddMockResponses(tokenVersionResponse(userID))
+		if resp, _ := request(mt.T, s, http.MethodPost, "/logout", other, nil); resp.StatusCode != http.StatusOK {
+			mt.Errorf("status with another token = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+func TestMetricsRequireToken(t *testing.T) {
+	config := DefaultWebServerConfig()
+	config.JWTSecret = "secret"
+	s, err := NewWebServer(config, nil, &log.Logger{SugaredLogger: zap.NewNop().Sugar()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetupRoutes()
+
+	for name, authorization := range map[string]string{
+		"no token":      "",
+		"invalid token": "Bearer not-a-token",
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/metrics", nil)
+			if authorization != "" {
+				req.Header.Set(fiber.HeaderAuthorization, authorization)
+			}
+			resp, err := s.app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSendOutputFileCompressed(t *testing.T) {
+	content := strings.Repeat("splat ", 1000)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(content))
+	zw.Close()
+	path := filepath.Join(t.TempDir(), "splat_cloud.ply.gz")
+	if err := os.WriteFile(path, compressed.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(WebServerConfig{})
+	app := fiber.New()
+	app.Get("/file", func(c *fiber.Ctx) error {
+		return s.sendOutputFile(c, path)
+	})
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		body           string
+		encoding       string
+	}{
+		{"sent as stored", "gzip, deflate", compressed.String(), "gzip"},
+		{"decompressed", "", content, ""},
+		{"gzip refused", "gzip;q=0", content, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/file", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set(fiber.HeaderAcceptEncoding, tt.acceptEncoding)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != http.StatusOK || string(body) != tt.body {
+				t.Errorf("got %d with a %d byte body, want 200 with %d bytes", resp.StatusCode, len(body), len(tt.body))
+			}
+			if got := resp.Header.Get(fiber.HeaderContentEncoding); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+		})
+	}
+}
+
+// nopCloser counts how often it was closed.
+type nopCloser struct {
+	closed int
+}
+
+func (c *nopCloser) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestDownloadStreamRecordsCompleteSends(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		read     int64
+		recorded int64
+	}{
+		{"known size sent", 10, 10, 10},
+		{"unknown size read to EOF", -1, 100, 10},
+		{"interrupted", 10, 4, 0},
+		{"unknown size interrupted", -1, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded := int64(0)
+			closer := &nopCloser{}
+			stream := &downloadStream{
+				Reader: strings.NewReader("0123456789"),
+				closer: closer,
+				size:   tt.size,
+				record: func(n int64) { recorded += n },
+			}
+
+			io.CopyN(io.Discard, stream, tt.read)
+			stream.Close()
+
+			if recorded != tt.recorded {
+				t.Errorf("recorded %d bytes, want %d", recorded, tt.recorded)
+			}
+			if closer.closed != 1 {
+				t.Errorf("closed %d times, want once", closer.closed)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// This file contains the rate limiting of the account routes, which slows down credential stuffing and mass
+// registration. Attempts are counted per key (i.e a client IP, or a username) in fixed windows; once a key used up
+// its attempts, further requests are rejected with 429 until its window ends.
+//
+// Limiters implement the RateLimiter interface, so the in-memory MemoryRateLimiter, which only counts the attempts
+// made to a single server, can be replaced by one shared between servers (i.e backed by Redis).
+
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// rateLimitPruneSize is the number of tracked keys above which expired windows are dropped.
+const rateLimitPruneSize = 4096
+
+// RateLimiter limits the number of attempts made per key.
+type RateLimiter interface {
+	// Allow counts an attempt for key.
+	//
+	// Returns true if the attempt is allowed, or false and how long until the key may try again if it is not.
+	Allow(ctx context.Context, key string) (bool, time.Duration, error)
+}
+
+// rateWindow is the tracked state of a single key.
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// MemoryRateLimiter is a RateLimiter counting attempts in memory, in fixed windows.
+type MemoryRateLimiter struct {
+	limit   int
+	window  time.Duration
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+// NewMemoryRateLimiter creates a MemoryRateLimiter allowing limit attempts per key in each window.
+// A limit of 0 allows every attempt.
+func NewMemoryRateLimiter(limit int, window time.Duration) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*rateWindow),
+	}
+}
+
+// Allow counts an attempt for key. See RateLimiter.
+func (l *MemoryRateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	if l.limit <= 0 {
+		return true, 0, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.windows) >= rateLimitPruneSize {
+		l.prune(now)
+	}
+
+	window, ok := l.windows[key]
+	if !ok || now.Sub(window.start) >= l.window {
+		window = &rateWindow{start: now}
+		l.windows[key] = window
+	}
+	if window.count >= l.limit {
+		return false, window.start.Add(l.window).Sub(now), nil
+	}
+	window.count++
+	return true, 0, nil
+}
+
+// prune drops keys whose window has ended. The caller must hold l.mu.
+func (l *MemoryRateLimiter) prune(now time.Time) {
+	for key, window := range l.windows {
+		if now.Sub(window.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// rateLimited is a middleware limiting the attempts made to a route with the AuthRateLimiter. Every key returned
+// by keys is counted, and the request is rejected with 429 and a Retry-After header if any of them is over the limit.
+// If the limiter fails, the request is let through rather than locking everyone out.
+func (s *WebServer) rateLimited(keys func(c *fiber.Ctx) []string, handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if s.rateLimiter == nil {
+			return handler(c)
+		}
+
+		for _, key := range keys(c) {
+			allowed, retryAfter, err := s.rateLimiter.Allow(c.Context(), key)
+			if err != nil {
+				s.logFor(c).Error("Rate limiter failed: ", err.Error())
+				break
+			}
+			if !allowed {
+				s.logFor(c).Infof("Rate limit exceeded for %s", key)
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+				return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{
+					"error":       "Too many attempts, try again later",
+					"retry_after": seconds,
+				})
+			}
+		}
+		return handler(c)
+	}
+}
+
+// loginRateLimitKeys returns the rate limit keys of a login request: the client IP, and the username logged in to,
+// so guessing the password of one account is limited even when spread over many IPs.
+func loginRateLimitKeys(c *fiber.Ctx) []string {
+	keys := []string{"login:ip:" + c.IP()}
+
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err == nil && req.Username != "" {
+		keys = append(keys, "login:user:"+req.Username)
+	}
+	return keys
+}
+
+// registerRateLimitKeys returns the rate limit keys of a registration request: the client IP.
+func registerRateLimitKeys(c *fiber.Ctx) []string {
+	return []string{"register:ip:" + c.IP()}
+}
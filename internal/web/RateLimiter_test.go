@@ -0,0 +1,98 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMemoryRateLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewMemoryRateLimiter(2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, err := limiter.Allow(ctx, "a"); err != nil || !allowed {
+			t.Fatalf("attempt %d: Allow() = %v, %v, want allowed", i+1, allowed, err)
+		}
+	}
+	allowed, retryAfter, err := limiter.Allow(ctx, "a")
+	if err != nil || allowed {
+		t.Fatalf("Allow() = %v, %v, want refused over the limit", allowed, err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("retry after %v, want within the window", retryAfter)
+	}
+
+	// Keys are counted separately
+	if allowed, _, _ := limiter.Allow(ctx, "b"); !allowed {
+		t.Error("Allow() refused another key")
+	}
+}
+
+func TestMemoryRateLimiterWindowEnds(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewMemoryRateLimiter(1, 20*time.Millisecond)
+
+	limiter.Allow(ctx, "a")
+	if allowed, _, _ := limiter.Allow(ctx, "a"); allowed {
+		t.Fatal("Allow() allowed an attempt over the limit")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if allowed, _, _ := limiter.Allow(ctx, "a"); !allowed {
+		t.Error("Allow() refused an attempt in a new window")
+	}
+}
+
+func TestMemoryRateLimiterDisabled(t *testing.T) {
+	limiter := NewMemoryRateLimiter(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		if allowed, _, _ := limiter.Allow(context.Background(), "a"); !allowed {
+			t.Fatalf("attempt %d refused with the limit disabled", i+1)
+		}
+	}
+}
+
+func TestRateLimitedLimitsEachUsername(t *testing.T) {
+	s := newTestServer(DefaultWebServerConfig())
+	s.rateLimiter = NewMemoryRateLimiter(2, time.Minute)
+
+	app := fiber.New(fiber.Config{ProxyHeader: fiber.HeaderXForwardedFor})
+	app.Post("/login", s.rateLimited(loginRateLimitKeys, func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	}))
+
+	login := func(username, ip string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username": "`+username+`"}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderXForwardedFor, ip)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Attempts on one account are limited even from different IPs
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if resp := login("alice", ip); resp.StatusCode != http.StatusOK {
+			t.Fatalf("got %d, want 200", resp.StatusCode)
+		}
+	}
+	resp := login("alice", "10.0.0.3")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("got %d, want 429", resp.StatusCode)
+	}
+	if resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Error("missing Retry-After header")
+	}
+
+	if resp := login("bob", "10.0.0.4"); resp.StatusCode != http.StatusOK {
+		t.Errorf("got %d for another account, want 200", resp.StatusCode)
+	}
+}
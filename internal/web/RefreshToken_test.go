@@ -0,0 +1,157 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+// tokenResponse is the body of a response issuing tokens.
+type tokenResponse struct {
+	JWTToken     string `json:"jwtToken"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// okResponse returns a mocked successful write command response.
+func okResponse() bson.D {
+	return bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}}
+}
+
+// refreshTokenRecord returns a stored refresh token of the user in the given family, valid for an hour.
+func refreshTokenRecord(userID, familyID primitive.ObjectID, token string, used bool) bson.D {
+	sum := sha256.Sum256([]byte(token))
+	return bson.D{
+		{Key: "_id", Value: hex.EncodeToString(sum[:])},
+		{Key: "user_id", Value: userID},
+		{Key: "family_id", Value: familyID},
+		{Key: "token_version", Value: 0},
+		{Key: "expires_at", Value: time.Now().Add(time.Hour)},
+		{Key: "used", Value: used},
+		{Key: "revoked", Value: false},
+	}
+}
+
+// decodeTokens decodes the tokens issued by a response.
+func decodeTokens(mt *mtest.T, body string) tokenResponse {
+	mt.Helper()
+	var tokens tokenResponse
+	if err := json.Unmarshal([]byte(body), &tokens); err != nil || tokens.JWTToken == "" || tokens.RefreshToken == "" {
+		mt.Fatalf("response %s does not issue tokens", body)
+	}
+	return tokens
+}
+
+// lookedUpRefreshToken returns the refresh token hash the rotation command looked up.
+func lookedUpRefreshToken(mt *mtest.T) string {
+	mt.Helper()
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == "findAndModify" {
+			return event.Command.Lookup("query", "_id").StringValue()
+		}
+	}
+	mt.Fatal("refresh token was not rotated")
+	return ""
+}
+
+func TestLoginRefreshCycle(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	encoded, err := bcrypt.GenerateFromPassword([]byte("password 1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mt.Run("login, refresh, access", func(mt *mtest.T) {
+		userID := primitive.NewObjectID()
+		userDoc := bson.D{{Key: "_id", Value: userID}, {Key: "username", Value: "alice"}, {Key: "encrypted_password", Value: string(encoded)}}
+		userResponse := mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch, userDoc)
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		// Login: lockout check, password check, lockout reset, refresh token issue, token claims
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "nerfdb.login_failures", mtest.FirstBatch),
+			userResponse,
+			okResponse(),
+			userResponse,
+			okResponse(),
+			userResponse,
+		)
+		resp, body := request(mt.T, s, http.MethodPost, "/user/account/login", "", strings.NewReader(`{"username":"alice","password":"password 1"}`))
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("login status = %d (%s), want %d", resp.StatusCode, body, http.StatusOK)
+		}
+		login := decodeTokens(mt, body)
+		claims := jwt.MapClaims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(login.JWTToken, claims); err != nil {
+			mt.Fatal(err)
+		}
+		familyID, err := primitive.ObjectIDFromHex(claims["sid"].(string))
+		if err != nil {
+			mt.Fatalf("token session %v: %v", claims["sid"], err)
+		}
+
+		// Refresh: the login's refresh token is consumed, and a new one issued in the same session
+		mt.ClearEvents()
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: refreshTokenRecord(userID, familyID, login.RefreshToken, false)}},
+			okResponse(),
+			userResponse,
+			userResponse,
+		)
+		resp, body = request(mt.T, s, http.MethodPost, "/refresh", "", strings.NewReader(`{"refresh_token":"`+login.RefreshToken+`"}`))
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("refresh status = %d (%s), want %d", resp.StatusCode, body, http.StatusOK)
+		}
+		sum := sha256.Sum256([]byte(login.RefreshToken))
+		if hash := lookedUpRefreshToken(mt); hash != hex.EncodeToString(sum[:]) {
+			mt.Errorf("rotated refresh token %s, want the login's", hash)
+		}
+		refreshed := decodeTokens(mt, body)
+		if refreshed.RefreshToken == login.RefreshToken {
+			mt.Error("refresh did not rotate the refresh token")
+		}
+
+		// Access with the refreshed token
+		mt.AddMockResponses(userResponse, mtest.CreateCursorResponse(0, "nerfdb.refresh_tokens", mtest.FirstBatch))
+		if resp, body := request(mt.T, s, http.MethodGet, "/user/sessions", refreshed.JWTToken, nil); resp.StatusCode != http.StatusOK {
+			mt.Errorf("access status = %d (%s), want %d", resp.StatusCode, body, http.StatusOK)
+		}
+	})
+
+	mt.Run("reused after rotation", func(mt *mtest.T) {
+		userID, familyID := primitive.NewObjectID(), primitive.NewObjectID()
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		// The token is no longer unused, so it is looked up to find out why, and its family revoked
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			mtest.CreateCursorResponse(0, "nerfdb.refresh_tokens", mtest.FirstBatch, refreshTokenRecord(userID, familyID, "rotated", true)),
+			okResponse(),
+		)
+		resp, body := request(mt.T, s, http.MethodPost, "/refresh", "", strings.NewReader(`{"refresh_token":"rotated"}`))
+		if resp.StatusCode != http.StatusUnauthorized {
+			mt.Fatalf("status = %d (%s), want %d", resp.StatusCode, body, http.StatusUnauthorized)
+		}
+
+		events := mt.GetAllStartedEvents()
+		revoke := events[len(events)-1]
+		if revoke.CommandName != "update" {
+			mt.Fatalf("last command %s, want the family revocation", revoke.CommandName)
+		}
+		update := revoke.Command.Lookup("updates").Array().Index(0).Value().Document()
+		if revoked := update.Lookup("q", "family_id").ObjectID(); revoked != familyID {
+			mt.Errorf("revoked family %s, want %s", revoked.Hex(), familyID.Hex())
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestRegisterDuplicateUsername(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("registered at once", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		// The username is free when checked, but the unique index rejects it as another user registered it meanwhile
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "E11000 duplicate key error"}),
+		)
+		body := strings.NewReader(`{"username":"alice","password":"Correct-Horse-Battery-9"}`)
+		resp, respBody := request(mt.T, s, http.MethodPost, "/user/account/register", "", body)
+		if resp.StatusCode != http.StatusConflict {
+			mt.Fatalf("status = %d, want 409: %s", resp.StatusCode, respBody)
+		}
+		if strings.Contains(respBody, "E11000") {
+			mt.Errorf("database error was sent to the client: %s", respBody)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestRenameScene(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID, sceneID := primitive.NewObjectID(), primitive.NewObjectID()
+	target := "/data/scene/name/" + sceneID.Hex()
+
+	invalid := map[string]struct {
+		target, body string
+	}{
+		"missing name":   {target, `{}`},
+		"empty name":     {target, `{"scene_name":""}`},
+		"name too long":  {target, `{"scene_name":"` + strings.Repeat("x", 129) + `"}`},
+		"short scene ID": {"/data/scene/name/1234", `{"scene_name":"garden"}`},
+		"not hex":        {"/data/scene/name/" + strings.Repeat("z", 24), `{"scene_name":"garden"}`},
+	}
+	for name, tt := range invalid {
+		mt.Run(name, func(mt *mtest.T) {
+			s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+			mt.AddMockResponses(tokenVersionResponse(userID))
+			resp, body := request(mt.T, s, http.MethodPatch, tt.target, bearerToken(mt, s, userID), strings.NewReader(tt.body))
+			if resp.StatusCode != http.StatusBadRequest {
+				mt.Fatalf("status = %d, want 400: %s", resp.StatusCode, body)
+			}
+			if events := mt.GetAllStartedEvents(); len(events) != 1 {
+				mt.Errorf("got %d commands, want only the token checked", len(events))
+			}
+		})
+	}
+
+	mt.Run("owner", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneID),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}},
+		)
+		resp, body := request(mt.T, s, http.MethodPatch, target, bearerToken(mt, s, userID), strings.NewReader(`{"scene_name":"garden"}`))
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+		events := mt.GetAllStartedEvents()
+		update := events[len(events)-1].Command.Lookup("updates").Array().Index(0).Value().Document()
+		if got := update.Lookup("u", "$set", "name").StringValue(); got != "garden" {
+			mt.Errorf("name set to %q, want garden", got)
+		}
+		if upsert, ok := update.Lookup("upsert").BooleanOK(); ok && upsert {
+			mt.Error("renaming a scene upserts it")
+		}
+	})
+
+	mt.Run("not owner", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		otherID := primitive.NewObjectID()
+
+		mt.AddMockResponses(tokenVersionResponse(otherID), userResponse(otherID))
+		resp, body := request(mt.T, s, http.MethodPatch, target, bearerToken(mt, s, otherID), strings.NewReader(`{"scene_name":"mine"}`))
+		if resp.StatusCode != http.StatusNotFound {
+			mt.Fatalf("status = %d, want 404: %s", resp.StatusCode, body)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "update" {
+				mt.Errorf("scene of another user was renamed: %s", event.Command)
+			}
+		}
+	})
+
+	mt.Run("missing scene", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		// The scene is still listed by its owner, but no longer exists (or is in the trash)
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneID),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+		)
+		resp, body := request(mt.T, s, http.MethodPatch, target, bearerToken(mt, s, userID), strings.NewReader(`{"scene_name":"garden"}`))
+		if resp.StatusCode != http.StatusNotFound {
+			mt.Fatalf("status = %d, want 404: %s", resp.StatusCode, body)
+		}
+	})
+}
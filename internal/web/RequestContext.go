@@ -0,0 +1,34 @@
+// This file contains the request context, passed by the handlers to the ClientService so database operations of a
+// request are aborted once it is no longer waited for.
+//
+// fasthttp does not report clients that disconnect while a handler runs, so a request's context is cancelled when
+// its handler returns, or when the server shuts down without the request finishing within the ShutdownTimeout.
+// Streamed responses (see fasthttp's SetBodyStreamWriter) are written after their handler returned, and must not
+// use the request context.
+//
+// The request context also carries the request's ID as the `request_id` log field (see log.ContextWithFields).
+
+package web
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// requestContext is a middleware setting the user context of each request (see fiber.Ctx.UserContext) to a context
+// cancelled once the request is handled, or the server shut down, and carrying the request's ID. The request's
+// logger (see logFor) is created from it.
+func (s *WebServer) requestContext(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(s.requestsCtx)
+	defer cancel()
+
+	if id, ok := c.Locals("requestID").(string); ok {
+		ctx = log.ContextWithFields(ctx, "request_id", id)
+	}
+	c.SetUserContext(ctx)
+	c.Locals("logger", s.logger.WithContext(ctx))
+	return c.Next()
+}
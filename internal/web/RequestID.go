@@ -0,0 +1,68 @@
+// This file contains the request ID, which correlates the log entries of a request. Each request is given an ID,
+// stored in its locals, sent back in the X-Request-ID header, and added as the `request_id` field to the entries of
+// the request's logger (see logFor).
+//
+// A request ID sent by the client (i.e by a proxy in front of the server) is kept, as long as it is short and plain,
+// so a request can be followed across services.
+
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// HeaderRequestID is the request and response header carrying the ID of a request.
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength is the longest request ID accepted from clients.
+const maxRequestIDLength = 64
+
+// requestID is a middleware giving each request an ID, stored in the "requestID" local and echoed in the
+// X-Request-ID response header.
+func (s *WebServer) requestID(c *fiber.Ctx) error {
+	id := c.Get(HeaderRequestID)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	c.Locals("requestID", id)
+	c.Set(HeaderRequestID, id)
+	return c.Next()
+}
+
+// logFor returns the logger of the request, adding its request_id to all entries. Stream writers run after the
+// request is handled, and must use s.logger instead.
+func (s *WebServer) logFor(c *fiber.Ctx) *log.Logger {
+	if logger, ok := c.Locals("logger").(*log.Logger); ok {
+		return logger
+	}
+	return s.logger
+}
+
+// validRequestID checks if a client supplied request ID is non-empty, at most maxRequestIDLength long, and only holds
+// letters, digits, '-', '_' and '.'.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		// Requests are still served without an ID
+		return "unknown"
+	}
+	return hex.EncodeToString(raw)
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := map[string]bool{
+		"abc-123_DEF.4": true,
+		"":              false,
+		"with space":    false,
+		"new\nline":     false,
+		"quote\"":       false,
+		"ünicode":       false,
+		"semi;colon":    false,
+	}
+	tests[strings.Repeat("a", maxRequestIDLength)] = true
+	tests[strings.Repeat("a", maxRequestIDLength+1)] = false
+	for id, want := range tests {
+		if got := validRequestID(id); got != want {
+			t.Errorf("validRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	s := newTestServer(WebServerConfig{})
+	app := fiber.New()
+	app.Use(s.requestID, s.requestContext)
+
+	// The handler reports the request ID carried by the request's context
+	app.Get("/", func(c *fiber.Ctx) error {
+		fields := log.FieldsFromContext(c.UserContext())
+		if len(fields) != 2 || fields[0] != "request_id" {
+			return c.SendString("")
+		}
+		return c.SendString(fields[1].(string))
+	})
+
+	tests := []struct {
+		name string
+		sent string
+		kept bool
+	}{
+		{"client ID kept", "proxy-42.abc", true},
+		{"no client ID", "", false},
+		{"invalid client ID replaced", "bad id\r\n", false},
+		{"long client ID replaced", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			if tt.sent != "" {
+				req.Header.Set(HeaderRequestID, tt.sent)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id := resp.Header.Get(HeaderRequestID)
+			if tt.kept && id != tt.sent {
+				t.Errorf("response ID = %q, want %q", id, tt.sent)
+			}
+			if !tt.kept && (id == tt.sent || !validRequestID(id)) {
+				t.Errorf("response ID = %q, want a new ID", id)
+			}
+
+			if logged, _ := io.ReadAll(resp.Body); string(logged) != id {
+				t.Errorf("request_id log field = %q, want %q", logged, id)
+			}
+		})
+	}
+}
@@ -5,9 +5,16 @@
 package web
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -17,14 +24,42 @@ import (
 
 var validate *validator.Validate
 
+// HeaderUploadID is the request header a client uses to tag a new scene upload, so its progress can be followed.
+const HeaderUploadID = "X-Upload-ID"
+
+// HeaderIdempotencyKey is the request header a client uses to make a new scene upload safe to retry.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// ErrFileTooLarge is returned when an uploaded video is larger than the configured maximum file size.
+var ErrFileTooLarge = errors.New("file too large")
+
+// Supported video containers, as listed in UploadConfig.VideoFormats.
+const (
+    VideoFormatMP4 = "mp4"
+    VideoFormatMOV = "mov"
+    VideoFormatAVI = "avi"
+)
+
+// videoHeaderSize is the number of leading bytes of a video its container is detected from.
+const videoHeaderSize = 12
+
+// videoFormatExtensions maps each video file extension to its container.
+var videoFormatExtensions = map[string]string{
+    ".mp4": VideoFormatMP4,
+    ".m4v": VideoFormatMP4,
+    ".mov": VideoFormatMOV,
+    ".avi": VideoFormatAVI,
+}
+
 // Initialize the custom validator
 func init() {
     validate = validator.New()
     validate.RegisterValidation("validOutputType", validateOutputType)
+    validate.RegisterValidation("uploadID", validateUploadID)
 }
 
 // ValidateRequest validates a request using a Fiber context and a request struct.
-// It parses the request differently based on HTTP method.
+// It parses the request differently based on HTTP method. Path parameters are parsed for every method.
 func ValidateRequest(c *fiber.Ctx, req interface{}) error {
     // Check the HTTP method
     method := c.Method()
@@ -35,13 +70,13 @@ func ValidateRequest(c *fiber.Ctx, req interface{}) error {
         if err := c.QueryParser(req); err != nil {
             return err
         }
-        if err := c.ParamsParser(req); err != nil {
-            return err
-        }
-    case "POST", "PUT", "PATCH":
-        // For requests with potential body content
-        if err := c.BodyParser(req); err != nil {
-            return err
+    case "POST", "PUT", "PATCH", "DELETE":
+        // For requests with potential body content. Routes that only take path parameters
+        // may legitimately be sent without a body.
+        if len(c.Body()) > 0 {
+            if err := c.BodyParser(req); err != nil {
+                return err
+            }
         }
         // Also parse query parameters for these methods if needed
         if err := c.QueryParser(req); err != nil {
@@ -51,6 +86,10 @@ func ValidateRequest(c *fiber.Ctx, req interface{}) error {
         // Unsupported HTTP method
     }
 
+    if err := c.ParamsParser(req); err != nil {
+        return err
+    }
+
     return validate.Struct(req)
 }
 
@@ -59,8 +98,11 @@ func ValidateRequest(c *fiber.Ctx, req interface{}) error {
 // The default go-validator is not great with file uploads, so we need to handle the file upload here, and just 
 // redundantly validate the other form fields.
 //
-// Returns a NewSceneRequest struct if successful, error otherwise.
-func ParseNewSceneRequest(c *fiber.Ctx) (*NewSceneRequest, error) {
+// Mode specific rules from config, such as the minimum total iterations, are enforced after the generic validation.
+//
+// Returns a NewSceneRequest struct if successful, an error wrapping ErrFileTooLarge if the file is larger than
+// config.MaxFileSize, error otherwise.
+func ParseNewSceneRequest(c *fiber.Ctx, config UploadConfig) (*NewSceneRequest, error) {
     var req NewSceneRequest
 
     // Handle file upload
@@ -68,18 +110,26 @@ func ParseNewSceneRequest(c *fiber.Ctx) (*NewSceneRequest, error) {
     if err != nil {
         return nil, errors.New("file upload error: " + err.Error())
     }
+    if config.MaxFileSize > 0 && file.Size > config.MaxFileSize {
+        return nil, fmt.Errorf("%w: %d bytes, the maximum is %d bytes", ErrFileTooLarge, file.Size, config.MaxFileSize)
+    }
+    if err := validateVideoFormat(file, config.VideoFormats); err != nil {
+        return nil, err
+    }
     req.File = file
 
     // Parse other form fields
     req.TrainingMode = c.FormValue("training_mode")
     req.SceneName = c.FormValue("scene_name")
+    req.UploadID = c.Get(HeaderUploadID)
+    req.IdempotencyKey = c.Get(HeaderIdempotencyKey)
 
     // Parse total iterations
     totalIterationsStr := c.FormValue("total_iterations")
     if totalIterationsStr != "" {
-        totalIterations, err := strconv.Atoi(totalIterationsStr)
+        totalIterations, err := parseBoundedInt("total_iterations", totalIterationsStr, 1, config.MaxIterations)
         if err != nil {
-            return nil, errors.New("invalid total iterations")
+            return nil, err
         }
         req.TotalIterations = totalIterations
     }
@@ -90,15 +140,36 @@ func ParseNewSceneRequest(c *fiber.Ctx) (*NewSceneRequest, error) {
         req.OutputTypes = strings.Split(outputTypesStr, ",")
     }
 
+    // Parse tags
+    req.Tags = parseTags(c.FormValue("tags"))
+
+    // Parse sfm only flag
+    if sfmOnlyStr := c.FormValue("sfm_only"); sfmOnlyStr != "" {
+        sfmOnly, err := strconv.ParseBool(sfmOnlyStr)
+        if err != nil {
+            return nil, errors.New("sfm_only must be a boolean")
+        }
+        req.SfmOnly = sfmOnly
+    }
+
+    // Parse downscale flag
+    if downscaleStr := c.FormValue("downscale"); downscaleStr != "" {
+        downscale, err := strconv.ParseBool(downscaleStr)
+        if err != nil {
+            return nil, errors.New("downscale must be a boolean")
+        }
+        req.Downscale = downscale
+    }
+
     // Parse save iterations
     saveIterationsStr := c.FormValue("save_iterations")
     if saveIterationsStr != "" {
         saveIterationsSlice := strings.Split(saveIterationsStr, ",")
         req.SaveIterations = make([]int, len(saveIterationsSlice))
         for i, s := range saveIterationsSlice {
-            val, err := strconv.Atoi(strings.TrimSpace(s))
+            val, err := parseBoundedInt("save_iterations", strings.TrimSpace(s), 1, config.MaxIterations)
             if err != nil {
-                return nil, errors.New("invalid save iterations")
+                return nil, err
             }
             req.SaveIterations[i] = val
         }
@@ -109,12 +180,262 @@ func ParseNewSceneRequest(c *fiber.Ctx) (*NewSceneRequest, error) {
         return nil, err
     }
 
+    // SfM only scenes are not trained, so their training fields are ignored
+    if !req.SfmOnly {
+        if err := validateMinIterations(req.TrainingMode, req.TotalIterations, config); err != nil {
+            return nil, err
+        }
+    }
+
+    return &req, nil
+}
+
+// ParseInitChunkedUploadRequest parses and validates the JSON body of a chunked upload init request. The declared
+// file is checked the same way as a video uploaded to /user/scene/new, except for its content, which is only checked
+// once its first chunk is received.
+//
+// Returns an InitChunkedUploadRequest if successful, an error wrapping ErrFileTooLarge if the declared size is larger
+// than the maximum file size, or another error if the request is invalid.
+func ParseInitChunkedUploadRequest(c *fiber.Ctx, config UploadConfig) (*InitChunkedUploadRequest, error) {
+    var req InitChunkedUploadRequest
+    if err := ValidateRequest(c, &req); err != nil {
+        return nil, err
+    }
+
+    if config.MaxFileSize > 0 && req.Size > config.MaxFileSize {
+        return nil, fmt.Errorf("%w: %d bytes, the maximum is %d bytes", ErrFileTooLarge, req.Size, config.MaxFileSize)
+    }
+    if _, err := validateVideoExtension(req.Filename, config.VideoFormats); err != nil {
+        return nil, err
+    }
+
+    if !req.SfmOnly {
+        if err := validateJSONIterations(req.TrainingMode, req.TotalIterations, req.SaveIterations, config); err != nil {
+            return nil, err
+        }
+    }
+
+    req.Tags = normalizeTags(req.Tags)
     return &req, nil
 }
 
+// ParseEstimateStorageRequest parses and validates the JSON body of a storage estimate request. The training fields
+// are checked the same way as those of a chunked upload init request.
+//
+// Returns an EstimateStorageRequest if successful, or an error if the request is invalid.
+func ParseEstimateStorageRequest(c *fiber.Ctx, config UploadConfig) (*EstimateStorageRequest, error) {
+    var req EstimateStorageRequest
+    if err := ValidateRequest(c, &req); err != nil {
+        return nil, err
+    }
+
+    if err := validateJSONIterations(req.TrainingMode, req.TotalIterations, req.SaveIterations, config); err != nil {
+        return nil, err
+    }
+
+    return &req, nil
+}
+
+// validateJSONIterations checks the iterations of a JSON request against the configured bounds. Form requests check
+// the upper bound while parsing the values instead.
+func validateJSONIterations(trainingMode string, totalIterations int, saveIterations []int, config UploadConfig) error {
+    if totalIterations > config.MaxIterations {
+        return fmt.Errorf("total_iterations must be an integer between 1 and %d", config.MaxIterations)
+    }
+    for _, iteration := range saveIterations {
+        if iteration > config.MaxIterations {
+            return fmt.Errorf("save_iterations must be an integer between 1 and %d", config.MaxIterations)
+        }
+    }
+    return validateMinIterations(trainingMode, totalIterations, config)
+}
+
+// ParseContentRange parses a `Content-Range: bytes <start>-<end>/<total>` header, as sent with each chunk of a
+// chunked upload.
+//
+// Returns the offset and length of the chunk and the total size, or an error if the header is malformed.
+func ParseContentRange(header string) (int64, int64, int64, error) {
+    malformed := errors.New("invalid Content-Range: expected bytes <start>-<end>/<total>")
+
+    rangeSpec, ok := strings.CutPrefix(header, "bytes ")
+    if !ok {
+        return 0, 0, 0, malformed
+    }
+    byteRange, totalStr, ok := strings.Cut(rangeSpec, "/")
+    if !ok {
+        return 0, 0, 0, malformed
+    }
+    startStr, endStr, ok := strings.Cut(byteRange, "-")
+    if !ok {
+        return 0, 0, 0, malformed
+    }
+
+    start, err := strconv.ParseInt(startStr, 10, 64)
+    if err != nil || start < 0 {
+        return 0, 0, 0, malformed
+    }
+    end, err := strconv.ParseInt(endStr, 10, 64)
+    if err != nil || end < start {
+        return 0, 0, 0, malformed
+    }
+    total, err := strconv.ParseInt(totalStr, 10, 64)
+    if err != nil || total <= end {
+        return 0, 0, 0, malformed
+    }
+    return start, end - start + 1, total, nil
+}
+
+// validateVideoFormat checks that the uploaded file is a video in one of the accepted formats, by its extension and
+// by sniffing its first bytes, so files that are not videos are rejected before they reach the workers.
+func validateVideoFormat(file *multipart.FileHeader, formats []string) error {
+    extFormat, err := validateVideoExtension(file.Filename, formats)
+    if err != nil {
+        return err
+    }
+
+    src, err := file.Open()
+    if err != nil {
+        return errors.New("file upload error: " + err.Error())
+    }
+    defer src.Close()
+
+    header := make([]byte, videoHeaderSize)
+    n, err := io.ReadFull(src, header)
+    if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+        return errors.New("file content is not a supported video")
+    }
+    return validateVideoContent(header[:n], extFormat, formats)
+}
+
+// validateVideoExtension checks that filename has the extension of one of the accepted formats.
+//
+// Returns the format of the extension if it is accepted, error otherwise.
+func validateVideoExtension(filename string, formats []string) (string, error) {
+    ext := strings.ToLower(filepath.Ext(filename))
+    extFormat, ok := videoFormatExtensions[ext]
+    if !ok || !slices.Contains(formats, extFormat) {
+        return "", fmt.Errorf("unsupported video file extension %q, accepted formats are %s", ext, strings.Join(formats, ", "))
+    }
+    return extFormat, nil
+}
+
+// validateVideoContent checks that the first bytes of a video match an accepted format, and the format of its
+// extension. mp4 and mov share a container, and are often mislabeled as each other, so either extension is accepted
+// for both.
+func validateVideoContent(header []byte, extFormat string, formats []string) error {
+    format := sniffVideoFormat(header)
+    isoFormats := []string{VideoFormatMP4, VideoFormatMOV}
+    if format == "" || !slices.Contains(formats, format) ||
+        (format != extFormat && !(slices.Contains(isoFormats, format) && slices.Contains(isoFormats, extFormat))) {
+        return fmt.Errorf("file content is not a supported video, accepted formats are %s", strings.Join(formats, ", "))
+    }
+    return nil
+}
+
+// sniffVideoFormat detects the video container from the first bytes of a file. Returns "" if it is not recognized.
+func sniffVideoFormat(header []byte) string {
+    if len(header) < videoHeaderSize {
+        return ""
+    }
+    switch {
+    case bytes.Equal(header[4:8], []byte("ftyp")):
+        // ISO base media file, the brand tells QuickTime apart from mp4
+        if bytes.Equal(header[8:12], []byte("qt  ")) {
+            return VideoFormatMOV
+        }
+        return VideoFormatMP4
+    case bytes.Equal(header[4:8], []byte("moov")), bytes.Equal(header[4:8], []byte("mdat")),
+        bytes.Equal(header[4:8], []byte("wide")), bytes.Equal(header[4:8], []byte("free")):
+        // Older QuickTime files start with an atom other than ftyp
+        return VideoFormatMOV
+    case bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("AVI ")):
+        return VideoFormatAVI
+    default:
+        return ""
+    }
+}
+
+// parseBoundedInt parses value as a base 10 integer within [min, max]. Decimals, exponents and values that
+// overflow are rejected rather than rounded, so a value is never silently changed.
+func parseBoundedInt(name, value string, min, max int) (int, error) {
+    parsed, err := strconv.ParseInt(value, 10, 64)
+    if err != nil || parsed < int64(min) || parsed > int64(max) {
+        return 0, fmt.Errorf("%s must be an integer between %d and %d", name, min, max)
+    }
+    return int(parsed), nil
+}
+
+// parseTags parses a comma separated list of tags. Tags are trimmed and lowercased; empty and duplicate tags are dropped.
+func parseTags(tagsStr string) []string {
+    return normalizeTags(strings.Split(tagsStr, ","))
+}
+
+// normalizeTags trims and lowercases tags, dropping empty and duplicate tags.
+func normalizeTags(rawTags []string) []string {
+    tags := make([]string, 0)
+    seen := make(map[string]bool)
+    for _, tag := range rawTags {
+        tag = strings.ToLower(strings.TrimSpace(tag))
+        if tag == "" || seen[tag] {
+            continue
+        }
+        seen[tag] = true
+        tags = append(tags, tag)
+    }
+    return tags
+}
+
+// validateMinIterations checks that the total iterations meet the configured floor for the training mode.
+func validateMinIterations(trainingMode string, totalIterations int, config UploadConfig) error {
+    minIterations, ok := config.MinTotalIterations[trainingMode]
+    if !ok || totalIterations >= minIterations {
+        return nil
+    }
+    return fmt.Errorf("total_iterations must be at least %d for %s training", minIterations, trainingMode)
+}
+
 // ValidateOutputType is a custom validator for output types in a VideoUploadRequest.
 func validateOutputType(fl validator.FieldLevel) bool {
     outputType := fl.Field().String()
     trainingMode := fl.Parent().FieldByName("TrainingMode").String()
     return scene.Nerf{}.IsValidOutputType(trainingMode, outputType)
-}
\ No newline at end of file
+}
+
+// validateUploadID is a custom validator for client chosen upload IDs. Only letters, digits, '-' and '_' are allowed.
+func validateUploadID(fl validator.FieldLevel) bool {
+    for _, r := range fl.Field().String() {
+        if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+            return false
+        }
+    }
+    return true
+}
+
+// ParseTimeRange parses optional RFC3339 `since` and `until` bounds. Empty strings are returned as nil bounds.
+//
+// Returns an error if either bound is malformed, or if since is after until.
+func ParseTimeRange(since, until string) (*time.Time, *time.Time, error) {
+    var sinceTime, untilTime *time.Time
+
+    if since != "" {
+        t, err := time.Parse(time.RFC3339, since)
+        if err != nil {
+            return nil, nil, errors.New("invalid since: expected RFC3339 timestamp")
+        }
+        sinceTime = &t
+    }
+
+    if until != "" {
+        t, err := time.Parse(time.RFC3339, until)
+        if err != nil {
+            return nil, nil, errors.New("invalid until: expected RFC3339 timestamp")
+        }
+        untilTime = &t
+    }
+
+    if sinceTime != nil && untilTime != nil && sinceTime.After(*untilTime) {
+        return nil, nil, errors.New("invalid range: since must not be after until")
+    }
+
+    return sinceTime, untilTime, nil
+}
@@ -0,0 +1,71 @@
+package web
+
+import "testing"
+
+func TestParseContentRange(t *testing.T) {
+	offset, length, total, err := ParseContentRange("bytes 100-199/1000")
+	if err != nil || offset != 100 || length != 100 || total != 1000 {
+		t.Errorf("ParseContentRange() = %d, %d, %d, %v, want 100, 100, 1000", offset, length, total, err)
+	}
+
+	for _, header := range []string{
+		"",
+		"bytes 100-199",
+		"bytes 199-100/1000",
+		"bytes 0-1000/1000",
+		"bytes -1-5/10",
+		"items 0-9/10",
+		"bytes 0-9/*",
+	} {
+		if _, _, _, err := ParseContentRange(header); err == nil {
+			t.Errorf("ParseContentRange(%q) succeeded, want an error", header)
+		}
+	}
+}
+
+func TestValidateVideoContent(t *testing.T) {
+	formats := []string{VideoFormatMP4, VideoFormatMOV}
+	mp4 := []byte("\x00\x00\x00\x20ftypisom")
+	mov := []byte("\x00\x00\x00\x14ftypqt  ")
+	avi := []byte("RIFF\x00\x00\x00\x00AVI ")
+
+	tests := []struct {
+		name      string
+		header    []byte
+		extFormat string
+		valid     bool
+	}{
+		{"mp4", mp4, VideoFormatMP4, true},
+		{"mov", mov, VideoFormatMOV, true},
+		{"mov labeled as mp4", mov, VideoFormatMP4, true},
+		{"old quicktime", []byte("\x00\x00\x00\x08wide\x00\x00\x00\x00"), VideoFormatMOV, true},
+		{"format not accepted", avi, VideoFormatAVI, false},
+		{"avi labeled as mp4", avi, VideoFormatMP4, false},
+		{"not a video", []byte("<html><body>"), VideoFormatMP4, false},
+		// The whole header is needed to tell the container
+		{"short header", mp4[:videoHeaderSize-1], VideoFormatMP4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateVideoContent(tt.header, tt.extFormat, formats)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateVideoContent() = %v, want valid: %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateVideoExtension(t *testing.T) {
+	formats := []string{VideoFormatMP4, VideoFormatMOV}
+
+	for filename, want := range map[string]string{"scene.mp4": VideoFormatMP4, "SCENE.M4V": VideoFormatMP4, "scene.mov": VideoFormatMOV} {
+		if got, err := validateVideoExtension(filename, formats); err != nil || got != want {
+			t.Errorf("validateVideoExtension(%q) = %q, %v, want %q", filename, got, err, want)
+		}
+	}
+	for _, filename := range []string{"scene.avi", "scene.mkv", "scene"} {
+		if _, err := validateVideoExtension(filename, formats); err == nil {
+			t.Errorf("validateVideoExtension(%q) succeeded, want an error", filename)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestRestoreScene(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID, sceneID := primitive.NewObjectID(), primitive.NewObjectID()
+	ok := bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}}
+
+	mt.Run("owner", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		// The trashed scene is no longer in the owner's scene list, its recorded owner is checked
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID),
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: sceneID},
+				{Key: "user_id", Value: userID},
+				{Key: "deleted_at", Value: time.Now()},
+			}),
+			ok,
+			ok,
+		)
+		resp, body := request(mt.T, s, http.MethodPost, "/data/scene/"+sceneID.Hex()+"/restore", bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+	})
+
+	mt.Run("not owner", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		otherID := primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			tokenVersionResponse(otherID),
+			userResponse(otherID),
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch),
+		)
+		resp, body := request(mt.T, s, http.MethodPost, "/data/scene/"+sceneID.Hex()+"/restore", bearerToken(mt, s, otherID), nil)
+		if resp.StatusCode != http.StatusNotFound {
+			mt.Fatalf("status = %d, want 404: %s", resp.StatusCode, body)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "find" && event.Command.Lookup("find").StringValue() == "scenes" {
+				if _, err := event.Command.LookupErr("filter", "$or"); err != nil {
+					mt.Errorf("scene was looked up without its owner: %s", event.Command)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+)
+
+// newRoutedServer returns a WebServer with the given config and its routes set up, without a ClientService, for
+// testing which routes match. JWT protected routes respond with 401 to requests without a token when they match.
+func newRoutedServer(t *testing.T, config WebServerConfig) *WebServer {
+	t.Helper()
+	config.JWTSecret = "secret"
+	s, err := NewWebServer(config, nil, &log.Logger{SugaredLogger: zap.NewNop().Sugar()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetupRoutes()
+	return s
+}
+
+func TestDisabledRoutes(t *testing.T) {
+	config := DefaultWebServerConfig()
+	config.DisabledRoutes = []string{"/user/scene/history", "DELETE /data/scene/:scene_id", "POST /user/account/register"}
+	s := newRoutedServer(t, config)
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		// Disabled for all methods
+		{http.MethodGet, "/user/scene/history", http.StatusNotFound},
+		// Disabled for one method only, the path still has other methods
+		{http.MethodDelete, "/data/scene/0123456789abcdef01234567", http.StatusMethodNotAllowed},
+		{http.MethodPatch, "/data/scene/0123456789abcdef01234567", http.StatusUnauthorized},
+		{http.MethodPost, "/user/account/register", http.StatusNotFound},
+		// Other routes are registered
+		{http.MethodGet, "/user/scene/metadata/0123456789abcdef01234567", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		resp, body := request(t, s, tt.method, tt.target, "", nil)
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s: status = %d, want %d: %s", tt.method, tt.target, resp.StatusCode, tt.want, body)
+		}
+	}
+}
+
+func TestRouteMatching(t *testing.T) {
+	const sceneID = "0123456789abcdef01234567"
+	tests := []struct {
+		name                  string
+		strict, caseSensitive bool
+		target                string
+		want                  int
+	}{
+		{"default", false, false, "/user/scene/history", http.StatusUnauthorized},
+		{"default trailing slash", false, false, "/user/scene/history/", http.StatusUnauthorized},
+		{"default case", false, false, "/User/Scene/History", http.StatusUnauthorized},
+		{"strict", true, false, "/user/scene/history", http.StatusUnauthorized},
+		{"strict trailing slash", true, false, "/user/scene/history/", http.StatusNotFound},
+		{"strict case", true, false, "/User/Scene/History", http.StatusUnauthorized},
+		{"case sensitive", false, true, "/user/scene/history", http.StatusUnauthorized},
+		{"case sensitive trailing slash", false, true, "/user/scene/history/", http.StatusUnauthorized},
+		{"case sensitive case", false, true, "/User/Scene/History", http.StatusNotFound},
+		// Path parameters match in any case, and are passed on as sent
+		{"case sensitive parameter", false, true, "/user/scene/metadata/" + strings.ToUpper(sceneID), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultWebServerConfig()
+			config.StrictRouting = tt.strict
+			config.CaseSensitiveRoutes = tt.caseSensitive
+			s := newRoutedServer(t, config)
+
+			resp, body := request(t, s, http.MethodGet, tt.target, "", nil)
+			if resp.StatusCode != tt.want {
+				t.Errorf("GET %s: status = %d, want %d: %s", tt.target, resp.StatusCode, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestRouteParametersKeepCase(t *testing.T) {
+	s := newRoutedServer(t, DefaultWebServerConfig())
+	var got string
+	s.app.Get("/echo/:value", func(c *fiber.Ctx) error {
+		got = c.Params("value")
+		return nil
+	})
+
+	request(t, s, http.MethodGet, "/Echo/MixedCase", "", nil)
+	if got != "MixedCase" {
+		t.Errorf("parameter = %q, want %q", got, "MixedCase")
+	}
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestOtherUsersSceneNotFound(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	otherID, sceneID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	routes := map[string]string{
+		"metadata":  "/user/scene/metadata/",
+		"thumbnail": "/user/scene/thumbnail/",
+		"name":      "/user/scene/name/",
+	}
+	for name, route := range routes {
+		mt.Run(name, func(mt *mtest.T) {
+			s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+			// The scene is only found if the user owns it or it is shared with them, which the mocked lookup is not
+			mt.AddMockResponses(
+				tokenVersionResponse(otherID),
+				userResponse(otherID),
+				mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch),
+			)
+			resp, body := request(mt.T, s, http.MethodGet, route+sceneID.Hex(), bearerToken(mt, s, otherID), nil)
+			if resp.StatusCode != http.StatusNotFound {
+				mt.Fatalf("status = %d, want 404: %s", resp.StatusCode, body)
+			}
+
+			var found bool
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName != "find" || event.Command.Lookup("find").StringValue() != "scenes" {
+					continue
+				}
+				found = true
+				owners, err := event.Command.LookupErr("filter", "$or")
+				if err != nil {
+					mt.Fatalf("scene was looked up without checking access: %s", event.Command)
+				}
+				values, _ := owners.Array().Values()
+				var byOwner, bySharing bool
+				for _, value := range values {
+					condition := value.Document()
+					if id, ok := condition.Lookup("user_id").ObjectIDOK(); ok && id == otherID {
+						byOwner = true
+					}
+					if id, ok := condition.Lookup("shared_with").ObjectIDOK(); ok && id == otherID {
+						bySharing = true
+					}
+				}
+				if !byOwner || !bySharing {
+					mt.Errorf("access is not checked against the requesting user: %s", owners)
+				}
+			}
+			if !found {
+				mt.Error("scene was not looked up")
+			}
+		})
+	}
+}
+
+func TestSharedUserCanOnlyRead(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	ownerID, sharedID, sceneID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("read", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		mt.AddMockResponses(
+			tokenVersionResponse(sharedID),
+			userResponse(sharedID),
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: sceneID},
+				{Key: "user_id", Value: ownerID},
+				{Key: "name", Value: "garden"},
+				{Key: "shared_with", Value: bson.A{sharedID}},
+			}),
+		)
+		resp, body := request(mt.T, s, http.MethodGet, "/user/scene/name/"+sceneID.Hex(), bearerToken(mt, s, sharedID), nil)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, "garden") {
+			mt.Fatalf("status = %d, want 200 with the scene name: %s", resp.StatusCode, body)
+		}
+	})
+
+	modifications := map[string]struct {
+		method, target, body string
+	}{
+		"rename":     {http.MethodPatch, "/data/scene/name/" + sceneID.Hex(), `{"scene_name":"mine"}`},
+		"delete":     {http.MethodDelete, "/data/scene/" + sceneID.Hex(), ""},
+		"share link": {http.MethodPost, "/data/scene/share-link/" + sceneID.Hex(), ""},
+		"share":      {http.MethodPost, "/data/scene/acl/" + sceneID.Hex(), `{"username":"mallory","action":"grant"}`},
+	}
+	for name, tt := range modifications {
+		mt.Run(name, func(mt *mtest.T) {
+			s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+			// The scene is shared with the user, but not in their scene list
+			mt.AddMockResponses(tokenVersionResponse(sharedID), userResponse(sharedID))
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			resp, respBody := request(mt.T, s, tt.method, tt.target, bearerToken(mt, s, sharedID), body)
+			if resp.StatusCode != http.StatusNotFound {
+				mt.Fatalf("status = %d, want 404: %s", resp.StatusCode, respBody)
+			}
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName != "find" || event.Command.Lookup("find").StringValue() != "users" {
+					mt.Errorf("scene was accessed by a user it is only shared with: %s", event.Command)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+// sceneCountResponse returns a mocked CountDocuments response counting n scenes.
+func sceneCountResponse(n int) bson.D {
+	return mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{{Key: "_id", Value: 1}, {Key: "n", Value: n}})
+}
+
+// historyPage is the response of the user scene history.
+type historyPage struct {
+	Resources []string `json:"resources"`
+	Total     int64    `json:"total"`
+	Limit     int      `json:"limit"`
+	Offset    int      `json:"offset"`
+	IsEmpty   bool     `json:"is_empty"`
+}
+
+func TestUserSceneHistoryPagination(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	sceneIDs := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+
+	for _, query := range []string{"limit=101", "limit=-1", "offset=-1", "limit=abc"} {
+		mt.Run(query, func(mt *mtest.T) {
+			s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+			mt.AddMockResponses(tokenVersionResponse(userID))
+			resp, body := request(mt.T, s, http.MethodGet, "/user/scene/history?"+query, bearerToken(mt, s, userID), nil)
+			if resp.StatusCode != http.StatusBadRequest {
+				mt.Fatalf("status = %d, want 400: %s", resp.StatusCode, body)
+			}
+			if events := mt.GetAllStartedEvents(); len(events) != 1 {
+				mt.Errorf("got %d commands, want only the token checked", len(events))
+			}
+		})
+	}
+
+	pages := map[string]struct {
+		query               string
+		wantLimit, wantSkip int64
+	}{
+		"default":       {"", defaultHistoryPageSize, 0},
+		"largest limit": {"?limit=100&offset=1", 100, 1},
+		"smallest":      {"?limit=1&offset=0", 1, 0},
+	}
+	for name, tt := range pages {
+		mt.Run(name, func(mt *mtest.T) {
+			s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+			mt.AddMockResponses(
+				tokenVersionResponse(userID),
+				userResponse(userID, sceneIDs...),
+				sceneCountResponse(len(sceneIDs)),
+				mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{{Key: "_id", Value: sceneIDs[tt.wantSkip]}}),
+				userResponse(userID, sceneIDs...),
+				sceneCountResponse(len(sceneIDs)),
+			)
+			resp, body := request(mt.T, s, http.MethodGet, "/user/scene/history"+tt.query, bearerToken(mt, s, userID), nil)
+			if resp.StatusCode != http.StatusOK {
+				mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+			}
+			var page historyPage
+			if err := json.Unmarshal([]byte(body), &page); err != nil {
+				mt.Fatal(err)
+			}
+			if page.Limit != int(tt.wantLimit) || page.Offset != int(tt.wantSkip) || page.Total != int64(len(sceneIDs)) {
+				mt.Errorf("page = %+v, want limit %d, offset %d and total %d", page, tt.wantLimit, tt.wantSkip, len(sceneIDs))
+			}
+
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName != "find" || event.Command.Lookup("find").StringValue() != "scenes" {
+					continue
+				}
+				if got := event.Command.Lookup("limit").AsInt64(); got != tt.wantLimit {
+					mt.Errorf("limit = %d, want %d", got, tt.wantLimit)
+				}
+				// The skip is left out for the first page
+				if skip, _ := event.Command.Lookup("skip").AsInt64OK(); skip != tt.wantSkip {
+					mt.Errorf("skip = %d, want %d", skip, tt.wantSkip)
+				}
+				return
+			}
+			mt.Fatal("history page was not looked up")
+		})
+	}
+
+	mt.Run("offset past the end", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			userResponse(userID, sceneIDs...),
+			sceneCountResponse(len(sceneIDs)),
+			userResponse(userID, sceneIDs...),
+			sceneCountResponse(len(sceneIDs)),
+		)
+		resp, body := request(mt.T, s, http.MethodGet, "/user/scene/history?offset=3", bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+		var page historyPage
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			mt.Fatal(err)
+		}
+		// Only the page is empty, the user still has history
+		if page.Resources == nil || len(page.Resources) != 0 || page.Total != int64(len(sceneIDs)) || page.IsEmpty {
+			mt.Errorf("page = %+v, want no resources of %d scenes, not empty", page, len(sceneIDs))
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "find" && event.Command.Lookup("find").StringValue() == "scenes" {
+				mt.Errorf("page past the end was looked up: %s", event.Command)
+			}
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+// uploadRequest sends a new scene upload of the user to s, with an mp4 video of size bytes.
+func uploadRequest(t *testing.T, s *WebServer, token string, size int) (*http.Response, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	video := append([]byte("\x00\x00\x00\x20ftypisom"), bytes.Repeat([]byte{0}, max(size-12, 0))...)
+	if _, err := file.Write(video); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.WriteField("sfm_only", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/user/scene/new", &body)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(content)
+}
+
+func TestUploadRejectedAboveStorageHighWaterMark(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("above the mark", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		if err := os.MkdirAll(filepath.Join("data", "nerf"), 0o755); err != nil {
+			mt.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join("data", "nerf", "splat.ply"), []byte(strings.Repeat("x", 100)), 0o644); err != nil {
+			mt.Fatal(err)
+		}
+		config := services.DefaultClientServiceConfig()
+		config.StorageHighWaterMark = 10
+		s := newMockedServer(mt, config)
+		userID := primitive.NewObjectID()
+
+		mt.AddMockResponses(tokenVersionResponse(userID))
+		resp, body := uploadRequest(mt.T, s, bearerToken(mt, s, userID), 1024)
+		if resp.StatusCode != http.StatusInsufficientStorage {
+			mt.Fatalf("status = %d, want 507: %s", resp.StatusCode, body)
+		}
+		if _, err := os.Stat(filepath.Join("data", "raw")); err == nil {
+			mt.Error("rejected upload was written to the data directory")
+		}
+	})
+}
+
+func TestUploadRejectedAboveMaxFileSize(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("oversized", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		s.config.Upload.MaxFileSize = 1024
+		userID := primitive.NewObjectID()
+
+		mt.AddMockResponses(tokenVersionResponse(userID))
+		resp, body := uploadRequest(mt.T, s, bearerToken(mt, s, userID), 2048)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			mt.Fatalf("status = %d, want 413: %s", resp.StatusCode, body)
+		}
+		if !strings.Contains(body, ErrFileTooLarge.Error()) {
+			mt.Errorf("body = %s, want it to report the file as too large", body)
+		}
+		if _, err := os.Stat(filepath.Join("data", "raw")); err == nil {
+			mt.Error("rejected upload was written to the data directory")
+		}
+	})
+}
+
+func TestUploadSlotRequired(t *testing.T) {
+	s := newTestServer(WebServerConfig{UploadRetryAfter: 10 * time.Second})
+	s.uploadSlots = make(chan struct{}, 1)
+	started, release := make(chan struct{}), make(chan struct{})
+	app := fiber.New()
+	app.Post("/", s.uploadSlotRequired(func(c *fiber.Ctx) error {
+		started <- struct{}{}
+		<-release
+		return c.SendStatus(http.StatusCreated)
+	}))
+	send := func() *http.Response {
+		resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/", nil), -1)
+		if err != nil {
+			t.Error(err)
+		}
+		return resp
+	}
+
+	// The first upload takes the only slot until it is done
+	first := make(chan *http.Response, 1)
+	go func() { first <- send() }()
+	<-started
+
+	resp := send()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("upload over the limit: status = %d, want 503", resp.StatusCode)
+	}
+	if got := resp.Header.Get(fiber.HeaderRetryAfter); got != "10" {
+		t.Errorf("Retry-After = %q, want 10", got)
+	}
+
+	close(release)
+	if resp := <-first; resp.StatusCode != http.StatusCreated {
+		t.Errorf("first upload: status = %d, want 201", resp.StatusCode)
+	}
+	// The slot is freed once the upload is done
+	go func() { <-started }()
+	if resp := send(); resp.StatusCode != http.StatusCreated {
+		t.Errorf("upload after the slot was freed: status = %d, want 201", resp.StatusCode)
+	}
+}
+
+func TestUploadRejectedAboveConcurrentLimit(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("all slots taken", func(mt *mtest.T) {
+		inTempDir(mt.T)
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		s.uploadSlots = make(chan struct{}, 1)
+		s.uploadSlots <- struct{}{}
+		userID := primitive.NewObjectID()
+
+		mt.AddMockResponses(tokenVersionResponse(userID))
+		resp, body := uploadRequest(mt.T, s, bearerToken(mt, s, userID), 1024)
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			mt.Fatalf("status = %d, want 503: %s", resp.StatusCode, body)
+		}
+		if _, err := os.Stat(filepath.Join("data", "raw")); err == nil {
+			mt.Error("rejected upload was written to the data directory")
+		}
+	})
+}
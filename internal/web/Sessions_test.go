@@ -0,0 +1,125 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+// sessionToken returns a token of the user issued to the given session, signed by s, carrying token version 0.
+func sessionToken(mt *mtest.T, s *WebServer, userID, sessionID primitive.ObjectID) string {
+	mt.Helper()
+	token, err := s.signToken(jwt.MapClaims{
+		"sub": userID.Hex(),
+		"ver": 0,
+		"jti": primitive.NewObjectID().Hex(),
+		"sid": sessionID.Hex(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		mt.Fatal(err)
+	}
+	return token
+}
+
+func TestUserSessions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	current, other := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("list", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		session := func(familyID primitive.ObjectID, device string) bson.D {
+			return bson.D{
+				{Key: "_id", Value: familyID.Hex()},
+				{Key: "user_id", Value: userID},
+				{Key: "family_id", Value: familyID},
+				{Key: "device", Value: device},
+				{Key: "created_at", Value: time.Now()},
+				{Key: "expires_at", Value: time.Now().Add(time.Hour)},
+			}
+		}
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			mtest.CreateCursorResponse(0, "nerfdb.refresh_tokens", mtest.FirstBatch,
+				session(current, "laptop"), session(other, "phone")),
+		)
+		resp, body := request(mt.T, s, http.MethodGet, "/user/sessions", sessionToken(mt, s, userID, current), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+
+		var got struct {
+			Sessions []struct {
+				ID      string `json:"id"`
+				Device  string `json:"device"`
+				Current bool   `json:"current"`
+			} `json:"sessions"`
+		}
+		if err := json.Unmarshal([]byte(body), &got); err != nil {
+			mt.Fatal(err)
+		}
+		if len(got.Sessions) != 2 {
+			mt.Fatalf("got %d sessions, want 2: %s", len(got.Sessions), body)
+		}
+		for _, session := range got.Sessions {
+			if want := session.ID == current.Hex(); session.Current != want {
+				mt.Errorf("session %s (%s) current = %v, want %v", session.ID, session.Device, session.Current, want)
+			}
+		}
+	})
+
+	mt.Run("revoke", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			mtest.CreateCursorResponse(0, "nerfdb.refresh_tokens", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: 1},
+				{Key: "n", Value: 1},
+			}),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}},
+		)
+		resp, body := request(mt.T, s, http.MethodDelete, "/user/sessions/"+other.Hex(), sessionToken(mt, s, userID, current), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+
+		// Tokens of the revoked session are rejected, those of other sessions are still accepted
+		mt.AddMockResponses(tokenVersionResponse(userID))
+		resp, body = request(mt.T, s, http.MethodGet, "/user/sessions", sessionToken(mt, s, userID, other), nil)
+		if resp.StatusCode != http.StatusUnauthorized {
+			mt.Errorf("revoked session: status = %d, want 401: %s", resp.StatusCode, body)
+		}
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			mtest.CreateCursorResponse(0, "nerfdb.refresh_tokens", mtest.FirstBatch),
+		)
+		resp, body = request(mt.T, s, http.MethodGet, "/user/sessions", sessionToken(mt, s, userID, current), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Errorf("other session: status = %d, want 200: %s", resp.StatusCode, body)
+		}
+	})
+
+	mt.Run("revoke unknown session", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			mtest.CreateCursorResponse(0, "nerfdb.refresh_tokens", mtest.FirstBatch),
+		)
+		resp, body := request(mt.T, s, http.MethodDelete, "/user/sessions/"+primitive.NewObjectID().Hex(), sessionToken(mt, s, userID, current), nil)
+		if resp.StatusCode != http.StatusNotFound {
+			mt.Fatalf("status = %d, want 404: %s", resp.StatusCode, body)
+		}
+	})
+}
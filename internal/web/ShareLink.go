@@ -0,0 +1,101 @@
+// This file contains the signing and verification of share links. A share link gives anyone holding it read access
+// to the outputs of a completed scene until it expires, without an account.
+//
+// Share links are stateless: the token carries the scene ID and expiry, signed with HMAC-SHA256, so nothing is stored
+// server-side. A link can therefore not be revoked before it expires, other than by rotating the share link secret.
+// Tokens have the form `<payload>.<signature>`, both base64url encoded.
+
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrShareLinkInvalid is returned when a share link is malformed, or its signature does not match.
+	ErrShareLinkInvalid = errors.New("invalid share link")
+	// ErrShareLinkExpired is returned when a validly signed share link has expired.
+	ErrShareLinkExpired = errors.New("share link has expired")
+	// ErrShareLinksUnavailable is returned when creating a share link without a key to sign it with.
+	ErrShareLinksUnavailable = errors.New("share links are not configured")
+)
+
+// shareLink is the payload of a share link token.
+type shareLink struct {
+	SceneID   primitive.ObjectID `json:"sid"`
+	ExpiresAt int64              `json:"exp"`
+}
+
+// Expiry returns the time the share link expires.
+func (l *shareLink) Expiry() time.Time {
+	return time.Unix(l.ExpiresAt, 0)
+}
+
+// shareLinkKey returns the key share links are signed with, ShareLinkSecret. Share links are never signed with the
+// JWT secret, so a key is not used for more than one purpose.
+func (s *WebServer) shareLinkKey() []byte {
+	return []byte(s.config.ShareLinkSecret)
+}
+
+// signShareLink creates a share link token for the given scene, valid until expiresAt.
+//
+// Returns ErrShareLinksUnavailable if there is no key to sign it with.
+func (s *WebServer) signShareLink(sceneID primitive.ObjectID, expiresAt time.Time) (string, error) {
+	key := s.shareLinkKey()
+	if len(key) == 0 {
+		return "", ErrShareLinksUnavailable
+	}
+
+	payload, err := json.Marshal(shareLink{SceneID: sceneID, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(shareLinkSignature(key, encoded)), nil
+}
+
+// parseShareLink verifies a share link token and returns its payload.
+//
+// Returns ErrShareLinkInvalid if the token is malformed or its signature does not match. Returns the payload along
+// with ErrShareLinkExpired if it has expired.
+func (s *WebServer) parseShareLink(token string) (*shareLink, error) {
+	key := s.shareLinkKey()
+	encoded, signature, ok := strings.Cut(token, ".")
+	if len(key) == 0 || !ok {
+		return nil, ErrShareLinkInvalid
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, shareLinkSignature(key, encoded)) {
+		return nil, ErrShareLinkInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrShareLinkInvalid
+	}
+	var link shareLink
+	if err := json.Unmarshal(payload, &link); err != nil || link.SceneID.IsZero() {
+		return nil, ErrShareLinkInvalid
+	}
+
+	if !time.Now().Before(link.Expiry()) {
+		return &link, ErrShareLinkExpired
+	}
+	return &link, nil
+}
+
+// shareLinkSignature returns the HMAC-SHA256 of the encoded payload.
+func shareLinkSignature(key []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,124 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestParseShareLink(t *testing.T) {
+	s := newTestServer(WebServerConfig{JWTSecret: "secret", ShareLinkSecret: "share"})
+	sceneID := primitive.NewObjectID()
+
+	token, err := s.signShareLink(sceneID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("signShareLink: %v", err)
+	}
+	link, err := s.parseShareLink(token)
+	if err != nil || link.SceneID != sceneID {
+		t.Fatalf("parseShareLink() = %v, %v, want the link to scene %s", link, err, sceneID.Hex())
+	}
+
+	expired, err := s.signShareLink(sceneID, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("signShareLink: %v", err)
+	}
+	if link, err := s.parseShareLink(expired); !errors.Is(err, ErrShareLinkExpired) || link == nil {
+		t.Errorf("parseShareLink(expired) = %v, %v, want the link and ErrShareLinkExpired", link, err)
+	}
+
+	for name, invalid := range map[string]string{
+		"malformed":       "token",
+		"bad signature":   token[:len(token)-2] + "AA",
+		"other key":       signedBy(t, "other", sceneID),
+		"signed as a jwt": signedBy(t, "secret", sceneID),
+	} {
+		if _, err := s.parseShareLink(invalid); !errors.Is(err, ErrShareLinkInvalid) {
+			t.Errorf("parseShareLink(%s) = %v, want ErrShareLinkInvalid", name, err)
+		}
+	}
+
+	// The JWT secret is never used to sign share links
+	unconfigured := newTestServer(WebServerConfig{JWTSecret: "secret"})
+	if _, err := unconfigured.signShareLink(sceneID, time.Now().Add(time.Hour)); !errors.Is(err, ErrShareLinksUnavailable) {
+		t.Errorf("signShareLink() without a share link secret = %v, want ErrShareLinksUnavailable", err)
+	}
+	if _, err := unconfigured.parseShareLink(signedBy(t, "secret", sceneID)); !errors.Is(err, ErrShareLinkInvalid) {
+		t.Errorf("parseShareLink() without a share link secret = %v, want ErrShareLinkInvalid", err)
+	}
+}
+
+// signedBy returns a share link to the scene, valid for an hour, signed with the given key.
+func signedBy(t *testing.T, key string, sceneID primitive.ObjectID) string {
+	t.Helper()
+	token, err := newTestServer(WebServerConfig{ShareLinkSecret: key}).signShareLink(sceneID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestGetSharedSceneInfo(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	sceneID := primitive.NewObjectID()
+
+	mt.Run("valid", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		s.config.ShareLinkSecret = "share"
+		token, err := s.signShareLink(sceneID, time.Now().Add(time.Hour))
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: sceneID},
+			{Key: "name", Value: "garden"},
+			{Key: "nerf", Value: bson.D{
+				{Key: "splat_cloud_file_paths", Value: bson.D{{Key: "30000", Value: "splat.ply"}}},
+			}},
+		}))
+		resp, body := request(mt.T, s, http.MethodGet, "/shared/"+token+"/info", "", nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+		var info struct {
+			SceneID string           `json:"scene_id"`
+			Name    string           `json:"name"`
+			Outputs map[string][]int `json:"outputs"`
+		}
+		if err := json.Unmarshal([]byte(body), &info); err != nil {
+			mt.Fatal(err)
+		}
+		if info.SceneID != sceneID.Hex() || info.Name != "garden" {
+			mt.Errorf("got scene %s named %q, want %s named garden", info.SceneID, info.Name, sceneID.Hex())
+		}
+		if got := info.Outputs["splat_cloud"]; len(got) != 1 || got[0] != 30000 {
+			mt.Errorf("splat_cloud outputs = %v, want [30000]", got)
+		}
+	})
+
+	mt.Run("expired", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		s.config.ShareLinkSecret = "share"
+		token, err := s.signShareLink(sceneID, time.Now().Add(-time.Second))
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		resp, body := request(mt.T, s, http.MethodGet, "/shared/"+token+"/info", "", nil)
+		if resp.StatusCode != http.StatusGone {
+			mt.Fatalf("status = %d, want 410: %s", resp.StatusCode, body)
+		}
+		if events := mt.GetAllStartedEvents(); len(events) != 0 {
+			mt.Errorf("expired link looked up the scene: %s", events[0].Command)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestGetScenesSharedWithMe(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("lists shared scenes only", func(mt *mtest.T) {
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		userID, ownerID := primitive.NewObjectID(), primitive.NewObjectID()
+		sharedID, legacyID := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			mtest.CreateCursorResponse(0, "nerfdb.scenes", mtest.FirstBatch,
+				bson.D{
+					{Key: "_id", Value: sharedID},
+					{Key: "name", Value: "garden"},
+					{Key: "status", Value: scene.StatusComplete},
+					{Key: "user_id", Value: ownerID},
+				},
+				// A scene of the user created before owners were recorded, shared with the user by mistake
+				bson.D{{Key: "_id", Value: legacyID}, {Key: "name", Value: "mine"}},
+			),
+			mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}}),
+			mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: ownerID},
+				{Key: "username", Value: "bob"},
+			}),
+		)
+		resp, body := request(mt.T, s, http.MethodGet, "/shared-with-me", bearerToken(mt, s, userID), nil)
+		if resp.StatusCode != http.StatusOK {
+			mt.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+		}
+
+		var result struct {
+			Scenes []services.SharedScene `json:"scenes"`
+		}
+		if err := json.Unmarshal([]byte(body), &result); err != nil {
+			mt.Fatal(err)
+		}
+		if len(result.Scenes) != 1 || result.Scenes[0].ID != sharedID.Hex() {
+			mt.Fatalf("listed %+v, want only the shared scene %s", result.Scenes, sharedID.Hex())
+		}
+		if got := result.Scenes[0]; got.Owner.Username != "bob" || !got.ReadOnly {
+			mt.Errorf("shared scene = %+v, want owned by bob and read only", got)
+		}
+
+		// Scenes owned by the user are left out by the query
+		find := mt.GetAllStartedEvents()[1].Command
+		if got := find.Lookup("filter", "user_id", "$ne").ObjectID(); got != userID {
+			mt.Errorf("query excludes scenes of %s, want the user %s", got.Hex(), userID.Hex())
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+func TestRevokeAllSessionsRejectsExistingTokens(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("revoked", func(mt *mtest.T) {
+		userID := primitive.NewObjectID()
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		token := bearerToken(mt, s, userID)
+
+		mt.AddMockResponses(
+			tokenVersionResponse(userID),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: userID}, {Key: "token_version", Value: 1}}}},
+		)
+		if resp, body := request(mt.T, s, http.MethodPost, "/user/sessions/revoke-all", token, nil); resp.StatusCode != http.StatusOK {
+			mt.Fatalf("revoke-all status = %d (%s), want %d", resp.StatusCode, body, http.StatusOK)
+		}
+		events := mt.GetAllStartedEvents()
+		if revoke := events[len(events)-1].Command; revoke.Lookup("update", "$inc", "token_version").AsInt64() != 1 {
+			mt.Fatalf("revoke-all sent %v, want the token version incremented", revoke)
+		}
+
+		// The stored version is now 1, so the token carrying version 0 is rejected
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: userID},
+			{Key: "token_version", Value: 1},
+		}))
+		if resp, _ := request(mt.T, s, http.MethodPost, "/logout", token, nil); resp.StatusCode != http.StatusUnauthorized {
+			mt.Errorf("status with a token issued before revoke-all = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+	})
+
+	mt.Run("no token version", func(mt *mtest.T) {
+		userID := primitive.NewObjectID()
+		s := newMockedServer(mt, services.DefaultClientServiceConfig())
+		token, err := s.signToken(jwt.MapClaims{
+			"sub": userID.Hex(),
+			"jti": primitive.NewObjectID().Hex(),
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		// The user never revoked their tokens, but a token without a version is still rejected
+		mt.AddMockResponses(tokenVersionResponse(userID))
+		if resp, _ := request(mt.T, s, http.MethodPost, "/logout", token, nil); resp.StatusCode != http.StatusUnauthorized {
+			mt.Errorf("status with a token without a version = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+	})
+}
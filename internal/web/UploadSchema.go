@@ -0,0 +1,172 @@
+// This file contains the upload schema, which describes the form fields of a video upload to /user/scene/new, so
+// clients can build upload forms and validate them before sending.
+//
+// The schema is not written by hand: fields and their rules are read from the `form` and `validate` tags of
+// NewSceneRequest, and completed with the bounds of the UploadConfig that ParseNewSceneRequest enforces. A rule added
+// to the request struct or the config therefore shows up in the schema without further changes.
+
+package web
+
+import (
+	"mime/multipart"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// deprecatedTrainingModes are training modes that still pass validation, but are rejected by upload handlers.
+var deprecatedTrainingModes = []string{scene.TrainingModeTensorf}
+
+// UploadSchema describes the form fields of a video upload.
+type UploadSchema struct {
+	Fields []UploadFieldSchema `json:"fields"`
+}
+
+// UploadFieldSchema describes a single upload form field, or the items of a list field.
+type UploadFieldSchema struct {
+	Name string `json:"name,omitempty"`
+	// Type is one of "file", "string", "integer" or "array".
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+	// Format is "csv" for arrays sent as a comma separated list.
+	Format string   `json:"format,omitempty"`
+	Enum   []string `json:"enum,omitempty"`
+	// EnumByTrainingMode lists the allowed values per training mode, for values that depend on it.
+	EnumByTrainingMode map[string][]string `json:"enum_by_training_mode,omitempty"`
+	Minimum            *int                `json:"minimum,omitempty"`
+	Maximum            *int                `json:"maximum,omitempty"`
+	// MinimumByTrainingMode raises Minimum for the given training modes.
+	MinimumByTrainingMode map[string]int     `json:"minimum_by_training_mode,omitempty"`
+	MinLength             *int               `json:"min_length,omitempty"`
+	MaxLength             *int               `json:"max_length,omitempty"`
+	MaxItems              *int               `json:"max_items,omitempty"`
+	Items                 *UploadFieldSchema `json:"items,omitempty"`
+	// MaxSize is the largest accepted file, in bytes.
+	MaxSize int64 `json:"max_size,omitempty"`
+	// Formats and Extensions are the accepted video containers, and the file extensions of each.
+	Formats    []string `json:"formats,omitempty"`
+	Extensions []string `json:"extensions,omitempty"`
+}
+
+// BuildUploadSchema returns the schema of the upload form accepted by ParseNewSceneRequest with the given config.
+func BuildUploadSchema(config UploadConfig) UploadSchema {
+	var schema UploadSchema
+
+	reqType := reflect.TypeOf(NewSceneRequest{})
+	for i := 0; i < reqType.NumField(); i++ {
+		field := reqType.Field(i)
+		name := field.Tag.Get("form")
+		if name == "" {
+			// Not a form field, i.e a header
+			continue
+		}
+
+		fieldSchema := uploadFieldType(field.Type)
+		fieldSchema.Name = name
+		applyValidateTag(&fieldSchema, field.Tag.Get("validate"))
+		applyUploadConfig(&fieldSchema, config)
+		schema.Fields = append(schema.Fields, fieldSchema)
+	}
+	return schema
+}
+
+// uploadFieldType returns the schema of a form field of type t, without any rules.
+func uploadFieldType(t reflect.Type) UploadFieldSchema {
+	switch {
+	case t == reflect.TypeOf(&multipart.FileHeader{}):
+		return UploadFieldSchema{Type: "file"}
+	case t.Kind() == reflect.Slice:
+		// Lists are parsed from comma separated form values
+		items := uploadFieldType(t.Elem())
+		return UploadFieldSchema{Type: "array", Format: "csv", Items: &items}
+	case t.Kind() == reflect.Int:
+		return UploadFieldSchema{Type: "integer"}
+	default:
+		return UploadFieldSchema{Type: "string"}
+	}
+}
+
+// applyValidateTag adds the rules of a validate tag to a field schema. Rules after `dive` apply to the items.
+func applyValidateTag(field *UploadFieldSchema, tag string) {
+	target := field
+	for _, rule := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "dive":
+			if field.Items != nil {
+				target = field.Items
+			}
+		case "required":
+			target.Required = true
+		case "oneof":
+			target.Enum = slices.DeleteFunc(strings.Fields(value), func(v string) bool {
+				return slices.Contains(deprecatedTrainingModes, v)
+			})
+		case "validOutputType":
+			// See validateOutputType
+			target.EnumByTrainingMode = make(map[string][]string)
+			for mode, outputTypes := range scene.ValidOutputTypes {
+				if !slices.Contains(deprecatedTrainingModes, mode) {
+					target.EnumByTrainingMode[mode] = outputTypes
+				}
+			}
+		case "min", "max":
+			bound, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			setBound(target, key, bound)
+		}
+	}
+}
+
+// setBound sets a min or max rule, which bounds the value of integers, the length of strings and the item count
+// of arrays.
+func setBound(field *UploadFieldSchema, key string, bound int) {
+	switch {
+	case field.Type == "integer" && key == "min":
+		field.Minimum = &bound
+	case field.Type == "integer":
+		field.Maximum = &bound
+	case field.Type == "array" && key == "max":
+		field.MaxItems = &bound
+	case field.Type == "string" && key == "min":
+		field.MinLength = &bound
+	case field.Type == "string":
+		field.MaxLength = &bound
+	}
+}
+
+// applyUploadConfig adds the bounds ParseNewSceneRequest enforces from the config to a field schema.
+func applyUploadConfig(field *UploadFieldSchema, config UploadConfig) {
+	switch {
+	case field.Type == "file":
+		field.MaxSize = config.MaxFileSize
+		field.Formats = config.VideoFormats
+		for ext, format := range videoFormatExtensions {
+			if slices.Contains(config.VideoFormats, format) {
+				field.Extensions = append(field.Extensions, ext)
+			}
+		}
+		slices.Sort(field.Extensions)
+	case field.Type == "array":
+		applyUploadConfig(field.Items, config)
+	case field.Type == "integer":
+		// Integers are parsed with parseBoundedInt, within [1, MaxIterations]
+		minimum, maximum := 1, config.MaxIterations
+		field.Minimum, field.Maximum = &minimum, &maximum
+	}
+
+	if field.Name == "total_iterations" {
+		// See validateMinIterations
+		field.MinimumByTrainingMode = make(map[string]int)
+		for mode, minIterations := range config.MinTotalIterations {
+			if !slices.Contains(deprecatedTrainingModes, mode) {
+				field.MinimumByTrainingMode[mode] = minIterations
+			}
+		}
+	}
+}
@@ -8,85 +8,360 @@
 package web
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/golang-jwt/jwt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
-	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
 	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
 )
 
+// uploadProgressIdleTimeout is how long an upload progress stream waits for an update before giving up.
+const uploadProgressIdleTimeout = 30 * time.Second
+
+// sceneProgressKeepAlive is how often a scene progress stream without updates sends a comment, which detects
+// clients that went away while a stage runs for a long time.
+const sceneProgressKeepAlive = 15 * time.Second
+
 type WebServer struct {
 	jwtSecret     string
+	config        WebServerConfig
 	app           *fiber.App
 	clientService *services.ClientService
+	workerURLs    *services.WorkerURLSigner
+	uploadSlots   chan struct{}
+	rateLimiter   RateLimiter
 	logger        *log.Logger
+
+	// requestsCtx is the parent of all request contexts, cancelled by cancelRequests on shutdown
+	requestsCtx    context.Context
+	cancelRequests context.CancelFunc
 }
 
 // NewWebServer creates a new WebServer instance.
-func NewWebServer(jwtSecret string, clientService *services.ClientService, logger *log.Logger) *WebServer {
+//
+// Returns error if the JWT configuration is invalid (i.e RS256 without a public key, or a TokenTTL that is not
+// positive).
+func NewWebServer(config WebServerConfig, clientService *services.ClientService, logger *log.Logger) (*WebServer, error) {
 	logger.Debug("Creating new web server instance")
 
+	if err := validateJWTConfig(config); err != nil {
+		return nil, err
+	}
+	corsConfig, err := corsConfig(config.CORS)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAccessLogConfig(config.AccessLog); err != nil {
+		return nil, err
+	}
+	if err := validateContentTypes(config.ContentTypes); err != nil {
+		return nil, err
+	}
+	if config.WorkerToken == "" && config.WorkerURLSecret == "" {
+		logger.Warn("No worker token or worker URL secret configured, worker data requests will be rejected")
+	}
+
 	app := fiber.New(fiber.Config{
-		BodyLimit: 16 * 1024 * 1024, // Max Single Request Body Size: 16MB
-		StreamRequestBody: true,     // Stream request body to disk
+		BodyLimit:         config.BodyLimit,           // Max Single Request Body Size
+		StreamRequestBody: true,                       // Stream request body to disk
+		StrictRouting:     config.StrictRouting,       // Match routes regardless of a trailing slash, unless strict
+		CaseSensitive:     config.CaseSensitiveRoutes, // Match routes regardless of case, unless case sensitive
 	})
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Authorization, Content-Type",
-	}))
+	app.Use(cors.New(corsConfig))
+
+	// Uploads hold a slot while they are received, see uploadSlotRequired
+	var uploadSlots chan struct{}
+	if config.MaxConcurrentUploads > 0 {
+		uploadSlots = make(chan struct{}, config.MaxConcurrentUploads)
+	}
+
+	// Login and registration attempts are limited, see rateLimited
+	rateLimiter := config.AuthRateLimiter
+	if rateLimiter == nil && config.AuthRateLimit > 0 {
+		rateLimiter = NewMemoryRateLimiter(config.AuthRateLimit, config.AuthRateLimitWindow)
+	}
 
-	return &WebServer{
-		jwtSecret:     jwtSecret,
+	s := &WebServer{
+		jwtSecret:     config.JWTSecret,
+		config:        config,
 		app:           app,
 		clientService: clientService,
+		workerURLs:    services.NewWorkerURLSigner(config.WorkerURLSecret),
+		uploadSlots:   uploadSlots,
+		rateLimiter:   rateLimiter,
 		logger:        logger,
 	}
+	s.requestsCtx, s.cancelRequests = context.WithCancel(context.Background())
+
+	// Registered before the routes, so they see every request. The request ID is set first, for the access log
+	app.Use(s.requestID)
+	app.Use(s.accessLog)
+	app.Use(s.requestContext)
+	return s, nil
+}
+
+// corsConfig returns the fiber CORS middleware settings for the given CORSConfig.
+//
+// Returns error if credentials are allowed for all origins, which browsers refuse.
+func corsConfig(config CORSConfig) (cors.Config, error) {
+	origins := "*"
+	if len(config.AllowOrigins) > 0 {
+		origins = strings.Join(config.AllowOrigins, ",")
+	}
+	if config.AllowCredentials && slices.Contains(strings.Split(origins, ","), "*") {
+		return cors.Config{}, errors.New("CORS credentials require explicit allowed origins, not \"*\"")
+	}
+
+	result := cors.Config{
+		AllowOrigins:     origins,
+		AllowCredentials: config.AllowCredentials,
+		AllowHeaders:     "Authorization, Content-Type, " + HeaderUploadID + ", " + HeaderIdempotencyKey + ", " + HeaderRequestID,
+		ExposeHeaders:    "X-Frame-Count, " + HeaderThumbnailWidth + ", " + HeaderThumbnailHeight + ", " + HeaderRequestID,
+	}
+	if len(config.AllowMethods) > 0 {
+		result.AllowMethods = strings.Join(config.AllowMethods, ",")
+	}
+	return result, nil
 }
 
-// Run starts the web server on the given IP and port.
+// Run starts the web server on the given IP and port, and serves until it receives SIGINT or SIGTERM.
+// See RunWithContext.
 func (s *WebServer) Run(ip string, port int) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return s.RunWithContext(ctx, ip, port)
+}
+
+// RunWithContext starts the web server on the given IP and port, and serves until ctx is done. The server then
+// stops accepting connections, and waits up to the configured ShutdownTimeout for in-flight requests (i.e uploads)
+// to finish before returning.
+//
+// Returns the error that stopped the server from listening, or the shutdown error (i.e the timeout was reached).
+// Returns nil after a clean shutdown.
+func (s *WebServer) RunWithContext(ctx context.Context, ip string, port int) error {
 	s.SetupRoutes()
 	s.SetupFileStructure()
-	return s.app.Listen(ip + ":" + strconv.Itoa(port))
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- s.app.Listen(ip + ":" + strconv.Itoa(port))
+	}()
+
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("Shutting down web server...")
+	var err error
+	if s.config.ShutdownTimeout > 0 {
+		err = s.app.ShutdownWithTimeout(s.config.ShutdownTimeout)
+	} else {
+		err = s.app.Shutdown()
+	}
+	// Requests still running after the timeout are abandoned, aborting their database operations
+	s.cancelRequests()
+	if err != nil {
+		s.logger.Error("Web server shutdown failed: ", err.Error())
+		return err
+	}
+	s.logger.Info("Web server shut down")
+	return nil
 }
 
 // SetupRoutes sets up the routes for the web server.
+// Routes listed in the config's DisabledRoutes are not registered, so they respond with 404, or 405 if other methods
+// of the path are still enabled.
+//
+// Unless StrictRouting or CaseSensitiveRoutes are configured, routes match regardless of a trailing slash and of case,
+// so "/User/Scene/History/" is handled as "/user/scene/history". Path parameters (i.e scene IDs) keep their case.
 func (s *WebServer) SetupRoutes() {
+	r := &routeRegistrar{app: s.app, disabled: s.config.DisabledRoutes, logger: s.logger}
+
 	// External Account Routes
-	s.app.Post("/user/account/login", s.loginUser)
-	s.app.Post("/user/account/register", s.registerUser)
-	s.app.Patch("/user/account/update/username", s.tokenRequired(s.updateUserUsername))
-	s.app.Patch("/user/account/update/password", s.tokenRequired(s.updateUserPassword))
-	s.app.Delete("/user/account/delete", s.tokenRequired(s.deleteUser))
+	r.Post("/user/account/login", s.rateLimited(loginRateLimitKeys, s.loginUser))
+	r.Post("/user/account/register", s.rateLimited(registerRateLimitKeys, s.registerUser))
+	r.Post("/refresh", s.refreshToken)
+	r.Post("/logout", s.tokenRequired(s.logoutUser))
+	r.Patch("/user/account/update/username", s.tokenRequired(s.updateUserUsername))
+	r.Patch("/user/account/update/password", s.tokenRequired(s.updateUserPassword))
+	r.Post("/user/password", s.tokenRequired(s.updateUserPassword))
+	r.Post("/user/account/token/refresh", s.tokenRequired(s.reissueToken))
+	r.Get("/user/sessions", s.tokenRequired(s.getUserSessions))
+	r.Delete("/user/sessions/:session_id", s.tokenRequired(s.revokeUserSession))
+	r.Post("/user/sessions/revoke-all", s.tokenRequired(s.revokeAllUserSessions))
+	r.Get("/user/me", s.tokenRequired(s.getCurrentUser))
+	r.Delete("/user/me", s.tokenRequired(s.deleteUser))
+	r.Delete("/user/account/delete", s.tokenRequired(s.deleteUser))
 
 	// External Scene Routes
-	s.app.Delete("/user/scene/delete/:scene_id", s.tokenRequired(s.deleteUserScene))
-	s.app.Post("/user/scene/new", s.tokenRequired(s.postNewScene))
-	s.app.Get("/user/scene/metadata/:scene_id", s.tokenRequired(s.getSceneMetadata))
-	s.app.Get("/user/scene/thumbnail/:scene_id", s.tokenRequired(s.getSceneThumbnail))
-	s.app.Get("/user/scene/name/:scene_id", s.tokenRequired(s.getSceneName))
-	s.app.Get("/user/scene/progress/:scene_id", s.tokenRequired(s.getSceneProgress))
-	s.app.Get("/user/scene/history", s.tokenRequired(s.getUserSceneHistory))
-	s.app.Get("/user/scene/output/:output_type/:scene_id", s.tokenRequired(s.getSceneOutput))
+	r.Delete("/user/scene/delete/:scene_id", s.tokenRequired(s.deleteUserScene))
+	r.Post("/user/scene/new", s.tokenRequired(s.uploadSlotRequired(s.postNewScene)))
+	r.Get("/user/scene/upload/progress/:upload_id", s.tokenRequired(s.getUploadProgress))
+	r.Get("/video/schema", s.getUploadSchema)
+	r.Get("/capabilities", s.getCapabilities)
+	r.Post("/video/init", s.tokenRequired(s.initChunkedUpload))
+	r.Get("/video/chunk/:upload_id", s.tokenRequired(s.getChunkedUpload))
+	r.Post("/video/chunk/:upload_id", s.tokenRequired(s.uploadSlotRequired(s.appendChunk)))
+	r.Post("/video/complete/:upload_id", s.tokenRequired(s.completeChunkedUpload))
+	r.Post("/video/estimate-storage", s.tokenRequired(s.estimateStorage))
+	r.Get("/user/scene/metadata/:scene_id", s.tokenRequired(s.getSceneMetadata))
+	r.Get("/user/scene/thumbnail/:scene_id", s.tokenRequired(s.getSceneThumbnail))
+	r.Get("/user/scene/name/:scene_id", s.tokenRequired(s.getSceneName))
+	r.Get("/user/scene/progress/:scene_id", s.tokenRequired(s.getSceneProgress))
+	r.Get("/user/scene/history", s.tokenRequired(s.getUserSceneHistory))
+	r.Get("/user/scene/history/export", s.tokenRequired(s.exportSceneHistory))
+	r.Get("/shared-with-me", s.tokenRequired(s.getScenesSharedWithMe))
+	r.Get("/user/scene/output/:output_type/:scene_id", s.tokenRequired(s.getSceneOutput))
+
+	r.Get("/user/failures", s.tokenRequired(s.getUserFailures))
+	r.Get("/user/tags", s.tokenRequired(s.getUserTags))
+	r.Get("/user/usage", s.tokenRequired(s.getUserUsage))
+	r.Put("/user/notifications/webhook", s.tokenRequired(s.setUserWebhook))
+	r.Post("/user/notifications/test", s.tokenRequired(s.testUserWebhook))
+	r.Get("/user/notifications/inbox", s.tokenRequired(s.getUserNotifications))
+	r.Post("/user/notifications/inbox/read", s.tokenRequired(s.markUserNotificationsRead))
+
+	// External Scene Data Routes
+	r.Post("/data/scene/acl/:scene_id", s.tokenRequired(s.updateSceneACL))
+	r.Patch("/data/scene/name/:scene_id", s.tokenRequired(s.renameScene))
+	r.Post("/data/scene/promote/:scene_id", s.tokenRequired(s.promoteScene))
+	r.Post("/data/scene/share-link/:scene_id", s.tokenRequired(s.createShareLink))
+	r.Post("/data/scene/cancel-and-delete/:scene_id", s.tokenRequired(s.cancelAndDeleteScene))
+	r.Post("/data/scene/:scene_id/restore", s.tokenRequired(s.restoreScene))
+	r.Post("/data/scene/thumbnail/:scene_id/from-render", s.tokenRequired(s.refreshSceneThumbnailFromRender))
+	r.Get("/data/scene/sfm/:scene_id/report", s.tokenRequired(s.getSfmQualityReport))
+	r.Get("/data/scene/sfm/:scene_id/poses", s.tokenRequired(s.getSfmPoses))
+	r.Get("/data/scene/sfm/:scene_id/point_cloud", s.tokenRequired(s.getSfmPointCloud))
+	r.Get("/data/scene/logs/:scene_id/combined", s.tokenRequired(s.getSceneCombinedLog))
+	r.Get("/data/scene/turntable/:scene_id", s.tokenRequired(s.getSceneTurntable))
+	r.Get("/data/scene/status/:scene_id", s.tokenRequired(s.getSceneStatus))
+	r.Get("/data/scene/video/:scene_id/info", s.tokenRequired(s.getSceneVideoInfo))
+	r.Get("/data/scene/progress/:scene_id", s.tokenRequired(s.streamSceneProgress))
+	r.Get("/data/scene/eta/:scene_id", s.tokenRequired(s.streamSceneETA))
+	r.Get("/data/scene/output/:scene_id/:output_type", s.tokenRequired(s.getSceneOutputIteration))
+	r.Get("/data/scene/output/:scene_id/:output_type/stats", s.tokenRequired(s.getSceneOutputStats))
+	r.Get("/data/scene/:scene_id", s.tokenRequired(s.getScene))
+	r.Patch("/data/scene/:scene_id", s.tokenRequired(s.updateScene))
+	r.Delete("/data/scene/:scene_id", s.tokenRequired(s.deleteScene))
+	r.Post("/data/scenes/download", s.tokenRequired(s.downloadScenes))
+	r.Post("/data/scenes/metadata", s.tokenRequired(s.getScenesMetadata))
+
+	// Share Link Routes
+	r.Get("/shared/:token/info", s.getSharedSceneInfo)
+	r.Get("/shared/:token/output/:output_type", s.getSharedSceneOutput)
+
+	// Admin Routes
+	r.Get("/admin/stats", s.tokenRequired(s.adminRequired(s.getPlatformStats)))
+	r.Get("/admin/queue/throughput", s.tokenRequired(s.adminRequired(s.getQueueThroughput)))
+	r.Post("/admin/scene/repair", s.tokenRequired(s.adminRequired(s.repairScenes)))
+	r.Post("/admin/scene/repair/:scene_id", s.tokenRequired(s.adminRequired(s.repairScene)))
+	r.Patch("/admin/user/role", s.tokenRequired(s.adminRequired(s.setUserRole)))
 
 	// Internal routes
-	s.app.Get("/worker-data/*", s.getWorkerData)
+	r.Get("/worker-data/*", s.workerAuthRequired(s.getWorkerData))
 
 	// Debug routes
-	s.app.Get("/routes", s.getRoutes)
-	s.app.Get("/health", s.healthCheck)
+	r.Get("/routes", s.getRoutes)
+	r.Get("/health", s.healthCheck)
+	r.Get("/health/ready", s.readinessCheck)
+	if s.config.PublicMetrics {
+		r.Get("/metrics", s.getMetrics)
+	} else {
+		r.Get("/metrics", s.tokenRequired(s.adminRequired(s.getMetrics)))
+	}
+}
+
+// Response headers carrying the size of a served thumbnail.
+const (
+	HeaderThumbnailWidth  = "X-Thumbnail-Width"
+	HeaderThumbnailHeight = "X-Thumbnail-Height"
+)
+
+// routeRegistrar registers routes on a fiber app, skipping routes that are disabled.
+//
+// A route is disabled by its path as registered (i.e "/worker-data/*"), which disables it for all methods,
+// or by "<METHOD> <path>" (i.e "POST /user/account/register"), which only disables that method.
+type routeRegistrar struct {
+	app      *fiber.App
+	disabled []string
+	logger   *log.Logger
+}
+
+// enabled checks if the route for method and path is not disabled.
+func (r *routeRegistrar) enabled(method, path string) bool {
+	for _, route := range r.disabled {
+		if route == path || route == method+" "+path {
+			r.logger.Infof("Route disabled: %s %s", method, path)
+			return false
+		}
+	}
+	return true
+}
+
+// Get registers a GET (and HEAD) route, unless it is disabled.
+func (r *routeRegistrar) Get(path string, handler fiber.Handler) {
+	if r.enabled(fiber.MethodGet, path) {
+		r.app.Get(path, handler)
+	}
+}
+
+// Post registers a POST route, unless it is disabled.
+func (r *routeRegistrar) Post(path string, handler fiber.Handler) {
+	if r.enabled(fiber.MethodPost, path) {
+		r.app.Post(path, handler)
+	}
+}
+
+// Put registers a PUT route, unless it is disabled.
+func (r *routeRegistrar) Put(path string, handler fiber.Handler) {
+	if r.enabled(fiber.MethodPut, path) {
+		r.app.Put(path, handler)
+	}
+}
+
+// Patch registers a PATCH route, unless it is disabled.
+func (r *routeRegistrar) Patch(path string, handler fiber.Handler) {
+	if r.enabled(fiber.MethodPatch, path) {
+		r.app.Patch(path, handler)
+	}
+}
+
+// Delete registers a DELETE route, unless it is disabled.
+func (r *routeRegistrar) Delete(path string, handler fiber.Handler) {
+	if r.enabled(fiber.MethodDelete, path) {
+		r.app.Delete(path, handler)
+	}
 }
 
 // SetupFileStructure creates the necessary directories for storing data files.
@@ -115,9 +390,9 @@ func (s *WebServer) SetupFileStructure() {
 
 // tokenRequired is a middleware that checks for a valid JWT token in the Authorization header.
 //
-// The token is expected to be in the format: `Bearer <token>`.   
+// The token is expected to be in the format: `Bearer <token>`.
 // A valid token will decode to a user ID (of type String(primitive.ObjectID)).
-// It is expected that the user ID is stored in the token's `sub` claim. 
+// It is expected that the user ID is stored in the token's `sub` claim.
 //
 // Validation of the user's existence is not performed here.
 // and instead the user ID is stored in the fiber context for use in request handlers,
@@ -126,132 +401,526 @@ func (s *WebServer) tokenRequired(handler fiber.Handler) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			s.logger.Debug("Missing Authorization header")
+			s.logFor(c).Debug("Missing Authorization header")
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Missing Authorization header"})
 		}
 
-		s.logger.Debugf("\nAuthorization header: %s", authHeader)
+		// Only the scheme is logged, the token would let anyone reading the logs act as the user
 		parts := strings.Split(authHeader, " ")
+		s.logFor(c).Debugf("Authorization header with scheme %q", parts[0])
 
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			s.logger.Debug("Invalid Authorization header format. Expected: `Bearer <token>`")
+			s.logFor(c).Debug("Invalid Authorization header format. Expected: `Bearer <token>`")
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid Authorization header format. Expected: `Bearer <token>`"})
 		}
 
 		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(s.jwtSecret), nil
-		})
+		token, err := jwt.Parse(tokenString, s.jwtKey)
 
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			s.logFor(c).Debug("Token expired")
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Token expired"})
+		}
 		if err != nil || !token.Valid {
-			s.logger.Debug("Invalid token")
+			s.logFor(c).Debug("Invalid token")
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			s.logger.Debug("Invalid token claims")
+			s.logFor(c).Debug("Invalid token claims")
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token claims"})
 		}
 		userID, ok := claims["sub"].(string)
 		if !ok {
-			s.logger.Debug("Invalid user ID in token")
+			s.logFor(c).Debug("Invalid user ID in token")
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user ID in token"})
+		}
+
+		// Tokens issued before the user's tokens were revoked are rejected. Tokens without a version could never be
+		// revoked this way, so they are rejected too.
+		userObjectID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			s.logFor(c).Debug("Invalid user ID in token")
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user ID in token"})
 		}
+		version, ok := claims["ver"].(float64)
+		if !ok {
+			s.logFor(c).Debug("Token rejected: no token version")
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		if err := s.clientService.VerifyTokenVersion(c.UserContext(), userObjectID, int(version)); err != nil {
+			s.logFor(c).Debug("Token rejected: ", err.Error())
+			if errors.Is(err, services.ErrTokenRevoked) || errors.Is(err, user.ErrUserNotFound) {
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+			}
+			return s.internalError(c, err)
+		}
+
+		// Tokens logged out of, and tokens of a revoked session, are rejected until they expire. Tokens issued before
+		// sessions were tracked have no session.
+		tokenID := jwtTokenID(claims, tokenString)
+		sessionID, _ := claims["sid"].(string)
+		revoked, err := s.clientService.IsTokenRevoked(c.UserContext(), tokenID, sessionID)
+		if err != nil {
+			return s.internalError(c, err)
+		}
+		if revoked {
+			s.logFor(c).Debug("Token rejected: logged out or session revoked")
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
 
 		c.Locals("userID", userID)
+		c.Locals("tokenID", tokenID)
+		c.Locals("sessionID", sessionID)
+		if exp, ok := claims["exp"].(float64); ok {
+			c.Locals("tokenExpiresAt", time.Unix(int64(exp), 0))
+		}
+		return handler(c)
+	}
+}
+
+// jwtTokenID returns the ID of a token, used to revoke it: its `jti` claim, or a hash of the raw token for tokens
+// issued without one.
+func jwtTokenID(claims jwt.MapClaims, tokenString string) string {
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		return jti
+	}
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+// adminRequired is a middleware that only allows users with the admin role through. It must be wrapped by tokenRequired,
+// as it relies on the user ID stored in the fiber context.
+//
+// The role is looked up in the database on every request, so role changes take effect immediately. Responds with 403
+// to other users, and with 500 if the role can not be looked up.
+func (s *WebServer) adminRequired(handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+		if err != nil {
+			s.logFor(c).Debug("Invalid user ID: ", err.Error())
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		isAdmin, err := s.clientService.IsAdmin(c.UserContext(), userID)
+		if err != nil {
+			s.logFor(c).Error("Failed to check admin role: ", err.Error())
+			if errors.Is(err, scene.ErrDatabaseUnavailable) {
+				return s.internalError(c, err)
+			}
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check admin role"})
+		}
+		if !isAdmin {
+			s.logFor(c).Debug("Non-admin user attempted to access admin route")
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Admin access required"})
+		}
+
+		return handler(c)
+	}
+}
+
+// HeaderWorkerToken is the request header workers send the configured worker token in.
+const HeaderWorkerToken = "X-Worker-Token"
+
+// workerAuthRequired is a middleware for internal routes used by workers. It allows requests through that carry
+// either the configured worker token in the X-Worker-Token header, or a valid, unexpired signature for the requested
+// path (see services.WorkerURLSigner), responding with 401 otherwise. If neither a worker token nor a worker URL
+// secret is configured, all requests are rejected.
+func (s *WebServer) workerAuthRequired(handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Get(HeaderWorkerToken)
+		if s.config.WorkerToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.config.WorkerToken)) == 1 {
+			return handler(c)
+		}
+
+		err := s.workerURLs.Verify(c.Params("*"), c.Query(services.WorkerURLExpiresParam), c.Query(services.WorkerURLSignatureParam))
+		if err != nil {
+			s.logFor(c).Debug("Worker request rejected: ", err.Error())
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
 		return handler(c)
 	}
 }
 
+// uploadSlotRequired is a middleware for upload routes, bounding the number of uploads received at once across all
+// users to MaxConcurrentUploads. An upload takes a slot before its body is read, and frees it once the handler returns,
+// whether it succeeded, failed, or the client went away. Without a free slot, the upload is rejected with 503 and
+// a Retry-After header, rather than waiting.
+func (s *WebServer) uploadSlotRequired(handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if s.uploadSlots == nil {
+			return handler(c)
+		}
+
+		select {
+		case s.uploadSlots <- struct{}{}:
+			defer func() { <-s.uploadSlots }()
+			return handler(c)
+		default:
+			s.logFor(c).Info("Rejecting upload: too many concurrent uploads")
+			if s.config.UploadRetryAfter > 0 {
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(s.config.UploadRetryAfter.Seconds())))
+			}
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": "Too many concurrent uploads, try again later"})
+		}
+	}
+}
+
+// internalError sends the response for an unexpected error returned while handling a request.
+//
+// Errors caused by an unavailable database are sanitized to `503 {"error":"database unavailable"}`, so driver
+// internals are never leaked to the client; the full error is logged instead. All other errors are sent as 500.
+func (s *WebServer) internalError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, scene.ErrDatabaseUnavailable) {
+		s.logFor(c).Error("Request failed, database unavailable: ", err.Error())
+		if s.config.DatabaseRetryAfter > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(s.config.DatabaseRetryAfter.Seconds())))
+		}
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": scene.ErrDatabaseUnavailable.Error()})
+	}
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
 // loginUser handles the login request.
 //
 // It expects a JSON payload with the following format:
+//
 //	{
 //	    "username": "username",
-//	    "password": "password"
+//	    "password": "password",
+//	    "device": "device label" (optional, defaults to the User-Agent)
 //	}
+//
+// Each login starts a session, listed at /user/sessions under the device label.
+//
+// Responds with `{"jwtToken": string, "refreshToken": string}`. The refresh token is exchanged for a new JWT token
+// at /refresh once the JWT token expires.
+//
+// Responds with 429 and a Retry-After header after too many login attempts from the client or to the username
+// (see AuthRateLimit).
+//
+// Responds with 423 after too many consecutive failed logins, with `retry_after` (seconds) and `locked_until`, and
+// a Retry-After header. Logins are refused until then, even with the right password.
 func (s *WebServer) loginUser(c *fiber.Ctx) error {
-	s.logger.Debug("Login request received")
+	s.logFor(c).Debug("Login request received")
 
 	var req LoginRequest
 	if err := ValidateRequest(c, &req); err != nil {
-		s.logger.Debug("Login request validation failed: ", err.Error())
+		s.logFor(c).Debug("Login request validation failed: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	s.logger.Debug("Login request validated")
+	s.logFor(c).Debug("Login request validated")
 
-	userID, err := s.clientService.LoginUser(context.TODO(), req.Username, req.Password)
+	userID, err := s.clientService.LoginUser(c.UserContext(), req.Username, req.Password)
 	if err != nil {
-		s.logger.Debug("User login failed: ", err.Error())
+		s.logFor(c).Debug("User login failed: ", err.Error())
+		var lockedErr *services.AccountLockedError
+		if errors.As(err, &lockedErr) {
+			retryAfter := int(math.Ceil(time.Until(lockedErr.Until).Seconds()))
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(http.StatusLocked).JSON(fiber.Map{
+				"error":        services.ErrAccountLocked.Error(),
+				"retry_after":  retryAfter,
+				"locked_until": lockedErr.Until.UTC(),
+			})
+		}
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 	}
-	s.logger.Debug("User logged in")
+	s.logFor(c).Debug("User logged in")
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": userID,
-	})
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	device := req.Device
+	if device == "" {
+		device = c.Get(fiber.HeaderUserAgent)
+		if len(device) > maxUserAgentDeviceLength {
+			device = device[:maxUserAgentDeviceLength]
+		}
+	}
+
+	refreshToken, sessionID, err := s.clientService.IssueRefreshToken(c.UserContext(), userObjectID, device)
 	if err != nil {
-		s.logger.Debug("Failed to generate token")
+		s.logFor(c).Debug("Failed to issue refresh token: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	return s.sendToken(c, userID, sessionID, refreshToken)
+}
+
+// logoutUser handles the logout request. It is a JWT protected route.
+//
+// The token used for the request is revoked, and rejected from now on. Other tokens of the user are unaffected.
+func (s *WebServer) logoutUser(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Logout request received")
+
+	// Tokens without an expiry (i.e issued by an external service) are revoked forever
+	expiresAt, _ := c.Locals("tokenExpiresAt").(time.Time)
+	if err := s.clientService.RevokeToken(c.UserContext(), c.Locals("tokenID").(string), expiresAt); err != nil {
+		s.logFor(c).Debug("Failed to revoke token: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Logged out"})
+}
+
+// reissueToken handles the request to re-issue the caller's token. It is a JWT protected route.
+//
+// The new token reflects the user's current role, i.e after being promoted by an admin. It is also how a user
+// whose tokens were revoked (see setUserRole) gets a valid token again, after logging in.
+func (s *WebServer) reissueToken(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Reissue token request received")
+	return s.sendToken(c, c.Locals("userID").(string), c.Locals("sessionID").(string), "")
+}
+
+// refreshToken handles the request to exchange a refresh token (issued at login) for a new JWT token.
+// It is not JWT protected, as it is used once the JWT token has expired.
+//
+// It expects a JSON body with field `refresh_token`. Refresh tokens are single use: the response carries a new one,
+// as `{"jwtToken": string, "refreshToken": string}`. Responds with 401 if the refresh token is unknown, expired,
+// revoked or was already used. Reusing a refresh token also revokes all refresh tokens rotated from the same login.
+func (s *WebServer) refreshToken(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Refresh token request received")
+
+	var req RefreshTokenRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Refresh token request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, sessionID, refreshToken, err := s.clientService.RotateRefreshToken(c.UserContext(), req.RefreshToken)
+	if err != nil {
+		s.logFor(c).Debug("Failed to refresh token: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrRefreshTokenInvalid), errors.Is(err, user.ErrRefreshTokenReused):
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return s.sendToken(c, userID, sessionID, refreshToken)
+}
+
+// getUserSessions handles the request to list the caller's active sessions. It is a JWT protected route.
+//
+// A session is started by each login, and lasts while it is refreshed. Responds with `{"sessions": [...]}`, each
+// with `id`, `device`, `issued_at`, `last_used_at` (the last login or refresh), `expires_at` and `current`, set for
+// the session of the token used for the request.
+func (s *WebServer) getUserSessions(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get user sessions request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", c.Locals("userID").(string))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sessions, err := s.clientService.GetUserSessions(c.UserContext(), userID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get user sessions: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	current := c.Locals("sessionID").(string)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == current
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"sessions": sessions})
+}
+
+// revokeUserSession handles the request to end one of the caller's sessions, i.e a lost device. It is a JWT
+// protected route.
+//
+// It expects a path parameter `session_id`. The session can no longer be refreshed, and its tokens are rejected.
+// Responds with 404 if the caller has no active session with the ID.
+func (s *WebServer) revokeUserSession(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Revoke user session request received")
+
+	var req RevokeSessionRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Revoke session request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(req.SessionID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid session ID: ", req.SessionID)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", c.Locals("userID").(string))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	// Access tokens of the session are rejected until the last one issued has expired
+	accessTokenExpiry := time.Now().Add(s.config.TokenTTL)
+
+	if err := s.clientService.RevokeSession(c.UserContext(), userID, sessionID, accessTokenExpiry); err != nil {
+		s.logFor(c).Debug("Failed to revoke session: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrSessionNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Session revoked"})
+}
+
+// revokeAllUserSessions handles the request to log the caller out everywhere. It is a JWT protected route.
+//
+// All of the caller's sessions end, and every token issued so far (including the one used for the request) is
+// rejected. The caller has to log in again.
+func (s *WebServer) revokeAllUserSessions(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Revoke all user sessions request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", c.Locals("userID").(string))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := s.clientService.RevokeAllSessions(c.UserContext(), userID); err != nil {
+		switch {
+		case errors.Is(err, user.ErrUserNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "All sessions revoked, log in again"})
+}
+
+// maxUserAgentDeviceLength is the length the User-Agent is cut to when used as a session's device label.
+const maxUserAgentDeviceLength = 128
+
+// sendToken issues a JWT token for the user with the given ID, carrying the user's current role and token version,
+// and sends it as `{"jwtToken": string}`. The token expires after the configured TokenTTL. If sessionID is not
+// empty, the token belongs to that session (its `sid` claim), and is rejected once the session is revoked.
+// If refreshToken is not empty, it is sent along as `refreshToken`.
+func (s *WebServer) sendToken(c *fiber.Ctx, userID, sessionID, refreshToken string) error {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	claims, err := s.clientService.GetTokenClaims(c.UserContext(), userObjectID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get token claims: ", err.Error())
+		if errors.Is(err, user.ErrUserNotFound) {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	now := time.Now()
+	tokenClaims := jwt.MapClaims{
+		"sub":  claims.UserID,
+		"role": claims.Role,
+		"ver":  claims.TokenVersion,
+		"iat":  now.Unix(),
+		"jti":  primitive.NewObjectID().Hex(),
+		"exp":  now.Add(s.config.TokenTTL).Unix(),
+	}
+	if sessionID != "" {
+		tokenClaims["sid"] = sessionID
+	}
+
+	tokenString, err := s.signToken(tokenClaims)
+	if err != nil {
+		s.logFor(c).Debug("Failed to generate token: ", err.Error())
+		if errors.Is(err, ErrTokenSigningUnavailable) {
+			return c.Status(http.StatusNotImplemented).JSON(fiber.Map{"error": "Tokens are issued by an external service"})
+		}
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
 	}
-	s.logger.Debugf("JWT token generated, userID %s\n", userID)
+	s.logFor(c).Debugf("JWT token generated, userID %s\n", userID)
 
-	return c.Status(http.StatusOK).JSON(fiber.Map{"jwtToken": tokenString})
+	response := fiber.Map{"jwtToken": tokenString}
+	if refreshToken != "" {
+		response["refreshToken"] = refreshToken
+	}
+	return c.Status(http.StatusOK).JSON(response)
 }
 
-// registerUser handles the registration request. 
-// 
+// registerUser handles the registration request.
+//
 // It expects a JSON payload with the following format:
+//
 //	{
 //	    "username": "username",
 //	    "password": "password"
 //	}
+//
+// The password must meet the password policy, otherwise responds with 400 and the unmet requirements in `rules`.
+// Responds with 409 if the username is already taken.
+//
+// Responds with 429 and a Retry-After header after too many registrations from the client (see AuthRateLimit).
 func (s *WebServer) registerUser(c *fiber.Ctx) error {
-	s.logger.Debug("Register request received")
+	s.logFor(c).Debug("Register request received")
 
 	var req RegisterRequest
 	if err := ValidateRequest(c, &req); err != nil {
-		s.logger.Debug("Register request validation failed: ", err.Error())
+		s.logFor(c).Debug("Register request validation failed: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "success": false})
 	}
 
-	err := s.clientService.RegisterUser(context.TODO(), req.Username, req.Password)
+	err := s.clientService.RegisterUser(c.UserContext(), req.Username, req.Password)
 	if err != nil {
-		s.logger.Debug("User registration failed: ", err.Error())
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "success": false})
+		s.logFor(c).Debug("User registration failed: ", err.Error())
+		var weakErr *user.WeakPasswordError
+		switch {
+		case errors.As(err, &weakErr):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "rules": weakErr.Failed, "success": false})
+		case errors.Is(err, user.ErrUsernameTaken):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error(), "success": false})
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "success": false})
+		}
 	}
 
-	s.logger.Debug("User registered successfully")
+	s.logFor(c).Debug("User registered successfully")
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"success": true})
 }
 
 // updateUserUsername handles the request to update the username of a user. It is a JWT protected route.
 //
 // It expects a JSON payload with the following format:
+//
 //	{
 //	    "password": "password",
 //	    "new_username": "new_username"
 //	}
 func (s *WebServer) updateUserUsername(c *fiber.Ctx) error {
-	s.logger.Debug("Update username request received")
+	s.logFor(c).Debug("Update username request received")
 
 	var req UpdateUsernameRequest
 	if err := ValidateRequest(c, &req); err != nil {
-		s.logger.Debug("Update username request validation failed: ", err.Error())
+		s.logFor(c).Debug("Update username request validation failed: ", err.Error())
 		return fiber.NewError(http.StatusBadRequest, err.Error())
 	}
 
 	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", err.Error())
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
 		return fiber.NewError(http.StatusBadRequest, "Invalid user ID")
 	}
 
-	err = s.clientService.UpdateUserUsername(context.TODO(), userID, req.Password, req.NewUsername)
+	err = s.clientService.UpdateUserUsername(c.UserContext(), userID, req.Password, req.NewUsername)
 	if err != nil {
-		s.logger.Debug("Failed to update username: ", err.Error())
+		s.logFor(c).Debug("Failed to update username: ", err.Error())
 		return fiber.NewError(http.StatusBadRequest, err.Error())
 	}
 
@@ -265,8 +934,11 @@ func (s *WebServer) updateUserUsername(c *fiber.Ctx) error {
 //	    "old_password": "old_password",
 //	    "new_password": "new_password"
 //	}
+//
+// Responds with 400 if the new password does not meet the password policy, and 401 if the old password is wrong.
+// Changing the password revokes all of the user's tokens and sessions, including the one making the request.
 func (s *WebServer) updateUserPassword(c *fiber.Ctx) error {
-	s.logger.Debug("Update password request received")
+	s.logFor(c).Debug("Update password request received")
 
 	var req UpdatePasswordRequest
 	if err := ValidateRequest(c, &req); err != nil {
@@ -275,17 +947,26 @@ func (s *WebServer) updateUserPassword(c *fiber.Ctx) error {
 
 	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", err.Error())
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
 		return fiber.NewError(http.StatusBadRequest, "Invalid user ID")
 	}
 
-	err = s.clientService.UpdateUserPassword(context.TODO(), userID, req.OldPassword, req.NewPassword)
+	err = s.clientService.UpdateUserPassword(c.UserContext(), userID, req.OldPassword, req.NewPassword)
 	if err != nil {
-		s.logger.Debug("Failed to update password: ", err.Error())
-		return fiber.NewError(http.StatusBadRequest, err.Error())
+		s.logFor(c).Debug("Failed to update password: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrWeakPassword):
+			return fiber.NewError(http.StatusBadRequest, err.Error())
+		case errors.Is(err, user.ErrIncorrectPassword):
+			return fiber.NewError(http.StatusUnauthorized, err.Error())
+		case errors.Is(err, user.ErrUserNotFound):
+			return fiber.NewError(http.StatusNotFound, err.Error())
+		default:
+			return s.internalError(c, err)
+		}
 	}
 
-	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Password updated"})
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Password updated, log in again with the new password"})
 }
 
 // Must be careful in implementing these two functions.
@@ -293,7 +974,7 @@ func (s *WebServer) updateUserPassword(c *fiber.Ctx) error {
 //
 // Planning: Confirmation at the client level. In progress scenes are denied deletion
 // (This should be redundant ui-wise since the client doesnt display )
-// If a completed scene is deleted, we do not need to delete the output files. FOR NOW. Instead just 
+// If a completed scene is deleted, we do not need to delete the output files. FOR NOW. Instead just
 // remove from DB.
 //
 // This allows us to implement a goroutine that periodically cleans up old output files. (we can just append to a list of files to delete)
@@ -301,10 +982,40 @@ func (s *WebServer) deleteUserScene(c *fiber.Ctx) error {
 	return fiber.NewError(http.StatusNotImplemented, "Not implemented")
 }
 
-// Should deleting a user also delete all their scenes? How to handle this?
-// Do we need to expand auth for confirmation, or leave that at the client level?
+// deleteUser handles the request to delete the logged in user's account, along with all of their scenes and files.
+// It is a JWT protected route. Confirmation is left to the client.
+//
+// Responds with a summary of what was deleted: `scenes_deleted`, `bytes_freed`, `shares_removed` and
+// `sessions_deleted`. If the deletion stops part way, responds with 500, the failed `step` and what was `deleted`
+// so far; the account still exists, and the request may be retried to finish the deletion.
 func (s *WebServer) deleteUser(c *fiber.Ctx) error {
-	return fiber.NewError(http.StatusNotImplemented, "Not implemented")
+	s.logFor(c).Debug("Delete user request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	deleted, err := s.clientService.DeleteUser(c.UserContext(), userID)
+	if err != nil {
+		var deletionErr *services.UserDeletionError
+		switch {
+		case errors.Is(err, user.ErrUserNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.As(err, &deletionErr):
+			s.logFor(c).Error("User deletion incomplete: ", err.Error())
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Account deletion incomplete, retry the request to finish it",
+				"step":    deletionErr.Step,
+				"deleted": deletionErr.Deleted,
+			})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Account deleted", "deleted": deleted})
 }
 
 // postNewScene handles the new scene request. It is a JWT protected route.
@@ -317,358 +1028,2823 @@ func (s *WebServer) deleteUser(c *fiber.Ctx) error {
 //   - output_types: optional,
 //     a comma-separated list of output types to save (e.g. splat_cloud, point_cloud, etc.)
 //   - save_iterations: optional,
-//     a comma-separated list of iterations to save the output at (0 <= x <= 30000)
+//     a comma-separated list of iterations to save the output at (1 <= x <= Upload.MaxIterations, 30000 by default)
 //   - total_iterations: optional,
-//     the total number of iterations to run (0 <= x <= 30000)
+//     the total number of iterations to run (1 <= x <= Upload.MaxIterations)
 //   - scene_name: optional,
 //     the name of the scene
+//   - sfm_only: optional,
+//     if true, only SfM is run, producing camera poses and a point cloud without NeRF training. The training fields
+//     are then not required, and ignored.
+//   - downscale: optional,
+//     if true, the video is scaled down before processing if it is larger than the configured maximum resolution.
+//
+// Iteration values must be plain integers; decimals and out of range values are rejected with 400.
+//
+// An optional `Idempotency-Key` header makes the request safe to retry: requests with the same key create a single
+// scene and respond with its ID. Responds with 409 if a request with the same key is still creating the scene.
 func (s *WebServer) postNewScene(c *fiber.Ctx) error {
-	s.logger.Debug("New Scene Request received")
+	s.logFor(c).Debug("New Scene Request received")
 	var req *NewSceneRequest
 	var err error
 
 	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", err.Error())
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
 	}
 
-	req, err = ParseNewSceneRequest(c)
+	req, err = ParseNewSceneRequest(c, s.config.Upload)
 	if err != nil {
-		s.logger.Debug("Video upload request parsing failed: ", err.Error())
+		s.logFor(c).Debug("Video upload request parsing failed: ", err.Error())
+		if errors.Is(err, ErrFileTooLarge) {
+			return c.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if req.TrainingMode == "tensorf" {
-		s.logger.Debug("Tensorf training mode is now deprecated. Please use gaussian training mode.")
+	if slices.Contains(deprecatedTrainingModes, req.TrainingMode) {
+		s.logFor(c).Debug("Tensorf training mode is now deprecated. Please use gaussian training mode.")
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Tensorf training mode is now deprecated. Please use gaussian training mode."})
 	}
 
 	sceneID, err := s.clientService.HandleIncomingVideo(
-		context.TODO(),
+		c.UserContext(),
 		userID,
-		req.File,
-		req.TrainingMode,
-		req.OutputTypes,
-		req.SaveIterations,
-		req.TotalIterations,
-		req.SceneName,
+		services.NewVideoFile(req.File),
+		services.NewSceneOptions{
+			TrainingMode:    req.TrainingMode,
+			OutputTypes:     req.OutputTypes,
+			SaveIterations:  req.SaveIterations,
+			TotalIterations: req.TotalIterations,
+			SceneName:       req.SceneName,
+			Tags:            req.Tags,
+			SfmOnly:         req.SfmOnly,
+			Downscale:       req.Downscale,
+			UploadID:        req.UploadID,
+			IdempotencyKey:  req.IdempotencyKey,
+		},
 	)
 	if err != nil {
-		s.logger.Debug("Video processing failed:", err.Error())
+		s.logFor(c).Debug("Video processing failed:", err.Error())
+		if errors.Is(err, services.ErrIdempotencyKeyInProgress) {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, services.ErrStorageReadOnly) || errors.Is(err, services.ErrNoWorkersAvailable) {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, services.ErrStorageFull) {
+			return c.Status(http.StatusInsufficientStorage).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	s.logger.Debugf("Video received and processing scene %s. Check back later for updates.\n", sceneID)
+	s.logFor(c).Debugf("Video received and processing scene %s. Check back later for updates.\n", sceneID)
 	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"id": sceneID, "message": "Video received and processing scene. Check back later for updates."})
 }
 
-// getSceneMetadata handles the request to get the metadata for a scene. It is a JWT protected route.
+// getUploadProgress handles the request to follow the progress of a video upload. It is a JWT protected route.
 //
-// It expects path parameter `scene_id`.
-func (s *WebServer) getSceneMetadata(c *fiber.Ctx) error {
-	s.logger.Debug("Get scene metadata request received")
-
-	var req GetSceneMetadataRequest
+// It expects path parameter `upload_id`, matching the `X-Upload-ID` header sent with the upload to /user/scene/new.
+// The route may be opened before or during the upload. Progress is streamed as server-sent events of the form
+// `data: {"received": int, "total": int, "done": bool, "error": string}`, and the stream ends once the upload is done.
+// If no progress is reported for uploadProgressIdleTimeout, the stream ends with an `event: timeout`.
+func (s *WebServer) getUploadProgress(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get upload progress request received")
+
+	var req GetUploadProgressRequest
 	if err := ValidateRequest(c, &req); err != nil {
-		s.logger.Debug("Get job data request validation failed: ", err.Error())
+		s.logFor(c).Debug("Get upload progress request validation failed: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", err.Error())
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
 	}
 
-	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
-	if err != nil {
-		s.logger.Debug("Invalid job ID: ", err.Error())
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job ID"})
-	}
+	updates, cancel := s.clientService.SubscribeUploadProgress(userID, req.UploadID)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		timer := time.NewTimer(uploadProgressIdleTimeout)
+		defer timer.Stop()
+
+		for {
+			select {
+			case progress, ok := <-updates:
+				if !ok {
+					return
+				}
+				data, _ := json.Marshal(progress)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+				if err := w.Flush(); err != nil {
+					// Client went away
+					return
+				}
+				timer.Reset(uploadProgressIdleTimeout)
+			case <-timer.C:
+				fmt.Fprint(w, "event: timeout\ndata: {}\n\n")
+				w.Flush()
+				return
+			}
+		}
+	})
 
-	sceneData, err := s.clientService.GetSceneMetadata(context.TODO(), userID, sceneID)
-	if err != nil {
-		s.logger.Debug("Failed to get job data: ", err.Error())
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-	}
+	return nil
+}
 
-	sceneJson, err := json.Marshal(sceneData)
+// getUploadSchema handles the request to get the schema of the upload form of /user/scene/new: its fields, whether
+// they are required, their allowed values and bounds, and which lists are sent as comma separated values.
+func (s *WebServer) getUploadSchema(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get upload schema request received")
+	return c.Status(http.StatusOK).JSON(BuildUploadSchema(s.config.Upload))
+}
+
+// getCapabilities handles the request to get the capabilities of the server: its training modes and output types,
+// iteration bounds, upload and quota limits, export formats, and build version. Limits are the ones the server
+// enforces, so clients can check requests before sending them.
+func (s *WebServer) getCapabilities(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get capabilities request received")
+	return c.Status(http.StatusOK).JSON(BuildCapabilities(s.config))
+}
+
+// initChunkedUpload handles the request to start a chunked video upload, for videos too large to upload reliably to
+// /user/scene/new in one request. It is a JWT protected route.
+//
+// It expects a JSON body with `filename` and `size` (in bytes) of the video, and the training fields of
+// /user/scene/new: `training_mode`, `output_types`, `save_iterations`, `total_iterations`, and optionally `scene_name`,
+// `tags`, `sfm_only` and `downscale`. Responds with the upload's status, holding the `id` to send the chunks to
+// /video/chunk/:upload_id with.
+func (s *WebServer) initChunkedUpload(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Init chunked upload request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	req, err := ParseInitChunkedUploadRequest(c, s.config.Upload)
+	if err != nil {
+		s.logFor(c).Debug("Init chunked upload request validation failed: ", err.Error())
+		if errors.Is(err, ErrFileTooLarge) {
+			return c.Status(http.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if slices.Contains(deprecatedTrainingModes, req.TrainingMode) {
+		s.logFor(c).Debug("Tensorf training mode is now deprecated. Please use gaussian training mode.")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Tensorf training mode is now deprecated. Please use gaussian training mode."})
+	}
+
+	status, err := s.clientService.InitChunkedUpload(c.UserContext(), userID, req.Filename, req.Size, services.NewSceneOptions{
+		TrainingMode:    req.TrainingMode,
+		OutputTypes:     req.OutputTypes,
+		SaveIterations:  req.SaveIterations,
+		TotalIterations: req.TotalIterations,
+		SceneName:       req.SceneName,
+		Tags:            req.Tags,
+		SfmOnly:         req.SfmOnly,
+		Downscale:       req.Downscale,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrStorageReadOnly), errors.Is(err, services.ErrNoWorkersAvailable):
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrStorageFull):
+			return c.Status(http.StatusInsufficientStorage).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusCreated).JSON(status)
+}
+
+// estimateStorage handles the request to estimate the storage a training run consumes, so users can plan runs against
+// their quota before uploading. It is a JWT protected route.
+//
+// It expects a JSON body with the training fields of /user/scene/new: `training_mode`, `output_types`,
+// `save_iterations` and `total_iterations`. No video is needed. Responds with the estimated `total_bytes`, broken down
+// into `sfm_bytes` and the `output_bytes` of each output type, based on the files recently completed scenes produced.
+func (s *WebServer) estimateStorage(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Estimate storage request received")
+
+	req, err := ParseEstimateStorageRequest(c, s.config.Upload)
+	if err != nil {
+		s.logFor(c).Debug("Estimate storage request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if slices.Contains(deprecatedTrainingModes, req.TrainingMode) {
+		s.logFor(c).Debug("Tensorf training mode is now deprecated. Please use gaussian training mode.")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Tensorf training mode is now deprecated. Please use gaussian training mode."})
+	}
+
+	estimate, err := s.clientService.EstimateStorage(c.UserContext(), req.OutputTypes, req.SaveIterations)
+	if err != nil {
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(estimate)
+}
+
+// getChunkedUpload handles the request to get the status of a chunked upload, i.e to find the offset to resume it
+// from after a dropped connection. It is a JWT protected route.
+//
+// It expects path parameter `upload_id`. Responds with the upload's `size`, and the number of bytes `received`.
+func (s *WebServer) getChunkedUpload(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get chunked upload request received")
+
+	var req ChunkedUploadRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get chunked upload request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	status, err := s.clientService.GetChunkedUpload(userID, req.UploadID)
+	if err != nil {
+		if errors.Is(err, services.ErrChunkedUploadNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(status)
+}
+
+// appendChunk handles the request to upload the next chunk of a chunked upload. It is a JWT protected route.
+//
+// It expects path parameter `upload_id`, the raw bytes of the chunk as body, and a `Content-Range` header of the
+// form `bytes <start>-<end>/<total>`, where total is the size declared to /video/init. Chunks must be sent in order,
+// each starting where the previous one ended; otherwise the request is rejected with 409, and `received` holds the
+// offset to send from. If the request ends early, the bytes received are kept. The first chunk must hold at least the
+// first 12 bytes of the video, which its format is checked against. Responds with the upload's status.
+func (s *WebServer) appendChunk(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Append chunk request received")
+
+	// The body is read as a stream, so it is not parsed by ValidateRequest
+	var req ChunkedUploadRequest
+	if err := c.ParamsParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validate.Struct(req); err != nil {
+		s.logFor(c).Debug("Append chunk request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	offset, length, total, err := ParseContentRange(c.Get(fiber.HeaderContentRange))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	status, err := s.clientService.GetChunkedUpload(userID, req.UploadID)
+	if err != nil {
+		if errors.Is(err, services.ErrChunkedUploadNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+	if total != status.Size {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Content-Range total must be the upload size, %d bytes", status.Size)})
+	}
+
+	var body io.Reader = bytes.NewReader(c.Body())
+	if stream := c.Context().RequestBodyStream(); stream != nil {
+		body = stream
+	}
+
+	// The first chunk starts with the video's header, so its content is checked before anything is written. It must
+	// hold the whole header, otherwise the rest of the header would be written unchecked by the next chunk.
+	if offset == 0 {
+		if length < videoHeaderSize {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("the first chunk must hold at least %d bytes", videoHeaderSize)})
+		}
+		buffered := bufio.NewReader(io.LimitReader(body, length))
+		header, _ := buffered.Peek(videoHeaderSize)
+		extFormat, err := validateVideoExtension(status.Filename, s.config.Upload.VideoFormats)
+		if err == nil {
+			err = validateVideoContent(header, extFormat, s.config.Upload.VideoFormats)
+		}
+		if err != nil {
+			s.logFor(c).Debug("Chunked upload content validation failed: ", err.Error())
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		body = buffered
+	}
+
+	status, err = s.clientService.AppendChunk(c.UserContext(), userID, req.UploadID, offset, length, body)
+	if err != nil {
+		var offsetErr *services.ChunkOffsetError
+		switch {
+		case errors.As(err, &offsetErr):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error(), "received": offsetErr.Expected})
+		case errors.Is(err, services.ErrChunkedUploadBusy):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrChunkedUploadNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrChunkTooLarge):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "chunk ended before Content-Range end", "received": status.Received})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(status)
+}
+
+// completeChunkedUpload handles the request to complete a chunked upload once all of its chunks are sent, creating
+// the scene like /user/scene/new would. It is a JWT protected route.
+//
+// It expects path parameter `upload_id`. Responds with 409 if bytes are missing, and with the scene ID otherwise.
+// If creating the scene fails, the upload is kept, so the request can be retried.
+func (s *WebServer) completeChunkedUpload(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Complete chunked upload request received")
+
+	var req ChunkedUploadRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Complete chunked upload request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := s.clientService.CompleteChunkedUpload(c.UserContext(), userID, req.UploadID)
+	if err != nil {
+		s.logFor(c).Debug("Video processing failed:", err.Error())
+		switch {
+		case errors.Is(err, services.ErrChunkedUploadNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrChunkedUploadIncomplete), errors.Is(err, services.ErrChunkedUploadBusy):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrStorageReadOnly), errors.Is(err, services.ErrNoWorkersAvailable):
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrStorageFull):
+			return c.Status(http.StatusInsufficientStorage).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	s.logFor(c).Debugf("Chunked upload completed and processing scene %s.\n", sceneID)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"id": sceneID, "message": "Video received and processing scene. Check back later for updates."})
+}
+
+// getSceneMetadata handles the request to get the metadata for a scene. It is a JWT protected route.
+//
+// It expects path parameter `scene_id`.
+func (s *WebServer) getSceneMetadata(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene metadata request received")
+
+	var req GetSceneMetadataRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get job data request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid job ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job ID"})
+	}
+
+	sceneData, err := s.clientService.GetSceneMetadata(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get job data: ", err.Error())
+		if errors.Is(err, scene.ErrSceneNotFound) || errors.Is(err, scene.ErrNerfNotFound) || errors.Is(err, scene.ErrSfmNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	sceneJson, err := json.Marshal(sceneData)
+	if err != nil {
+		s.logFor(c).Debug("Failed to marshal job data: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	s.logFor(c).Debug(fmt.Sprintf("Job data retrieved successfully, data: %s", sceneJson))
+	return c.Status(http.StatusOK).Send(sceneJson)
+}
+
+// defaultHistoryPageSize is the number of scenes returned by getUserSceneHistory when no limit is given.
+const defaultHistoryPageSize = 20
+
+// exportSceneHistory handles the request to download all scenes of a user as a spreadsheet friendly file. It is a
+// JWT protected route.
+//
+// It expects an optional query parameter `format`: "csv" (the default) or "json". Each scene, including scenes still
+// processing or failed, is exported with its id, name, status, created_at, size (of the uploaded video, in bytes)
+// and tags, oldest first. CSV fields are quoted as needed (RFC 4180), and tags are joined by commas within their
+// field. Names and tags starting with a formula character are prefixed with a quote (see csvCell), so spreadsheets do
+// not evaluate them. The export is streamed as the scenes are read, so a failure while streaming truncates it.
+func (s *WebServer) exportSceneHistory(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Export scene history request received")
+
+	var req ExportSceneHistoryRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Export scene history request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", c.Locals("userID").(string))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	format := req.Format
+	if format == "" {
+		format = "csv"
+	}
+	if format == "json" {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	} else {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="scenes.%s"`, format))
+
+	// The fiber context is released once the handler returns, so nothing in the stream writer may use it
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var err error
+		if format == "json" {
+			err = s.writeSceneHistoryJSON(w, userID)
+		} else {
+			err = s.writeSceneHistoryCSV(w, userID)
+		}
+		if err != nil {
+			// Either the client went away or the scenes could not be read, the export can not be completed
+			s.logger.Error("Failed to export scene history: ", err.Error())
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+// writeSceneHistoryCSV writes the scene history export of the user as CSV, with a header row.
+func (s *WebServer) writeSceneHistoryCSV(w *bufio.Writer, userID primitive.ObjectID) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"id", "name", "status", "created_at", "size", "tags"}); err != nil {
+		return err
+	}
+	err := s.clientService.ExportSceneHistory(context.Background(), userID, func(row *services.SceneExportRow) error {
+		if err := writer.Write(sceneHistoryRecord(row)); err != nil {
+			return err
+		}
+		// Writes fail once the client went away, which stops the export
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// sceneHistoryRecord returns the CSV record of a scene in the scene history export.
+func sceneHistoryRecord(row *services.SceneExportRow) []string {
+	return []string{
+		row.ID,
+		csvCell(row.Name),
+		row.StatusName,
+		row.CreatedAt.Format(time.RFC3339),
+		strconv.FormatInt(row.Size, 10),
+		csvCell(strings.Join(row.Tags, ",")),
+	}
+}
+
+// csvCell returns the user supplied value escaped for a CSV cell: values starting with a character spreadsheets
+// start formulas with ('=', '+', '-', '@', a tab or a carriage return) are prefixed with a quote, so they are shown
+// as text rather than evaluated.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// writeSceneHistoryJSON writes the scene history export of the user as a JSON array.
+func (s *WebServer) writeSceneHistoryJSON(w *bufio.Writer, userID primitive.ObjectID) error {
+	if _, err := w.WriteString("["); err != nil {
+		return err
+	}
+	first := true
+	err := s.clientService.ExportSceneHistory(context.Background(), userID, func(row *services.SceneExportRow) error {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := w.WriteString(","); err != nil {
+				return err
+			}
+		}
+		first = false
+		// Writes fail once the client went away, which stops the export
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := w.WriteString("]"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// getUserSceneHistory handles the request to get the history of scenes for a user. It is a JWT protected route.
+//
+// The user can optionally specify RFC3339 query parameters `since` and `until` to only include scenes created
+// within that range. Results are paginated with query parameters `limit` (1-100, default 20) and `offset`.
+// Responds with `{"resources": [string], "total": int, "scene_count": int, "limit": int, "offset": int,
+// "is_empty": bool}`, where total is the number of scenes across all pages, and scene_count the number of scenes the
+// user owns, including scenes still processing or failed and regardless of the date range. The shape is the same
+// when there are no scenes: resources is an empty list, and is_empty is set, so clients can tell a user without
+// history (i.e to show onboarding) from a past-the-end page, where only resources is empty.
+func (s *WebServer) getUserSceneHistory(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get user history request received")
+
+	var req GetUserSceneHistoryRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get user history request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	since, until, err := ParseTimeRange(req.Since, req.Until)
+	if err != nil {
+		s.logFor(c).Debug("Invalid history date range: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultHistoryPageSize
+	}
+
+	sceneIDList, total, err := s.clientService.GetUserSceneHistory(c.UserContext(), userID, since, until, req.Offset, limit)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get user history: ", err.Error())
+		return s.internalError(c, err)
+	}
+	sceneCount, err := s.clientService.CountUserScenes(c.UserContext(), userID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to count user scenes: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	s.logFor(c).Debug("User history retrieved successfully")
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"resources":   sceneIDList,
+		"total":       total,
+		"scene_count": sceneCount,
+		"limit":       limit,
+		"offset":      req.Offset,
+		"is_empty":    total == 0,
+	})
+}
+
+// getUserTags handles the request to get the distinct tags used across the user's scenes, with their counts.
+// It is a JWT protected route.
+//
+// Tags are sorted by descending frequency.
+func (s *WebServer) getUserTags(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get user tags request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	tags, err := s.clientService.GetUserTags(c.UserContext(), userID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get user tags: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	s.logFor(c).Debug("User tags retrieved successfully")
+	return c.Status(http.StatusOK).JSON(fiber.Map{"tags": tags})
+}
+
+// getScenesSharedWithMe handles the request to list the scenes other users have shared with the caller.
+// It is a JWT protected route. Each scene includes its owner, and is marked read only.
+func (s *WebServer) getScenesSharedWithMe(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scenes shared with me request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	scenes, err := s.clientService.GetScenesSharedWithUser(c.UserContext(), userID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get shared scenes: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"scenes": scenes})
+}
+
+// getCurrentUser handles the request to get the profile of the logged in user, i.e to display their username.
+// It is a JWT protected route. Responds with the user's `id` and `username`.
+func (s *WebServer) getCurrentUser(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get current user request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	profile, err := s.clientService.GetUserByID(c.UserContext(), userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(profile)
+}
+
+// getUserUsage handles the request to get the total number of bytes the user has uploaded and downloaded.
+// It is a JWT protected route.
+func (s *WebServer) getUserUsage(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get user usage request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	usage, err := s.clientService.GetUserUsage(c.UserContext(), userID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get user usage: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(usage)
+}
+
+// setUserWebhook handles the request to set the URL the user's notifications are sent to. It is a JWT protected route.
+//
+// It expects a JSON payload with the following format:
+//
+//	{
+//	    "url": "https://example.com/hook"
+//	}
+//
+// A new signing secret is generated and returned on every change. An empty url removes the webhook.
+func (s *WebServer) setUserWebhook(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Set user webhook request received")
+
+	var req SetWebhookRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Set user webhook request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	secret, err := s.clientService.SetUserWebhook(c.UserContext(), userID, req.URL)
+	if err != nil {
+		s.logFor(c).Debug("Failed to set user webhook: ", err.Error())
+		if errors.Is(err, services.ErrInvalidWebhookURL) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	if req.URL == "" {
+		return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Webhook removed"})
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Webhook set", "secret": secret})
+}
+
+// testUserWebhook handles the request to send a signed sample payload to the user's webhook. It is a JWT protected route.
+//
+// Responds with the delivery result: whether it was delivered, the endpoint's status code, the latency, and any error.
+func (s *WebServer) testUserWebhook(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Test user webhook request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	delivery, err := s.clientService.TestUserWebhook(c.UserContext(), userID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to test user webhook: ", err.Error())
+		if errors.Is(err, services.ErrWebhookNotConfigured) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(delivery)
+}
+
+// getUserNotifications handles the request to get the unread notifications of the user's inbox, for clients that can
+// not receive webhooks. It is a JWT protected route.
+//
+// Notifications are added when the user's scenes complete or fail. Responds with `{"notifications": [...]}`, newest
+// first, each with its `id`, `type` (scene_completed or scene_failed), `scene_id`, `scene_name`, `message` (i.e the
+// failure reason) and `created_at`.
+func (s *WebServer) getUserNotifications(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get user notifications request received")
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	notifications, err := s.clientService.GetUserNotifications(c.UserContext(), userID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get user notifications: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	s.logFor(c).Debug("User notifications retrieved successfully")
+	return c.Status(http.StatusOK).JSON(fiber.Map{"notifications": notifications})
+}
+
+// markUserNotificationsRead handles the request to mark notifications of the user's inbox read, removing them from
+// the unread notifications. It is a JWT protected route.
+//
+// It expects an optional JSON body with `ids` (up to 100) of the notifications to mark read. Without ids, all unread
+// notifications are marked read. Responds with the number of notifications marked read in `marked`.
+func (s *WebServer) markUserNotificationsRead(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Mark user notifications read request received")
+
+	var req MarkNotificationsReadRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Mark user notifications read request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		notificationID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			s.logFor(c).Debug("Invalid notification ID: ", id)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid notification ID"})
+		}
+		ids = append(ids, notificationID)
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	marked, err := s.clientService.MarkUserNotificationsRead(c.UserContext(), userID, ids)
+	if err != nil {
+		s.logFor(c).Debug("Failed to mark user notifications read: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	s.logFor(c).Debug("User notifications marked read successfully")
+	return c.Status(http.StatusOK).JSON(fiber.Map{"marked": marked})
+}
+
+// getUserFailures handles the request to get the failure reasons and processing logs of all of the user's failed scenes.
+// It is a JWT protected route.
+//
+// The user can optionally specify RFC3339 query parameters `since` and `until` to only include scenes that failed
+// within that range.
+func (s *WebServer) getUserFailures(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get user failures request received")
+
+	var req GetUserFailuresRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get user failures request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	since, until, err := ParseTimeRange(req.Since, req.Until)
+	if err != nil {
+		s.logFor(c).Debug("Invalid failure date range: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	failures, err := s.clientService.GetUserFailures(c.UserContext(), userID, since, until)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get user failures: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	s.logFor(c).Debug("User failures retrieved successfully")
+	return c.Status(http.StatusOK).JSON(fiber.Map{"failures": failures})
+}
+
+// getSceneThumbnail handles the request to get the thumbnail for a scene. It is a JWT protected route.
+//
+// It expects path parameter `scene_id`. If the thumbnail's size is known, it is sent in the
+// `X-Thumbnail-Width` and `X-Thumbnail-Height` headers.
+func (s *WebServer) getSceneThumbnail(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene thumbnail request received")
+
+	var req GetSceneThumbnailRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene thumbnail request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	thumbnailPath, size, err := s.clientService.GetSceneThumbnailPath(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene thumbnail: ", err.Error())
+		if errors.Is(err, scene.ErrSceneNotFound) || errors.Is(err, scene.ErrSfmNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+	if size != nil {
+		c.Set(HeaderThumbnailWidth, strconv.Itoa(size.Width))
+		c.Set(HeaderThumbnailHeight, strconv.Itoa(size.Height))
+	}
+
+	thumbnailData, err := os.ReadFile(thumbnailPath)
+	if err != nil {
+		s.logFor(c).Debug("Failed to read thumbnail data: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	s.logFor(c).Debug("Scene thumbnail retrieved successfully")
+	c.Set(fiber.HeaderContentType, s.contentType(thumbnailPath))
+	s.recordDownload(c, int64(len(thumbnailData)))
+	return c.Status(http.StatusOK).Send(thumbnailData)
+}
+
+// refreshSceneThumbnailFromRender handles the request to replace a scene's thumbnail with a frame rendered from
+// its trained model. It is a JWT protected route, and only the owner of the scene may use it.
+//
+// It expects path parameter `scene_id`. Responds with 409 if the scene has not finished training.
+func (s *WebServer) refreshSceneThumbnailFromRender(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Refresh scene thumbnail request received")
+
+	var req RefreshSceneThumbnailRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Refresh scene thumbnail request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	if _, err := s.clientService.RefreshSceneThumbnailFromRender(c.UserContext(), userID, sceneID); err != nil {
+		s.logFor(c).Debug("Failed to refresh scene thumbnail: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotReady):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	s.logFor(c).Debug("Scene thumbnail refreshed successfully")
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Thumbnail updated"})
+}
+
+// getSceneCombinedLog handles the request to get the processing log of a scene as plain text, one entry per line
+// in time order, with a `--- <stage> stage started ---` marker line before the first entry of each stage.
+// It is a JWT protected route, and only the owner of the scene may use it.
+//
+// It expects path parameter `scene_id`, and optional query parameter `level` (debug, info, warn or error)
+// to only include entries of at least that level.
+func (s *WebServer) getSceneCombinedLog(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene combined log request received")
+
+	var req GetSceneCombinedLogRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene combined log request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	entries, err := s.clientService.GetSceneCombinedLog(c.UserContext(), userID, sceneID, req.Level)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene combined log: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		if entry.Marker {
+			b.WriteString(entry.Message)
+		} else {
+			fmt.Fprintf(&b, "%s [%s] [%s] %s", entry.Time.UTC().Format(time.RFC3339), strings.ToUpper(entry.Level), entry.Stage, entry.Message)
+		}
+		b.WriteByte('\n')
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.Status(http.StatusOK).SendString(b.String())
+}
+
+// getSfmQualityReport handles the request to get the SfM quality report of a scene (frames used vs total, registered
+// cameras, reprojection error). It is a JWT protected route, and the owner of the scene and the users it is shared with
+// may use it.
+//
+// It expects path parameter `scene_id`. Responds with 404 if the scene has no report.
+func (s *WebServer) getSfmQualityReport(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get sfm quality report request received")
+
+	var req GetSfmReportRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get sfm quality report request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	report, err := s.clientService.GetSfmQualityReport(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get sfm quality report: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound), errors.Is(err, scene.ErrSfmNotFound), errors.Is(err, scene.ErrSfmReportNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(report)
+}
+
+// getSfmPoses handles the request to get the camera poses SfM reconstructed for a scene: the intrinsic matrix, and the
+// extrinsic matrix of each frame. It is a JWT protected route, and the owner of the scene and the users it is shared
+// with may use it.
+//
+// It expects path parameter `scene_id`. Responds with 404 if SfM has not completed.
+func (s *WebServer) getSfmPoses(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get sfm poses request received")
+
+	var req GetSfmOutputRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get sfm poses request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	poses, err := s.clientService.GetSfmPoses(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get sfm poses: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound), errors.Is(err, scene.ErrSfmNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(poses)
+}
+
+// getSfmPointCloud handles the request to download the point cloud SfM reconstructed for a scene. It is a JWT protected
+// route, and the owner of the scene and the users it is shared with may use it.
+//
+// It expects path parameter `scene_id`. Responds with 404 if SfM has not completed, or the sfm-worker sent no point
+// cloud.
+func (s *WebServer) getSfmPointCloud(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get sfm point cloud request received")
+
+	var req GetSfmOutputRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get sfm point cloud request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	pointCloudPath, err := s.clientService.GetSfmPointCloudPath(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get sfm point cloud: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound), errors.Is(err, scene.ErrSfmNotFound), errors.Is(err, scene.ErrSfmPointCloudNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return s.sendFileWithRangeSupport(c, pointCloudPath)
+}
+
+// getScene handles the request to get a whole scene in a single call: its name, status, config, tags, sfm summary and
+// available outputs. It is a JWT protected route, and the owner of the scene and the users it is shared with may use
+// it.
+//
+// It expects path parameter `scene_id`.
+func (s *WebServer) getScene(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene request received")
+
+	var req GetSceneRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	details, err := s.clientService.GetSceneDetails(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(details)
+}
+
+// deleteScene handles the request to delete a scene that has finished processing. It is a JWT protected route, and
+// only the owner of the scene may use it.
+//
+// If a trash retention is configured, the scene is moved to the trash, from which it can be restored with
+// /data/scene/:scene_id/restore until it is purged along with its files. Otherwise it is deleted right away, along
+// with its files.
+//
+// It expects path parameter `scene_id`. Responds with 404 if the scene does not exist or the user does not own it,
+// and with 409 if the scene is still processing; queued scenes can be deleted with
+// /data/scene/cancel-and-delete/:scene_id.
+func (s *WebServer) deleteScene(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Delete scene request received")
+
+	var req DeleteSceneRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Delete scene request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	err = s.clientService.DeleteScene(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to delete scene: ", err.Error())
+		switch {
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrInvalidOpOnProcessingScene):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Scene is still processing"})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Scene deleted"})
+}
+
+// restoreScene handles the request to take a deleted scene out of the trash. It is a JWT protected route, and only
+// the owner of the scene may use it.
+//
+// It expects path parameter `scene_id`. Responds with 409 if the scene is not in the trash, or was deleted longer
+// ago than the trash retention, and with 404 if it was purged or the user does not own it.
+func (s *WebServer) restoreScene(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Restore scene request received")
+
+	var req DeleteSceneRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Restore scene request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	err = s.clientService.RestoreScene(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to restore scene: ", err.Error())
+		switch {
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotInTrash):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Scene restored"})
+}
+
+// cancelAndDeleteScene handles the request to cancel a queued scene and delete it, along with its files, in a single
+// call. It is a JWT protected route, and only the owner of the scene may use it.
+//
+// It expects path parameter `scene_id`. Responds with 409 if the scene has already started processing.
+func (s *WebServer) cancelAndDeleteScene(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Cancel and delete scene request received")
+
+	var req CancelAndDeleteSceneRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Cancel and delete scene request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	err = s.clientService.CancelAndDeleteScene(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to cancel and delete scene: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrInvalidOpOnProcessingScene):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Scene has already started processing"})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Scene cancelled and deleted"})
+}
+
+// downloadScenes handles the request to download the outputs of several scenes as a single ZIP archive. It is a JWT
+// protected route, and the owner of the scenes and the users they are shared with may use it.
+//
+// It expects a JSON body with `scene_ids` (up to 50) and an optional `output_types` filter, defaulting to all
+// output types. The archive holds a folder per scene: `<scene_id>/<output_type>/iteration_<n>/<file name>`.
+// Compressed outputs are stored decompressed, and files missing on disk are skipped.
+//
+// Responds with 403 if the user does not have access to one of the scenes, or 404 if one does not exist, before
+// anything is sent. The archive is streamed as it is written, so a failure while streaming truncates it.
+func (s *WebServer) downloadScenes(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Download scenes request received")
+
+	var req DownloadScenesRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Download scenes request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneIDs := make([]primitive.ObjectID, 0, len(req.SceneIDs))
+	for _, id := range req.SceneIDs {
+		sceneID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			s.logFor(c).Debug("Invalid scene ID: ", id)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+		}
+		sceneIDs = append(sceneIDs, sceneID)
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", c.Locals("userID").(string))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	entries, err := s.clientService.GetScenesOutputArchive(c.UserContext(), userID, sceneIDs, req.OutputTypes)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scenes output archive: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="scenes.zip"`)
+	// The fiber context is released once the handler returns, so nothing in the stream writer may use it
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		counter := &countingWriter{w: w}
+		archive := zip.NewWriter(counter)
+		for _, entry := range entries {
+			if err := writeArchiveEntry(archive, entry); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					s.logger.Debug("Skipping missing output in archive: ", entry.Path)
+					continue
+				}
+				// Either the client went away or the file could not be read, the archive can not be completed
+				s.logger.Error("Failed to write scenes archive: ", err.Error())
+				break
+			}
+		}
+		archive.Close()
+		w.Flush()
+		s.clientService.RecordTransfer(context.TODO(), userID, 0, counter.n)
+	})
+
+	return nil
+}
+
+// writeArchiveEntry adds a stored output to a ZIP archive, decompressing it if it is compressed.
+func writeArchiveEntry(archive *zip.Writer, entry services.OutputArchiveEntry) error {
+	info, err := os.Stat(entry.Path)
+	if err != nil {
+		return err
+	}
+	reader, err := services.OpenOutput(entry.Path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: entry.Name, Method: zip.Deflate, Modified: info.ModTime()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, reader)
+	return err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// getSceneTurntable handles the request to get the turntable preview of a completed scene: a sequence of frames
+// rendered while orbiting the trained model. It is a JWT protected route, and the owner of the scene and the users it
+// is shared with may use it.
+//
+// It expects path parameter `scene_id`. Frames are sent in playback order as the parts of a `multipart/mixed`
+// response, and the number of frames is given in the `X-Frame-Count` header. Responds with 404 if the scene has no
+// turntable preview.
+func (s *WebServer) getSceneTurntable(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene turntable request received")
+
+	var req GetSceneTurntableRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene turntable request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	framePaths, err := s.clientService.GetSceneTurntableFrames(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene turntable: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound), errors.Is(err, scene.ErrNerfNotFound), errors.Is(err, scene.ErrTurntableNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, framePath := range framePaths {
+		header := textproto.MIMEHeader{}
+		header.Set(fiber.HeaderContentType, s.contentType(framePath))
+		header.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; name="frame"; filename="%s"`, filepath.Base(framePath)))
+		header.Set("X-Frame-Index", strconv.Itoa(i))
+
+		part, err := mw.CreatePart(header)
+		if err != nil {
+			return s.internalError(c, err)
+		}
+		frame, err := os.ReadFile(framePath)
+		if err != nil {
+			s.logFor(c).Debug("Failed to read turntable frame: ", err.Error())
+			return s.internalError(c, err)
+		}
+		if _, err := part.Write(frame); err != nil {
+			return s.internalError(c, err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return s.internalError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "multipart/mixed; boundary="+mw.Boundary())
+	c.Set("X-Frame-Count", strconv.Itoa(len(framePaths)))
+	s.recordDownload(c, int64(body.Len()))
+	return c.Status(http.StatusOK).Send(body.Bytes())
+}
+
+// getSceneName handles the request to get the name of a scene. It is a JWT protected route.
+//
+// It expects path parameter `scene_id`.
+func (s *WebServer) getSceneName(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene name request received")
+
+	var req GetSceneNameRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene name request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneName, err := s.clientService.GetSceneName(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene name: ", err.Error())
+		if errors.Is(err, scene.ErrSceneNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"name": sceneName})
+}
+
+// getSceneOutput handles the request to get the output for a scene. It is a JWT protected route.
+//
+// It expects a path parameters `scene_id` `output_type`.
+//
+// The user can optionally specify a query parameter `iteration` to get the output at a specific iteration.
+// If the iteration is not specified, the latest output is given.
+func (s *WebServer) getSceneOutput(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene output request received")
+
+	var req GetSceneOutputRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene output request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", req.SceneID)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", c.Locals("userID").(string))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	outputPath, iteration, err := s.clientService.GetSceneOutputPath(c.UserContext(), userID, sceneID, req.OutputType, req.Iteration)
+	if err != nil {
+		s.logFor(c).Debugf("Failed to get scene output: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	s.clientService.RecordOutputDownload(sceneID, req.OutputType, iteration)
+	return s.sendOutputFile(c, outputPath)
+}
+
+// getSceneOutputIteration handles the request to download a scene output saved at a specific iteration. It is a JWT
+// protected route, and the owner of the scene and the users it is shared with may use it.
+//
+// It expects path parameters `scene_id` and `output_type`, and an optional query parameter `iteration`.
+// If the iteration is not specified, the final saved iteration is given. Responds with 404 if the output was not saved
+// at the iteration, listing the saved iterations in `available_iterations`.
+func (s *WebServer) getSceneOutputIteration(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene output iteration request received")
+
+	var req GetSceneOutputIterationRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene output iteration request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	outputPath, iteration, err := s.clientService.GetSceneOutputIterationPath(c.UserContext(), userID, sceneID, req.OutputType, req.Iteration)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene output iteration: ", err.Error())
+		var notSaved *services.IterationNotSavedError
+		switch {
+		case errors.As(err, &notSaved):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error(), "available_iterations": notSaved.Available})
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound), errors.Is(err, scene.ErrNerfNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	s.clientService.RecordOutputDownload(sceneID, req.OutputType, iteration)
+	return s.sendOutputFile(c, outputPath)
+}
+
+// getSceneOutputStats handles the request to get how often the outputs of a type of a scene were downloaded.
+// It is a JWT protected route, and only the owner of the scene may use it.
+//
+// It expects path parameters `scene_id` and `output_type`. Responds with the download count and last access time of
+// each saved iteration in `stats`.
+func (s *WebServer) getSceneOutputStats(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene output stats request received")
+
+	var req GetSceneOutputStatsRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene output stats request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	stats, err := s.clientService.GetSceneOutputStats(c.UserContext(), userID, sceneID, req.OutputType)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene output stats: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound), errors.Is(err, scene.ErrNerfNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"stats": stats})
+}
+
+// getSceneProgress handles the request to get the progress of a scene. It is a JWT protected route.
+//
+// It expects a path parameter `scene_id`.
+func (s *WebServer) getSceneProgress(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene progress request received")
+
+	var req GetSceneProgressRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene progress request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	progress, err := s.clientService.GetSceneProgress(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene progress: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(progress)
+}
+
+// getScenesMetadata handles the request to get the metadata of several scenes at once (see getSceneMetadata). It is a
+// JWT protected route.
+//
+// It expects a JSON body with `scene_ids` (up to 100). Responds with the metadata of each scene the user owns in
+// `scenes`, keyed by scene ID. The other scenes, including ones without outputs yet, are listed in `skipped`.
+func (s *WebServer) getScenesMetadata(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scenes metadata request received")
+
+	var req GetScenesMetadataRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scenes metadata request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneIDs := make([]primitive.ObjectID, 0, len(req.SceneIDs))
+	for _, id := range req.SceneIDs {
+		sceneID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			s.logFor(c).Debug("Invalid scene ID: ", id)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+		}
+		sceneIDs = append(sceneIDs, sceneID)
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", c.Locals("userID").(string))
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	metadata, err := s.clientService.GetScenesMetadata(c.UserContext(), userID, sceneIDs)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scenes metadata: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(metadata)
+}
+
+// getSceneVideoInfo handles the request to get the metadata of a scene's uploaded video, without the video itself. It
+// is a JWT protected route, and the owner of the scene and the users it is shared with may use it.
+//
+// It expects path parameter `scene_id`, and responds with:
+//
+//	{
+//	    "width": int,
+//	    "height": int,
+//	    "fps": int,
+//	    "duration": int (seconds),
+//	    "frame_count": int,
+//	    "codec": string (if probed),
+//	    "size": int (bytes)
+//	}
+//
+// Responds with 404 if the scene does not exist, or its video has not been probed yet.
+func (s *WebServer) getSceneVideoInfo(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene video info request received")
+
+	var req GetSceneVideoInfoRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene video info request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	info, err := s.clientService.GetSceneVideoInfo(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene video info: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound), errors.Is(err, services.ErrVideoNotProbed):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(info)
+}
+
+// getSceneStatus handles the request to get the processing status of a scene. It is a JWT protected route, and the
+// owner of the scene and the users it is shared with may use it.
+//
+// It expects path parameter `scene_id`, and responds with:
+//
+//	{
+//	    "status": "sfm_processing" | "nerf_processing" | "complete" | "failed",
+//	    "sfm": "pending" | "running" | "done" | "failed",
+//	    "nerf": "pending" | "running" | "done" | "failed",
+//	    "progress": float64 (0-1)
+//	}
+func (s *WebServer) getSceneStatus(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get scene status request received")
+
+	var req GetSceneStatusRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get scene status request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	status, err := s.clientService.GetSceneStatus(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get scene status: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(status)
+}
+
+// streamSceneProgress handles the request to follow the processing of a scene. It is a JWT protected route, and the
+// owner of the scene and the users it is shared with may use it.
+//
+// It expects path parameter `scene_id`. The processing status (see getSceneStatus) is streamed as server-sent events
+// of the form `event: progress` / `data: {"status", "sfm", "nerf", "progress"}`, first the current status and then
+// each change. The stream ends with an `event: done` once the scene completes or fails, or an `event: error` if the
+// scene can no longer be read (i.e it was deleted).
+func (s *WebServer) streamSceneProgress(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Stream scene progress request received")
+
+	var req StreamSceneProgressRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Stream scene progress request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	updates, cancel, err := s.clientService.WatchSceneStatus(c.UserContext(), userID, sceneID, s.config.SceneProgressInterval)
+	if err != nil {
+		s.logFor(c).Debug("Failed to watch scene status: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// Stops the watch when the client goes away, so it does not outlive the stream
+		defer cancel()
+		keepAlive := time.NewTicker(sceneProgressKeepAlive)
+		defer keepAlive.Stop()
+
+		var last scene.ProcessingStatus
+		for {
+			select {
+			case status, ok := <-updates:
+				if !ok {
+					if last.Finished() {
+						fmt.Fprint(w, "event: done\ndata: {}\n\n")
+					} else {
+						fmt.Fprint(w, "event: error\ndata: {\"error\": \"scene is no longer available\"}\n\n")
+					}
+					w.Flush()
+					return
+				}
+				last = status
+				data, _ := json.Marshal(status)
+				fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				// Client went away
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// streamSceneETA handles the request to follow the estimated completion of a scene. It is a JWT protected route, and
+// the owner of the scene and the users it is shared with may use it.
+//
+// It expects path parameter `scene_id`. Estimates are streamed as server-sent events of the form `event: eta` /
+// `data: {"processing", "position", "queue_size", "average_interval", "estimated_completion"}`, first the current
+// estimate and then each significant change as the queue drains. The stream ends with an `event: done` once the scene
+// left the processing queue, or an `event: error` if the estimate can no longer be computed.
+func (s *WebServer) streamSceneETA(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Stream scene ETA request received")
+
+	var req StreamSceneETARequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Stream scene ETA request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	if err != nil {
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	updates, cancel, err := s.clientService.WatchSceneETA(c.UserContext(), userID, sceneID, s.config.SceneProgressInterval)
+	if err != nil {
+		s.logFor(c).Debug("Failed to watch scene ETA: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// Stops the watch when the client goes away, so it does not outlive the stream
+		defer cancel()
+		keepAlive := time.NewTicker(sceneProgressKeepAlive)
+		defer keepAlive.Stop()
+
+		processing := true
+		for {
+			select {
+			case eta, ok := <-updates:
+				if !ok {
+					if processing {
+						fmt.Fprint(w, "event: error\ndata: {\"error\": \"scene ETA is no longer available\"}\n\n")
+					} else {
+						fmt.Fprint(w, "event: done\ndata: {}\n\n")
+					}
+					w.Flush()
+					return
+				}
+				processing = eta.Processing
+				data, _ := json.Marshal(eta)
+				fmt.Fprintf(w, "event: eta\ndata: %s\n\n", data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				// Client went away
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// updateScene handles the request to update several fields of a scene at once. It is a JWT protected route, and
+// only the owner of the scene may use it.
+//
+// It expects path parameter `scene_id`, and a JSON payload with any of the following fields:
+//
+//	{
+//	    "name": "name" (1-128 characters),
+//	    "description": "description" (up to 2048 characters, empty clears it),
+//	    "tags": ["tag", ...] (up to 16, replacing the current tags),
+//	    "favorite": bool
+//	}
+//
+// All provided fields are applied in a single update; unknown fields are ignored. Responds with 400 if no field
+// is provided.
+func (s *WebServer) updateScene(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Update scene request received")
+
+	var req UpdateSceneRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Update scene request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	update := scene.SceneUpdate{Name: req.Name, Description: req.Description, Favorite: req.Favorite}
+	if req.Tags != nil {
+		tags := normalizeTags(*req.Tags)
+		update.Tags = &tags
+	}
+	if update.IsEmpty() {
+		s.logFor(c).Debug("Update scene request has no fields")
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "No fields to update"})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Failed to marshal job data: ", err.Error())
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
 	}
 
-	s.logger.Debug(fmt.Sprintf("Job data retrieved successfully, data: %s", sceneJson))
-	return c.Status(http.StatusOK).Send(sceneJson)
+	err = s.clientService.UpdateScene(c.UserContext(), userID, sceneID, update)
+	if err != nil {
+		s.logFor(c).Debug("Failed to update scene: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Scene updated"})
 }
 
-// getUserSceneHistory handles the request to get the history of scenes for a user. It is a JWT protected route.
-func (s *WebServer) getUserSceneHistory(c *fiber.Ctx) error {
-	s.logger.Debug("Get user history request received")
+// renameScene handles the request to rename a scene. It is a JWT protected route, and only the owner of the scene
+// may use it. Responds with 404 if the scene does not exist or the user does not own it.
+//
+// It expects path parameter `scene_id`, and a JSON payload with the following format:
+//
+//	{
+//	    "scene_name": "name" (1-128 characters)
+//	}
+func (s *WebServer) renameScene(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Rename scene request received")
+
+	var req RenameSceneRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Rename scene request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
 
 	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", err.Error())
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
 	}
 
-	sceneIDList, err := s.clientService.GetUserSceneHistory(context.TODO(), userID)
+	err = s.clientService.RenameScene(c.UserContext(), userID, sceneID, req.SceneName)
 	if err != nil {
-		s.logger.Debug("Failed to get user history: ", err.Error())
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		s.logFor(c).Debug("Failed to rename scene: ", err.Error())
+		switch {
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
 	}
 
-	s.logger.Debug("User history retrieved successfully")
-	return c.Status(http.StatusOK).JSON(fiber.Map{"resources": sceneIDList})
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Scene renamed"})
 }
 
-// getSceneThumbnail handles the request to get the thumbnail for a scene. It is a JWT protected route.
+// promoteScene handles the request to promote a completed preview scene to a full quality run, reusing its video
+// (and sfm output, when available) instead of re-uploading. It is a JWT protected route, and only the owner of the
+// scene may use it.
 //
-// It expects path parameter `scene_id`
-func (s *WebServer) getSceneThumbnail(c *fiber.Ctx) error {
-	s.logger.Debug("Get scene thumbnail request received")
+// It expects path parameter `scene_id`. Responds with the ID of the new scene, which is processed like an upload.
+func (s *WebServer) promoteScene(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Promote scene request received")
 
-	var req GetSceneThumbnailRequest
+	var req PromoteSceneRequest
 	if err := ValidateRequest(c, &req); err != nil {
-		s.logger.Debug("Get scene thumbnail request validation failed: ", err.Error())
+		s.logFor(c).Debug("Promote scene request validation failed: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	if err != nil {
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+	}
+
 	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", err.Error())
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
 	}
 
+	newSceneID, err := s.clientService.PromoteScene(c.UserContext(), userID, sceneID)
+	if err != nil {
+		s.logFor(c).Debug("Failed to promote scene: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNoAccess):
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrSceneNotReady), errors.Is(err, scene.ErrSceneNotPreview):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrPromotionSourceMissing):
+			return c.Status(http.StatusGone).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"id": newSceneID, "message": "Full run queued. Check back later for updates."})
+}
+
+// defaultShareLinkTTL is how long a share link is valid for when no ttl is given.
+const defaultShareLinkTTL = 24 * time.Hour
+
+// createShareLink handles the request to create a share link to a completed scene, giving anyone holding it read
+// access to the scene's outputs until it expires. It is a JWT protected route, and only the owner of the scene may
+// use it. Responds with 404 if the scene does not exist or the user does not own it.
+//
+// It expects path parameter `scene_id`, and an optional JSON payload with the following format:
+//
+//	{
+//	    "ttl": "24h" (Go duration, up to the configured maximum, default 24h)
+//	}
+//
+// Responds with `{"token": string, "expires_at": RFC3339}`. The link is then served under /shared/:token.
+func (s *WebServer) createShareLink(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Create share link request received")
+
+	var req CreateShareLinkRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Create share link request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ttl := defaultShareLinkTTL
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 || parsed > s.config.ShareLinkMaxTTL {
+			s.logFor(c).Debug("Invalid share link ttl: ", req.TTL)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("ttl must be a positive duration of at most %s", s.config.ShareLinkMaxTTL)})
+		}
+		ttl = parsed
+	}
+
 	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
 	if err != nil {
-		s.logger.Debug("Invalid scene ID: ", err.Error())
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
 	}
 
-	thumbnailPath, err := s.clientService.GetSceneThumbnailPath(context.TODO(), userID, sceneID)
+	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Failed to get scene thumbnail: ", err.Error())
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
 	}
 
-	thumbnailData, err := os.ReadFile(thumbnailPath)
+	err = s.clientService.CheckSceneShareable(c.UserContext(), userID, sceneID)
 	if err != nil {
-		s.logger.Debug("Failed to read thumbnail data: ", err.Error())
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		s.logFor(c).Debug("Scene cannot be shared: ", err.Error())
+		switch {
+		case errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrNerfNotFound):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": scene.ErrSceneNotReady.Error()})
+		default:
+			return s.internalError(c, err)
+		}
 	}
 
-	s.logger.Debug("Scene thumbnail retrieved successfully")
-	return c.Status(http.StatusOK).Send(thumbnailData)
+	expiresAt := time.Now().Add(ttl)
+	token, err := s.signShareLink(sceneID, expiresAt)
+	if err != nil {
+		s.logFor(c).Debug("Failed to sign share link: ", err.Error())
+		if errors.Is(err, ErrShareLinksUnavailable) {
+			return c.Status(http.StatusNotImplemented).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{"token": token, "expires_at": expiresAt.UTC().Truncate(time.Second)})
 }
 
-// getSceneName handles the request to get the name of a scene. It is a JWT protected route.
+// shareLinkError responds to a request with a share link that could not be verified: 410 if it has expired,
+// or 404 if it is invalid.
+func (s *WebServer) shareLinkError(c *fiber.Ctx, err error) error {
+	s.logFor(c).Debug("Share link rejected: ", err.Error())
+	if errors.Is(err, ErrShareLinkExpired) {
+		return c.Status(http.StatusGone).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": ErrShareLinkInvalid.Error()})
+}
+
+// getSharedSceneInfo handles the request to check a share link without fetching its content. It is not JWT
+// protected; the share link itself grants access.
 //
-// It expects path parameter `scene_id`.
-func (s *WebServer) getSceneName(c *fiber.Ctx) error {
-	s.logger.Debug("Get scene name request received")
+// It expects path parameter `token`. Responds with 410 if the link has expired, or 404 if it is invalid or the scene
+// no longer exists. Otherwise responds with the following format:
+//
+//	{
+//	    "scene_id": string,
+//	    "name": string,
+//	    "outputs": {"output_type": [int (iteration), ...], ...},
+//	    "expires_at": RFC3339,
+//	    "remaining_seconds": int
+//	}
+func (s *WebServer) getSharedSceneInfo(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get shared scene info request received")
 
-	var req GetSceneNameRequest
+	var req GetSharedSceneInfoRequest
 	if err := ValidateRequest(c, &req); err != nil {
-		s.logger.Debug("Get scene name request validation failed: ", err.Error())
+		s.logFor(c).Debug("Get shared scene info request validation failed: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
+	link, err := s.parseShareLink(req.Token)
 	if err != nil {
-		s.logger.Debug("Invalid scene ID: ", err.Error())
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+		return s.shareLinkError(c, err)
 	}
 
-	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	info, err := s.clientService.GetSharedSceneInfo(c.UserContext(), link.SceneID)
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", err.Error())
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		s.logFor(c).Debug("Failed to get shared scene info: ", err.Error())
+		if errors.Is(err, scene.ErrSceneNotFound) || errors.Is(err, scene.ErrNerfNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"scene_id":          info.ID,
+		"name":              info.Name,
+		"outputs":           info.Outputs,
+		"expires_at":        link.Expiry().UTC(),
+		"remaining_seconds": int64(time.Until(link.Expiry()).Seconds()),
+	})
+}
+
+// getSharedSceneOutput handles the request to download an output of a shared scene. It is not JWT protected;
+// the share link itself grants access.
+//
+// It expects path parameters `token` and `output_type`, and an optional query parameter `iteration`, defaulting to
+// the latest saved iteration. Responds with 410 if the link has expired, or 404 if it is invalid or the output does
+// not exist.
+func (s *WebServer) getSharedSceneOutput(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get shared scene output request received")
+
+	var req GetSharedSceneOutputRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get shared scene output request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	sceneName, err := s.clientService.GetSceneName(context.TODO(), userID, sceneID)
+	link, err := s.parseShareLink(req.Token)
 	if err != nil {
-		s.logger.Debug("Failed to get scene name: ", err.Error())
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return s.shareLinkError(c, err)
 	}
 
-	return c.Status(http.StatusOK).JSON(fiber.Map{"name": sceneName})
+	outputPath, iteration, err := s.clientService.GetSharedSceneOutputPath(c.UserContext(), link.SceneID, req.OutputType, req.Iteration)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get shared scene output: ", err.Error())
+		var notSaved *services.IterationNotSavedError
+		switch {
+		case errors.As(err, &notSaved):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error(), "available_iterations": notSaved.Available})
+		case errors.Is(err, scene.ErrSceneNotFound), errors.Is(err, scene.ErrNerfNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	s.clientService.RecordOutputDownload(link.SceneID, req.OutputType, iteration)
+	return s.sendOutputFile(c, outputPath)
 }
 
-// getSceneOutput handles the request to get the output for a scene. It is a JWT protected route.
-// 
-// It expects a path parameters `scene_id` `output_type`.
-// 
-// The user can optionally specify a query parameter `iteration` to get the output at a specific iteration.
-// If the iteration is not specified, the latest output is given.
-func (s *WebServer) getSceneOutput(c *fiber.Ctx) error {
-	s.logger.Debug("Get scene output request received")
+// updateSceneACL handles the request to grant or revoke another user's read access to a scene. It is a JWT protected route.
+// Only the owner of the scene may change its ACL. Users the scene is shared with may view it, but not modify or delete it,
+// and get 404 like other users.
+//
+// It expects path parameter `scene_id`, and a JSON payload with the following format:
+//
+//	{
+//	    "username": "username",
+//	    "action": "grant" | "revoke"
+//	}
+func (s *WebServer) updateSceneACL(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Update scene ACL request received")
 
-	var req GetSceneOutputRequest
+	var req UpdateSceneACLRequest
 	if err := ValidateRequest(c, &req); err != nil {
-		s.logger.Debug("Get scene output request validation failed: ", err.Error())
+		s.logFor(c).Debug("Update scene ACL request validation failed: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
 	if err != nil {
-		s.logger.Debug("Invalid scene ID: ", req.SceneID)
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
 	}
 
 	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", c.Locals("userID").(string))
+		s.logFor(c).Debug("Invalid user ID: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
 	}
 
-	outputPath, err := s.clientService.GetSceneOutputPath(context.TODO(), userID, sceneID, req.OutputType, req.Iteration)
+	grant := req.Action == "grant"
+	err = s.clientService.UpdateSceneACL(c.UserContext(), userID, sceneID, req.Username, grant)
 	if err != nil {
-		s.logger.Debugf("Failed to get scene output: ", err.Error())
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		s.logFor(c).Debug("Failed to update scene ACL: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNotFound), errors.Is(err, scene.ErrSceneNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, scene.ErrShareWithOwner):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
 	}
 
-	return s.sendFileWithRangeSupport(c, outputPath)
+	if grant {
+		return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Access granted"})
+	}
+	return c.Status(http.StatusOK).JSON(fiber.Map{"message": "Access revoked"})
 }
 
-// getSceneProgress handles the request to get the progress of a scene. It is a JWT protected route.
+// getPlatformStats handles the request to get aggregate platform statistics. It is an admin protected route.
+func (s *WebServer) getPlatformStats(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get platform stats request received")
+
+	stats, err := s.clientService.GetPlatformStats(c.UserContext())
+	if err != nil {
+		s.logFor(c).Debug("Failed to get platform stats: ", err.Error())
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(stats)
+}
+
+// maxThroughputWindow is the longest window queue throughput can be requested for.
+const maxThroughputWindow = 90 * 24 * time.Hour
+
+// getQueueThroughput handles the request to get the number of processing jobs finished per hour or day.
+// It is an admin protected route.
 //
-// It expects a path parameter `scene_id`.
-func (s *WebServer) getSceneProgress(c *fiber.Ctx) error {
-	s.logger.Debug("Get scene progress request received")
+// It expects optional query parameters `window`, a Go duration (i.e "24h", "168h", default 24h, at most 90 days),
+// and `bucket`, either "hour" or "day" (default hour).
+func (s *WebServer) getQueueThroughput(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get queue throughput request received")
 
-	var req GetSceneProgressRequest
+	var req GetQueueThroughputRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Get queue throughput request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	window := 24 * time.Hour
+	if req.Window != "" {
+		var err error
+		window, err = time.ParseDuration(req.Window)
+		if err != nil || window <= 0 || window > maxThroughputWindow {
+			s.logFor(c).Debug("Invalid throughput window: ", req.Window)
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid window, expected a positive duration of at most 2160h"})
+		}
+	}
+	bucket := req.Bucket
+	if bucket == "" {
+		bucket = "hour"
+	}
+
+	throughput, err := s.clientService.GetQueueThroughput(c.UserContext(), window, bucket)
+	if err != nil {
+		s.logFor(c).Debug("Failed to get queue throughput: ", err.Error())
+		if errors.Is(err, services.ErrInvalidThroughputBucket) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(throughput)
+}
+
+// setUserRole handles the request to change the role of a user. It is an admin protected route.
+//
+// It expects a JSON payload with the following format:
+//
+//	{
+//	    "username": "username",
+//	    "role": "user" | "admin",
+//	    "revoke_tokens": bool (optional)
+//	}
+//
+// Admin routes check the role on every request, so the change takes effect immediately. Tokens carry the role
+// for clients, and are updated by /user/account/token/refresh. If revoke_tokens is true, all of the user's
+// existing tokens are rejected from now on.
+func (s *WebServer) setUserRole(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Set user role request received")
+
+	var req SetUserRoleRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Set user role request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	err := s.clientService.SetUserRole(c.UserContext(), req.Username, req.Role, req.RevokeTokens)
+	if err != nil {
+		s.logFor(c).Debug("Failed to set user role: ", err.Error())
+		switch {
+		case errors.Is(err, user.ErrUserNotFound):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, user.ErrInvalidRole):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		default:
+			return s.internalError(c, err)
+		}
+	}
+
+	return c.Status(http.StatusOK).JSON(fiber.Map{
+		"username":       req.Username,
+		"role":           req.Role,
+		"tokens_revoked": req.RevokeTokens,
+	})
+}
+
+// repairScene handles the request to validate a scene document and fill its missing fields with defaults.
+// It is an admin protected route.
+//
+// It expects path parameter `scene_id`. If query parameter `dry_run=true` is given, repairs are only reported.
+func (s *WebServer) repairScene(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Repair scene request received")
+
+	var req RepairSceneRequest
 	if err := ValidateRequest(c, &req); err != nil {
-		s.logger.Debug("Get scene progress request validation failed: ", err.Error())
+		s.logFor(c).Debug("Repair scene request validation failed: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	sceneID, err := primitive.ObjectIDFromHex(req.SceneID)
 	if err != nil {
-		s.logger.Debug("Invalid scene ID: ", err.Error())
+		s.logFor(c).Debug("Invalid scene ID: ", err.Error())
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
 	}
 
-	userID, err := primitive.ObjectIDFromHex(c.Locals("userID").(string))
+	report, err := s.clientService.RepairScene(c.UserContext(), sceneID, req.DryRun)
 	if err != nil {
-		s.logger.Debug("Invalid user ID: ", err.Error())
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		s.logFor(c).Debug("Failed to repair scene: ", err.Error())
+		if errors.Is(err, scene.ErrSceneNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		return s.internalError(c, err)
 	}
 
-	progress, err := s.clientService.GetSceneProgress(context.TODO(), userID, sceneID)
-	if err != nil {
-		s.logger.Debug("Failed to get scene progress: ", err.Error())
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	return c.Status(http.StatusOK).JSON(report)
+}
+
+// repairScenes handles the request to repair a batch of scene documents. It is an admin protected route.
+//
+// It expects a JSON payload with the following format:
+//
+//	{
+//	    "scene_ids": ["scene_id", ...]
+//	}
+//
+// If query parameter `dry_run=true` is given, repairs are only reported. Scenes that fail to repair are
+// reported individually, and do not fail the request.
+func (s *WebServer) repairScenes(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Repair scenes request received")
+
+	var req RepairScenesRequest
+	if err := ValidateRequest(c, &req); err != nil {
+		s.logFor(c).Debug("Repair scenes request validation failed: ", err.Error())
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(http.StatusOK).JSON(progress)
+	sceneIDs := make([]primitive.ObjectID, 0, len(req.SceneIDs))
+	for _, id := range req.SceneIDs {
+		sceneID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			s.logFor(c).Debug("Invalid scene ID: ", err.Error())
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid scene ID"})
+		}
+		sceneIDs = append(sceneIDs, sceneID)
+	}
+
+	reports := s.clientService.RepairScenes(c.UserContext(), sceneIDs, req.DryRun)
+	return c.Status(http.StatusOK).JSON(fiber.Map{"reports": reports})
 }
 
-// getWorkerData handles the request to send data between workers. It is an internal route.
-// 
-// The path given is trusted and thus a vulnerability.
+// workerDataDir is the directory getWorkerData serves files from. Worker paths are relative to the working
+// directory (i.e "data/raw/videos/<id>.mp4"), like all paths stored by the server, and must resolve within it.
+const workerDataDir = "data"
+
+// getWorkerData handles the request to send data between workers. It is an internal route, requiring the worker
+// token or a signed URL (see workerAuthRequired).
+//
+// The path is resolved relative to the working directory, and only files within workerDataDir are served.
+// Paths escaping it (i.e with "..", or through a symlink) are rejected with 403.
 func (s *WebServer) getWorkerData(c *fiber.Ctx) error {
-	s.logger.Debug("Get worker data request received, path:", c.Params("*"))
+	s.logFor(c).Debug("Get worker data request received, path:", c.Params("*"))
 
-	fullPath := c.Params("*")
+	requested := c.Params("*")
 
-	if fullPath == "" {
-		s.logger.Debug("Invalid path parameter")
+	if requested == "" {
+		s.logFor(c).Debug("Invalid path parameter")
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid path parameter"})
 	}
 
-	basePath := "/app"
-	fullPath = filepath.Join(basePath, fullPath)
-
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		s.logger.Debug("File not found: ", fullPath)
+	fullPath, err := resolveWorkerDataPath(requested)
+	if errors.Is(err, os.ErrNotExist) {
+		s.logFor(c).Debug("File not found: ", requested)
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File Not Found"})
 	}
+	if errors.Is(err, errPathOutsideWorkerData) {
+		s.logFor(c).Warnf("Rejected worker data path outside %s: %s", workerDataDir, requested)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if err != nil {
+		return s.internalError(c, err)
+	}
+
+	return s.sendFileWithRangeSupport(c, fullPath)
+}
+
+// errPathOutsideWorkerData is returned by resolveWorkerDataPath for paths escaping workerDataDir.
+var errPathOutsideWorkerData = errors.New("path is outside the worker data directory")
+
+// resolveWorkerDataPath resolves a requested worker data path to an absolute path within workerDataDir, following
+// symlinks. Returns errPathOutsideWorkerData if it escapes the directory, or os.ErrNotExist if the file is missing.
+func resolveWorkerDataPath(requested string) (string, error) {
+	root, err := filepath.Abs(workerDataDir)
+	if err != nil {
+		return "", err
+	}
+	fullPath, err := filepath.Abs(filepath.Clean(requested))
+	if err != nil {
+		return "", err
+	}
+	if !withinDir(root, fullPath) {
+		return "", errPathOutsideWorkerData
+	}
+
+	// The cleaned path is within the directory, but a symlink in it could still point outside
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+	if fullPath, err = filepath.EvalSymlinks(fullPath); err != nil {
+		return "", err
+	}
+	if !withinDir(root, fullPath) {
+		return "", errPathOutsideWorkerData
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", os.ErrNotExist
+	}
+	return fullPath, nil
+}
 
-	return c.SendFile(fullPath)
+// withinDir reports whether the absolute, cleaned path is dir or inside it.
+func withinDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 // getRoutes handles the request to get the list of routes available on the server.
 func (s *WebServer) getRoutes(c *fiber.Ctx) error {
-	s.logger.Debug("Get routes request received")
+	s.logFor(c).Debug("Get routes request received")
 	routes := s.app.GetRoutes()
 	return c.Status(http.StatusOK).JSON(routes)
 }
 
-// healthCheck handles the request to check the health of the server.
+// getMetrics handles the request to get internal server metrics (e.g. cache hit/miss counters). It is a JWT protected
+// route restricted to admins, unless PublicMetrics is set.
+func (s *WebServer) getMetrics(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Get metrics request received")
+	return c.Status(http.StatusOK).JSON(s.clientService.GetMetrics())
+}
+
+// healthCheck handles the request to check the health of the server. It is a cheap liveness probe; see
+// readinessCheck for the state of the server's dependencies.
+// Responds with 503 if the data directory is not writable, as uploads cannot be accepted.
 func (s *WebServer) healthCheck(c *fiber.Ctx) error {
-	s.logger.Debug("Health check request received")
+	s.logFor(c).Debug("Health check request received")
+	if err := s.clientService.CheckStorage(); err != nil {
+		return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
 	return c.SendString("OK")
 }
 
+// readinessCheck handles the request to check whether the server can serve requests, i.e for a load balancer.
+// The database, the queues, the message broker and the data directory are checked.
+//
+// Responds with `{"ready": bool, "checks": {"<dependency>": "ok" | "<reason>"}}`, with 200 if all checks passed,
+// or 503 if any failed.
+func (s *WebServer) readinessCheck(c *fiber.Ctx) error {
+	s.logFor(c).Debug("Readiness check request received")
+
+	report := s.clientService.CheckReadiness(c.UserContext())
+	if !report.Ready {
+		return c.Status(http.StatusServiceUnavailable).JSON(report)
+	}
+	return c.Status(http.StatusOK).JSON(report)
+}
+
+// recordDownload records n downloaded bytes against the requesting user, for usage accounting.
+// Requests without an authenticated user are not recorded.
+func (s *WebServer) recordDownload(c *fiber.Ctx, n int64) {
+	s.downloadRecorder(c)(n)
+}
+
+// downloadRecorder returns a function recording downloaded bytes against the requesting user, like recordDownload.
+// It does not use the fiber context, so it can be called once a streamed response was sent, after the handler
+// returned.
+func (s *WebServer) downloadRecorder(c *fiber.Ctx) func(n int64) {
+	userIDStr, ok := c.Locals("userID").(string)
+	if !ok {
+		return func(int64) {}
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		return func(int64) {}
+	}
+	return func(n int64) {
+		s.clientService.RecordTransfer(s.requestsCtx, userID, 0, n)
+	}
+}
+
+// sendDownloadStream streams a response body of the given size (-1 if unknown) read from r, closing closer once it
+// has been sent. The download is recorded (see recordDownload) only if the whole body was read, so failed sends are
+// not counted.
+func (s *WebServer) sendDownloadStream(c *fiber.Ctx, r io.Reader, closer io.Closer, size int64) error {
+	return c.SendStream(&downloadStream{Reader: r, closer: closer, size: size, record: s.downloadRecorder(c)}, int(size))
+}
+
+// sendOutputFile sends a stored scene output. Uncompressed outputs are sent with range support. Compressed outputs
+// (see services.OutputCompression) are sent as stored with a Content-Encoding header if the client accepts their
+// compression and does not request a range, and are decompressed on the fly otherwise, without range support.
+func (s *WebServer) sendOutputFile(c *fiber.Ctx, filePath string) error {
+	algorithm := services.OutputCompression(filePath)
+	if algorithm == "" {
+		return s.sendFileWithRangeSupport(c, filePath)
+	}
+
+	c.Vary(fiber.HeaderAcceptEncoding)
+	c.Set("Accept-Ranges", "none")
+	c.Set(fiber.HeaderContentType, s.contentType(services.UncompressedName(filePath)))
+
+	if c.Get(fiber.HeaderRange) == "" && acceptsEncoding(c.Get(fiber.HeaderAcceptEncoding), algorithm) {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to open file"})
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get file info"})
+		}
+		c.Set(fiber.HeaderContentEncoding, algorithm)
+		c.Status(fiber.StatusOK)
+		return s.sendDownloadStream(c, file, file, stat.Size())
+	}
+
+	// The decompressed size is unknown, so the output is sent chunked
+	reader, err := services.OpenOutput(filePath)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to open file"})
+	}
+	c.Status(fiber.StatusOK)
+	return s.sendDownloadStream(c, reader, reader, -1)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header value accepts the given content encoding.
+func acceptsEncoding(header string, encoding string) bool {
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		if name != encoding && name != "*" {
+			continue
+		}
+		// An explicit q=0 rejects the encoding
+		q := strings.ReplaceAll(strings.TrimSpace(params), " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
 
 // sendFileWithRangeSupport sends a file with support for the Range header.
 // Call this function from any handler which you suspect needs to handle large files.
 //
-// This function trusts the Range header and does not perform any validation on the range values.
+// A single range (`bytes=<start>-<end>`, `bytes=<start>-` or the suffix `bytes=-<length>`) is sent as 206 Partial
+// Content with a Content-Range header, and an unsatisfiable one is answered with 416. Requests without a range, or
+// with a malformed or multi-part one, are sent the whole file with 200. The file is streamed, not buffered.
 func (s *WebServer) sendFileWithRangeSupport(c *fiber.Ctx, filePath string) error {
-    file, err := os.Open(filePath)
-    if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to open file"})
-    }
-    defer file.Close()
-
-    stat, err := file.Stat()
-    if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get file info"})
-    }
-
-    fileSize := stat.Size()
-    contentLength := fileSize
-    start := int64(0)
-    end := fileSize - 1
-
-    rangeHeader := c.Get("Range")
-    if rangeHeader != "" {
-        if strings.HasPrefix(rangeHeader, "bytes=") {
-            rangeHeader = rangeHeader[6:]
-            rangeParts := strings.Split(rangeHeader, "-")
-            if len(rangeParts) == 2 {
-                start, _ = strconv.ParseInt(rangeParts[0], 10, 64)
-                if rangeParts[1] != "" {
-                    end, _ = strconv.ParseInt(rangeParts[1], 10, 64)
-                }
-            }
-        }
-    }
-
-    if start >= fileSize || start > end || end >= fileSize {
-        return c.Status(fiber.StatusRequestedRangeNotSatisfiable).SendString("Invalid range")
-    }
-
-    contentLength = end - start + 1
-
-    c.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize))
-    c.Set("Accept-Ranges", "bytes")
-    c.Set("Content-Length", fmt.Sprintf("%d", contentLength))
-
-    // Set the appropriate status code
-    if rangeHeader != "" {
-        c.Status(fiber.StatusPartialContent)
-    } else {
-        c.Status(fiber.StatusOK)
-    }
-
-    // Set the Content-Type header based on the file extension
-    c.Type(filepath.Ext(filePath))
-
-    // Seek to the start position in the file
-    _, err = file.Seek(start, io.SeekStart)
-    if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to seek file"})
-    }
-
-    // Use io.CopyN to send only the requested range of bytes
-    _, err = io.CopyN(c, file, contentLength)
-    if err != nil && err != io.EOF {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to send file"})
-    }
-
-    return nil
-}
\ No newline at end of file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to open file"})
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get file info"})
+	}
+	fileSize := stat.Size()
+
+	c.Set("Accept-Ranges", "bytes")
+	// Set the Content-Type header based on the file extension
+	c.Set(fiber.HeaderContentType, s.contentType(filePath))
+
+	start, end, partial, satisfiable := parseByteRange(c.Get(fiber.HeaderRange), fileSize)
+	if !satisfiable {
+		file.Close()
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", fileSize))
+		return c.Status(fiber.StatusRequestedRangeNotSatisfiable).SendString("Invalid range")
+	}
+
+	contentLength := end - start
+	if partial {
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end-1, fileSize))
+		c.Status(fiber.StatusPartialContent)
+	} else {
+		c.Status(fiber.StatusOK)
+	}
+
+	// The stream is closed, closing the file, once it has been sent
+	return s.sendDownloadStream(c, io.NewSectionReader(file, start, contentLength), file, contentLength)
+}
+
+// parseByteRange parses a Range header for a file of the given size into the half-open byte range [start, end).
+//
+// partial is false if the whole file is to be sent: the header is empty, malformed, or asks for several ranges,
+// which may be ignored. satisfiable is false if the range lies beyond the end of the file.
+func parseByteRange(header string, size int64) (start, end int64, partial, satisfiable bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, true
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, false, true
+	}
+
+	if first == "" {
+		// A suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, size, false, true
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		return max(size-n, 0), size, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, size, false, true
+	}
+	end = size
+	if last != "" {
+		lastByte, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || lastByte < start {
+			return 0, size, false, true
+		}
+		end = min(lastByte+1, size)
+	}
+	if start >= size {
+		return 0, 0, true, false
+	}
+	return start, end, true, true
+}
+
+// downloadStream is a streamed response body, recording the download once it has been read in full. fasthttp reads
+// exactly size bytes of a stream of known size, and reads a stream of unknown size (-1) until EOF.
+type downloadStream struct {
+	io.Reader
+	closer   io.Closer
+	size     int64
+	read     int64
+	complete bool
+	record   func(n int64)
+}
+
+func (d *downloadStream) Read(p []byte) (int, error) {
+	n, err := d.Reader.Read(p)
+	d.read += int64(n)
+	if err == io.EOF || (d.size >= 0 && d.read >= d.size) {
+		d.complete = true
+	}
+	return n, err
+}
+
+// Close records the download if it was sent in full, and closes the underlying file or reader.
+func (d *downloadStream) Close() error {
+	if d.complete {
+		d.record(d.read)
+	}
+	return d.closer.Close()
+}
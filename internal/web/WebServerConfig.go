@@ -0,0 +1,152 @@
+// This file contains the WebServerConfig struct, which holds the tunable settings of the WebServer.
+// Values are expected to be populated by the caller (usually from environment variables in main), falling back
+// to DefaultWebServerConfig for anything not provided.
+
+package web
+
+import (
+	"crypto/rsa"
+	"time"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+)
+
+// WebServerConfig holds the tunable settings of the WebServer.
+type WebServerConfig struct {
+	// JWTAlgorithm is the algorithm JWT tokens are signed and verified with: JWTAlgorithmHS256 (using JWTSecret)
+	// or JWTAlgorithmRS256 (using JWTPublicKey and JWTPrivateKey).
+	JWTAlgorithm string
+	// JWTSecret is the key used to sign and verify HS256 JWT tokens.
+	JWTSecret string
+	// JWTPublicKey is the key used to verify RS256 JWT tokens. Required for RS256.
+	JWTPublicKey *rsa.PublicKey
+	// JWTPrivateKey is the key used to sign RS256 JWT tokens. Without it, tokens are only verified (i.e when they are
+	// issued by a central auth service), and the routes issuing tokens respond with 501.
+	JWTPrivateKey *rsa.PrivateKey
+	// TokenTTL is how long issued JWT tokens are valid for. It must be positive, as tokens that never expire stay valid
+	// forever once leaked.
+	TokenTTL time.Duration
+	// ShareLinkSecret is the key used to sign share links. If empty, share links cannot be created, and existing links
+	// are rejected.
+	ShareLinkSecret string
+	// ShareLinkMaxTTL is the longest validity a share link may be created with.
+	ShareLinkMaxTTL time.Duration
+	// WorkerToken is the shared secret workers send in the X-Worker-Token header to fetch worker data.
+	WorkerToken string
+	// WorkerURLSecret is the key signed worker data URLs are verified with (see services.WorkerURLSigner). A worker
+	// data request is served if it carries either the worker token or a valid signature. If both are empty, worker
+	// data is not served to anyone.
+	WorkerURLSecret string
+	// Upload holds the settings used to validate new scene uploads.
+	Upload UploadConfig
+	// MaxConcurrentUploads is the number of video uploads the server receives at once, across all users. Further
+	// uploads are rejected with 503 until one finishes. Zero disables the limit.
+	MaxConcurrentUploads int
+	// UploadRetryAfter is sent as the Retry-After header when an upload is rejected by MaxConcurrentUploads.
+	UploadRetryAfter time.Duration
+	// AuthRateLimit is the number of login and registration attempts allowed per client IP, and of login attempts
+	// per username, in each AuthRateLimitWindow. Further attempts are rejected with 429. Zero disables the limit.
+	AuthRateLimit int
+	// AuthRateLimitWindow is the window AuthRateLimit attempts are counted in.
+	AuthRateLimitWindow time.Duration
+	// AuthRateLimiter counts the attempts limited by AuthRateLimit. If nil, a MemoryRateLimiter is used; set it to
+	// share the limit between servers.
+	AuthRateLimiter RateLimiter
+	// BodyLimit is the largest request body accepted, in bytes. Larger requests are rejected with 413. It must leave
+	// room for Upload.MaxFileSize and the other form fields of an upload.
+	BodyLimit int
+	// DatabaseRetryAfter is sent as the Retry-After header when a request fails because the database is unavailable.
+	// Zero disables the header.
+	DatabaseRetryAfter time.Duration
+	// DisabledRoutes lists routes that are not registered, and thus respond with 404 (or 405 if other methods of the
+	// path are still enabled). Entries are either a route path as registered (i.e "/routes"), disabling all methods, or
+	// "<METHOD> <path>" (i.e "POST /user/account/register").
+	DisabledRoutes []string
+	// StrictRouting makes routes with and without a trailing slash distinct (i.e "/user/scene/history/" does not
+	// match "/user/scene/history"). Off by default.
+	StrictRouting bool
+	// CaseSensitiveRoutes makes routes differing in case distinct (i.e "/User/Scene/History" does not match
+	// "/user/scene/history"). Off by default. Path parameters keep their case either way.
+	CaseSensitiveRoutes bool
+	// PublicMetrics serves /metrics to anyone, i.e for a scraper on a private network. Off by default, in which case
+	// only admins may read the metrics, as they expose the server's internals.
+	PublicMetrics bool
+	// CORS holds the cross-origin settings browsers are sent.
+	CORS CORSConfig
+	// AccessLog holds the verbosity of the access log, per route.
+	AccessLog AccessLogConfig
+	// ContentTypes maps file extensions (i.e ".splat") to the content type files with the extension are served with,
+	// overriding the system's MIME table.
+	ContentTypes map[string]string
+	// SceneProgressInterval is how often scene progress streams poll the scene for changes.
+	SceneProgressInterval time.Duration
+	// ShutdownTimeout is how long in-flight requests are given to finish when the server shuts down, after which
+	// they are cut off. Zero waits indefinitely.
+	ShutdownTimeout time.Duration
+}
+
+// CORSConfig holds the cross-origin (CORS) settings of the WebServer.
+type CORSConfig struct {
+	// AllowOrigins lists the origins allowed to make cross-origin requests (i.e "https://app.example.com").
+	// If empty, all origins ("*") are allowed.
+	AllowOrigins []string
+	// AllowMethods lists the methods allowed in cross-origin requests. If empty, the common methods are allowed
+	// (GET, POST, HEAD, PUT, DELETE and PATCH).
+	AllowMethods []string
+	// AllowCredentials allows cross-origin requests with credentials (i.e cookies). It requires explicit
+	// AllowOrigins, as browsers refuse credentials for a wildcard origin.
+	AllowCredentials bool
+}
+
+// UploadConfig holds the settings used to validate new scene uploads.
+type UploadConfig struct {
+	// MinTotalIterations is the minimum accepted `total_iterations` per training mode.
+	// Training modes without an entry only have to satisfy the global bounds.
+	MinTotalIterations map[string]int
+	// MaxIterations is the maximum accepted `total_iterations` and `save_iterations` value.
+	MaxIterations int
+	// MaxFileSize is the largest accepted video file, in bytes. Larger uploads are rejected with 413.
+	MaxFileSize int64
+	// VideoFormats lists the accepted video containers ("mp4", "mov" and/or "avi"). Uploads are checked by both
+	// their extension and their content.
+	VideoFormats []string
+}
+
+// DefaultWebServerConfig returns the default WebServer configuration. The JWT secret has no default.
+func DefaultWebServerConfig() WebServerConfig {
+	return WebServerConfig{
+		JWTAlgorithm:          JWTAlgorithmHS256,
+		TokenTTL:              24 * time.Hour,
+		ShareLinkMaxTTL:       7 * 24 * time.Hour,
+		DatabaseRetryAfter:    5 * time.Second,
+		ShutdownTimeout:       30 * time.Second,
+		BodyLimit:             512 * 1024 * 1024,
+		UploadRetryAfter:      10 * time.Second,
+		AuthRateLimit:         10,
+		AuthRateLimitWindow:   time.Minute,
+		SceneProgressInterval: 2 * time.Second,
+		AccessLog: AccessLogConfig{
+			Level: AccessLogLevelInfo,
+			// Health checks and metrics scrapes arrive every few seconds, and would drown out everything else
+			RouteLevels: map[string]string{
+				"/health":       AccessLogLevelOff,
+				"/health/ready": AccessLogLevelOff,
+				"/metrics":      AccessLogLevelDebug,
+			},
+		},
+		ContentTypes: map[string]string{
+			".splat": "application/x-splat",
+			".ply":   "application/x-ply",
+			".ingp":  "application/x-ingp",
+		},
+		Upload: UploadConfig{
+			MinTotalIterations: map[string]int{
+				scene.TrainingModeGaussian: 1000,
+				scene.TrainingModeTensorf:  5000,
+			},
+			MaxIterations: 30000,
+			MaxFileSize:   500 * 1024 * 1024,
+			VideoFormats:  []string{VideoFormatMP4},
+		},
+	}
+}
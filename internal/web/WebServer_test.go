@@ -0,0 +1,127 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/NeRF-or-Nothing/go-web-server/internal/log"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/queue"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/scene"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/models/user"
+	"github.com/NeRF-or-Nothing/go-web-server/internal/services"
+)
+
+// newTestServer returns a WebServer with the given config and a logger discarding its entries, for testing
+// handlers and middlewares that do not reach the ClientService.
+func newTestServer(config WebServerConfig) *WebServer {
+	return &WebServer{
+		jwtSecret:   config.JWTSecret,
+		config:      config,
+		workerURLs:  services.NewWorkerURLSigner(config.WorkerURLSecret),
+		logger:      &log.Logger{SugaredLogger: zap.NewNop().Sugar()},
+		requestsCtx: context.Background(),
+	}
+}
+
+// newMockedServer returns a WebServer with the default config and its routes set up, whose ClientService uses the
+// mocked client with the given config. Tokens are revoked in memory, and there is no message broker.
+func newMockedServer(mt *mtest.T, serviceConfig services.ClientServiceConfig) *WebServer {
+	logger := &log.Logger{SugaredLogger: zap.NewNop().Sugar()}
+	tasks := services.NewTaskPool(services.TaskPoolConfig{}, logger)
+	mt.Cleanup(tasks.Close)
+
+	clientService := services.NewClientService(
+		nil,
+		scene.NewSceneManager(mt.Client, scene.DefaultSceneManagerConfig(), logger, true),
+		user.NewUserManager(mt.Client, &user.BcryptHasher{Cost: bcrypt.MinCost}, logger, true),
+		queue.NewQueueListManager(mt.Client, queue.QueueListManagerConfig{}, logger, true),
+		user.NewRefreshTokenManager(mt.Client, logger, true),
+		user.NewLoginFailureManager(mt.Client, logger, true),
+		user.NewNotificationManager(mt.Client, logger, true),
+		user.NewMemoryTokenRevoker(),
+		tasks,
+		services.NewChunkedUploadStore(mt.TempDir()),
+		serviceConfig,
+		logger,
+	)
+
+	config := DefaultWebServerConfig()
+	config.JWTSecret = "secret"
+	s, err := NewWebServer(config, clientService, logger)
+	if err != nil {
+		mt.Fatal(err)
+	}
+	s.SetupRoutes()
+	return s
+}
+
+// bearerToken returns a token of the user, signed by s, carrying token version 0.
+func bearerToken(mt *mtest.T, s *WebServer, userID primitive.ObjectID) string {
+	mt.Helper()
+	token, err := s.signToken(jwt.MapClaims{
+		"sub": userID.Hex(),
+		"ver": 0,
+		"jti": primitive.NewObjectID().Hex(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		mt.Fatal(err)
+	}
+	return token
+}
+
+// tokenVersionResponse returns a mocked response to the token version lookup of tokenRequired, for a user that never
+// revoked their tokens.
+func tokenVersionResponse(userID primitive.ObjectID) bson.D {
+	return mtest.CreateCursorResponse(0, "nerfdb.users", mtest.FirstBatch, bson.D{{Key: "_id", Value: userID}})
+}
+
+// request sends a request to s with the given bearer token (if not empty) and body (if not nil), returning the
+// response and its body.
+func request(t *testing.T, s *WebServer, method, target, token string, body io.Reader) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(content)
+}
+
+// inTempDir runs the test in a temporary directory, as the server reads and writes data/ in the working directory.
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
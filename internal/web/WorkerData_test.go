@@ -0,0 +1,155 @@
+package web
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// writeWorkerData creates data/raw/video.mp4 and secret.txt next to data/ in the working directory, and a symlink
+// data/raw/link.mp4 pointing to secret.txt.
+func writeWorkerData(t *testing.T) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join("data", "raw"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join("data", "raw", "video.mp4"), "secret.txt"} {
+		if err := os.WriteFile(path, []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join("..", "..", "secret.txt"), filepath.Join("data", "raw", "link.mp4")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveWorkerDataPath(t *testing.T) {
+	dir := inTempDir(t)
+	writeWorkerData(t)
+
+	tests := map[string]error{
+		"data/raw/video.mp4":             nil,
+		"data/../secret.txt":             errPathOutsideWorkerData,
+		"data/raw/../../../secret.txt":   errPathOutsideWorkerData,
+		"../secret.txt":                  errPathOutsideWorkerData,
+		filepath.Join(dir, "secret.txt"): errPathOutsideWorkerData,
+		"/etc/passwd":                    errPathOutsideWorkerData,
+		"data/raw/link.mp4":              errPathOutsideWorkerData,
+		"data/raw/missing.mp4":           os.ErrNotExist,
+		"data/raw":                       os.ErrNotExist,
+	}
+	for requested, want := range tests {
+		t.Run(requested, func(t *testing.T) {
+			if _, err := resolveWorkerDataPath(requested); !errors.Is(err, want) {
+				t.Errorf("resolveWorkerDataPath(%q) = %v, want %v", requested, err, want)
+			}
+		})
+	}
+}
+
+func TestGetWorkerDataRejectsPathsOutsideData(t *testing.T) {
+	inTempDir(t)
+	writeWorkerData(t)
+
+	s := newTestServer(WebServerConfig{})
+	app := fiber.New()
+	app.Get("/worker-data/*", s.getWorkerData)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"file in data", "/worker-data/data/raw/video.mp4", fiber.StatusOK},
+		{"dot dot", "/worker-data/data/../secret.txt", fiber.StatusForbidden},
+		{"dot dot out of data", "/worker-data/data/raw/../../../secret.txt", fiber.StatusForbidden},
+		// Paths are not unescaped, so encoded separators and dots name a file that does not exist
+		{"encoded dot dot", "/worker-data/data/..%2f..%2fsecret.txt", fiber.StatusNotFound},
+		{"encoded dot dot with encoded dots", "/worker-data/data/%2e%2e/secret.txt", fiber.StatusNotFound},
+		{"absolute path", "/worker-data//etc/passwd", fiber.StatusForbidden},
+		{"symlink out of data", "/worker-data/data/raw/link.mp4", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, tt.target, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Errorf("GET %s status = %d, want %d", tt.target, resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+// workerStatus returns the status workerAuthRequired responds to a request for path with, sending the given worker
+// token, or 200 if the request was allowed through.
+func workerStatus(t *testing.T, s *WebServer, path, token string) int {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/worker-data/*", s.workerAuthRequired(func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	}))
+
+	req := httptest.NewRequest(fiber.MethodGet, "/worker-data/"+path, nil)
+	if token != "" {
+		req.Header.Set(HeaderWorkerToken, token)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestWorkerAuthRequired(t *testing.T) {
+	s := newTestServer(WebServerConfig{WorkerToken: "worker-token"})
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"missing token", "", fiber.StatusUnauthorized},
+		{"wrong token", "not-the-token", fiber.StatusUnauthorized},
+		{"token prefix", "worker", fiber.StatusUnauthorized},
+		{"correct token", "worker-token", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := workerStatus(t, s, "data/raw/video.mp4", tt.token); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+
+	t.Run("no token configured", func(t *testing.T) {
+		unconfigured := newTestServer(WebServerConfig{})
+		for _, token := range []string{"", "worker-token"} {
+			if status := workerStatus(t, unconfigured, "data/raw/video.mp4", token); status != fiber.StatusUnauthorized {
+				t.Errorf("status with token %q = %d, want %d", token, status, fiber.StatusUnauthorized)
+			}
+		}
+	})
+}
+
+func TestWorkerAuthRequiredSignedURLs(t *testing.T) {
+	s := newTestServer(WebServerConfig{WorkerURLSecret: "secret"})
+	query := s.workerURLs.Sign("data/raw/a.mp4", time.Now().Add(time.Minute))
+
+	if status := workerStatus(t, s, "data/raw/a.mp4?"+query, ""); status != fiber.StatusOK {
+		t.Errorf("signed path status = %d, want %d", status, fiber.StatusOK)
+	}
+	if status := workerStatus(t, s, "data/raw/b.mp4?"+query, ""); status != fiber.StatusUnauthorized {
+		t.Errorf("signature replayed against another path status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+	expired := s.workerURLs.Sign("data/raw/a.mp4", time.Now().Add(-time.Second))
+	if status := workerStatus(t, s, "data/raw/a.mp4?"+expired, ""); status != fiber.StatusUnauthorized {
+		t.Errorf("expired signature status = %d, want %d", status, fiber.StatusUnauthorized)
+	}
+}